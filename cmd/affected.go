@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const ninjaDepsFileName = ".ninja_deps"
+
+// affectedBy restricts the selected targets to the targets affected by the changes since that git
+// revision if not empty.
+var affectedBy string
+
+// changedFiles returns the absolute paths of all files in the workspace repository that differ
+// between `ref` and the working tree, including untracked files.
+func changedFiles(workspaceRoot, ref string) ([]string, error) {
+	files := []string{}
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", ref, "--"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		gitCmd := exec.Command("git", args...)
+		gitCmd.Dir = workspaceRoot
+		var stderr bytes.Buffer
+		gitCmd.Stderr = &stderr
+		output, err := gitCmd.Output()
+		if err != nil {
+			return nil, log.Errorf("Failed to list the files changed since '%s': %s.\n%s", ref, err, stderr.String())
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if line != "" {
+				files = append(files, path.Join(workspaceRoot, line))
+			}
+		}
+	}
+	return files, nil
+}
+
+// moduleFile is a file as seen through a module that contains it.
+type moduleFile struct {
+	path    string
+	module  string
+	relPath string
+}
+
+// moduleFiles returns `file` as seen through each module that contains it, e.g. also through the
+// symlink of the workspace module in DEPS/.
+func moduleFiles(file string, modulePaths map[string]module.ModulePath) []moduleFile {
+	files := []moduleFile{}
+	for name, modulePath := range modulePaths {
+		realPath, err := filepath.EvalSymlinks(modulePath.Path)
+		if err != nil {
+			continue
+		}
+		for _, root := range []string{modulePath.Path, realPath} {
+			if relPath := strings.TrimPrefix(file, root+"/"); relPath != file {
+				files = append(files, moduleFile{path.Join(modulePath.Path, relPath), name, relPath})
+				break
+			}
+		}
+	}
+	return files
+}
+
+// selectAffectedTargets returns the `targets` that depend on files changed since the git revision
+// `ref`, either directly or through other actions, according to the ninja file of `genOutput` and
+// the dependencies that ninja discovered in previous builds in `outputDir`. Targets declared in
+// changed BUILD.go files are affected as well. If RULES packages or MODULE files changed, all
+// targets are affected.
+func selectAffectedTargets(targets []string, ref, outputDir string, genOutput generatorOutput) ([]string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	modulePaths, err := module.GetAllModulePaths(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	files, err := changedFiles(workspaceRoot, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := map[string]bool{}
+	queue := []string{}
+	seed := func(node string) {
+		if !affected[node] {
+			affected[node] = true
+			queue = append(queue, node)
+		}
+	}
+	for _, file := range files {
+		seed(file)
+		for _, alias := range moduleFiles(file, modulePaths) {
+			seed(alias.path)
+			switch {
+			case alias.relPath == util.ModuleFileName || strings.HasPrefix(alias.relPath, rulesDirName+"/"):
+				log.Warning("'%s' changed. All targets are affected.\n", file)
+				return targets, nil
+			case path.Base(alias.relPath) == buildFileName:
+				// All targets declared in a changed BUILD.go file are affected.
+				pkg := path.Join(alias.module, path.Dir(alias.relPath))
+				for name, target := range genOutput.Targets {
+					if path.Dir(name) == pkg {
+						seed(name)
+						for _, output := range target.Outputs {
+							seed(path.Clean(output))
+							seed(strings.TrimPrefix(path.Clean(output), outputDir+"/"))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Walk the dependency graph from the changed files to everything that depends on them.
+	dependents := ninjaDependents(genOutput.NinjaFile, outputDir)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[node] {
+			seed(path.Clean(dependent))
+		}
+	}
+
+	selected := []string{}
+	for _, name := range targets {
+		if affected[name] {
+			selected = append(selected, name)
+		}
+	}
+	log.Log("%d of %d targets are affected by the changes since '%s'.\n", len(selected), len(targets), ref)
+	return selected, nil
+}
+
+// ninjaDependents returns the outputs of the build statements that use each node as input
+// according to `ninjaFile` and the dependencies that ninja discovered in previous builds in
+// `outputDir`.
+func ninjaDependents(ninjaFile, outputDir string) map[string][]string {
+	dependents := map[string][]string{}
+	_, _, edges := parseNinjaEdges(ninjaFile)
+	for _, edge := range edges {
+		for _, dep := range edge.deps {
+			dependents[path.Clean(dep)] = append(dependents[path.Clean(dep)], edge.outputs...)
+		}
+	}
+	for output, deps := range discoveredNinjaDeps(outputDir) {
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], output)
+		}
+	}
+	return dependents
+}
+
+// discoveredNinjaDeps returns the dependencies (e.g., included headers) that ninja discovered from
+// depfiles in previous builds in `dir` by output.
+func discoveredNinjaDeps(dir string) map[string][]string {
+	deps := map[string][]string{}
+	if !util.FileExists(path.Join(dir, ninjaDepsFileName)) || !util.FileExists(path.Join(dir, ninjaFileName)) {
+		return deps
+	}
+	var stdout bytes.Buffer
+	if err := tryRunNinja(dir, &stdout, []string{"-t", "deps"}); err != nil {
+		log.Debug("Failed to read the ninja deps log: %s.\n", err)
+		return deps
+	}
+
+	// The output lists "<output>: #deps N, ..." followed by one indented line per dependency.
+	current := ""
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "    ") {
+			deps[current] = append(deps[current], path.Clean(strings.TrimSpace(line)))
+		} else if idx := strings.Index(line, ": #deps"); idx > 0 {
+			current = path.Clean(line[:idx])
+		}
+	}
+	return deps
+}
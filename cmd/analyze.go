@@ -8,9 +8,9 @@ var analyzeCmd = &cobra.Command{
 	Use:   "analyze [patterns] [build flags] [: test args]",
 	Short: "Builds the targets and generates static analysis reports.",
 	Long:  `Builds the targets and generates static analysis reports.`,
-	Run:   runAnalyze,
+	RunE:  runAnalyze,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return completeBuildArgs(toComplete, modeAnalyze), cobra.ShellCompDirectiveNoFileComp
+		return completeBuildArgs(toComplete, modeAnalyze)
 	},
 	DisableFlagsInUseLine: true,
 }
@@ -18,9 +18,11 @@ var analyzeCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(analyzeCmd)
 	analyzeCmd.Flags().SetInterspersed(false)
+	addSetFlag(analyzeCmd)
+	addUseLastGoodFlag(analyzeCmd)
 }
 
-func runAnalyze(cmd *cobra.Command, args []string) {
+func runAnalyze(cmd *cobra.Command, args []string) error {
 	testArgs := []string{}
 	buildArgs := args
 	for idx, arg := range args {
@@ -30,5 +32,9 @@ func runAnalyze(cmd *cobra.Command, args []string) {
 			break
 		}
 	}
-	runBuild(buildArgs, modeAnalyze, testArgs)
+	buildArgs, err := withSetFlags(buildArgs)
+	if err != nil {
+		return err
+	}
+	return runBuild(buildArgs, modeAnalyze, testArgs)
 }
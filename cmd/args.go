@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// setFlags holds the build flags passed with `--set name=value`.
+var setFlags []string
+
+// extraNinjaArgs holds the arguments after `--` that are passed through to ninja.
+var extraNinjaArgs []string
+
+// addSetFlag registers the `--set` flag on `cmd` and explains how build flags are passed
+// when an argument is mistaken for an unknown command line flag.
+func addSetFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&setFlags, "set", nil, "Set build flag (name=value), can be repeated")
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return fmt.Errorf("%s\nBuild flags are passed as 'name=value' or '--set name=value'", err)
+	})
+}
+
+// withSetFlags appends the build flags passed with `--set` to `args`. They come last, so that
+// they take precedence over build flags given as bare `name=value` arguments.
+func withSetFlags(args []string) ([]string, error) {
+	result := append([]string{}, args...)
+	for _, setFlag := range setFlags {
+		if !strings.Contains(setFlag, "=") || strings.HasPrefix(setFlag, "=") {
+			return nil, log.Errorf("Invalid build flag '--set %s'. Use '--set name=value'.\n", setFlag)
+		}
+		result = append(result, setFlag)
+	}
+	return result, nil
+}
+
+// splitNinjaArgs splits `args` into target patterns and build flags and arguments for ninja.
+// Arguments after `--` are passed to ninja unless they are build flags (i.e., `name=value`).
+func splitNinjaArgs(cmd *cobra.Command, args []string) ([]string, []string) {
+	dashIdx := cmd.ArgsLenAtDash()
+	if dashIdx < 0 {
+		return args, nil
+	}
+	buildArgs := append([]string{}, args[:dashIdx]...)
+	ninjaArgs := []string{}
+	for _, arg := range args[dashIdx:] {
+		if strings.Contains(arg, "=") && !strings.HasPrefix(arg, "-") {
+			buildArgs = append(buildArgs, arg)
+		} else {
+			ninjaArgs = append(ninjaArgs, arg)
+		}
+	}
+	return buildArgs, ninjaArgs
+}
+
+// extractFlagOverrides removes arguments of the form 'name=//pattern=value' from `args` and
+// returns them as flag overrides after the overrides from the MODULE file.
+func extractFlagOverrides(args []string, moduleOverrides []module.FlagOverride) ([]string, []flagOverride, error) {
+	overrides := []flagOverride{}
+	for _, override := range moduleOverrides {
+		pattern, err := normalizeTarget(override.Targets)
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides = append(overrides, flagOverride{Pattern: dbt.TargetPatternRegexp(pattern), Flags: override.Flags})
+	}
+
+	remaining := []string{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 3)
+		if len(parts) < 3 || strings.HasPrefix(arg, "//") || !strings.HasPrefix(parts[1], "//") {
+			remaining = append(remaining, arg)
+			continue
+		}
+		pattern, err := normalizeTarget(parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides = append(overrides, flagOverride{Pattern: dbt.TargetPatternRegexp(pattern), Flags: map[string]string{parts[0]: parts[2]}})
+	}
+
+	for _, override := range overrides {
+		if _, err := regexp.Compile(override.Pattern); err != nil {
+			return nil, nil, log.Errorf("Flag override for '%s' has an invalid target pattern: %s.\n", targetID(override.Pattern), err)
+		}
+	}
+	return remaining, overrides, nil
+}
+
+// checkFlagOverrides reports flag overrides that set unknown build flags or match no target and
+// warns if the generator can not apply flag overrides at all.
+func checkFlagOverrides(overrides []flagOverride, genOutput generatorOutput) {
+	if len(overrides) == 0 {
+		return
+	}
+	if genOutput.ProtocolVersion < 10 {
+		log.Warning("The generator does not support flag overrides. Update dbt-rules to apply them.\n")
+		return
+	}
+	for _, override := range overrides {
+		for _, name := range sortMapKeys(override.Flags) {
+			if _, known := genOutput.Flags[name]; !known {
+				log.Warning("Flag override for '%s' sets the unknown build flag '%s'. Run 'dbt flags' to list all build flags.\n", targetID(override.Pattern), name)
+			}
+		}
+		re := regexp.MustCompile(fmt.Sprintf("^%s$", override.Pattern))
+		matches := false
+		for name := range genOutput.Targets {
+			matches = matches || re.MatchString(name)
+		}
+		if !matches {
+			log.Warning("Flag override for '%s' matches no target.\n", targetID(override.Pattern))
+		}
+	}
+}
+
+// isLiteralTargetName returns whether `pattern` looks like the name of a single target rather than
+// a regular expression. Dots are common in target names, e.g. "lib/foo.o", so they do not count as
+// wildcards.
+func isLiteralTargetName(pattern string) bool {
+	withoutDots := strings.ReplaceAll(pattern, ".", "")
+	return regexp.QuoteMeta(withoutDots) == withoutDots
+}
+
+// checkArgs reports build flags that the generator does not know and target patterns that match
+// no target, since a typo in either silently changes what is built.
+func checkArgs(patterns []string, flags map[string]string, mode mode, allTargets map[string]target, allFlags map[string]flag) error {
+	for _, name := range sortMapKeys(flags) {
+		if _, known := allFlags[name]; known || name == platformFlagName {
+			continue
+		}
+		arg := fmt.Sprintf("%s=%s", name, flags[name])
+		targetName, err := normalizeTarget(name)
+		if err != nil {
+			return err
+		}
+		if _, isTarget := allTargets[targetName]; isTarget {
+			return log.Errorf("Argument '%s' is treated as a build flag, but '%s' is a target. Target names containing '=' must start with '//'.\n", arg, name)
+		}
+		log.Warning("Argument '%s' sets the unknown build flag '%s'. Run 'dbt flags' to list all build flags.\n", arg, name)
+	}
+
+	for _, pattern := range patterns {
+		selected, err := selectTargets([]string{pattern}, mode, allTargets)
+		if err != nil {
+			return err
+		}
+		if len(selected) > 0 {
+			continue
+		}
+		if _, isFlag := allFlags[pattern]; isFlag {
+			return log.Errorf("Argument '%s' matches no target, but '%s' is a build flag. Build flags are passed as 'name=value' or '--set name=value'.\n", pattern, pattern)
+		}
+		re := regexp.MustCompile(fmt.Sprintf("^%s$", pattern))
+		exists := false
+		for name := range allTargets {
+			if re.MatchString(name) {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			log.Warning("Target pattern '%s' matches no target.\n", targetID(pattern))
+			continue
+		}
+
+		if isLiteralTargetName(pattern) {
+			hints := []string{}
+			if suggestions := closestNames(pattern, sortMapKeys(allTargets), len(pattern)/4+1); len(suggestions) > 0 {
+				hints = append(hints, fmt.Sprintf("Did you mean '%s'?", strings.Join(targetIDs(suggestions), "', '")))
+			}
+			return util.Fail(util.UnknownTarget, hints, "Target '%s' does not exist.\n", targetID(pattern))
+		}
+		// Wildcards are matched against the directories of all targets instead.
+		prefix, _ := regexp.MustCompile(pattern).LiteralPrefix()
+		dirs := map[string]bool{}
+		for name := range allTargets {
+			parts := strings.Split(name, "/")
+			for idx := 1; idx < len(parts); idx++ {
+				dirs[strings.Join(parts[:idx], "/")+"/"] = true
+			}
+		}
+		hints := []string{}
+		if suggestions := closestNames(prefix, sortMapKeys(dirs), len(prefix)/2+1); len(suggestions) > 0 {
+			hints = append(hints, fmt.Sprintf("The nearest existing directories are '%s'.", strings.Join(targetIDs(suggestions), "', '")))
+		}
+		return util.Fail(util.UnknownTarget, hints, "Target pattern '%s' matches no target.\n", targetID(pattern))
+	}
+	return nil
+}
+
+// Maximum number of suggestions for misspelled targets.
+const maxSuggestions = 3
+
+// closestNames returns up to maxSuggestions of `names` with the smallest edit distance to `name`,
+// ignoring names with a distance above `maxDistance`.
+func closestNames(name string, names []string, maxDistance int) []string {
+	distances := map[string]int{}
+	candidates := []string{}
+	for _, candidate := range names {
+		if distance := editDistance(name, candidate); distance <= maxDistance {
+			distances[candidate] = distance
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return distances[candidates[i]] < distances[candidates[j]]
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	return candidates
+}
+
+// editDistance returns the Levenshtein distance between `a` and `b`.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -2,10 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
 	"io"
 	"os"
 	"os/exec"
@@ -15,10 +13,12 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/daedaleanai/dbt/config"
 	"github.com/daedaleanai/dbt/log"
 	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
 	"github.com/daedaleanai/dbt/util"
 
 	"github.com/daedaleanai/cobra"
@@ -28,97 +28,14 @@ const buildDirName = "BUILD"
 const buildFileName = "BUILD.go"
 const compileCommandsDbFileName = "compile_commands.json"
 const compileCommandsFileName = "compile_commands.sh"
+const coverageDirName = "coverage"
 const dbtRulesDirName = "dbt-rules"
 const defaultOutputDir = "OUTPUT"
 const dependencyGraphFileName = "graph.dot"
-const generatorDirName = "GENERATOR"
-const generatorInputFileName = "input.json"
-const generatorOutputFileName = "output.json"
-const initFileName = "init.go"
-const mainFileName = "main.go"
-const modFileName = "go.mod"
 const ninjaFileName = "build.ninja"
 const outputDirFlagName = "output-dir"
 const rulesDirName = "RULES"
 
-const goMajorVersion = 1
-const goMinorVersion = 16
-
-const initFileTemplate = `
-// This file is generated. Do not edit this file.
-
-package %s
-
-import "dbt-rules/RULES/core"
-
-type __internal_pkg struct{}
-
-func DbtMain(vars map[string]interface{}) {
-%s
-}
-
-func in(name string) core.Path {
-	return core.NewInPath(__internal_pkg{}, name)
-}
-
-func ins(names ...string) []core.Path {
-	var paths []core.Path
-	for _, name := range names {
-		paths = append(paths, in(name))
-	}
-	return paths
-}
-
-func out(name string) core.OutPath {
-	return core.NewOutPath(__internal_pkg{}, name)
-}
-
-func (ip __internal_pkg) SrcDir() string {
-	return "%s"
-}
-
-`
-const mainFileTemplate = `
-// This file is generated. Do not edit this file.
-
-package main
-
-import (
-	"regexp"
-	"runtime"
-	"strconv"
-
-	"dbt-rules/RULES/core"
-)
-
-%s
-
-func init() {
-	requiredMajor := uint64(%d)
-	requiredMinor := uint64(%d)
-
-	re := regexp.MustCompile("^go([[:digit:]]+)\\.([[:digit:]]+)(\\.[[:digit:]]+)?$")
-	matches := re.FindStringSubmatch(runtime.Version())
-	if matches == nil {
-		core.Fatal("Failed to determine go version")
-	}
-	currentMajor, _ := strconv.ParseUint(matches[1], 10, 64)
-	currentMinor, _ := strconv.ParseUint(matches[2], 10, 64)
-
-	if currentMajor < requiredMajor || (currentMajor == requiredMajor && currentMinor < requiredMinor) {
-		core.Fatal("DBT requires go version >= %%d.%%d. Found %%d.%%d", requiredMajor, requiredMinor, currentMajor, currentMinor)
-	}
-}
-
-func main() {
-    vars := map[string]interface{}{}
-
-%s
-
-    core.GeneratorMain(vars)
-}
-`
-
 type mode uint
 
 const (
@@ -127,62 +44,41 @@ const (
 	modeTest
 	modeCoverage
 	modeAnalyze
+	modeClean
+	// modeOutputs is only used to complete the arguments of 'dbt outputs'.
+	modeOutputs
 )
 
-type target struct {
-	Description string
-	Runnable    bool
-	Testable    bool
-	Report      bool
-}
-
-type flag struct {
-	Description   string
-	Type          string
-	AllowedValues []string
-	Value         string
-}
-
-type generatorInput struct {
-	DbtVersion           [3]uint
-	SourceDir            string
-	WorkingDir           string
-	OutputDir            string
-	CmdlineFlags         map[string]string
-	WorkspaceFlags       map[string]string
-	CompletionsOnly      bool
-	RunArgs              []string
-	TestArgs             []string
-	Layout               string
-	SelectedTargets      []string
-	BuildAnalyzerTargets bool
-	PersistFlags         bool
-
-	// These fields are used by dbt-rules < v1.10.0 and must be kept for backward compatibility
-	Version        uint
-	BuildDirPrefix string
-	BuildFlags     map[string]string
-}
-
-type generatorOutput struct {
-	NinjaFile   string
-	Targets     map[string]target
-	Flags       map[string]flag
-	CompDbRules []string
+// The generator protocol is defined by pkg/dbt, which runs the generator.
+type (
+	target          = dbt.Target
+	flag            = dbt.Flag
+	diagnostic      = dbt.Diagnostic
+	generatorInput  = dbt.GeneratorInput
+	generatorOutput = dbt.GeneratorOutput
+	flagOverride    = dbt.FlagOverride
+)
 
-	// This field is set by dbt-rules < v1.10.0 and must be kept for backward compatibility
-	BuildDir string
-}
+// boolFlagType is the type that the generator reports for bool flags.
+const boolFlagType = "bool"
 
 var buildCmd = &cobra.Command{
-	Use:   "build [patterns] [build flags] [--commands] [--compdb] [--graph]",
+	Use:   "build [patterns] [build flags] [--commands] [--compdb] [--graph] [--audit-ninja] [--generate-only] [--emit-ninja-only] [--check-golden=FILE] [--sbom=FORMAT] [--sign] [-- [build flags] [ninja args]]",
 	Short: "Builds the targets",
-	Long:  `Builds the targets.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		runBuild(args, modeBuild, nil)
+	Long: `Builds the targets.
+Build flags are passed as 'name=value' or '--set name=value'. Arguments after '--' that are
+not build flags are passed to ninja.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		buildArgs, ninjaArgs := splitNinjaArgs(cmd, args)
+		extraNinjaArgs = ninjaArgs
+		buildArgs, err := withSetFlags(buildArgs)
+		if err != nil {
+			return err
+		}
+		return runBuild(buildArgs, modeBuild, nil)
 	},
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return completeBuildArgs(toComplete, modeBuild), cobra.ShellCompDirectiveNoFileComp
+		return completeBuildArgs(toComplete, modeBuild)
 	},
 	DisableFlagsInUseLine: true,
 }
@@ -191,7 +87,9 @@ var (
 	commandList     bool
 	commandDb       bool
 	dependencyGraph bool
+	interactive     bool
 	numThreads      int
+	generateOnly    bool
 )
 
 func init() {
@@ -199,61 +97,91 @@ func init() {
 	buildCmd.Flags().BoolVar(&commandList, "commands", false, "Create compile commands list")
 	buildCmd.Flags().BoolVar(&commandDb, "compdb", false, "Create compile commands JSON database")
 	buildCmd.Flags().BoolVar(&dependencyGraph, "graph", false, "Create dependency graph")
+	buildCmd.Flags().BoolVar(&auditNinja, "audit-ninja", false, "Audit the generated ninja file for unescaped paths and variables")
+	buildCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Pick targets interactively if none are given")
+	buildCmd.Flags().StringVar(&affectedBy, "affected-by", "", "Only build the targets affected by the changes since the git revision")
+	buildCmd.Flags().BoolVar(&generateOnly, "generate-only", false, "Only build the generated sources of the targets")
+	buildCmd.Flags().BoolVar(&emitNinjaOnly, "emit-ninja-only", false, "Only write the ninja file without building anything")
+	buildCmd.Flags().StringVar(&ninjaGoldenFile, "check-golden", "", "Compare the generated ninja file with a golden file")
+	buildCmd.Flags().BoolVar(&updateGoldens, "update-goldens", false, "Rewrite the golden file of --check-golden instead of comparing against it")
+	buildCmd.Flags().BoolVar(&signOutputs, "sign", false, "Sign the outputs of signable targets after the build")
+	buildCmd.Flags().StringVar(&remoteDownload, "remote-download", remoteDownloadAll, "Download the outputs of cached actions: 'all' or 'minimal' (only those needed locally)")
+	buildCmd.Flags().StringVar(&sbomFormat, "sbom", "", "Write a software bill of materials in FORMAT ('spdx' or 'cyclonedx') to the output directory")
 	buildCmd.Flags().IntVarP(&numThreads, "threads", "j", -1, "Run N jobs in parallel")
+	buildCmd.Flags().IntVar(&progressFd, "progress-fd", -1, "Stream JSON progress events to file descriptor N")
+	buildCmd.Flags().StringVar(&progressSocket, "progress-socket", "", "Stream JSON progress events to a UNIX socket")
+	addSetFlag(buildCmd)
+	addUseLastGoodFlag(buildCmd)
+	addNoStampFlag(buildCmd)
 }
 
-func runBuild(args []string, mode mode, modeArgs []string) {
-	workspaceRoot := util.GetWorkspaceRoot()
-	dbtRulesDir := path.Join(workspaceRoot, util.DepsDirName, dbtRulesDirName)
-	if !util.DirExists(dbtRulesDir) {
-		log.Fatal("You are running 'dbt build' without '%s' being available. Add that dependency, run 'dbt sync' and try again.\n", dbtRulesDirName)
-		return
+func runBuild(args []string, mode mode, modeArgs []string) error {
+	// Builds for multiple platforms run this function once per platform and share the progress reporter.
+	if progress == nil {
+		var err error
+		if progress, err = openProgressReporter(); err != nil {
+			return err
+		}
+		defer progress.Close()
 	}
 
-	workspaceFlags := module.ReadModuleFile(workspaceRoot).Flags
-	patterns, cmdlineFlags := parseArgs(args)
-	_, legacyFlags := parseArgs(args)
+	if platforms, remainingArgs := splitPlatforms(args); len(platforms) > 0 {
+		return runMultiPlatformBuild(platforms, remainingArgs, mode, modeArgs)
+	}
 
-	outputDir := defaultOutputDir
-	if workspaceOutputDir, exists := workspaceFlags[outputDirFlagName]; exists {
-		outputDir = workspaceOutputDir
-		delete(workspaceFlags, outputDirFlagName)
+	if err := checkSBOMFormat(); err != nil {
+		return err
 	}
-	if cmdlineOutputDir, exists := cmdlineFlags[outputDirFlagName]; exists {
-		outputDir = cmdlineOutputDir
-		delete(cmdlineFlags, outputDirFlagName)
+	if err := checkRemoteDownload(); err != nil {
+		return err
 	}
-
-	if !strings.HasPrefix(outputDir, "/") {
-		outputDir = path.Join(workspaceRoot, buildDirName, outputDir)
+	if signOutputs {
+		if err := checkSigningConfig(); err != nil {
+			return err
+		}
 	}
-	log.Debug("Output directory: %s.\n", outputDir)
-	genInput := generatorInput{
-		DbtVersion:           util.DbtVersion,
-		OutputDir:            outputDir,
-		CmdlineFlags:         cmdlineFlags,
-		WorkspaceFlags:       workspaceFlags,
-		TestArgs:             []string{},
-		RunArgs:              []string{},
-		BuildAnalyzerTargets: false,
-		PersistFlags:         config.GetConfig().PersistFlags,
-
-		// Legacy fields
-		Version:        2,
-		BuildDirPrefix: outputDir,
-		BuildFlags:     legacyFlags,
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if affectedBy != "" && len(patterns) == 0 {
+		patterns = []string{".*"}
 	}
+	outputDir := genInput.OutputDir
+	cmdlineFlags := genInput.CmdlineFlags
 	switch mode {
 	case modeRun:
 		genInput.RunArgs = modeArgs
 	case modeTest:
 		genInput.TestArgs = modeArgs
+		genInput.UpdateGoldens = updateGoldens
 	case modeCoverage:
 		genInput.TestArgs = modeArgs
+		genInput.Coverage = true
+		genInput.CoverageDir = path.Join(outputDir, coverageDirName)
+		genInput.ListOutputs = true
 	case modeAnalyze:
 		genInput.BuildAnalyzerTargets = true
 	}
-	genOutput := runGenerator(genInput)
+	if auditNinja || sbomFormat != "" || signOutputs || remoteDownload == remoteDownloadMinimal {
+		genInput.ListOutputs = true
+	}
+	// Dependencies are needed to check the visibility of targets.
+	genInput.ListDependencies = true
+	if mode != modeClean {
+		if err := runHooks(hookStagePreBuild, genInput.OutputDir, nil); err != nil {
+			return err
+		}
+		if genInput.StampFile, err = writeStampFile(outputDir); err != nil {
+			return err
+		}
+	}
+	progress.Emit(progressEvent{Phase: phaseGenerate})
+	generatorStartTime := time.Now()
+	genOutput, err := generateOrNotify(genInput, generatorStartTime)
+	if err != nil {
+		return err
+	}
 
 	// dbt-rules < v1.10.0 will compute the build directory based on flag values and return
 	// the build directory to be used by DBT.
@@ -262,40 +190,84 @@ func runBuild(args []string, mode mode, modeArgs []string) {
 	}
 
 	// Determine the set of targets to be built.
-	log.Debug("Target patterns: '%s'.\n", strings.Join(patterns, "', '"))
-	regexps := []*regexp.Regexp{}
-	for _, pattern := range patterns {
-		re, err := regexp.Compile(fmt.Sprintf("^%s$", pattern))
-		if err != nil {
-			log.Fatal("Target pattern '%s' is not a valid regular expression: %s.\n", pattern, err)
+	if len(genOutput.Targets) == 0 {
+		return util.Fail(util.NoBuildFiles, nil, "The workspace does not declare any targets.\n")
+	}
+	if err := checkArgs(patterns, cmdlineFlags, mode, genOutput.Targets, genOutput.Flags); err != nil {
+		return err
+	}
+	checkFlagOverrides(genInput.FlagOverrides, genOutput)
+	targets, err := selectTargets(patterns, mode, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+	if affectedBy != "" {
+		if targets, err = selectAffectedTargets(targets, affectedBy, genInput.OutputDir, genOutput); err != nil || len(targets) == 0 {
+			return err
 		}
-		regexps = append(regexps, re)
 	}
-	targets := []string{}
-
-	for name, target := range genOutput.Targets {
-		if skipTarget(mode, target) {
-			continue
+	if err := checkVisibility(targets, genOutput); err != nil {
+		return err
+	}
+	if err := checkTools(targets, genOutput); err != nil {
+		return err
+	}
+	if mode == modeTest || mode == modeCoverage {
+		checkTestBackends(targets, genInput.TestBackends, genOutput)
+	}
+	if mode == modeTest && len(targets) > 0 {
+		if targets, err = skipQuarantinedTests(targets); err != nil {
+			return err
 		}
-
-		for _, re := range regexps {
-			if re.MatchString(name) {
-				targets = append(targets, name)
-				break
-			}
+		if len(targets) == 0 {
+			log.Log("All selected tests are quarantined. Use --include-quarantined to run them anyway.\n")
+			return nil
 		}
 	}
 
 	// Second pass with all targets
 	if mode == modeAnalyze || mode == modeCoverage {
 		genInput.SelectedTargets = targets
-		genOutput = runGenerator(genInput)
+		if genOutput, err = generateOrNotify(genInput, generatorStartTime); err != nil {
+			return err
+		}
+	}
+	generatorDuration := time.Since(generatorStartTime)
+
+	if auditNinja {
+		if err := auditNinjaFile(genInput.OutputDir, genOutput); err != nil {
+			return err
+		}
 	}
 
 	// Write the Ninja build file.
-	ninjaFilePath := path.Join(genInput.OutputDir, ninjaFileName)
-	log.Debug("Ninja file: %s.\n", ninjaFilePath)
-	util.WriteFile(ninjaFilePath, []byte(genOutput.NinjaFile))
+	if err := writeNinjaFile(genInput.OutputDir, genOutput); err != nil {
+		return err
+	}
+	if err := markOutputDirUsed(genInput.OutputDir); err != nil {
+		return err
+	}
+	if ninjaGoldenFile != "" {
+		if err := checkNinjaGolden(ninjaGoldenFile, genInput.OutputDir, genOutput); err != nil {
+			return err
+		}
+	}
+	if emitNinjaOnly {
+		log.Success("Wrote '%s'.\n", path.Join(genInput.OutputDir, ninjaFileName))
+		return nil
+	}
+
+	if selectedTier != "" && len(targets) == 0 {
+		log.Log("No targets of tier '%s' match.\n", selectedTier)
+		return nil
+	}
+
+	// Let the user pick targets interactively if there is nothing to build.
+	if !commandList && !commandDb && !dependencyGraph && len(targets) == 0 && (interactive || config.GetConfig().Interactive) && isInteractiveTerminal() {
+		if picked := pickTargets(mode, genOutput); len(picked) > 0 {
+			return runBuild(append(args, picked...), mode, modeArgs)
+		}
+	}
 
 	// Print all available targets and flags if there is nothing to build.
 	if !commandList && !commandDb && !dependencyGraph && len(targets) == 0 {
@@ -311,10 +283,16 @@ func runBuild(args []string, mode mode, modeArgs []string) {
 			if skipTarget(mode, target) {
 				continue
 			}
-			fmt.Printf("  //%s", name)
+			fmt.Printf("  %s", targetID(name))
 			if target.Description != "" {
 				fmt.Printf("  (%s)", target.Description)
 			}
+			if target.Tier != "" {
+				fmt.Printf("  [%s]", target.Tier)
+			}
+			if len(target.Alias) > 0 {
+				fmt.Printf("  -> %s", strings.Join(targetIDs(target.Alias), ", "))
+			}
 			fmt.Println()
 		}
 
@@ -344,17 +322,12 @@ func runBuild(args []string, mode mode, modeArgs []string) {
 			}
 			fmt.Println()
 		}
-		return
+		return nil
 	}
 
 	if len(targets) > 0 {
-		ninjaArgs := []string{}
-		if log.Verbose {
-			ninjaArgs = []string{"-v", "-d", "explain"}
-		}
-		if numThreads >= 0 {
-			ninjaArgs = append(ninjaArgs, fmt.Sprintf("-j%d", numThreads))
-		}
+		ninjaArgs := ninjaOptionArgs()
+		numOptionArgs := len(ninjaArgs)
 
 		suffix := ""
 		switch mode {
@@ -362,78 +335,513 @@ func runBuild(args []string, mode mode, modeArgs []string) {
 			suffix = "#run"
 		case modeTest:
 			suffix = "#test"
+		case modeClean:
+			suffix = "#clean"
 		}
 
-		for _, target := range targets {
-			ninjaArgs = append(ninjaArgs, target+suffix)
+		if generateOnly {
+			sources := generatedSources(targets, genOutput.Targets)
+			if len(sources) == 0 {
+				log.Log("The targets have no generated sources.\n")
+				return nil
+			}
+			ninjaArgs = append(ninjaArgs, sources...)
+		} else {
+			for _, target := range targets {
+				ninjaArgs = append(ninjaArgs, target+suffix)
+			}
+		}
+		// Multi-platform builds build the targets of all platforms with a single ninja invocation.
+		if pendingPlatforms != nil {
+			pendingPlatforms.add(targets, ninjaArgs[numOptionArgs:])
+			return nil
+		}
+		// Targets that are run on an interactive terminal may need the terminal themselves, so ninja's
+		// output is neither shown in a progress bar nor captured then.
+		console := mode == modeRun && progress == nil && isTerminal(os.Stdout)
+		stdout, bar := ninjaStdout(console)
+		progress.Emit(progressEvent{Phase: phaseBuild, Targets: targetIDs(targets)})
+
+		var ninjaOutput bytes.Buffer
+		if !console {
+			stdout = io.MultiWriter(stdout, &ninjaOutput)
+		}
+		logOffset := ninjaLogSize(genInput.OutputDir)
+
+		// File states are determined before running ninja, so that files changed during the build
+		// are considered changed by the next build.
+		var fileStates map[string]fileState
+		if config.GetConfig().ContentHashes {
+			if fileStates, err = restoreModTimes(); err != nil {
+				return err
+			}
+		}
+
+		var goldens map[string][]byte
+		if mode == modeTest && updateGoldens {
+			if goldens, err = snapshotGoldens(targets, genOutput.Targets); err != nil {
+				return err
+			}
+		}
+
+		workingDir, err := util.GetWorkingDir()
+		if err != nil {
+			return err
+		}
+		credentialsPath, err := writeRemoteCacheCredentials(genInput.OutputDir)
+		if err != nil {
+			return err
+		}
+		startTime := time.Now()
+		ninjaErr := tryRunNinja(genInput.OutputDir, stdout, ninjaArgs)
+		bar.Finish()
+		if credentialsPath != "" {
+			os.Remove(credentialsPath)
+		}
+		if fileStates != nil {
+			if err := recordFileStates(fileStates); err != nil {
+				return err
+			}
+		}
+		if goldens != nil {
+			if err := reportGoldenChanges(goldens); err != nil {
+				return err
+			}
+		}
+		interrupted := ninjaErr == errInterrupted
+		progress.Emit(progressEvent{Phase: phaseDone, Targets: targetIDs(targets), Success: ninjaErr == nil, Interrupted: interrupted})
+		actions, err := recordActions(genInput.OutputDir, logOffset, ninjaOutput.String())
+		if err != nil {
+			return err
+		}
+		if err := recordCacheStats(genInput.OutputDir, actions); err != nil {
+			return err
+		}
+		if mode == modeTest {
+			if err := recordTestResults(targets, actions); err != nil {
+				return err
+			}
+		}
+		reportRemoteCacheHits(genInput.OutputDir)
+		failedActions := 0
+		for _, action := range actions {
+			if action.Failed {
+				failedActions++
+			}
+		}
+		event := buildEvent{
+			Time:              startTime,
+			WorkingDir:        workingDir,
+			OutputDir:         genInput.OutputDir,
+			Args:              os.Args[1:],
+			Flags:             cmdlineFlags,
+			Targets:           targetIDs(targets),
+			Duration:          time.Since(startTime),
+			Success:           ninjaErr == nil,
+			Interrupted:       interrupted,
+			GeneratorDuration: generatorDuration,
+			Actions:           len(actions),
+			FailedActions:     failedActions,
+		}
+		if err := recordBuildEvent(event); err != nil {
+			return err
+		}
+		notifyBuildResult(event)
+		if interrupted {
+			return log.ErrorfWithCode(log.ExitInterrupted, nil, "The build was interrupted.\n")
+		}
+		if ninjaErr != nil {
+			return log.ErrorfWithCode(log.ExitNinja, nil, "Running ninja failed: %s\n", ninjaErr)
+		}
+		// The outputs of the targets are the artifacts of the build and always downloaded.
+		if remoteDownload == remoteDownloadMinimal && mode != modeClean {
+			if err := materializeTargetOutputs(genInput.OutputDir, targets, genOutput.Targets); err != nil {
+				return err
+			}
+		}
+		if updateWarnings {
+			if err := updateWarningsBaseline(genInput.OutputDir, targets); err != nil {
+				return err
+			}
+		} else if !console {
+			if err := checkWarnings(ninjaOutput.String(), targets); err != nil {
+				return err
+			}
+		}
+		if mode != modeClean {
+			if err := updateOutputDirLinks(genInput.OutputDir, genInput.ConfigName); err != nil {
+				return err
+			}
+		}
+
+		if config.GetConfig().Permissions.Normalize {
+			normalizeBuildPermissions(genInput.OutputDir)
+		}
+
+		if mode == modeCoverage {
+			if err := printCoverageReports(targets, genOutput.Targets, genInput.OutputDir); err != nil {
+				return err
+			}
+		}
+		if signOutputs && mode != modeClean {
+			if err := signTargetOutputs(genInput.OutputDir, targets, genOutput); err != nil {
+				return err
+			}
+		}
+		if sbomFormat != "" && mode != modeClean {
+			if err := writeSBOM(genInput.OutputDir, targets, genOutput); err != nil {
+				return err
+			}
+		}
+		if mode != modeClean {
+			if err := runHooks(hookStagePostBuild, genInput.OutputDir, targets); err != nil {
+				return err
+			}
 		}
-		runNinja(genInput.OutputDir, os.Stdout, ninjaArgs)
 	}
 
 	if commandList {
 		args := append([]string{"-t", "commands"}, targets...)
-		printNinjaOutput(genInput.OutputDir, compileCommandsFileName, "Compile commands", args)
+		if err := printNinjaOutput(genInput.OutputDir, compileCommandsFileName, "Compile commands", args, unwrapCommandList); err != nil {
+			return err
+		}
 	}
 	if commandDb {
-		printNinjaOutput(genInput.OutputDir,
+		err := printNinjaOutput(genInput.OutputDir,
 			compileCommandsDbFileName,
 			"Compile commands database",
-			append([]string{"-t", "compdb"}, genOutput.CompDbRules...))
+			append([]string{"-t", "compdb"}, genOutput.CompDbRules...),
+			unwrapCompDb)
+		if err != nil {
+			return err
+		}
 	}
 	if dependencyGraph {
 		args := append([]string{"-t", "graph"}, targets...)
-		printNinjaOutput(genInput.OutputDir, dependencyGraphFileName, "Dependency graph", args)
+		if err := printNinjaOutput(genInput.OutputDir, dependencyGraphFileName, "Dependency graph", args, nil); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func runNinja(dir string, stdout io.Writer, args []string) {
-	log.Debug("Running ninja command: 'ninja %s'\n", strings.Join(args, " "))
-	ninjaCmd := exec.Command("ninja", args...)
+// newGeneratorInput splits `args` into target patterns and build flags and returns the patterns
+// together with the generator input for a regular build.
+func newGeneratorInput(args []string) ([]string, generatorInput, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, generatorInput{}, err
+	}
+	dbtRulesDir := path.Join(workspaceRoot, util.DepsDirName, dbtRulesDirName)
+	if !module.IsQuickstartWorkspace(workspaceRoot) && !util.DirExists(dbtRulesDir) {
+		return nil, generatorInput{}, util.Fail(util.DepsNotSynced, nil, "You are running 'dbt build' without '%s' being available.\n", dbtRulesDirName)
+	}
+
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return nil, generatorInput{}, err
+	}
+	for _, name := range sortMapKeys(moduleFile.Dependencies) {
+		if !util.DirExists(path.Join(workspaceRoot, util.DepsDirName, name)) {
+			return nil, generatorInput{}, util.Fail(util.DepsNotSynced, nil, "Dependency '%s' is not checked out.\n", name)
+		}
+	}
+	// Default flags of the DBT configuration take precedence over the flags of the MODULE file.
+	workspaceFlags := map[string]string{}
+	for name, value := range moduleFile.Flags {
+		workspaceFlags[name] = value
+	}
+	for name, value := range config.GetConfig().Flags {
+		workspaceFlags[name] = value
+	}
+	args, flagOverrides, err := extractFlagOverrides(args, moduleFile.FlagOverrides)
+	if err != nil {
+		return nil, generatorInput{}, err
+	}
+	patterns, cmdlineFlags, err := parseArgs(args, moduleFile.Configs)
+	if err != nil {
+		return nil, generatorInput{}, err
+	}
+	_, legacyFlags, _ := parseArgs(args, moduleFile.Configs)
+
+	outputDir := defaultOutputDir
+	if workspaceOutputDir, exists := workspaceFlags[outputDirFlagName]; exists {
+		outputDir = workspaceOutputDir
+		delete(workspaceFlags, outputDirFlagName)
+	}
+
+	// Flags of the selected build config apply unless they are set on the command-line.
+	configName, hasConfig := cmdlineFlags[configFlagName]
+	if hasConfig {
+		delete(cmdlineFlags, configFlagName)
+		delete(legacyFlags, configFlagName)
+		configFlags, err := resolveBuildConfig(moduleFile.Configs, configName)
+		if err != nil {
+			return nil, generatorInput{}, err
+		}
+		for name, value := range configFlags {
+			if _, exists := cmdlineFlags[name]; !exists {
+				cmdlineFlags[name] = value
+				legacyFlags[name] = value
+			}
+		}
+		outputDir = buildConfigOutputDir(configName, configFlags)
+	}
+	if cmdlineOutputDir, exists := cmdlineFlags[outputDirFlagName]; exists {
+		outputDir = cmdlineOutputDir
+		delete(cmdlineFlags, outputDirFlagName)
+	}
+
+	if !strings.HasPrefix(outputDir, "/") {
+		outputDir = path.Join(workspaceRoot, buildDirName, outputDir)
+	}
+	testBackends, err := resolveTestBackends(moduleFile.TestBackends)
+	if err != nil {
+		return nil, generatorInput{}, err
+	}
+	log.Debug("Output directory: %s.\n", outputDir)
+	return patterns, generatorInput{
+		DbtVersion:           util.DbtVersion,
+		OutputDir:            outputDir,
+		CmdlineFlags:         cmdlineFlags,
+		WorkspaceFlags:       workspaceFlags,
+		TestArgs:             []string{},
+		RunArgs:              []string{},
+		BuildAnalyzerTargets: false,
+		PersistFlags:         config.GetConfig().PersistFlags,
+		FlagOverrides:        flagOverrides,
+		TestBackends:         testBackends,
+		HostArch:             hostArch(),
+		ConfigName:           configName,
+
+		// Legacy fields
+		Version:        2,
+		BuildDirPrefix: outputDir,
+		BuildFlags:     legacyFlags,
+	}, nil
+}
+
+// selectTargets returns the names of all targets relevant for `mode` that match any of the `patterns`.
+// Matching alias targets are replaced by the targets they stand for.
+func selectTargets(patterns []string, mode mode, allTargets map[string]target) ([]string, error) {
+	log.Debug("Target patterns: '%s'.\n", strings.Join(patterns, "', '"))
+	regexps := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(fmt.Sprintf("^%s$", pattern))
+		if err != nil {
+			return nil, log.Errorf("Target pattern '%s' is not a valid regular expression: %s.\n", pattern, err)
+		}
+		regexps = append(regexps, re)
+	}
+	selected := map[string]bool{}
+	for name, target := range allTargets {
+		matches := false
+		for _, re := range regexps {
+			if re.MatchString(name) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		names := []string{name}
+		if len(target.Alias) > 0 {
+			var err error
+			if names, err = dbt.ExpandAlias(name, allTargets); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range names {
+			target := allTargets[name]
+			if !skipTarget(mode, target) && (selectedTier == "" || target.Tier == selectedTier) {
+				selected[name] = true
+			}
+		}
+	}
+	return sortMapKeys(selected), nil
+}
+
+func runNinja(dir string, stdout io.Writer, args []string) error {
+	err := tryRunNinja(dir, stdout, args)
+	if err == errInterrupted {
+		return log.ErrorfWithCode(log.ExitInterrupted, nil, "Ninja was interrupted.\n")
+	}
+	if err != nil {
+		return log.ErrorfWithCode(log.ExitNinja, nil, "Running ninja failed: %s\n", err)
+	}
+	return nil
+}
+
+// generateOrNotify is generateOrReuse, but also records the failed build in the build history and
+// sends a notification about it if the generator fails.
+func generateOrNotify(input generatorInput, startTime time.Time) (generatorOutput, error) {
+	output, err := generateOrReuse(input)
+	if err == nil {
+		return output, nil
+	}
+	event := buildEvent{
+		Time:              startTime,
+		OutputDir:         input.OutputDir,
+		Args:              os.Args[1:],
+		Flags:             input.CmdlineFlags,
+		Interrupted:       log.ExitCode(err) == log.ExitInterrupted,
+		GeneratorDuration: time.Since(startTime),
+		GeneratorFailed:   true,
+	}
+	if workingDir, err := util.GetWorkingDir(); err == nil {
+		event.WorkingDir = workingDir
+	}
+	if err := recordBuildEvent(event); err != nil {
+		log.Warning("Failed to record the build in the build history: %s.\n", err)
+	}
+	notifyBuildResult(event)
+	return output, err
+}
+
+// ninjaOptionArgs returns the command-line options of ninja for a build.
+func ninjaOptionArgs() []string {
+	args := []string{}
+	if log.Verbose {
+		args = []string{"-v", "-d", "explain"}
+	}
+	if numThreads >= 0 {
+		args = append(args, fmt.Sprintf("-j%d", numThreads))
+	} else if jobs := config.GetConfig().Jobs; jobs > 0 {
+		args = append(args, fmt.Sprintf("-j%d", jobs))
+	}
+	return append(args, extraNinjaArgs...)
+}
+
+// ninjaStdout returns the writer for the output of ninja during a build and the progress bar it
+// is shown in, if any. Interactive terminals get a progress bar, CI logs and verbose builds get
+// ninja's output as is. Builds that run in the `console` never get a progress bar.
+func ninjaStdout(console bool) (io.Writer, *progressBar) {
+	var stdout io.Writer = os.Stdout
+	var bar *progressBar
+	if !log.Verbose && isTerminal(os.Stdout) && !console {
+		bar = newProgressBar(os.Stdout)
+		stdout = bar
+	}
+	if progress != nil || bar != nil {
+		os.Setenv("NINJA_STATUS", ninjaStatusFormat)
+	}
+	if progress != nil {
+		stdout = &ninjaProgressWriter{out: stdout, reporter: progress}
+	}
+	return stdout, bar
+}
+
+func tryRunNinja(dir string, stdout io.Writer, args []string) error {
+	bin, err := getNinjaBin()
+	if err != nil {
+		return err
+	}
+	log.Debug("Running ninja command: '%s %s'\n", bin, strings.Join(args, " "))
+	ninjaCmd := exec.Command(bin, args...)
 	ninjaCmd.Dir = dir
+	if ninjaCmd.Env, err = ninjaEnvironment(dir); err != nil {
+		return err
+	}
 	ninjaCmd.Stderr = os.Stderr
 	ninjaCmd.Stdout = stdout
-	err := ninjaCmd.Run()
-	if err != nil {
-		log.Fatal("Running ninja failed: %s\n", err)
-	}
+	// Ninja terminates the actions it runs when it is interrupted.
+	return runInterruptible(ninjaCmd, false)
 }
 
-func printNinjaOutput(dir, fileName, label string, args []string) {
+func printNinjaOutput(dir, fileName, label string, args []string, transform func([]byte) ([]byte, error)) error {
 	var stdout bytes.Buffer
-	runNinja(dir, &stdout, args)
+	if err := runNinja(dir, &stdout, args); err != nil {
+		return err
+	}
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
 	absPath := path.Join(dir, fileName)
-	relPath, _ := filepath.Rel(util.GetWorkingDir(), absPath)
-	util.WriteFile(absPath, stdout.Bytes())
+	relPath, _ := filepath.Rel(workingDir, absPath)
+	output := stdout.Bytes()
+	if transform != nil {
+		if output, err = transform(output); err != nil {
+			return err
+		}
+	}
+	if err := util.WriteFile(absPath, output); err != nil {
+		return err
+	}
 	log.Log("\n%s: %s\n", label, relPath)
+	return nil
+}
+
+// unwrapCommandList removes the remote cache wrappers from the commands listed by 'ninja -t commands'.
+func unwrapCommandList(commands []byte) ([]byte, error) {
+	lines := strings.Split(string(commands), "\n")
+	for idx, line := range lines {
+		lines[idx] = unwrapCommand(line)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
 
+// unwrapCompDb removes the remote cache wrappers from the commands of the compile commands
+// database written by 'ninja -t compdb', so that tools reading it see the original commands.
+func unwrapCompDb(compDb []byte) ([]byte, error) {
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(compDb, &entries); err != nil {
+		return nil, log.Errorf("Failed to parse the compile commands database: %s.\n", err)
+	}
+	for _, entry := range entries {
+		if command, ok := entry["command"].(string); ok {
+			entry["command"] = unwrapCommand(command)
+		}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, log.Errorf("Failed to serialize the compile commands database: %s.\n", err)
+	}
+	return append(data, '\n'), nil
 }
 
-func completeBuildArgs(toComplete string, mode mode) []string {
-	genOutput := runGenerator(generatorInput{
+// completeBuildArgs completes target names, build flags and build configs for `mode`.
+func completeBuildArgs(toComplete string, mode mode) ([]string, cobra.ShellCompDirective) {
+	if strings.HasPrefix(toComplete, "@") {
+		moduleFile, err := readWorkspaceModuleFile()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		suggestions := []string{}
+		for _, name := range sortMapKeys(moduleFile.Configs) {
+			suggestions = append(suggestions, "@"+name)
+		}
+		return suggestions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	if strings.Contains(toComplete, "=") {
+		return completeFlagValues(toComplete)
+	}
+
+	genOutput, err := runGenerator(generatorInput{
 		DbtVersion:      util.DbtVersion,
 		CompletionsOnly: true,
 
 		// Legacy field expected by dbt-rules < v1.10.0.
 		Version: 2,
 	})
-
-	if strings.Contains(toComplete, "=") {
-		suggestions := []string{}
-		flag := strings.SplitN(toComplete, "=", 2)[0]
-		for _, value := range genOutput.Flags[flag].AllowedValues {
-			suggestions = append(suggestions, fmt.Sprintf("%s=%s", flag, value))
-		}
-		return suggestions
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
 	}
 
 	suggestions := []string{}
-	targetToComplete := normalizeTarget(toComplete)
+	targetToComplete, err := normalizeTarget(toComplete)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
 	for name, target := range genOutput.Targets {
 		if skipTarget(mode, target) {
 			continue
 		}
 		if strings.Contains(name, toComplete) {
-			suggestions = append(suggestions, fmt.Sprintf("//%s\t%s", name, target.Description))
+			suggestions = append(suggestions, fmt.Sprintf("%s\t%s", targetID(name), target.Description))
 		} else if strings.HasPrefix(name, targetToComplete) {
 			suggestions = append(suggestions, fmt.Sprintf("%s%s\t%s", toComplete, strings.TrimPrefix(name, targetToComplete), target.Description))
 		}
@@ -443,226 +851,232 @@ func completeBuildArgs(toComplete string, mode mode) []string {
 		suggestions = append(suggestions, fmt.Sprintf("%s=\t%s", name, flag.Description))
 	}
 
-	return suggestions
+	return suggestions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFlagValues completes `toComplete` of the form 'flag=prefix' with the legal values of the
+// build flag: its allowed values or, for bool flags without allowed values, 'true' and 'false'.
+func completeFlagValues(toComplete string) ([]string, cobra.ShellCompDirective) {
+	genOutput, err := runGenerator(generatorInput{
+		DbtVersion:      util.DbtVersion,
+		CompletionsOnly: true,
+		FlagsOnly:       true,
+
+		// Legacy field expected by dbt-rules < v1.10.0.
+		Version: 2,
+	})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	parts := strings.SplitN(toComplete, "=", 2)
+	name, prefix := parts[0], parts[1]
+	flag, exists := genOutput.Flags[name]
+	if !exists {
+		return []string{}, cobra.ShellCompDirectiveNoFileComp
+	}
+	values := flag.AllowedValues
+	if len(values) == 0 && flag.Type == boolFlagType {
+		values = []string{"true", "false"}
+	}
+
+	suggestions := []string{}
+	for _, value := range values {
+		if !strings.HasPrefix(value, prefix) {
+			continue
+		}
+		suggestion := fmt.Sprintf("%s=%s", name, value)
+		if value == flag.Default {
+			suggestion += "\tdefault"
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp
 }
 
-func parseArgs(args []string) ([]string, map[string]string) {
+// parseArgs splits `args` into target patterns and build flags. Arguments of the form '@NAME'
+// expand to the flags of the build config NAME. Flags given explicitly take precedence over them,
+// so that a preset and its expanded form result in the same flags.
+func parseArgs(args []string, configs map[string]module.BuildConfig) ([]string, map[string]string, error) {
 	patterns := []string{}
 	flags := map[string]string{}
+	presetFlags := map[string]string{}
 
 	// Split all args into two categories: If they contain a "= they are considered
 	// build flags, otherwise a target pattern to be built.
 	for _, arg := range args {
-		if strings.Contains(arg, "=") {
+		if strings.HasPrefix(arg, "-") {
+			return nil, nil, log.Errorf("Argument '%s' is neither a target pattern nor a build flag. Build flags are passed as 'name=value' or '--set name=value'.\n", arg)
+		}
+		if strings.HasPrefix(arg, "@") {
+			configFlags, err := resolveBuildConfig(configs, strings.TrimPrefix(arg, "@"))
+			if err != nil {
+				return nil, nil, err
+			}
+			for name, value := range configFlags {
+				presetFlags[name] = value
+			}
+		} else if strings.Contains(arg, "=") && !strings.HasPrefix(arg, "//") {
 			parts := strings.SplitN(arg, "=", 2)
 			flags[parts[0]] = parts[1]
 		} else {
-			patterns = append(patterns, normalizeTarget(arg))
+			target, err := normalizeTarget(arg)
+			if err != nil {
+				return nil, nil, err
+			}
+			patterns = append(patterns, dbt.TargetPatternRegexp(target))
 		}
 	}
 
-	return patterns, flags
-}
-
-func normalizeTarget(target string) string {
-	// Build targets are interpreted as relative to the workspace root when they start with '//'.
-	// Otherwise they are interpreted as relative to the current working directory.
-	// E.g.: Running 'dbt build //src/path/to/mylib.a' from anywhere in the workspace is equivalent
-	// to 'dbt build mylib.a' in '.../src/path/to/' or 'dbt build path/to/mylib.a' in '.../src/'.
-	if strings.HasPrefix(target, "//") {
-		return strings.TrimLeft(target, "/")
-	}
-	endsWithSlash := strings.HasSuffix(target, "/") || target == ""
-	target = path.Join(util.GetWorkingDir(), target)
-	moduleRoot := util.GetModuleRootForPath(target)
-	target = strings.TrimPrefix(target, path.Dir(moduleRoot))
-	if endsWithSlash {
-		target = target + "/"
-	}
-	return strings.TrimLeft(target, "/")
+	for name, value := range presetFlags {
+		if _, exists := flags[name]; !exists {
+			flags[name] = value
+		}
+	}
+	return patterns, flags, nil
 }
 
-func runGenerator(input generatorInput) generatorOutput {
-	workspaceRoot := util.GetWorkspaceRoot()
-	input.Layout = module.ReadModuleFile(workspaceRoot).Layout
-	input.SourceDir = path.Join(workspaceRoot, util.DepsDirName)
-	input.WorkingDir = util.GetWorkingDir()
-
-	// Remove all existing buildfiles.
-	generatorDir := path.Join(workspaceRoot, buildDirName, generatorDirName)
-	util.RemoveDir(generatorDir)
-
-	// Copy all BUILD.go files and RULES/ files from the source directory.
-	modules := module.GetAllModules(workspaceRoot)
-	packages := []string{}
-	for modName, module := range modules {
-		modBuildfilesDir := path.Join(generatorDir, modName)
-		modulePackages := copyBuildAndRuleFiles(modName, module.RootPath(), modBuildfilesDir, modules)
-		packages = append(packages, modulePackages...)
+// normalizeTarget returns the name of the target or target pattern `target`, which is relative to
+// the working directory unless it starts with "//".
+func normalizeTarget(target string) (string, error) {
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return "", err
 	}
+	id, err := dbt.NormalizeTarget(dbt.Context{WorkingDir: workingDir}, target)
+	return targetName(id), err
+}
 
-	createGeneratorMainFile(generatorDir, packages, modules)
-	createSumGoFile(generatorDir)
-
-	generatorInputPath := path.Join(generatorDir, generatorInputFileName)
-	util.WriteJson(generatorInputPath, &input)
-
-	cmd := exec.Command("go", "run", mainFileName)
-	cmd.Dir = generatorDir
-	if !input.CompletionsOnly {
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
+// dbtContext returns the context for running the generator of the workspace with pkg/dbt.
+func dbtContext() (dbt.Context, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return dbt.Context{}, err
 	}
-	err := cmd.Run()
+	workingDir, err := util.GetWorkingDir()
 	if err != nil {
-		log.Fatal("Failed to run generator: %s.\n", err)
+		return dbt.Context{}, err
 	}
-	var output generatorOutput
-	generatorOutputPath := path.Join(generatorDir, generatorOutputFileName)
-	util.ReadJson(generatorOutputPath, &output)
-	return output
+	cfg := config.GetConfig()
+	return dbt.Context{
+		WorkspaceRoot: workspaceRoot,
+		WorkingDir:    workingDir,
+		Config:        &cfg,
+		Log:           log.Output,
+		Stdout:        os.Stdout,
+		RunCommand:    runGeneratorCommand,
+	}, nil
 }
 
-func copyBuildAndRuleFiles(moduleName, modulePath, buildFilesDir string, modules map[string]module.Module) []string {
-	packages := []string{}
-
-	log.Debug("Processing module '%s'.\n", moduleName)
-
-	goFilesDir := path.Dir(buildFilesDir)
-
-	for _, goMod := range module.ListGoModules(modules[moduleName]) {
-		modFile := path.Join(goFilesDir, goMod.Name, modFileName)
-		modFileContent := createModFileContent(goMod.Name, goMod.Deps)
-		util.WriteFile(modFile, modFileContent)
+// runGeneratorCommand runs the generator so that it can be interrupted. 'go run' starts the
+// generator as another process, so both are interrupted as a group.
+func runGeneratorCommand(cmd *exec.Cmd) error {
+	err := runInterruptible(cmd, true)
+	if err == errInterrupted {
+		return log.ErrorfWithCode(log.ExitInterrupted, nil, "The generator was interrupted.\n")
 	}
+	return err
+}
 
-	buildFiles := module.ListBuildFiles(modules[moduleName])
-
-	for _, buildFile := range buildFiles {
-		relativeDirPath := strings.TrimSuffix(path.Dir(buildFile.CopyPath), "/")
-
-		packages = append(packages, relativeDirPath)
-		packageName, vars := parseBuildFile(buildFile.SourcePath)
-		varLines := []string{}
-		for _, varName := range vars {
-			varLines = append(varLines, fmt.Sprintf("    vars[in(\"%s\").Relative()] = &%s", varName, varName))
-		}
-
-		initFileContent := fmt.Sprintf(initFileTemplate, packageName, strings.Join(varLines, "\n"), path.Dir(buildFile.SourcePath))
-		initFilePath := path.Join(goFilesDir, relativeDirPath, initFileName)
-		util.WriteFile(initFilePath, []byte(initFileContent))
-
-		copyFilePath := path.Join(goFilesDir, buildFile.CopyPath)
-		util.CopyFile(buildFile.SourcePath, copyFilePath)
+func runGenerator(input generatorInput) (generatorOutput, error) {
+	ctx, err := dbtContext()
+	if err != nil {
+		return generatorOutput{}, err
 	}
-
-	for _, ruleFile := range module.ListRules(modules[moduleName]) {
-		copyFilePath := path.Join(goFilesDir, ruleFile.CopyPath)
-		util.CopyFile(ruleFile.SourcePath, copyFilePath)
+	if input, err = dbt.PrepareInput(ctx, input); err != nil {
+		return generatorOutput{}, err
+	}
+	// Shell completions must never fetch dbt-rules for quickstart mode.
+	if input.CompletionsOnly && !module.QuickstartRulesAvailable(ctx.WorkspaceRoot) {
+		return generatorOutput{}, log.Errorf("%s has not been fetched for quickstart mode yet.\n", dbtRulesDirName)
 	}
 
-	return packages
-}
-
-func parseBuildFile(buildFilePath string) (string, []string) {
-	fileAst, err := parser.ParseFile(token.NewFileSet(), buildFilePath, nil, parser.AllErrors)
-
+	output, handled, err := runGeneratorInDaemon(ctx.WorkspaceRoot, input)
 	if err != nil {
-		log.Fatal("Failed to parse '%s': %s.\n", buildFilePath, err)
+		return generatorOutput{}, err
 	}
-
-	vars := []string{}
-
-	for _, decl := range fileAst.Decls {
-		decl, ok := decl.(*ast.GenDecl)
-		if !ok {
-			log.Fatal("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
+	if !handled {
+		generator, err := dbt.PrepareGenerator(ctx)
+		if err != nil {
+			return generatorOutput{}, err
 		}
-
-		for _, spec := range decl.Specs {
-			switch spec := spec.(type) {
-			case *ast.ImportSpec:
-			case *ast.ValueSpec:
-				if decl.Tok.String() != "var" {
-					log.Fatal("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
-				}
-				for _, id := range spec.Names {
-					if id.Name == "_" {
-						log.Warning("'%s' contains an anonymous declarations.\n", buildFilePath)
-						continue
-					}
-					vars = append(vars, id.Name)
-				}
-			default:
-				log.Fatal("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
+		// Shell completions run the generator on every key press and leave the IDE directory alone.
+		if !input.CompletionsOnly {
+			if err := updateIdeDir(ctx.WorkspaceRoot, generator.Dir, generator.Sources); err != nil {
+				return generatorOutput{}, err
 			}
 		}
+		if output, err = generator.Run(ctx, input); err != nil {
+			return generatorOutput{}, err
+		}
 	}
-
-	return fileAst.Name.String(), vars
-}
-
-func createRootModFileContent(moduleName string, modules map[string]module.Module) []byte {
-	mod := strings.Builder{}
-
-	fmt.Fprintf(&mod, "module %s\n\n", moduleName)
-	fmt.Fprintf(&mod, "go %d.%d\n\n", goMajorVersion, goMinorVersion)
-
-	for _, topModule := range modules {
-		for _, goModule := range module.ListGoModules(topModule) {
-			fmt.Fprintf(&mod, "require %s v0.0.0\n", goModule.Name)
-			fmt.Fprintf(&mod, "replace %s => ./%s\n\n", goModule.Name, goModule.Name)
+	if output.ProtocolVersion > dbt.ProtocolVersion {
+		log.Warning("The generator uses protocol version %d, but this version of DBT only supports version %d. Consider updating DBT.\n", output.ProtocolVersion, dbt.ProtocolVersion)
+	}
+	if !input.CompletionsOnly {
+		if err := reportDiagnostics(output.Diagnostics, output.Flags); err != nil {
+			return generatorOutput{}, err
 		}
 	}
-
-	return []byte(mod.String())
+	return output, nil
 }
 
-func createModFileContent(moduleName string, deps []string) []byte {
-	mod := strings.Builder{}
-
-	fmt.Fprintf(&mod, "module %s\n\n", moduleName)
-	fmt.Fprintf(&mod, "go %d.%d\n\n", goMajorVersion, goMinorVersion)
-
-	for _, modName := range deps {
-		fmt.Fprintf(&mod, "require %s v0.0.0\n", modName)
-		fmt.Fprintf(&mod, "replace %s => ../%s\n\n", modName, modName)
+// reportDiagnostics prints the diagnostics emitted by the generator and fails if any of them is an
+// error. Diagnostics about build flags are followed by the values of the flags and where they come from.
+func reportDiagnostics(diagnostics []diagnostic, flags map[string]flag) error {
+	hasErrors := false
+	hints := []string{}
+	for _, diag := range diagnostics {
+		message := diag.Message
+		if diag.Target != "" {
+			message = fmt.Sprintf("%s: %s", targetID(diag.Target), message)
+		}
+		if len(diag.Flags) > 0 {
+			values := []string{}
+			for _, name := range diag.Flags {
+				value := fmt.Sprintf("%s=%s", name, flags[name].Value)
+				if flags[name].Source != "" {
+					value = fmt.Sprintf("%s (%s)", value, flags[name].Source)
+				}
+				values = append(values, value)
+				if flags[name].Source == "persisted" && diag.Severity == "error" {
+					hints = append(hints, fmt.Sprintf("'%s' was persisted by a previous build. Pass '%s=VALUE' to change it.", name, name))
+				}
+			}
+			message = fmt.Sprintf("%s. Current values: %s.", strings.TrimSuffix(message, "."), strings.Join(values, ", "))
+		}
+		switch diag.Severity {
+		case "error":
+			hasErrors = true
+			log.Error("%s\n", message)
+		case "warning":
+			log.Warning("%s\n", message)
+		default:
+			log.Log("%s\n", message)
+		}
 	}
-
-	return []byte(mod.String())
-}
-
-func createGeneratorMainFile(generatorDir string, packages []string, modules map[string]module.Module) {
-	importLines := []string{}
-	dbtMainLines := []string{}
-	for idx, pkg := range packages {
-		importLines = append(importLines, fmt.Sprintf("import p%d \"%s\"", idx, pkg))
-		dbtMainLines = append(dbtMainLines, fmt.Sprintf("    p%d.DbtMain(vars)", idx))
+	if hasErrors {
+		return log.ErrorfWithCode(log.ExitGenerator, hints, "The generator reported errors.\n")
 	}
-
-	mainFilePath := path.Join(generatorDir, mainFileName)
-	mainFileContent := fmt.Sprintf(mainFileTemplate, strings.Join(importLines, "\n"), goMajorVersion, goMinorVersion, strings.Join(dbtMainLines, "\n"))
-	util.WriteFile(mainFilePath, []byte(mainFileContent))
-
-	modFilePath := path.Join(generatorDir, modFileName)
-	modFileContent := createRootModFileContent("root", modules)
-	util.WriteFile(modFilePath, modFileContent)
+	return nil
 }
 
-func createSumGoFile(generatorDir string) {
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("go", "mod", "download")
-	cmd.Dir = generatorDir
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	err := cmd.Run()
-	fmt.Print(string(stderr.Bytes()))
-	if err != nil {
-		log.Fatal("Failed to run 'go mod download': %s.\n", err)
+// generatedSources returns the generated sources of the `targets`.
+func generatedSources(targets []string, allTargets map[string]target) []string {
+	sources := map[string]bool{}
+	for _, name := range targets {
+		for _, source := range allTargets[name].GeneratedSources {
+			sources[source] = true
+		}
 	}
+	return sortMapKeys(sources)
 }
 
 func skipTarget(mode mode, target target) bool {
+	// Aliases can contain targets for all modes.
+	if len(target.Alias) > 0 {
+		return false
+	}
 	switch mode {
 	case modeRun:
 		return !target.Runnable
@@ -670,6 +1084,11 @@ func skipTarget(mode mode, target target) bool {
 		return !target.Testable
 	case modeCoverage:
 		return !target.Testable && !target.Report
+	case modeClean:
+		return !target.Cleanable
+	case modeOutputs:
+		// Generators before protocol version 8 do not report the kind of targets.
+		return target.Kind != "" && target.Kind != "binary"
 	}
 	return false
 }
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const cacheStatsFileName = "cache-stats.json"
+const maxCacheStatsEntries = 100
+
+// cacheStats records which actions a build had to execute. Ninja skips all other actions because
+// their outputs are up to date, so every executed action is a miss of the incremental build.
+type cacheStats struct {
+	Time      time.Time
+	OutputDir string
+	// Executed maps the first output of each executed action to the name of its rule.
+	Executed map[string]string
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspects how effectively builds reuse previous outputs and downloads cached outputs",
+}
+
+var cacheReportCmd = &cobra.Command{
+	Use:   "report [--by-rule]",
+	Args:  cobra.NoArgs,
+	Short: "Reports which actions are executed again and again",
+	Long: `Reports the actions that had to be executed most often across the recorded builds. Actions that
+are executed by almost every build usually have volatile inputs or nondeterministic outputs.
+With --by-rule, the statistics are aggregated by ninja rule.`,
+	RunE: runCacheReport,
+}
+
+var cacheReportByRule bool
+var cacheReportLength int
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheReportCmd)
+	cacheReportCmd.Flags().BoolVar(&cacheReportByRule, "by-rule", false, "Aggregate the statistics by rule")
+	cacheReportCmd.Flags().IntVarP(&cacheReportLength, "number", "n", 20, "Number of entries to list")
+}
+
+func cacheStatsFilePath() (string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(workspaceRoot, buildDirName, cacheStatsFileName), nil
+}
+
+func readCacheStats() ([]cacheStats, error) {
+	statsFilePath, err := cacheStatsFilePath()
+	if err != nil {
+		return nil, err
+	}
+	stats := []cacheStats{}
+	if util.FileExists(statsFilePath) {
+		if err := util.ReadJson(statsFilePath, &stats); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// recordCacheStats records the `actions` executed by the last ninja run in `dir`.
+func recordCacheStats(dir string, actions []action) error {
+	rules := map[string]string{}
+	if len(actions) > 0 {
+		rules = ninjaRules(dir)
+	}
+	executed := map[string]string{}
+	for _, action := range actions {
+		executed[action.Outputs[0]] = rules[action.Outputs[0]]
+	}
+
+	recorded, err := readCacheStats()
+	if err != nil {
+		return err
+	}
+	stats := append([]cacheStats{{Time: time.Now(), OutputDir: dir, Executed: executed}}, recorded...)
+	if len(stats) > maxCacheStatsEntries {
+		stats = stats[:maxCacheStatsEntries]
+	}
+	statsFilePath, err := cacheStatsFilePath()
+	if err != nil {
+		return err
+	}
+	return util.WriteJson(statsFilePath, &stats)
+}
+
+// ninjaRules returns the name of the rule producing each output in `dir`.
+func ninjaRules(dir string) map[string]string {
+	var stdout bytes.Buffer
+	rules := map[string]string{}
+	if err := tryRunNinja(dir, &stdout, []string{"-t", "targets", "all"}); err != nil {
+		return rules
+	}
+
+	// Each line has the format "<output>: <rule>".
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.LastIndex(line, ": "); idx >= 0 {
+			rules[line[:idx]] = line[idx+2:]
+		}
+	}
+	return rules
+}
+
+type cacheReportEntry struct {
+	Name       string
+	Builds     int
+	Executions int
+	Outputs    map[string]bool
+}
+
+func runCacheReport(cmd *cobra.Command, args []string) error {
+	stats, err := readCacheStats()
+	if err != nil {
+		return err
+	}
+	if len(stats) == 0 {
+		return log.Errorf("No builds have been recorded yet.\n")
+	}
+
+	entries := map[string]*cacheReportEntry{}
+	for _, build := range stats {
+		seen := map[string]bool{}
+		for output, rule := range build.Executed {
+			name := output
+			if cacheReportByRule {
+				name = rule
+				if name == "" {
+					name = "(unknown)"
+				}
+			}
+			entry, exists := entries[name]
+			if !exists {
+				entry = &cacheReportEntry{Name: name, Outputs: map[string]bool{}}
+				entries[name] = entry
+			}
+			entry.Executions++
+			entry.Outputs[output] = true
+			if !seen[name] {
+				seen[name] = true
+				entry.Builds++
+			}
+		}
+	}
+
+	sorted := []*cacheReportEntry{}
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Builds != sorted[j].Builds {
+			return sorted[i].Builds > sorted[j].Builds
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if cacheReportLength >= 0 && len(sorted) > cacheReportLength {
+		sorted = sorted[:cacheReportLength]
+	}
+
+	fmt.Printf("Statistics of the last %d builds:\n", len(stats))
+	if cacheReportByRule {
+		fmt.Printf("  %-30s %8s %10s %8s %s\n", "RULE", "BUILDS", "EXECUTIONS", "OUTPUTS", "EXECUTIONS/OUTPUT")
+		for _, entry := range sorted {
+			fmt.Printf("  %-30s %8d %10d %8d %.1f\n", entry.Name, entry.Builds, entry.Executions, len(entry.Outputs),
+				float64(entry.Executions)/float64(len(entry.Outputs)))
+		}
+		return nil
+	}
+	fmt.Printf("  %8s  %s\n", "BUILDS", "OUTPUT")
+	for _, entry := range sorted {
+		fmt.Printf("  %8d  %s\n", entry.Builds, entry.Name)
+	}
+	return nil
+}
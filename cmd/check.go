@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Args:  cobra.NoArgs,
+	Short: "Type-checks all BUILD.go and RULES/ files",
+	Long: `Type-checks all BUILD.go and RULES/ files in the workspace by running 'go vet' on them.
+Problems are reported with the paths of the original files.`,
+	RunE: runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	ctx, err := dbtContext()
+	if err != nil {
+		return err
+	}
+	generator, err := dbt.PrepareGenerator(ctx)
+	if err != nil {
+		return err
+	}
+
+	modules, err := module.GetAllModules(ctx.WorkspaceRoot)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, moduleName := range sortMapKeys(modules) {
+		goModules, err := module.ListGoModules(modules[moduleName])
+		if err != nil {
+			return err
+		}
+		for _, goMod := range goModules {
+			goModDir := path.Join(generator.Dir, goMod.Name)
+			log.Debug("Running 'go vet ./...' in '%s'.\n", goModDir)
+
+			var output bytes.Buffer
+			vetCmd := generator.GoCommand("vet", "./...")
+			vetCmd.Dir = goModDir
+			vetCmd.Stdout = &output
+			vetCmd.Stderr = &output
+			err := vetCmd.Run()
+			os.Stderr.WriteString(generator.RemapPaths(output.String(), goModDir))
+			if err != nil {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return log.Errorf("Checking BUILD.go and %s/ files failed.\n", rulesDirName)
+	}
+	log.Success("All BUILD.go and %s/ files are valid.\n", rulesDirName)
+	return nil
+}
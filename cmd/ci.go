@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// targetTiers are the tiers that targets can be tagged with.
+var targetTiers = []string{"blocking", "nightly", "experimental"}
+
+// selectedTier restricts the selected targets to targets of that tier if not empty.
+var selectedTier string
+
+var ciCmd = &cobra.Command{
+	Use:   "ci --tier=TIER [patterns] [build flags]",
+	Short: "Builds and tests all targets of a tier",
+	Long: `Builds all targets tagged with the tier and runs the tests among them. Without patterns, all
+targets of the workspace are considered. Tiers let CI pipelines apply different policies, e.g. only
+failures of 'blocking' targets block merging, while 'nightly' and 'experimental' targets are built
+on a schedule.`,
+	RunE: runCI,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ciCmd)
+	ciCmd.Flags().StringVar(&selectedTier, "tier", "", "Tier of the targets to build and test ('"+strings.Join(targetTiers, "', '")+"')")
+	ciCmd.MarkFlagRequired("tier")
+	addSetFlag(ciCmd)
+}
+
+func runCI(cmd *cobra.Command, args []string) error {
+	if !isKnownTier(selectedTier) {
+		return log.Errorf("Unknown tier '%s'. Use one of '%s'.\n", selectedTier, strings.Join(targetTiers, "', '"))
+	}
+	args, err := withSetFlags(args)
+	if err != nil {
+		return err
+	}
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return err
+	}
+	patterns, _, err := parseArgs(args, moduleFile.Configs)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		args = append(args, "//.*")
+	}
+
+	if err := runBuild(args, modeBuild, nil); err != nil {
+		return err
+	}
+	if err := runBuild(args, modeTest, nil); err != nil {
+		return err
+	}
+	log.Success("All targets of tier '%s' were built and tested.\n", selectedTier)
+	return nil
+}
+
+func isKnownTier(tier string) bool {
+	for _, known := range targetTiers {
+		if tier == known {
+			return true
+		}
+	}
+	return false
+}
@@ -11,21 +11,51 @@ import (
 )
 
 var cleanCmd = &cobra.Command{
-	Use:   "clean",
-	Args:  cobra.NoArgs,
+	Use:   "clean [--targets [patterns] [build flags]]",
 	Short: "Removes all intermediate build results",
-	Long:  `Removes all intermediate build results.`,
-	Run:   runClean,
+	Long: `Removes all intermediate build results.
+With --targets, runs the clean actions of the matching targets instead. Clean actions revert
+side effects of targets outside of the BUILD/ directory.`,
+	RunE: runClean,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if !cleanTargets {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeBuildArgs(toComplete, modeClean)
+	},
 }
 
+var cleanTargets bool
+
 func init() {
 	rootCmd.AddCommand(cleanCmd)
+	cleanCmd.Flags().BoolVar(&cleanTargets, "targets", false, "Run the clean actions of the given targets")
+	addSetFlag(cleanCmd)
+	addUseLastGoodFlag(cleanCmd)
 }
 
-func runClean(cmd *cobra.Command, args []string) {
-	workspaceRoot := util.GetModuleRoot()
+func runClean(cmd *cobra.Command, args []string) error {
+	if cleanTargets {
+		args, err := withSetFlags(args)
+		if err != nil {
+			return err
+		}
+		return runBuild(args, modeClean, nil)
+	}
+	if len(args) > 0 {
+		return log.Errorf("Targets can only be cleaned with --targets.\n")
+	}
+
+	workspaceRoot, err := util.GetModuleRoot()
+	if err != nil {
+		return err
+	}
 	log.Debug("Workspace: %s.\n", workspaceRoot)
 	buildDir := path.Join(workspaceRoot, buildDirName)
 	log.Debug("Removing %s diectory '%s'.\n", buildDirName, buildDir)
-	os.RemoveAll(buildDir)
+	if err := os.RemoveAll(buildDir); err != nil {
+		checkForeignFiles(buildDir)
+		return log.Errorf("Failed to remove %s directory: %s.\n", buildDirName, err)
+	}
+	return nil
 }
@@ -17,7 +17,7 @@ var cloneCmd = &cobra.Command{
 	Short: "Clones a repository locally, recursively syncing and updating modules to satisfy all dependencies.",
 	Long: `Clones a repository locally, recursively syncing and updating modules to satisfy the dependencies
 declared in the MODULE files of each module, starting from the top-level MODULE file.`,
-	Run: runClone,
+	RunE: runClone,
 }
 
 var revision string
@@ -28,38 +28,46 @@ func init() {
 	rootCmd.AddCommand(cloneCmd)
 }
 
-func runClone(cmd *cobra.Command, args []string) {
+func runClone(cmd *cobra.Command, args []string) error {
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
 	repoUrl := args[0]
 	repoPath := ""
 	if len(args) > 1 {
 		if path.IsAbs(args[1]) {
 			repoPath = args[1]
 		} else {
-			repoPath = path.Join(util.GetWorkingDir(), args[1])
+			repoPath = path.Join(workingDir, args[1])
 		}
 	} else {
 		parts := strings.Split(repoUrl, "/")
 		repoName := parts[len(parts)-1]
 		repoName = strings.TrimSuffix(repoName, ".git")
-		repoPath = path.Join(util.GetWorkingDir(), repoName)
+		repoPath = path.Join(workingDir, repoName)
 	}
 
 	if util.DirExists(repoPath) {
 		log.Error("Directory '%s' already exists.\n", repoPath)
-		return
+		return nil
 	}
 
 	log.Log("Cloning '%s' into '%s'.\n", repoUrl, repoPath)
-	mod, err := module.CreateGitModule(repoPath, repoUrl)
+	mod, err := module.CreateGitModule(repoPath, repoUrl, "", module.CloneOptions{})
 	if err != nil {
 		os.RemoveAll(repoPath)
-		log.Fatal("Failed to create git module: %s.\n", err)
+		return log.Errorf("Failed to create git module: %s.\n", err)
+	}
+	if err := module.SetupModule(repoPath); err != nil {
+		return err
 	}
-	module.SetupModule(repoPath)
 	log.Log("Checking out revision '%s'\n", revision)
-	mod.Checkout(revision)
+	if err := mod.Checkout(revision); err != nil {
+		return err
+	}
 
 	// Move into the repo directory in order to set it up
 	os.Chdir(repoPath)
-	runSync(cmd, args)
+	return runSync(cmd, args)
 }
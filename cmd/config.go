@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+
+	"github.com/daedaleanai/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const configFlagName = "config"
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspects the build configs and settings of the workspace",
+	Long: `Inspects the build configs declared in the MODULE file of the workspace and the settings of
+DBT. A build config is selected with the 'config' build flag, e.g. 'dbt build config=asan'.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [NAME]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Shows the effective build flags of a build config",
+	Long: `Shows the effective build flags of a build config, including all flags inherited from the
+configs it extends. Without NAME, all build configs are listed.`,
+	RunE:              runConfigShow,
+	ValidArgsFunction: completeConfigNames,
+}
+
+var configSettingsCmd = &cobra.Command{
+	Use:   "settings",
+	Args:  cobra.NoArgs,
+	Short: "Shows the effective settings of DBT",
+	Long: `Shows the effective settings of DBT and the configuration files they were loaded from. The
+'.dbtconfig' file in the workspace root is overridden by the configuration file of the user, which
+is overridden by DBT_<SETTING> environment variables, e.g. DBT_JOBS=8.`,
+	RunE: runConfigSettings,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configSettingsCmd)
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return err
+	}
+	configs := moduleFile.Configs
+	if len(args) == 0 {
+		if len(configs) == 0 {
+			log.Log("The workspace does not declare any build configs.\n")
+			return nil
+		}
+		for _, name := range sortMapKeys(configs) {
+			if configs[name].Extends != "" {
+				fmt.Printf("%s (extends %s)\n", name, configs[name].Extends)
+			} else {
+				fmt.Println(name)
+			}
+		}
+		return nil
+	}
+
+	flags, err := resolveBuildConfig(configs, args[0])
+	if err != nil {
+		return err
+	}
+	for _, name := range sortMapKeys(flags) {
+		fmt.Printf("%s=%s\n", name, flags[name])
+	}
+	fmt.Printf("\nOutput directory: %s/%s\n", buildDirName, buildConfigOutputDir(args[0], flags))
+	return nil
+}
+
+func runConfigSettings(cmd *cobra.Command, args []string) error {
+	settings := config.GetConfig()
+	// Tokens are secrets and not shown.
+	for idx := range settings.DaemonTokens {
+		settings.DaemonTokens[idx].Token = "***"
+	}
+	for _, file := range config.LoadedFiles() {
+		fmt.Printf("# Loaded from %s\n", file)
+	}
+	data, err := yaml.Marshal(&settings)
+	if err != nil {
+		return log.Errorf("Failed to serialize the settings: %s.\n", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// resolveBuildConfig returns the effective build flags of the config `name`. Flags of a config
+// override the flags of the config it extends.
+func resolveBuildConfig(configs map[string]module.BuildConfig, name string) (map[string]string, error) {
+	chain := []string{}
+	visited := map[string]bool{}
+	for current := name; current != ""; current = configs[current].Extends {
+		if visited[current] {
+			return nil, log.Errorf("Build config '%s' extends itself: %s -> %s.\n", name, strings.Join(chain, " -> "), current)
+		}
+		if _, exists := configs[current]; !exists {
+			if current == name {
+				return nil, log.Errorf("There is no build config '%s'. Run 'dbt config show' to list all build configs.\n", name)
+			}
+			return nil, log.Errorf("Build config '%s' extends '%s', which does not exist.\n", chain[len(chain)-1], current)
+		}
+		visited[current] = true
+		chain = append(chain, current)
+	}
+
+	flags := map[string]string{}
+	for idx := len(chain) - 1; idx >= 0; idx-- {
+		for flagName, value := range configs[chain[idx]].Flags {
+			flags[flagName] = value
+		}
+	}
+	return flags, nil
+}
+
+// buildConfigOutputDir returns the output directory for the config `name` with the effective
+// `flags`. The directory name includes a hash of the flags, so that changing a config does not
+// reuse the outputs built with its previous flags.
+func buildConfigOutputDir(name string, flags map[string]string) string {
+	hasher := sha256.New()
+	for _, flagName := range sortMapKeys(flags) {
+		fmt.Fprintf(hasher, "%s=%s\n", flagName, flags[flagName])
+	}
+	return fmt.Sprintf("%s-%s-%x", defaultOutputDir, name, hasher.Sum(nil)[:4])
+}
+
+func completeConfigNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return sortMapKeys(moduleFile.Configs), cobra.ShellCompDirectiveNoFileComp
+}
@@ -1,6 +1,13 @@
 package cmd
 
 import (
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
 	"github.com/daedaleanai/cobra"
 )
 
@@ -8,9 +15,9 @@ var coverageCmd = &cobra.Command{
 	Use:   "coverage [patterns] [build flags] [: test args]",
 	Short: "Builds, tests the targets and generate coverage report.",
 	Long:  `Builds, tests the targets and generate coverage report.`,
-	Run:   runCoverage,
+	RunE:  runCoverage,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return completeBuildArgs(toComplete, modeCoverage), cobra.ShellCompDirectiveNoFileComp
+		return completeBuildArgs(toComplete, modeCoverage)
 	},
 	DisableFlagsInUseLine: true,
 }
@@ -18,9 +25,12 @@ var coverageCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(coverageCmd)
 	coverageCmd.Flags().SetInterspersed(false)
+	addSetFlag(coverageCmd)
+	addUseLastGoodFlag(coverageCmd)
+	addNoStampFlag(coverageCmd)
 }
 
-func runCoverage(cmd *cobra.Command, args []string) {
+func runCoverage(cmd *cobra.Command, args []string) error {
 	numThreads = 1
 	testArgs := []string{}
 	buildArgs := args
@@ -31,5 +41,35 @@ func runCoverage(cmd *cobra.Command, args []string) {
 			break
 		}
 	}
-	runBuild(buildArgs, modeCoverage, testArgs)
+	buildArgs, err := withSetFlags(buildArgs)
+	if err != nil {
+		return err
+	}
+	return runBuild(buildArgs, modeCoverage, testArgs)
+}
+
+// printCoverageReports prints the paths of the outputs of all report targets that have been built.
+func printCoverageReports(targets []string, allTargets map[string]target, outputDir string) error {
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	reports := []string{}
+	for _, name := range targets {
+		if !allTargets[name].Report {
+			continue
+		}
+		for _, output := range allTargets[name].Outputs {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			reports = append(reports, output)
+		}
+	}
+	sort.Strings(reports)
+	for _, report := range reports {
+		relPath, _ := filepath.Rel(workingDir, report)
+		log.Log("\nCoverage report: %s\n", relPath)
+	}
+	return nil
 }
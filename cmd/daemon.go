@@ -0,0 +1,616 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const daemonDirName = "DAEMON"
+const daemonLogFileName = "daemon.log"
+const daemonGeneratorFileName = "generator"
+const daemonAuditLogFileName = "daemon-audit.log"
+const daemonSocketFileName = "daemon.sock"
+const daemonStartTimeout = 5 * time.Second
+
+// daemonRequestTimeout is how long the daemon waits for a client to send its request and to read
+// the response, so that a client that stalls can not block the daemon.
+const daemonRequestTimeout = 10 * time.Second
+
+// maxDaemonSocketPathLength is the longest socket path supported on all platforms.
+const maxDaemonSocketPathLength = 103
+
+// errPeerCredentialsUnsupported is returned if the platform can not tell who is at the other end
+// of a daemon connection.
+var errPeerCredentialsUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// daemonTokenEnvVar is the environment variable that holds the token sent to the daemon.
+const daemonTokenEnvVar = "DBT_DAEMON_TOKEN"
+
+// Scopes of daemon tokens. Scopes do not imply each other.
+const (
+	// scopeReadGraph allows querying the status of the daemon and the targets and build flags of
+	// the workspace without running a build, e.g. for completions.
+	scopeReadGraph = "read-graph"
+	// scopeBuild allows running the generator for a build.
+	scopeBuild = "build"
+	// scopePublish allows builds that persist their build flags, which changes the build flags of
+	// every later build in the workspace.
+	scopePublish = "publish"
+)
+
+// daemonRequestScope returns the scope required for `request`. Stopping the daemon is reserved for
+// the user running it, so no scope allows it.
+func daemonRequestScope(request daemonRequest) (string, bool) {
+	switch request.Command {
+	case "status":
+		return scopeReadGraph, true
+	case "generate":
+		if request.Input.PersistFlags {
+			return scopePublish, true
+		}
+		if request.Input.CompletionsOnly || request.Input.FlagsOnly {
+			return scopeReadGraph, true
+		}
+		return scopeBuild, true
+	default:
+		return "", false
+	}
+}
+
+// daemonAuditEntry records who sent which request to the daemon.
+type daemonAuditEntry struct {
+	Time       time.Time
+	Command    string
+	Token      string
+	User       string
+	WorkingDir string            `json:",omitempty"`
+	Flags      map[string]string `json:",omitempty"`
+	Allowed    bool
+}
+
+// daemonRequest is sent by a client to the generator daemon. Command is one of "generate",
+// "status" or "stop".
+type daemonRequest struct {
+	Command string
+	Version string
+	Token   string
+	Input   generatorInput
+}
+
+type daemonResponse struct {
+	Status daemonStatus
+	Output generatorOutput
+	Stdout string
+	Stderr string
+	Error  string
+}
+
+type daemonStatus struct {
+	Pid             int
+	Version         string
+	Workspace       string
+	StartTime       time.Time
+	Requests        int
+	GeneratorBuilds int
+}
+
+// generatorDaemon serves generator requests for a workspace. It keeps the compiled generator
+// and only rebuilds it if any of the BUILD.go or RULES/ files changed.
+type generatorDaemon struct {
+	status      daemonStatus
+	fingerprint string
+	// shared is set if the daemon accepts requests from other users.
+	shared bool
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manages the generator daemon",
+	Long: `Manages the generator daemon of the workspace. While the daemon is running, builds send
+their generator requests to it. The daemon caches the compiled generator and only invokes the
+go toolchain again if BUILD.go or RULES/ files changed. The cached generator still evaluates all
+BUILD.go files for every request.`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Args:  cobra.NoArgs,
+	Short: "Starts the generator daemon in the background",
+	RunE:  runDaemonStart,
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Args:  cobra.NoArgs,
+	Short: "Stops the generator daemon",
+	RunE:  runDaemonStop,
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "Shows whether the generator daemon is running",
+	RunE:  runDaemonStatus,
+}
+
+var daemonServeCmd = &cobra.Command{
+	Use:    "serve",
+	Args:   cobra.NoArgs,
+	Short:  "Runs the generator daemon in the foreground",
+	Hidden: true,
+	RunE:   runDaemonServe,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonStartCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonServeCmd)
+}
+
+// daemonSocketPaths returns the paths at which the daemon socket of the workspace may be placed.
+// A private daemon places it in $XDG_RUNTIME_DIR/dbt if it is set, and in BUILD/DAEMON otherwise.
+// A shared daemon always places it in BUILD/DAEMON, since it must be reachable by other users.
+// Both directories belong to the user running the daemon, so that nobody else can impersonate it.
+func daemonSocketPaths(workspaceRoot string) []string {
+	paths := []string{}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		hash := sha256.Sum256([]byte(workspaceRoot))
+		paths = append(paths, path.Join(runtimeDir, "dbt", fmt.Sprintf("%x.sock", hash[:8])))
+	}
+	return append(paths, path.Join(workspaceRoot, buildDirName, daemonDirName, daemonSocketFileName))
+}
+
+// daemonShared reports whether the daemon accepts requests from other users, which is the case
+// if daemon tokens are configured.
+func daemonShared() bool {
+	return len(config.GetConfig().DaemonTokens) > 0
+}
+
+// prepareDaemonSocketDir creates the directory of the daemon socket `socketPath`, makes sure that
+// it belongs to the user and restricts its permissions. Other users may only traverse the
+// directory of a shared daemon.
+func prepareDaemonSocketDir(socketPath string, shared bool) error {
+	if len(socketPath) > maxDaemonSocketPathLength {
+		return log.Errorf("The daemon socket path '%s' is too long. Set $XDG_RUNTIME_DIR to a shorter directory.\n", socketPath)
+	}
+	socketDir := path.Dir(socketPath)
+	if err := util.MkdirAll(socketDir); err != nil {
+		return err
+	}
+	if uid, err := daemonSocketDirOwner(socketPath); err != nil || uid != os.Getuid() {
+		return log.Errorf("'%s' is not a directory owned by the current user.\n", socketDir)
+	}
+	var mode os.FileMode = 0700
+	if shared {
+		mode = 0711
+	}
+	if err := os.Chmod(socketDir, mode); err != nil {
+		return log.Errorf("Failed to change the filemode of '%s': %s.\n", socketDir, err)
+	}
+	return nil
+}
+
+// checkDaemonServer checks that the daemon at the other end of `conn` runs as the owner of the
+// directory of its socket `socketPath`. Where the platform does not support peer credentials, the
+// permissions of the socket directory have to suffice.
+func checkDaemonServer(conn net.Conn, socketPath string) error {
+	uid, err := daemonPeerUid(conn)
+	if err == errPeerCredentialsUnsupported {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to determine the uid of the daemon: %s", err)
+	}
+	if owner, err := daemonSocketDirOwner(socketPath); err != nil || uid != owner {
+		return fmt.Errorf("the daemon runs as uid %d, which does not own '%s'", uid, path.Dir(socketPath))
+	}
+	return nil
+}
+
+// callDaemon sends `request` to the daemon of the current workspace and returns its response.
+func callDaemon(request daemonRequest) (daemonResponse, error) {
+	var response daemonResponse
+	var conn net.Conn
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return response, err
+	}
+	for _, socketPath := range daemonSocketPaths(workspaceRoot) {
+		if conn, err = net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			err = checkDaemonServer(conn, socketPath)
+			break
+		}
+	}
+	if conn == nil {
+		return response, err
+	}
+	defer conn.Close()
+	if err != nil {
+		return response, err
+	}
+
+	request.Version = rootCmd.Version
+	request.Token = os.Getenv(daemonTokenEnvVar)
+	if err := json.NewEncoder(conn).Encode(&request); err != nil {
+		return response, err
+	}
+	err = json.NewDecoder(conn).Decode(&response)
+	return response, err
+}
+
+// runGeneratorInDaemon runs the generator in the daemon if it is running. It reports whether the
+// daemon handled the request.
+func runGeneratorInDaemon(workspaceRoot string, input generatorInput) (generatorOutput, bool, error) {
+	running := false
+	for _, socketPath := range daemonSocketPaths(workspaceRoot) {
+		running = running || util.FileExists(socketPath)
+	}
+	if !running {
+		return generatorOutput{}, false, nil
+	}
+	response, err := callDaemon(daemonRequest{Command: "generate", Input: input})
+	if err != nil {
+		log.Debug("Failed to reach the generator daemon: %s.\n", err)
+		return generatorOutput{}, false, nil
+	}
+	if response.Status.Version != rootCmd.Version {
+		log.Warning("The generator daemon runs dbt %s. Restart it with 'dbt daemon stop' and 'dbt daemon start'.\n", response.Status.Version)
+		return generatorOutput{}, false, nil
+	}
+
+	if !input.CompletionsOnly {
+		fmt.Fprint(log.Output, response.Stdout)
+		fmt.Fprint(log.Output, response.Stderr)
+	}
+	if response.Error != "" {
+		return generatorOutput{}, true, log.ErrorfWithCode(log.ExitGenerator, nil, "%s.\n", response.Error)
+	}
+	return response.Output, true, nil
+}
+
+func runDaemonStart(cmd *cobra.Command, args []string) error {
+	if response, err := callDaemon(daemonRequest{Command: "status"}); err == nil {
+		log.Success("The generator daemon is already running (pid %d).\n", response.Status.Pid)
+		return nil
+	}
+
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	logFilePath := path.Join(workspaceRoot, buildDirName, daemonDirName, daemonLogFileName)
+	if err := util.MkdirAll(path.Dir(logFilePath)); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return log.Errorf("Failed to open '%s': %s.\n", logFilePath, err)
+	}
+	defer logFile.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return log.Errorf("Failed to determine the dbt executable: %s.\n", err)
+	}
+	serveCmd := exec.Command(executable, "daemon", "serve", "--workspace", workspaceRoot)
+	serveCmd.Dir = workspaceRoot
+	serveCmd.Stdout = logFile
+	serveCmd.Stderr = logFile
+	// Detach the daemon from the terminal session.
+	detachProcess(serveCmd)
+	if err := serveCmd.Start(); err != nil {
+		return log.Errorf("Failed to start the generator daemon: %s.\n", err)
+	}
+
+	for deadline := time.Now().Add(daemonStartTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if _, err := callDaemon(daemonRequest{Command: "status"}); err == nil {
+			log.Success("Started the generator daemon (pid %d).\n", serveCmd.Process.Pid)
+			return nil
+		}
+	}
+	return log.Errorf("The generator daemon did not start. See '%s' for details.\n", logFilePath)
+}
+
+func runDaemonStop(cmd *cobra.Command, args []string) error {
+	response, err := callDaemon(daemonRequest{Command: "stop"})
+	if err != nil {
+		log.Log("The generator daemon is not running.\n")
+		return nil
+	}
+	if response.Error != "" {
+		return log.Errorf("%s.\n", response.Error)
+	}
+	log.Success("Stopped the generator daemon (pid %d).\n", response.Status.Pid)
+	return nil
+}
+
+func runDaemonStatus(cmd *cobra.Command, args []string) error {
+	response, err := callDaemon(daemonRequest{Command: "status"})
+	if err != nil {
+		log.Log("The generator daemon is not running.\n")
+		return nil
+	}
+	if response.Error != "" {
+		return log.Errorf("%s.\n", response.Error)
+	}
+	status := response.Status
+	fmt.Printf("Pid:              %d\n", status.Pid)
+	fmt.Printf("Version:          %s\n", status.Version)
+	fmt.Printf("Workspace:        %s\n", status.Workspace)
+	fmt.Printf("Uptime:           %s\n", time.Since(status.StartTime).Round(time.Second))
+	fmt.Printf("Requests:         %d\n", status.Requests)
+	fmt.Printf("Generator builds: %d\n", status.GeneratorBuilds)
+	return nil
+}
+
+func runDaemonServe(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	shared := daemonShared()
+	socketPaths := daemonSocketPaths(workspaceRoot)
+	socketPath := socketPaths[0]
+	if shared {
+		socketPath = socketPaths[len(socketPaths)-1]
+	}
+	if err := prepareDaemonSocketDir(socketPath, shared); err != nil {
+		return err
+	}
+	// A socket left behind by a daemon that did not shut down cleanly prevents listening.
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return log.Errorf("Failed to listen on '%s': %s.\n", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+	if shared {
+		if err := os.Chmod(socketPath, 0666); err != nil {
+			return log.Errorf("Failed to change the filemode of '%s': %s.\n", socketPath, err)
+		}
+	}
+
+	daemon := &generatorDaemon{status: daemonStatus{
+		Pid:       os.Getpid(),
+		Version:   rootCmd.Version,
+		Workspace: workspaceRoot,
+		StartTime: time.Now(),
+	}, shared: shared}
+	log.Log("Generator daemon listening on '%s'.\n", socketPath)
+
+	// Requests are handled one at a time, since they share the generator directory.
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return log.Errorf("Failed to accept connection: %s.\n", err)
+		}
+		stop := daemon.handle(conn)
+		conn.Close()
+		if stop {
+			log.Log("Generator daemon stopped.\n")
+			listener.Close()
+			return nil
+		}
+	}
+}
+
+// handle serves a single request and reports whether the daemon should stop.
+func (d *generatorDaemon) handle(conn net.Conn) bool {
+	uid, err := daemonPeerUid(conn)
+	if err == errPeerCredentialsUnsupported {
+		// Only the user can reach the socket of a private daemon. Unknown clients of a shared daemon
+		// need a token.
+		if !d.shared {
+			uid = os.Getuid()
+		}
+	} else if err != nil {
+		log.Warning("Failed to determine the uid of the client: %s.\n", err)
+		return false
+	}
+	var request daemonRequest
+	conn.SetDeadline(time.Now().Add(daemonRequestTimeout))
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		log.Warning("Failed to decode request: %s.\n", err)
+		return false
+	}
+
+	response := daemonResponse{}
+	tokenName, allowed := authorizeDaemonRequest(request, uid)
+	d.audit(request, uid, tokenName, allowed)
+	if !allowed {
+		if scope, exists := daemonRequestScope(request); exists {
+			response.Error = fmt.Sprintf("Access denied: the '%s' request requires a token with scope '%s' in $%s",
+				request.Command, scope, daemonTokenEnvVar)
+		} else {
+			response.Error = fmt.Sprintf("Access denied: only the user running the daemon may send '%s' requests", request.Command)
+		}
+		response.Status.Pid = d.status.Pid
+		response.Status.Version = d.status.Version
+		conn.SetDeadline(time.Now().Add(daemonRequestTimeout))
+		json.NewEncoder(conn).Encode(&response)
+		return false
+	}
+	if request.Command == "generate" && request.Version == d.status.Version {
+		d.status.Requests++
+		// Errors while assembling the generator directory must not terminate the daemon.
+		var err error
+		response.Output, response.Stdout, response.Stderr, response.Error, err = d.generate(request.Input)
+		if err != nil {
+			log.Warning("Request failed: %s.\n", err)
+			response.Error = err.Error()
+		}
+	}
+	response.Status = d.status
+	// Running the generator may take longer than the deadline for receiving the request.
+	conn.SetDeadline(time.Now().Add(daemonRequestTimeout))
+	if err := json.NewEncoder(conn).Encode(&response); err != nil {
+		log.Warning("Failed to send response: %s.\n", err)
+	}
+	return request.Command == "stop"
+}
+
+// authorizeDaemonRequest decides whether the request `request` from a client running as `uid` is
+// allowed. Requests from the user running the daemon are always allowed, all other requests need a
+// token from the DBT configuration with the required scope. It returns the name of the token and
+// whether the request is allowed.
+func authorizeDaemonRequest(request daemonRequest, uid int) (string, bool) {
+	if uid == os.Getuid() {
+		return "", true
+	}
+	tokens := config.GetConfig().DaemonTokens
+	scope, known := daemonRequestScope(request)
+	if !known {
+		return "", false
+	}
+	for _, token := range tokens {
+		if request.Token == "" || subtle.ConstantTimeCompare([]byte(token.Token), []byte(request.Token)) != 1 {
+			continue
+		}
+		for _, tokenScope := range token.Scopes {
+			if tokenScope == scope {
+				return token.Name, true
+			}
+		}
+		return token.Name, false
+	}
+	return "", false
+}
+
+// audit appends an entry for `request` to the audit log of the daemon. The log is kept in the state
+// directory of the user running the daemon, where neither 'dbt clean' nor other users of the
+// workspace can remove or change it.
+func (d *generatorDaemon) audit(request daemonRequest, uid int, tokenName string, allowed bool) {
+	entry := daemonAuditEntry{
+		Time:    time.Now(),
+		Command: request.Command,
+		Token:   tokenName,
+		User:    fmt.Sprintf("uid %d", uid),
+		Allowed: allowed,
+	}
+	if uid < 0 {
+		entry.User = "unknown"
+	} else if peer, err := user.LookupId(fmt.Sprint(uid)); err == nil {
+		entry.User = peer.Username
+	}
+	if request.Command == "generate" {
+		entry.WorkingDir = request.Input.WorkingDir
+		entry.Flags = request.Input.CmdlineFlags
+	}
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		log.Warning("Failed to marshal audit log entry: %s.\n", err)
+		return
+	}
+	stateDir, err := workspaceStateDir(d.status.Workspace)
+	if err != nil {
+		log.Warning("Failed to record the request in the audit log: %s.\n", err)
+		return
+	}
+	if err := util.MkdirAll(stateDir); err != nil {
+		log.Warning("Failed to record the request in the audit log: %s.\n", err)
+		return
+	}
+	auditLogPath := path.Join(stateDir, daemonAuditLogFileName)
+	file, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Warning("Failed to open '%s': %s.\n", auditLogPath, err)
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
+
+// generate runs the generator for `input`. Besides the output, it returns the stdout and stderr of
+// the generator and a description of its failure. Errors while preparing the generator are returned
+// separately.
+func (d *generatorDaemon) generate(input generatorInput) (generatorOutput, string, string, string, error) {
+	var output generatorOutput
+	cfg := config.GetConfig()
+	ctx := dbt.Context{WorkspaceRoot: d.status.Workspace, WorkingDir: input.WorkingDir, Config: &cfg, Log: log.Output}
+	generator, err := dbt.PrepareGenerator(ctx)
+	if err != nil {
+		return output, "", "", "", err
+	}
+	if !input.CompletionsOnly {
+		if err := updateIdeDir(d.status.Workspace, generator.Dir, generator.Sources); err != nil {
+			return output, "", "", "", err
+		}
+	}
+	if err := generator.WriteInput(input); err != nil {
+		return output, "", "", "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	binPath := path.Join(d.status.Workspace, buildDirName, daemonDirName, daemonGeneratorFileName)
+	fingerprint := generatorFingerprint(generator.Dir, generator.Sources)
+	if fingerprint != d.fingerprint || !util.FileExists(binPath) {
+		log.Log("Building the generator.\n")
+		buildCmd := generator.BuildCommand(binPath)
+		buildCmd.Stderr = &stderr
+		if err := buildCmd.Run(); err != nil {
+			return output, "", generator.RemapPaths(stderr.String(), generator.Dir), fmt.Sprintf("Failed to build generator: %s", err), nil
+		}
+		d.fingerprint = fingerprint
+		d.status.GeneratorBuilds++
+	}
+
+	generatorCmd := exec.Command(binPath)
+	generatorCmd.Dir = generator.Dir
+	generatorCmd.Stdout = &stdout
+	generatorCmd.Stderr = &stderr
+	if err := generatorCmd.Run(); err != nil {
+		return output, stdout.String(), generator.RemapPaths(stderr.String(), generator.Dir), fmt.Sprintf("Failed to run generator: %s", err), nil
+	}
+	if output, err = generator.ReadOutput(); err != nil {
+		return output, "", "", "", err
+	}
+	return output, stdout.String(), generator.RemapPaths(stderr.String(), generator.Dir), "", nil
+}
+
+// generatorFingerprint returns a hash that changes whenever the generator has to be rebuilt: the
+// size and modification time of all overlaid source files and the content of all generated files.
+func generatorFingerprint(generatorDir string, sources map[string]string) string {
+	hash := sha256.New()
+	for _, overlaidPath := range sortMapKeys(sources) {
+		if info, err := os.Stat(sources[overlaidPath]); err == nil {
+			fmt.Fprintf(hash, "%s %s %d %d\n", overlaidPath, sources[overlaidPath], info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	filepath.Walk(generatorDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.Name() == dbt.GeneratorInputFileName || info.Name() == dbt.GeneratorOutputFileName {
+			return nil
+		}
+		if data, err := ioutil.ReadFile(filePath); err == nil {
+			fmt.Fprintf(hash, "%s %d\n", filePath, len(data))
+			hash.Write(data)
+		}
+		return nil
+	})
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
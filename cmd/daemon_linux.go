@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"net"
+	"syscall"
+)
+
+// daemonPeerUid returns the uid of the process at the other end of the daemon connection `conn`.
+func daemonPeerUid(conn net.Conn) (int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return -1, errPeerCredentialsUnsupported
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if credErr != nil {
+		return -1, credErr
+	}
+	return int(cred.Uid), nil
+}
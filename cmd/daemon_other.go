@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package cmd
+
+import "net"
+
+// daemonPeerUid returns the uid of the process at the other end of the daemon connection `conn`.
+// The uid is only available on Linux.
+func daemonPeerUid(conn net.Conn) (int, error) {
+	return -1, errPeerCredentialsUnsupported
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"path"
 	"regexp"
 
@@ -20,8 +22,11 @@ const masterVersion = "origin/master"
 
 var (
 	depCmd = &cobra.Command{
-		Use:   "dep",
-		Short: "Manages module dependencies",
+		Use:     "dep",
+		Aliases: []string{"deps"},
+		Short:   "Manages module dependencies",
+		Long: `Manages the dependencies declared in the MODULE file of the current module.
+Unless --no-sync is given, 'dbt sync' is run after the MODULE file has been changed.`,
 	}
 
 	addCmd = &cobra.Command{
@@ -29,7 +34,7 @@ var (
 		Args:              cobra.RangeArgs(0, 1),
 		Short:             "Adds a dependency to the MODULE file of the current module",
 		Long:              `Adds a dependency to the MODULE file of the current module.`,
-		Run:               runAdd,
+		RunE:              runAdd,
 		ValidArgsFunction: completeDepArgs,
 	}
 
@@ -38,12 +43,34 @@ var (
 		Args:              cobra.ExactArgs(1),
 		Short:             "Removes a dependency from the MODULE file of the current module",
 		Long:              `Removes a dependency from the MODULE file of the current module.`,
-		Run:               runRemove,
+		RunE:              runRemove,
 		ValidArgsFunction: completeDepArgs,
 	}
+
+	upgradeCmd = &cobra.Command{
+		Use:   "upgrade MODULE [--version=VERSION]",
+		Args:  cobra.ExactArgs(1),
+		Short: "Bumps the pinned version of a dependency of the current module",
+		Long: `Bumps the pinned version of a dependency of the current module. The dependency is pinned
+to the commit its version string currently resolves to. With --version, the version string is
+changed as well.`,
+		RunE:              runUpgrade,
+		ValidArgsFunction: completeDepArgs,
+	}
+
+	whyCmd = &cobra.Command{
+		Use:   "why MODULE",
+		Args:  cobra.ExactArgs(1),
+		Short: "Shows which modules require a dependency and which version is used",
+		Long: `Shows which modules in the workspace require MODULE, the version each of them requires
+and which of the versions has been selected by the last 'dbt sync'.`,
+		RunE:              runWhy,
+		ValidArgsFunction: completeWhyArgs,
+	}
 )
 
-var url, version string
+var url, version, upgradeVersion string
+var noSync bool
 
 func init() {
 	rootCmd.AddCommand(depCmd)
@@ -53,37 +80,64 @@ func init() {
 	addCmd.Flags().StringVar(&version, "version", masterVersion, "Dependency version")
 
 	depCmd.AddCommand(removeCmd)
+
+	depCmd.AddCommand(upgradeCmd)
+	upgradeCmd.Flags().StringVar(&upgradeVersion, "version", "", "New dependency version")
+
+	depCmd.AddCommand(whyCmd)
+
+	for _, cmd := range []*cobra.Command{addCmd, removeCmd, upgradeCmd} {
+		cmd.Flags().BoolVar(&noSync, "no-sync", false, "Only edit the MODULE file without running 'dbt sync'")
+	}
 }
 
-func runAdd(cmd *cobra.Command, args []string) {
-	moduleRoot := util.GetModuleRoot()
+func runAdd(cmd *cobra.Command, args []string) error {
+	moduleRoot, err := util.GetModuleRoot()
+	if err != nil {
+		return err
+	}
 	moduleName := path.Base(moduleRoot)
 	log.Debug("Module: %s.\n", moduleRoot)
 
-	moduleFile := module.ReadModuleFile(moduleRoot)
+	moduleFile, err := module.ReadModuleFile(moduleRoot)
+	if err != nil {
+		return err
+	}
 
 	var name string
 	if len(args) == 0 {
-		checkUrl(url)
+		if err := checkUrl(url); err != nil {
+			return err
+		}
 		name = urlRegexp.FindStringSubmatch(url)[1]
 	} else {
 		name = args[0]
 	}
-	checkName(name)
+	if err := checkName(name); err != nil {
+		return err
+	}
 
 	dep, exists := moduleFile.Dependencies[name]
-	if url != "" {
+	if url != "" && url != dep.URL {
 		dep.URL = url
+		dep.Hash = ""
 	}
-	if version != "" {
+	if version != "" && version != dep.Version {
 		dep.Version = version
+		dep.Hash = ""
 	}
 
-	checkUrl(dep.URL)
-	checkVersion(dep.Version)
+	if err := checkUrl(dep.URL); err != nil {
+		return err
+	}
+	if err := checkVersion(dep.Version); err != nil {
+		return err
+	}
 
 	moduleFile.Dependencies[name] = dep
-	module.WriteModuleFile(moduleRoot, moduleFile)
+	if err := module.WriteModuleFile(moduleRoot, moduleFile); err != nil {
+		return err
+	}
 
 	if exists {
 		log.Success("Updated dependency '%s' to module '%s'.\n", name, moduleName)
@@ -92,50 +146,246 @@ func runAdd(cmd *cobra.Command, args []string) {
 		log.Success("Added dependency '%s' to module '%s'.\n", name, moduleName)
 		log.Debug("Added dependency '%s' to module '%s': URL='%s', version='%s'.\n", name, moduleName, url, version)
 	}
+	return syncDependencies(cmd)
 }
 
-func runRemove(cmd *cobra.Command, args []string) {
-	moduleRoot := util.GetModuleRoot()
+func runRemove(cmd *cobra.Command, args []string) error {
+	moduleRoot, err := util.GetModuleRoot()
+	if err != nil {
+		return err
+	}
 	moduleName := path.Base(moduleRoot)
 	log.Debug("Module: '%s'.\n", moduleRoot)
 
-	moduleFile := module.ReadModuleFile(moduleRoot)
+	moduleFile, err := module.ReadModuleFile(moduleRoot)
+	if err != nil {
+		return err
+	}
 	name := args[0]
-	checkName(name)
+	if err := checkName(name); err != nil {
+		return err
+	}
 
 	if _, exists := moduleFile.Dependencies[name]; !exists {
 		log.Warning("Module '%s' has no dependency on module '%s'.\n", moduleName, name)
-		return
+		return nil
 	}
 
 	delete(moduleFile.Dependencies, name)
-	module.WriteModuleFile(moduleRoot, moduleFile)
+	if err := module.WriteModuleFile(moduleRoot, moduleFile); err != nil {
+		return err
+	}
 	log.Success("Removed dependency '%s' from module '%s'.\n", name, moduleName)
+	return syncDependencies(cmd)
 }
 
-func checkName(name string) {
+func runUpgrade(cmd *cobra.Command, args []string) error {
+	moduleRoot, err := util.GetModuleRoot()
+	if err != nil {
+		return err
+	}
+	moduleName := path.Base(moduleRoot)
+	log.Debug("Module: '%s'.\n", moduleRoot)
+
+	moduleFile, err := module.ReadModuleFile(moduleRoot)
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	dep, exists := moduleFile.Dependencies[name]
+	if !exists {
+		return log.Errorf("Module '%s' has no dependency on module '%s'.\n", moduleName, name)
+	}
+	if upgradeVersion != "" {
+		if err := checkVersion(upgradeVersion); err != nil {
+			return err
+		}
+		dep.Version = upgradeVersion
+	}
+
+	// Resolve the version string to the commit it currently points to.
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+	depModule, err := module.OpenOrCreateDependency(depModulePath, dep)
+	if err != nil {
+		return err
+	}
+	if _, err := depModule.Fetch(); err != nil {
+		return err
+	}
+	previousHash := dep.Hash
+	dep.Hash, err = depModule.RevParse(dep.Version)
+	if err != nil {
+		return err
+	}
+
+	moduleFile.Dependencies[name] = dep
+	if err := module.WriteModuleFile(moduleRoot, moduleFile); err != nil {
+		return err
+	}
+
+	if previousHash == dep.Hash {
+		log.Success("Dependency '%s' of module '%s' is already pinned to '%s'.\n", name, moduleName, shortHash(dep.Hash))
+	} else {
+		log.Success("Upgraded dependency '%s' of module '%s' from '%s' to '%s'.\n", name, moduleName, shortHash(previousHash), shortHash(dep.Hash))
+	}
+	return syncDependencies(cmd)
+}
+
+func runWhy(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+	if !util.DirExists(depModulePath) {
+		return util.Fail(util.DepsNotSynced, nil, "Module '%s' is not part of the workspace.\n", name)
+	}
+	depModule, err := module.OpenModule(depModulePath)
+	if err != nil {
+		return err
+	}
+	selectedHash, err := depModule.Head()
+	if err != nil {
+		return err
+	}
+
+	workspaceModule, err := module.OpenModule(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	modulePaths, err := workspaceModulePaths(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	for _, modulePath := range modulePaths {
+		moduleName := path.Base(modulePath)
+		moduleFile, err := module.ReadModuleFile(modulePath)
+		if err != nil {
+			return err
+		}
+		dep, exists := moduleFile.Dependencies[name]
+		if !exists {
+			continue
+		}
+		fmt.Printf("%s requires version '%s'", moduleName, dep.Version)
+		if dep.Hash != "" {
+			fmt.Printf(" (hash '%s')", shortHash(dep.Hash))
+		}
+		if moduleName == workspaceModule.Name() {
+			fmt.Printf(" [workspace pin]")
+		}
+		if dep.Hash != "" && dep.Hash != selectedHash {
+			fmt.Printf(" [not selected]")
+		}
+		fmt.Println()
+	}
+	fmt.Printf("\nSelected hash: '%s'\n", shortHash(selectedHash))
+	return nil
+}
+
+// workspaceModulePaths returns the paths of the workspace module and all modules in the DEPS/ directory.
+func workspaceModulePaths(workspaceRoot string) ([]string, error) {
+	paths := []string{workspaceRoot}
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	entries, err := ioutil.ReadDir(depsDir)
+	if err != nil {
+		return paths, nil
+	}
+	workspaceModule, err := module.OpenModule(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// Skip the symlink to the workspace module.
+		if entry.Name() != workspaceModule.Name() {
+			paths = append(paths, path.Join(depsDir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func completeWhyArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	completions := []string{}
+	if len(args) == 0 {
+		workspaceRoot, err := util.GetWorkspaceRoot()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		modulePaths, err := workspaceModulePaths(workspaceRoot)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		for _, modulePath := range modulePaths[1:] {
+			completions = append(completions, path.Base(modulePath))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// syncDependencies runs 'dbt sync' after a MODULE file has been changed, unless --no-sync was given.
+func syncDependencies(cmd *cobra.Command) error {
+	if noSync {
+		return nil
+	}
+	log.Log("\n")
+	return runSync(cmd, []string{})
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	if hash == "" {
+		return "none"
+	}
+	return hash
+}
+
+func checkName(name string) error {
 	if !nameRegexp.MatchString(name) {
-		log.Fatal("Module name '%s' does not match the expected format.\n", url)
+		return log.Errorf("Module name '%s' does not match the expected format.\n", name)
 	}
+	return nil
 }
 
-func checkUrl(url string) {
+func checkUrl(url string) error {
 	if !urlRegexp.MatchString(url) {
-		log.Fatal("URL '%s' does not match the expected format.\n", url)
+		return log.Errorf("URL '%s' does not match the expected format.\n", url)
 	}
+	return nil
 }
 
-func checkVersion(version string) {
+func checkVersion(version string) error {
 	if !versionRegexp.MatchString(version) {
-		log.Fatal("Version '%s' does not match the expected format.\n", version)
+		return log.Errorf("Version '%s' does not match the expected format.\n", version)
 	}
+	return nil
 }
 
 func completeDepArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	completions := []string{}
 	if len(args) == 0 {
-		moduleRoot := util.GetModuleRoot()
-		moduleFile := module.ReadModuleFile(moduleRoot)
+		moduleRoot, err := util.GetModuleRoot()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		moduleFile, err := module.ReadModuleFile(moduleRoot)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
 		for name := range moduleFile.Dependencies {
 			completions = append(completions, name)
 		}
@@ -0,0 +1,460 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var depsAnalyzeCmd = &cobra.Command{
+	Use:   "deps-analyze [patterns] [build flags] [--fix]",
+	Short: "Reports unused and missing dependencies of the targets",
+	Long: `Compares the headers that were actually included when building the targets (according to
+the ninja deps log) with the dependencies declared in the BUILD.go files. Reports declared
+dependencies that are never used and used headers whose owning target is not a dependency.
+The targets must have been built before with the same build flags. With --fix, the findings are
+applied to the Deps fields of the targets in their BUILD.go files.`,
+	RunE: runDepsAnalyze,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var depsAnalyzeFix bool
+
+func init() {
+	rootCmd.AddCommand(depsAnalyzeCmd)
+	depsAnalyzeCmd.Flags().BoolVar(&depsAnalyzeFix, "fix", false, "Apply the findings to the BUILD.go files")
+}
+
+func runDepsAnalyze(cmd *cobra.Command, args []string) error {
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "No targets specified.\n")
+	}
+	genInput.ListDependencies = true
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+	if !util.FileExists(path.Join(outputDir, ninjaFileName)) {
+		return log.Errorf("The targets have not been built yet. Run 'dbt build' with the same build flags first.\n")
+	}
+
+	// Determine which target owns each header.
+	owners := map[string]string{}
+	for name, target := range genOutput.Targets {
+		for _, header := range target.Headers {
+			owners[cleanBuildPath(outputDir, header)] = name
+		}
+	}
+
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+	sort.Strings(targets)
+	findings := 0
+	fixes := map[string][]depFix{}
+	for _, name := range targets {
+		target := genOutput.Targets[name]
+		if len(target.Objects) == 0 {
+			continue
+		}
+
+		headers, err := ninjaDeps(outputDir, target.Objects)
+		if err != nil {
+			return err
+		}
+		used := map[string]bool{}
+		for _, header := range headers {
+			if owner, exists := owners[cleanBuildPath(outputDir, header)]; exists && owner != name {
+				used[owner] = true
+			}
+		}
+
+		declared := map[string]bool{}
+		for _, dep := range target.Deps {
+			declared[dep] = true
+			// Only dependencies that own headers can be judged based on the included headers.
+			if !used[dep] && len(genOutput.Targets[dep].Headers) > 0 {
+				fmt.Printf("%s: remove dependency %s (unused)\n", targetID(name), targetID(dep))
+				fixes[path.Dir(name)] = append(fixes[path.Dir(name)], depFix{target: name, dep: dep, remove: true})
+				findings++
+			}
+		}
+		for _, dep := range sortMapKeys(used) {
+			if !declared[dep] {
+				fmt.Printf("%s: add dependency %s (headers used but not declared)\n", targetID(name), targetID(dep))
+				fixes[path.Dir(name)] = append(fixes[path.Dir(name)], depFix{target: name, dep: dep})
+				findings++
+			}
+		}
+	}
+
+	if findings == 0 {
+		log.Success("All dependencies are used and declared.\n")
+		return nil
+	}
+	if depsAnalyzeFix {
+		return applyDepFixes(fixes)
+	}
+	return nil
+}
+
+// depFix adds `dep` to or removes it from the dependencies of `target`.
+type depFix struct {
+	target string
+	dep    string
+	remove bool
+}
+
+func (fix depFix) String() string {
+	if fix.remove {
+		return fmt.Sprintf("remove dependency %s from %s", targetID(fix.dep), targetID(fix.target))
+	}
+	return fmt.Sprintf("add dependency %s to %s", targetID(fix.dep), targetID(fix.target))
+}
+
+// sourceEdit replaces the source between the offsets `start` and `end` with `text`.
+type sourceEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// applyDepFixes applies the `fixes` of each BUILD.go package to its BUILD.go file. Fixes that can
+// not be applied automatically are reported.
+func applyDepFixes(fixes map[string][]depFix) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modulePaths, err := module.GetAllModulePaths(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	applied := 0
+	files := 0
+	for _, pkg := range sortMapKeys(fixes) {
+		buildFilePath := packageBuildFile(pkg, modulePaths)
+		if buildFilePath == "" {
+			log.Warning("Could not find the module of package '%s'. Its dependencies must be fixed manually.\n", pkg)
+			continue
+		}
+		count, err := fixBuildFileDeps(buildFilePath, pkg, fixes[pkg], modulePaths)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			applied += count
+			files++
+		}
+	}
+	log.Success("Applied %d fixes to %d %s files.\n", applied, files, buildFileName)
+	return nil
+}
+
+// fixBuildFileDeps applies the `fixes` to the BUILD.go file of the package `pkg` and returns the
+// number of fixes that were applied. Dependencies are only edited in Deps fields of composite
+// literals assigned to top-level variables, and the file is formatted afterwards.
+func fixBuildFileDeps(buildFilePath, pkg string, fixes []depFix, modulePaths map[string]module.ModulePath) (int, error) {
+	src, err := util.ReadFile(buildFilePath)
+	if err != nil {
+		return 0, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, buildFilePath, src, parser.ParseComments)
+	if err != nil {
+		log.Warning("Failed to parse '%s': %s. Its dependencies must be fixed manually.\n", buildFilePath, err)
+		return 0, nil
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	// Determine the names under which the packages of dependencies are imported.
+	importNames := map[string]string{}
+	usedNames := map[string]bool{}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else if packageName := buildPackageName(importPath, modulePaths); packageName != "" {
+			name = packageName
+		}
+		importNames[importPath] = name
+		usedNames[name] = true
+	}
+
+	edits := []sourceEdit{}
+	newImports := []string{}
+	applied := 0
+	for _, fix := range fixes {
+		deps := targetDepsLiteral(file, path.Base(fix.target))
+		if deps == nil {
+			log.Warning("Could not %s: the target has no Deps field in '%s'.\n", fix, buildFilePath)
+			continue
+		}
+		depPkg, depVar := path.Dir(fix.dep), path.Base(fix.dep)
+
+		if fix.remove {
+			elt := findDepElement(deps, depVar, importNames[depPkg], depPkg == pkg)
+			if elt == nil {
+				log.Warning("Could not %s: the dependency is not listed literally in '%s'.\n", fix, buildFilePath)
+				continue
+			}
+			edits = append(edits, removeElementEdit(src, offset(elt.Pos()), offset(elt.End())))
+			applied++
+			continue
+		}
+
+		expr := depVar
+		if depPkg != pkg {
+			if !ast.IsExported(depVar) {
+				log.Warning("Could not %s: '%s' is not exported.\n", fix, depVar)
+				continue
+			}
+			name, imported := importNames[depPkg]
+			if !imported {
+				name = buildPackageName(depPkg, modulePaths)
+				if name == "" || usedNames[name] || file.Scope.Lookup(name) != nil {
+					log.Warning("Could not %s: the package '%s' can not be imported automatically.\n", fix, depPkg)
+					continue
+				}
+				importNames[depPkg] = name
+				usedNames[name] = true
+				newImports = append(newImports, depPkg)
+			}
+			expr = name + "." + depVar
+		}
+		for _, elt := range deps.Elts {
+			if unary, ok := elt.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+				expr = "&" + expr
+				break
+			}
+		}
+		edits = append(edits, appendElementEdit(src, deps, fset, expr))
+		applied++
+	}
+	if applied == 0 {
+		return 0, nil
+	}
+	if len(newImports) > 0 {
+		edits = append(edits, addImportsEdit(file, fset, newImports, importNames))
+	}
+
+	// Apply the edits from the end of the file, so that the offsets of earlier edits stay valid.
+	// Insertions at the same offset are applied in reverse, so that they end up in order.
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	fixed := append([]byte{}, src...)
+	for _, edit := range edits {
+		fixed = append(append(append([]byte{}, fixed[:edit.start]...), edit.text...), fixed[edit.end:]...)
+	}
+	formatted, err := format.Source(fixed)
+	if err != nil {
+		log.Warning("Failed to format '%s' after fixing its dependencies: %s. It was not changed.\n", buildFilePath, err)
+		return 0, nil
+	}
+	if err := util.WriteFile(buildFilePath, formatted); err != nil {
+		return 0, err
+	}
+	log.Debug("Fixed %d dependencies in '%s'.\n", applied, buildFilePath)
+	return applied, nil
+}
+
+// packageBuildFile returns the path of the BUILD.go file of the package `pkg`, whose first path
+// element is the name of its module, or an empty string if the module does not exist.
+func packageBuildFile(pkg string, modulePaths map[string]module.ModulePath) string {
+	parts := strings.SplitN(pkg, "/", 2)
+	modulePath, exists := modulePaths[parts[0]]
+	if !exists {
+		return ""
+	}
+	return path.Join(append([]string{modulePath.Path}, append(parts[1:], buildFileName)...)...)
+}
+
+// buildPackageName returns the package name declared by the BUILD.go file of the package `pkg`,
+// or an empty string if it can not be determined.
+func buildPackageName(pkg string, modulePaths map[string]module.ModulePath) string {
+	buildFilePath := packageBuildFile(pkg, modulePaths)
+	if buildFilePath == "" {
+		return ""
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), buildFilePath, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return file.Name.Name
+}
+
+// targetDepsLiteral returns the value of the Deps field of the composite literal assigned to the
+// top-level variable `varName`, or nil if there is none.
+func targetDepsLiteral(file *ast.File, varName string) *ast.CompositeLit {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for idx, name := range valueSpec.Names {
+				if name.Name != varName || idx >= len(valueSpec.Values) {
+					continue
+				}
+				value := valueSpec.Values[idx]
+				if unary, ok := value.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+					value = unary.X
+				}
+				literal, ok := value.(*ast.CompositeLit)
+				if !ok {
+					return nil
+				}
+				for _, elt := range literal.Elts {
+					field, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					if key, ok := field.Key.(*ast.Ident); ok && key.Name == "Deps" {
+						deps, _ := field.Value.(*ast.CompositeLit)
+						return deps
+					}
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// findDepElement returns the element of `deps` that refers to the variable `depVar`, which is
+// declared in the same package if `samePackage` and else in the package imported as `importName`.
+func findDepElement(deps *ast.CompositeLit, depVar, importName string, samePackage bool) ast.Expr {
+	for _, elt := range deps.Elts {
+		expr := elt
+		if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			expr = unary.X
+		}
+		switch expr := expr.(type) {
+		case *ast.Ident:
+			if samePackage && expr.Name == depVar {
+				return elt
+			}
+		case *ast.SelectorExpr:
+			if pkgIdent, ok := expr.X.(*ast.Ident); ok && !samePackage && pkgIdent.Name == importName && expr.Sel.Name == depVar {
+				return elt
+			}
+		}
+	}
+	return nil
+}
+
+// removeElementEdit removes the element between the offsets `start` and `end` of a composite
+// literal together with its trailing comma, and its line including a line comment if it has one of
+// its own.
+func removeElementEdit(src []byte, start, end int) sourceEdit {
+	rest := bytes.TrimLeft(src[end:], " \t")
+	if len(rest) > 0 && rest[0] == ',' {
+		end = len(src) - len(rest) + 1
+	}
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	lineEnd := bytes.IndexByte(src[end:], '\n')
+	if lineEnd >= 0 && len(bytes.TrimSpace(src[lineStart:start])) == 0 {
+		if trailing := bytes.TrimSpace(src[end : end+lineEnd]); len(trailing) == 0 || bytes.HasPrefix(trailing, []byte("//")) {
+			return sourceEdit{start: lineStart, end: end + lineEnd + 1}
+		}
+	}
+	return sourceEdit{start: start, end: end}
+}
+
+// appendElementEdit adds `expr` to the elements of the composite literal `deps`: at the end if the
+// literal spans several lines, else at the start, where it stays clear of removed elements.
+func appendElementEdit(src []byte, deps *ast.CompositeLit, fset *token.FileSet, expr string) sourceEdit {
+	if fset.Position(deps.Lbrace).Line != fset.Position(deps.Rbrace).Line {
+		lineStart := bytes.LastIndexByte(src[:fset.Position(deps.Rbrace).Offset], '\n') + 1
+		return sourceEdit{start: lineStart, end: lineStart, text: expr + ",\n"}
+	}
+	// gofmt removes the trailing comma of single-line literals.
+	lbrace := fset.Position(deps.Lbrace).Offset + 1
+	return sourceEdit{start: lbrace, end: lbrace, text: expr + ", "}
+}
+
+// addImportsEdit adds imports of the `importPaths` to `file` under the names in `importNames`.
+func addImportsEdit(file *ast.File, fset *token.FileSet, importPaths []string, importNames map[string]string) sourceEdit {
+	lines := ""
+	for _, importPath := range importPaths {
+		if name := importNames[importPath]; name != path.Base(importPath) {
+			lines += name + " "
+		}
+		lines += strconv.Quote(importPath) + "\n"
+	}
+	// The imports are added to the first import block or else after the last import.
+	end := file.Name.End()
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		if genDecl.Lparen.IsValid() {
+			offset := fset.Position(genDecl.Rparen).Offset
+			return sourceEdit{start: offset, end: offset, text: lines}
+		}
+		end = genDecl.End()
+	}
+	offset := fset.Position(end).Offset
+	return sourceEdit{start: offset, end: offset, text: "\n\nimport (\n" + lines + ")"}
+}
+
+// ninjaDeps returns all dependencies recorded in the ninja deps log for the given outputs.
+func ninjaDeps(dir string, outputs []string) ([]string, error) {
+	var stdout bytes.Buffer
+	if err := runNinja(dir, &stdout, append([]string{"-t", "deps"}, outputs...)); err != nil {
+		return nil, err
+	}
+
+	// The output lists "<output>: #deps N, ..." followed by one indented line per dependency.
+	deps := []string{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "    ") {
+			deps = append(deps, strings.TrimSpace(line))
+		}
+	}
+	return deps, nil
+}
+
+func cleanBuildPath(dir, p string) string {
+	if !path.IsAbs(p) {
+		p = path.Join(dir, p)
+	}
+	return path.Clean(p)
+}
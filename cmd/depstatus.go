@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+var depStatusCmd = &cobra.Command{
+	Use:   "status [--porcelain]",
+	Args:  cobra.NoArgs,
+	Short: "Shows the git state of all modules in the DEPS/ directory",
+	Long: `Shows for each module in the DEPS/ directory the checked out branch and commit, the number of
+files with uncommited changes, how many commits the branch is ahead of and behind its upstream
+branch and whether the checked out commit is the one pinned by the MODULE files. The pinned
+commit is the one pinned by the workspace MODULE file or, for indirect dependencies, one of the
+commits pinned by the modules requiring it.
+
+With --porcelain, one line of tab-separated fields is printed per module without a header:
+name, branch, commit, number of dirty files, commits ahead, commits behind and whether the
+commit is pinned ("yes", "no" or "-" if no commit is pinned). Unknown fields are printed as "-".`,
+	RunE: runDepStatus,
+}
+
+var depStatusPorcelain bool
+
+func init() {
+	depCmd.AddCommand(depStatusCmd)
+	depStatusCmd.Flags().BoolVar(&depStatusPorcelain, "porcelain", false, "Print tab-separated fields for scripts")
+}
+
+// depStatus is the state of a module in the DEPS/ directory. Unknown fields are "-".
+type depStatus struct {
+	name, branch, commit, dirty, ahead, behind, pinned string
+}
+
+// pinnedHashes returns the hashes of module `name` pinned by the workspace MODULE file or, if it
+// does not pin one, by any module of the workspace.
+func pinnedHashes(workspaceRoot, name string, modulePaths []string) ([]string, error) {
+	workspaceFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	if dep, exists := workspaceFile.Dependencies[name]; exists && dep.Hash != "" {
+		return []string{dep.Hash}, nil
+	}
+	hashes := []string{}
+	for _, modulePath := range modulePaths[1:] {
+		moduleFile, err := module.ReadModuleFile(modulePath)
+		if err != nil {
+			return nil, err
+		}
+		if dep, exists := moduleFile.Dependencies[name]; exists && dep.Hash != "" {
+			hashes = append(hashes, dep.Hash)
+		}
+	}
+	return hashes, nil
+}
+
+func readDepStatus(workspaceRoot, modulePath string, modulePaths []string) (depStatus, error) {
+	name := path.Base(modulePath)
+	mod, err := module.OpenModule(modulePath)
+	if err != nil {
+		return depStatus{}, err
+	}
+	head, err := mod.Head()
+	if err != nil {
+		return depStatus{}, err
+	}
+	status := depStatus{name: name, branch: "-", commit: head, dirty: "-", ahead: "-", behind: "-", pinned: "-"}
+
+	if gitModule, isGit := mod.(module.GitModule); isGit {
+		if branch := gitModule.Branch(); branch != "" {
+			status.branch = branch
+		}
+		dirtyFiles, err := gitModule.DirtyFiles()
+		if err != nil {
+			return depStatus{}, err
+		}
+		status.dirty = strconv.Itoa(len(dirtyFiles))
+		if ahead, behind, hasUpstream := gitModule.AheadBehind(); hasUpstream {
+			status.ahead, status.behind = strconv.Itoa(ahead), strconv.Itoa(behind)
+		}
+	}
+
+	hashes, err := pinnedHashes(workspaceRoot, name, modulePaths)
+	if err != nil {
+		return depStatus{}, err
+	}
+	if len(hashes) > 0 {
+		status.pinned = "no"
+		for _, hash := range hashes {
+			if hash == head {
+				status.pinned = "yes"
+			}
+		}
+	}
+	return status, nil
+}
+
+func runDepStatus(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modulePaths, err := workspaceModulePaths(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	statuses := []depStatus{}
+	for _, modulePath := range modulePaths[1:] {
+		status, err := readDepStatus(workspaceRoot, modulePath, modulePaths)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	if depStatusPorcelain {
+		for _, status := range statuses {
+			fmt.Println(strings.Join([]string{status.name, status.branch, status.commit, status.dirty, status.ahead, status.behind, status.pinned}, "\t"))
+		}
+		return nil
+	}
+
+	rows := [][]string{{"NAME", "BRANCH", "COMMIT", "DIRTY", "AHEAD", "BEHIND", "PINNED"}}
+	for _, status := range statuses {
+		rows = append(rows, []string{status.name, status.branch, shortHash(status.commit), status.dirty, status.ahead, status.behind, status.pinned})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for idx, field := range row {
+			if len(field) > widths[idx] {
+				widths[idx] = len(field)
+			}
+		}
+	}
+	for _, row := range rows {
+		line := []string{}
+		for idx, field := range row {
+			line = append(line, fmt.Sprintf("%-*s", widths[idx], field))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(line, "  "), " "))
+	}
+	return nil
+}
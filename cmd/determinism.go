@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const determinismDirName = "DETERMINISM"
+const determinismRecordsFileName = "determinism.json"
+const maxDeterminismRecords = 100
+
+// determinismScore counts the outputs of a rule that were bit-identical in two builds.
+type determinismScore struct {
+	Identical int
+	Total     int
+}
+
+func (score determinismScore) percentage() float64 {
+	return float64(score.Identical) * 100 / float64(score.Total)
+}
+
+// determinismRecord is the result of one 'dbt determinism' run.
+type determinismRecord struct {
+	Time    time.Time
+	Targets []string
+	// Rules maps the name of each ninja rule to its score.
+	Rules map[string]determinismScore
+}
+
+var determinismCmd = &cobra.Command{
+	Use:   "determinism [patterns] [build flags] [--sample=N]",
+	Short: "Scores how deterministic the outputs of each rule are",
+	Long: `Builds a random sample of the targets matching the patterns (all targets by default) twice
+from scratch and compares all outputs of all actions of both builds. Both builds use the same
+output directory, which is moved into BUILD/DETERMINISM/ after each build. For each ninja rule, the
+percentage of bit-identical outputs is printed, least deterministic rules first, next to the
+score of the previous run. The results are recorded, so that progress can be tracked over time.
+Stamping and the remote cache are disabled for both builds.`,
+	RunE: runDeterminism,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var determinismSampleSize int
+
+func init() {
+	rootCmd.AddCommand(determinismCmd)
+	determinismCmd.Flags().IntVar(&determinismSampleSize, "sample", 20, "Number of targets to build")
+	addSetFlag(determinismCmd)
+}
+
+func runDeterminism(cmd *cobra.Command, args []string) error {
+	args, err := withSetFlags(args)
+	if err != nil {
+		return err
+	}
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	genInput.PersistFlags = false
+	if len(patterns) == 0 {
+		patterns = []string{".*"}
+	}
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return log.Errorf("No targets match the given patterns.\n")
+	}
+	// A different sample is built by every run, so that repeated runs cover all targets.
+	rand.New(rand.NewSource(time.Now().UnixNano())).Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if determinismSampleSize > 0 && len(targets) > determinismSampleSize {
+		targets = targets[:determinismSampleSize]
+	}
+	sort.Strings(targets)
+
+	buildArgs, err := buildFlagArgs(args)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		buildArgs = append(buildArgs, targetID(target))
+	}
+	log.Log("Building %d targets twice.\n", len(targets))
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	determinismDir := path.Join(buildDir, determinismDirName)
+	digests, rules, err := buildTwice(buildArgs, path.Join(determinismDir, "build"), determinismDir)
+	if err != nil {
+		return err
+	}
+	removeDanglingOutputDirLinks(buildDir)
+
+	record := determinismRecord{Time: time.Now(), Targets: targetIDs(targets), Rules: map[string]determinismScore{}}
+	for output, digest := range digests[0] {
+		rule := rules[output]
+		if rule == "" || rule == "phony" {
+			continue
+		}
+		score := record.Rules[rule]
+		score.Total++
+		if digests[1][output] == digest {
+			score.Identical++
+		}
+		record.Rules[rule] = score
+	}
+	if len(record.Rules) == 0 {
+		return log.Errorf("The targets have no outputs to compare.\n")
+	}
+
+	stateDir, err := workspaceStateDir(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	recordsFilePath := path.Join(stateDir, determinismRecordsFileName)
+	records := []determinismRecord{}
+	if util.FileExists(recordsFilePath) {
+		if err := util.ReadJson(recordsFilePath, &records); err != nil {
+			return err
+		}
+	}
+	printDeterminismScoreboard(record, records)
+	records = append([]determinismRecord{record}, records...)
+	if len(records) > maxDeterminismRecords {
+		records = records[:maxDeterminismRecords]
+	}
+	return util.WriteJson(recordsFilePath, &records)
+}
+
+// buildFlagArgs returns the arguments in `args` that set build flags, including build configs.
+func buildFlagArgs(args []string) ([]string, error) {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return nil, err
+	}
+	flagArgs := []string{}
+	for _, arg := range args {
+		_, flags, err := parseArgs([]string{arg}, moduleFile.Configs)
+		if err != nil {
+			return nil, err
+		}
+		if len(flags) > 0 {
+			flagArgs = append(flagArgs, arg)
+		}
+	}
+	return flagArgs, nil
+}
+
+// outputDigests returns the SHA256 digests of all regular files in `outputDir` by relative path.
+func outputDigests(outputDir string) (map[string]string, error) {
+	digests := map[string]string{}
+	err := util.WalkSymlink(outputDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		digests[filePath[len(outputDir)+1:]] = fmt.Sprintf("%x", sha256.Sum256(data))
+		return nil
+	})
+	if err != nil {
+		return nil, log.Errorf("Failed to read the outputs in '%s': %s.\n", outputDir, err)
+	}
+	return digests, nil
+}
+
+// printDeterminismScoreboard prints the scores of `record`, least deterministic rules first, and
+// the most recent previous score of each rule.
+func printDeterminismScoreboard(record determinismRecord, previousRecords []determinismRecord) {
+	names := sortMapKeys(record.Rules)
+	sort.SliceStable(names, func(i, j int) bool {
+		return record.Rules[names[i]].percentage() < record.Rules[names[j]].percentage()
+	})
+
+	fmt.Printf("Determinism of %d targets:\n", len(record.Targets))
+	fmt.Printf("  %-30s %9s %8s %9s\n", "RULE", "IDENTICAL", "OUTPUTS", "PREVIOUS")
+	for _, name := range names {
+		score := record.Rules[name]
+		previous := "-"
+		for _, previousRecord := range previousRecords {
+			if previousScore, exists := previousRecord.Rules[name]; exists {
+				previous = fmt.Sprintf("%.1f%%", previousScore.percentage())
+				break
+			}
+		}
+		fmt.Printf("  %-30s %8.1f%% %8d %9s\n", name, score.percentage(), score.Total, previous)
+	}
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// Output directories not used within this number of days are reported as stale.
+const doctorStaleDays = 30
+
+var goVersionRegexp = regexp.MustCompile(`go(\d+)\.(\d+)`)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Args:  cobra.NoArgs,
+	Short: "Diagnoses problems with the environment and the workspace",
+	Long: `Checks that go, ninja and git are installed in supported versions and, when run inside a
+workspace, that the MODULE files are valid, all dependencies are present in DEPS/, there are no
+dangling symlinks in DEPS/, no two modules provide the same RULES package and no output
+directories are stale. For each problem, a fix is suggested.`,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorReport counts the problems found by 'dbt doctor'.
+type doctorReport struct {
+	problems int
+	warnings int
+}
+
+func (report *doctorReport) ok(format string, a ...interface{}) {
+	log.Success(format, a...)
+}
+
+func (report *doctorReport) problem(fix, format string, a ...interface{}) {
+	report.problems++
+	log.Error(format, a...)
+	log.Log("  Fix: %s\n", fix)
+}
+
+func (report *doctorReport) warning(fix, format string, a ...interface{}) {
+	report.warnings++
+	log.Warning(format, a...)
+	log.Log("  Fix: %s\n", fix)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	report := &doctorReport{}
+	checkGo(report)
+	checkNinja(report)
+	checkGit(report)
+
+	if workspaceRoot, err := util.FindWorkspaceRoot(); err != nil {
+		log.Log("Not inside a workspace. Skipping the workspace checks.\n")
+	} else {
+		log.Log("Checking workspace '%s'.\n", workspaceRoot)
+		checkWorkspace(report, workspaceRoot)
+	}
+
+	if report.problems > 0 {
+		return log.Errorf("Found %d problems and %d warnings.\n", report.problems, report.warnings)
+	}
+	if report.warnings > 0 {
+		log.Warning("Found %d warnings.\n", report.warnings)
+		return nil
+	}
+	log.Success("No problems found.\n")
+	return nil
+}
+
+func checkGo(report *doctorReport) {
+	installFix := fmt.Sprintf("Install go >= %d.%d from https://go.dev/dl/ and make sure it is in PATH.", dbt.GoMajorVersion, dbt.GoMinorVersion)
+	if _, err := exec.LookPath("go"); err != nil {
+		report.problem(installFix, "Could not find go.\n")
+		return
+	}
+	output, err := exec.Command("go", "version").Output()
+	matches := goVersionRegexp.FindStringSubmatch(string(output))
+	if err != nil || matches == nil {
+		report.problem(installFix, "Failed to determine the version of go.\n")
+		return
+	}
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	if major < dbt.GoMajorVersion || (major == dbt.GoMajorVersion && minor < dbt.GoMinorVersion) {
+		report.problem(installFix, "Found go %d.%d, but DBT requires go >= %d.%d.\n", major, minor, dbt.GoMajorVersion, dbt.GoMinorVersion)
+		return
+	}
+	report.ok("Found go %d.%d.\n", major, minor)
+}
+
+func checkNinja(report *doctorReport) {
+	bin := findNinjaBin()
+	if bin == "" {
+		if config.GetConfig().NinjaDownload {
+			log.Log("Could not find ninja. Ninja %s will be downloaded by the first build.\n", pinnedNinjaVersion)
+			return
+		}
+		report.problem("Install ninja or set 'ninja-bin' in the DBT configuration file.", "Could not find ninja.\n")
+		return
+	}
+	versionString, supported, err := ninjaVersion(bin)
+	if err != nil {
+		report.problem("Check that 'ninja-bin' in the DBT configuration file points to a ninja binary.", "Failed to determine the version of ninja: %s.\n", err)
+		return
+	}
+	if !supported {
+		report.problem(fmt.Sprintf("Install ninja >= %d.%d.%d.", minNinjaVersion[0], minNinjaVersion[1], minNinjaVersion[2]),
+			"'%s' has version %s, which is not supported.\n", bin, versionString)
+		return
+	}
+	report.ok("Found ninja %s at '%s'.\n", versionString, bin)
+}
+
+func checkGit(report *doctorReport) {
+	output, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		report.problem("Install git and make sure it is in PATH.", "Could not find git.\n")
+		return
+	}
+	report.ok("Found %s.\n", strings.TrimSpace(string(output)))
+}
+
+func checkWorkspace(report *doctorReport, workspaceRoot string) {
+	if module.IsQuickstartWorkspace(workspaceRoot) {
+		report.ok("The workspace is a quickstart workspace without a MODULE file.\n")
+		checkStaleOutputDirs(report, workspaceRoot)
+		return
+	}
+
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	modulePaths := map[string]string{path.Base(workspaceRoot): workspaceRoot}
+	healthy := true
+	entries, _ := ioutil.ReadDir(depsDir)
+	for _, entry := range entries {
+		entryPath := path.Join(depsDir, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if _, err := os.Stat(entryPath); err != nil {
+				target, _ := os.Readlink(entryPath)
+				report.problem(fmt.Sprintf("Remove '%s' and run 'dbt sync'.", entryPath), "'%s/%s' is a dangling symlink to '%s'.\n", util.DepsDirName, entry.Name(), target)
+				healthy = false
+				continue
+			}
+		} else if !entry.IsDir() {
+			continue
+		}
+		modulePaths[entry.Name()] = entryPath
+	}
+
+	for _, name := range sortMapKeys(modulePaths) {
+		moduleFile, ok := checkModuleFile(report, name, modulePaths[name])
+		if !ok {
+			healthy = false
+			continue
+		}
+		for _, depName := range sortMapKeys(moduleFile.Dependencies) {
+			if !util.DirExists(path.Join(depsDir, depName)) {
+				report.problem("Run 'dbt sync'.", "Module '%s' depends on '%s', which is missing in %s/.\n", name, depName, util.DepsDirName)
+				healthy = false
+			}
+		}
+	}
+	if !util.DirExists(path.Join(depsDir, dbtRulesDirName)) {
+		report.problem(fmt.Sprintf("Add '%s' as a dependency with 'dbt dep add' and run 'dbt sync'.", dbtRulesDirName), "%s/ does not contain %s.\n", util.DepsDirName, dbtRulesDirName)
+		healthy = false
+	}
+
+	if healthy {
+		report.ok("All %d modules are present and their MODULE files are valid.\n", len(modulePaths))
+		checkRulesConflicts(report, workspaceRoot)
+	}
+	checkStaleOutputDirs(report, workspaceRoot)
+}
+
+// checkModuleFile checks that the MODULE file of a module (if any) can be parsed by this version of DBT.
+func checkModuleFile(report *doctorReport, name, modulePath string) (module.ModuleFile, bool) {
+	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
+	if !util.FileExists(moduleFilePath) {
+		return module.ModuleFile{}, true
+	}
+	var moduleFileVersion struct {
+		Version uint
+	}
+	data, err := util.ReadFile(moduleFilePath)
+	if err != nil {
+		report.problem(fmt.Sprintf("Check the permissions of '%s'.", moduleFilePath), "%s.\n", err)
+		return module.ModuleFile{}, false
+	}
+	if err := yaml.Unmarshal(data, &moduleFileVersion); err != nil {
+		report.problem(fmt.Sprintf("Fix the syntax of '%s'.", moduleFilePath), "The MODULE file of module '%s' is invalid: %s.\n", name, err)
+		return module.ModuleFile{}, false
+	}
+	if moduleFileVersion.Version > util.DbtVersion[1] {
+		report.problem("Run 'dbt upgrade'.", "The MODULE file of module '%s' has version %d, which requires a newer version of DBT.\n", name, moduleFileVersion.Version)
+		return module.ModuleFile{}, false
+	}
+	moduleFile, err := module.ReadModuleFile(modulePath)
+	if err != nil {
+		report.problem(fmt.Sprintf("Fix '%s'.", moduleFilePath), "The MODULE file of module '%s' is invalid: %s.\n", name, err)
+		return module.ModuleFile{}, false
+	}
+	return moduleFile, true
+}
+
+// checkRulesConflicts reports RULES packages that are provided by more than one module.
+func checkRulesConflicts(report *doctorReport, workspaceRoot string) {
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		report.problem("Run 'dbt sync'.", "%s.\n", err)
+		return
+	}
+	providers := map[string]map[string]bool{}
+	for name, mod := range modules {
+		rules, err := module.ListRules(mod)
+		if err != nil {
+			report.problem(fmt.Sprintf("Check the %s directory of module '%s'.", rulesDirName, name), "%s.\n", err)
+			continue
+		}
+		for _, file := range rules {
+			pkg := path.Dir(file.CopyPath)
+			if providers[pkg] == nil {
+				providers[pkg] = map[string]bool{}
+			}
+			providers[pkg][name] = true
+		}
+	}
+
+	conflicts := 0
+	for _, pkg := range sortMapKeys(providers) {
+		if len(providers[pkg]) < 2 {
+			continue
+		}
+		modules := sortMapKeys(providers[pkg])
+		report.problem("Rename the package in all but one of the modules.", "%s package '%s' is provided by the modules '%s'.\n", rulesDirName, pkg, strings.Join(modules, "', '"))
+		conflicts++
+	}
+	if conflicts == 0 {
+		report.ok("No two modules provide the same %s package.\n", rulesDirName)
+	}
+}
+
+func checkStaleOutputDirs(report *doctorReport, workspaceRoot string) {
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	if !util.DirExists(buildDir) {
+		return
+	}
+	stale, err := staleOutputDirs(buildDir, time.Now().AddDate(0, 0, -doctorStaleDays), "")
+	if err != nil {
+		report.problem(fmt.Sprintf("Check the permissions of '%s'.", buildDir), "%s.\n", err)
+		return
+	}
+	if len(stale) == 0 {
+		report.ok("There are no stale output directories.\n")
+		return
+	}
+	size := int64(0)
+	for _, outputDir := range stale {
+		size += dirSize(outputDir)
+	}
+	report.warning(fmt.Sprintf("Run 'dbt gc --days=%d' to remove them.", doctorStaleDays),
+		"%d output directories (%s) have not been used within %d days.\n", len(stale), formatSize(size), doctorStaleDays)
+}
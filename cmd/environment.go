@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const hermeticHomeDirName = "home"
+
+// PATH of hermetic builds unless 'path' is configured.
+var defaultHermeticPath = []string{"/usr/local/bin", "/usr/bin", "/bin"}
+
+// Variables pinned in hermetic builds unless configured otherwise.
+var defaultHermeticVars = map[string]string{
+	"LC_ALL": "C",
+	"TZ":     "UTC",
+}
+
+// Variables that hermetic builds always inherit, because they only affect how ninja reports
+// progress. Credentials of the remote cache are passed to its wrappers in a file instead.
+var hermeticPassPrefixes = []string{"NINJA_STATUS", "TERM"}
+
+// ninjaEnvironment returns the environment that ninja runs in with the output directory `dir`.
+// Unless the MODULE file configures a hermetic environment, it is the environment of DBT with
+// the configured PATH and pinned variables.
+func ninjaEnvironment(dir string) ([]string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	config := moduleFile.Environment
+
+	env := map[string]string{}
+	inherited := map[string]string{}
+	for _, entry := range os.Environ() {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			inherited[parts[0]] = parts[1]
+		}
+	}
+
+	pathDirs := config.Path
+	if config.Hermetic {
+		for name, value := range inherited {
+			if isPassedToHermeticBuilds(name, config.Pass) {
+				env[name] = value
+			}
+		}
+		for name, value := range defaultHermeticVars {
+			env[name] = value
+		}
+		// Commands that read or write files in HOME get an empty directory of their own.
+		homeDir := path.Join(dir, hermeticHomeDirName)
+		if err := util.MkdirAll(homeDir); err != nil {
+			return nil, err
+		}
+		env["HOME"] = homeDir
+		if len(pathDirs) == 0 {
+			pathDirs = defaultHermeticPath
+		}
+	} else {
+		env = inherited
+	}
+
+	if len(pathDirs) > 0 {
+		resolved := []string{}
+		for _, pathDir := range pathDirs {
+			if !path.IsAbs(pathDir) {
+				pathDir = path.Join(workspaceRoot, pathDir)
+			}
+			resolved = append(resolved, pathDir)
+		}
+		env["PATH"] = strings.Join(resolved, ":")
+	}
+	for name, value := range config.Vars {
+		env[name] = value
+	}
+
+	entries := []string{}
+	for _, name := range sortMapKeys(env) {
+		entries = append(entries, fmt.Sprintf("%s=%s", name, env[name]))
+	}
+	return entries, nil
+}
+
+func isPassedToHermeticBuilds(name string, pass []string) bool {
+	for _, passed := range pass {
+		if name == passed {
+			return true
+		}
+	}
+	for _, prefix := range hermeticPassPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// environmentDigest returns a digest of the parts of the environment of ninja in `dir` that the
+// MODULE file configures: the whole environment of hermetic builds except the variables that only
+// affect progress reporting, and otherwise the configured PATH and variables. It returns an empty
+// string if the MODULE file does not configure the environment.
+func environmentDigest(dir string) (string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	config := moduleFile.Environment
+	if !config.Hermetic && len(config.Path) == 0 && len(config.Vars) == 0 {
+		return "", nil
+	}
+	env, err := ninjaEnvironment(dir)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, entry := range env {
+		name := strings.SplitN(entry, "=", 2)[0]
+		_, configured := config.Vars[name]
+		// HOME of hermetic builds is an empty directory in the build directory.
+		hermetic := config.Hermetic && name != "HOME" && !isPassedToHermeticBuilds(name, nil)
+		if hermetic || configured || (name == "PATH" && len(config.Path) > 0) {
+			// Workspaces in different locations get the same digest, so that they share remote cache entries.
+			fmt.Fprintln(hash, strings.ReplaceAll(entry, workspaceRoot, remoteCacheWorkspacePlaceholder))
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16], nil
+}
+
+// environmentDigestRegexp matches the no-op that addEnvironmentDigest prefixes commands with.
+var environmentDigestRegexp = regexp.MustCompile(`^: dbt-env-[0-9a-f]+; `)
+
+// addEnvironmentDigest prefixes all commands in `ninjaFile` with a no-op that contains `digest`, so
+// that ninja reruns all actions when the configured environment changes.
+func addEnvironmentDigest(ninjaFile, digest string) string {
+	lines := strings.Split(ninjaFile, "\n")
+	for idx, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == line || (idx > 0 && continuesOnNextLine(lines[idx-1])) {
+			continue
+		}
+		parts := strings.SplitN(trimmed, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "command" {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		lines[idx] = fmt.Sprintf("%scommand = : dbt-env-%s; %s", indent, digest, strings.TrimLeft(parts[1], " "))
+	}
+	return strings.Join(lines, "\n")
+}
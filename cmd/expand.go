@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// Maximum depth of nested variable references that are expanded in commands.
+const maxNinjaExpansionDepth = 32
+
+var expandCmd = &cobra.Command{
+	Use:   "expand patterns [build flags] [--deps]",
+	Short: "Prints the ninja build statements generated for targets",
+	Long: `Prints the ninja build statements that produce the outputs of the targets, the rules they use
+and the global variables they reference, followed by the fully expanded command line of each
+build statement. Phony build statements are followed to the statements they stand for. With
+--deps, the build statements of all dependencies are printed as well. The ninja file is not
+written and nothing is built.`,
+	RunE: runExpand,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var expandDeps bool
+
+func init() {
+	rootCmd.AddCommand(expandCmd)
+	expandCmd.Flags().BoolVar(&expandDeps, "deps", false, "Print the build statements of all dependencies as well")
+	addSetFlag(expandCmd)
+}
+
+// ninjaEdge is a build statement of a ninja file with its evaluated paths.
+type ninjaEdge struct {
+	statement ninjaStatement
+	rule      string
+	outputs   []string
+	// inputs are the explicit inputs, deps also contain implicit and order-only inputs.
+	inputs []string
+	deps   []string
+	// vars are the bindings of the build statement evaluated in the file scope.
+	vars map[string]string
+}
+
+func runExpand(cmd *cobra.Command, args []string) error {
+	args, err := withSetFlags(args)
+	if err != nil {
+		return err
+	}
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "No targets specified.\n")
+	}
+	genInput.PersistFlags = false
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+	if err := checkArgs(patterns, nil, modeBuild, genOutput.Targets, genOutput.Flags); err != nil {
+		return err
+	}
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+
+	globals, rules, edges := parseNinjaEdges(genOutput.NinjaFile)
+	producers := map[string]int{}
+	for idx, edge := range edges {
+		for _, output := range edge.outputs {
+			producers[path.Clean(output)] = idx
+		}
+	}
+
+	// Collect the build statements producing the targets and, transitively, their dependencies.
+	selected := map[int]bool{}
+	queue := []string{}
+	for _, name := range targets {
+		queue = append(queue, name)
+		for _, output := range genOutput.Targets[name].Outputs {
+			queue = append(queue, output, strings.TrimPrefix(output, outputDir+"/"))
+		}
+	}
+	for len(queue) > 0 {
+		node := path.Clean(queue[0])
+		queue = queue[1:]
+		idx, exists := producers[node]
+		if !exists || selected[idx] {
+			continue
+		}
+		selected[idx] = true
+		if expandDeps {
+			queue = append(queue, edges[idx].deps...)
+		} else if edges[idx].rule == "phony" {
+			queue = append(queue, edges[idx].inputs...)
+		}
+	}
+	if len(selected) == 0 {
+		return log.Errorf("The ninja file contains no build statements for the targets.\n")
+	}
+
+	indices := []int{}
+	for idx := range selected {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	printExpandedEdges(indices, edges, rules, globals)
+	return nil
+}
+
+// parseNinjaEdges returns the global variables, the rules and the build statements of `ninjaFile`.
+func parseNinjaEdges(ninjaFile string) (map[string]string, map[string]ninjaStatement, []ninjaEdge) {
+	globals := map[string]string{}
+	rules := map[string]ninjaStatement{}
+	edges := []ninjaEdge{}
+	for _, statement := range parseNinjaFile(ninjaFile) {
+		switch statement.kind {
+		case "let":
+			parts := strings.SplitN(statement.text, "=", 2)
+			if len(parts) == 2 {
+				globals[strings.TrimSpace(parts[0])] = expandNinjaText(strings.TrimLeft(parts[1], " "), globals)
+			}
+		case "rule":
+			rules[statement.text] = statement
+		case "build":
+			edges = append(edges, newNinjaEdge(statement, globals))
+		}
+	}
+	return globals, rules, edges
+}
+
+func newNinjaEdge(statement ninjaStatement, globals map[string]string) ninjaEdge {
+	edge := ninjaEdge{statement: statement, vars: map[string]string{}}
+	for _, binding := range statement.bindings {
+		edge.vars[binding.key] = expandNinjaText(binding.value, globals)
+	}
+	scope := map[string]string{}
+	for name, value := range globals {
+		scope[name] = value
+	}
+	for name, value := range edge.vars {
+		scope[name] = value
+	}
+
+	outputs, inputs := splitBuildStatement(statement.text)
+	for _, output := range evaluateNinjaPaths(outputs, scope) {
+		if output != "|" {
+			edge.outputs = append(edge.outputs, output)
+		}
+	}
+	// Explicit outputs are the ones before '|', explicit inputs the ones before '|' or '||'.
+	inputPaths := evaluateNinjaPaths(inputs, scope)
+	if len(inputPaths) > 0 {
+		edge.rule = inputPaths[0]
+		inputPaths = inputPaths[1:]
+	}
+	explicit := true
+	for _, input := range inputPaths {
+		if input == "|" || input == "||" {
+			explicit = false
+			continue
+		}
+		if explicit {
+			edge.inputs = append(edge.inputs, input)
+		}
+		edge.deps = append(edge.deps, input)
+	}
+	return edge
+}
+
+// explicitOutputs returns the outputs of `edge` that are listed before '|'.
+func (edge ninjaEdge) explicitOutputs(globals map[string]string) []string {
+	outputs, _ := splitBuildStatement(edge.statement.text)
+	scope := map[string]string{}
+	for name, value := range globals {
+		scope[name] = value
+	}
+	for name, value := range edge.vars {
+		scope[name] = value
+	}
+	explicit := []string{}
+	for _, output := range evaluateNinjaPaths(outputs, scope) {
+		if output == "|" {
+			break
+		}
+		explicit = append(explicit, output)
+	}
+	return explicit
+}
+
+// expandedCommand returns the command of `edge` with all variables expanded as ninja would.
+func (edge ninjaEdge) expandedCommand(rule ninjaStatement, globals map[string]string) string {
+	ruleVars := map[string]string{}
+	for _, binding := range rule.bindings {
+		ruleVars[binding.key] = binding.value
+	}
+	var lookup func(name string, depth int) string
+	lookup = func(name string, depth int) string {
+		switch name {
+		case "in":
+			return strings.Join(shellEscapePaths(edge.inputs), " ")
+		case "in_newline":
+			return strings.Join(shellEscapePaths(edge.inputs), "\n")
+		case "out":
+			return strings.Join(shellEscapePaths(edge.explicitOutputs(globals)), " ")
+		}
+		if value, exists := edge.vars[name]; exists {
+			return value
+		}
+		if value, exists := ruleVars[name]; exists && depth < maxNinjaExpansionDepth {
+			return expandNinjaTextFunc(value, func(name string) string { return lookup(name, depth+1) })
+		}
+		return globals[name]
+	}
+	return lookup("command", 0)
+}
+
+// shellEscapePaths quotes paths with characters that are special to the shell like ninja does
+// when it expands $in and $out. Empty strings are quoted as well.
+func shellEscapePaths(paths []string) []string {
+	escaped := []string{}
+	for _, p := range paths {
+		if p == "" || strings.Trim(p, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+-./") != "" {
+			p = "'" + strings.ReplaceAll(p, "'", `'\''`) + "'"
+		}
+		escaped = append(escaped, p)
+	}
+	return escaped
+}
+
+// expandNinjaText evaluates `text` with the variables `vars`. Escaped spaces, colons and dollar
+// signs are unescaped.
+func expandNinjaText(text string, vars map[string]string) string {
+	return expandNinjaTextFunc(text, func(name string) string { return vars[name] })
+}
+
+func expandNinjaTextFunc(text string, lookup func(string) string) string {
+	var result strings.Builder
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case c != '$' || idx+1 == len(text):
+			result.WriteByte(c)
+		case text[idx+1] == '{' && strings.IndexByte(text[idx:], '}') > 0:
+			end := idx + strings.IndexByte(text[idx:], '}')
+			result.WriteString(lookup(text[idx+2 : end]))
+			idx = end
+		case isNinjaVariableChar(text[idx+1]):
+			end := idx + 1
+			for end < len(text) && isNinjaVariableChar(text[end]) {
+				end++
+			}
+			result.WriteString(lookup(text[idx+1 : end]))
+			idx = end - 1
+		default:
+			result.WriteByte(text[idx+1])
+			idx++
+		}
+	}
+	return result.String()
+}
+
+// printExpandedEdges prints the global variables and rules referenced by the build statements
+// `indices` of `edges`, followed by the build statements and their expanded commands.
+func printExpandedEdges(indices []int, edges []ninjaEdge, rules map[string]ninjaStatement, globals map[string]string) {
+	usedRules := map[string]bool{}
+	usedGlobals := map[string]bool{}
+	addRefs := func(text string, locals map[string]string) {
+		names, _ := ninjaVariableRefs(text)
+		for _, name := range names {
+			if _, isLocal := locals[name]; !isLocal && !ninjaBuiltinVariables[name] {
+				if _, isGlobal := globals[name]; isGlobal {
+					usedGlobals[name] = true
+				}
+			}
+		}
+	}
+	for _, idx := range indices {
+		edge := edges[idx]
+		addRefs(edge.statement.text, edge.vars)
+		for _, binding := range edge.statement.bindings {
+			addRefs(binding.value, nil)
+		}
+		if rule, exists := rules[edge.rule]; exists {
+			usedRules[edge.rule] = true
+			ruleVars := map[string]string{}
+			for _, binding := range rule.bindings {
+				ruleVars[binding.key] = binding.value
+			}
+			for name, value := range edge.vars {
+				ruleVars[name] = value
+			}
+			for _, binding := range rule.bindings {
+				addRefs(binding.value, ruleVars)
+			}
+		}
+	}
+
+	for _, name := range sortMapKeys(usedGlobals) {
+		fmt.Printf("%s = %s\n", name, globals[name])
+	}
+	for _, name := range sortMapKeys(usedRules) {
+		rule := rules[name]
+		fmt.Printf("\n# line %d\nrule %s\n", rule.line, name)
+		for _, binding := range rule.bindings {
+			fmt.Printf("  %s = %s\n", binding.key, binding.value)
+		}
+	}
+	for _, idx := range indices {
+		edge := edges[idx]
+		fmt.Printf("\n# line %d\nbuild %s\n", edge.statement.line, edge.statement.text)
+		for _, binding := range edge.statement.bindings {
+			fmt.Printf("  %s = %s\n", binding.key, binding.value)
+		}
+		if rule, exists := rules[edge.rule]; exists {
+			fmt.Printf("# command: %s\n", edge.expandedCommand(rule, globals))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var fixPermsCmd = &cobra.Command{
+	Use:   "fix-perms",
+	Args:  cobra.NoArgs,
+	Short: "Normalizes the permissions of all build results",
+	Long: `Normalizes the permissions of all files in the BUILD/ directory and reports
+files that are owned by other users (e.g., root-owned leftovers of container builds).`,
+	RunE: runFixPerms,
+}
+
+func init() {
+	rootCmd.AddCommand(fixPermsCmd)
+}
+
+func runFixPerms(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	if !util.DirExists(buildDir) {
+		log.Success("There is no %s/ directory. Nothing to do.\n", buildDirName)
+		return nil
+	}
+
+	normalizeBuildPermissions(buildDir)
+	if !checkForeignFiles(buildDir) {
+		return log.Errorf("Some files could not be fixed.\n")
+	}
+	log.Success("Done.\n")
+	return nil
+}
+
+// normalizeBuildPermissions applies the configured file modes to all files in `dir`.
+func normalizeBuildPermissions(dir string) {
+	perms := config.GetConfig().Permissions
+	log.Debug("Normalizing permissions in '%s' (executables: %o, data: %o).\n", dir, perms.Executable, perms.Data)
+	err := util.NormalizePermissions(dir, os.FileMode(perms.Executable), os.FileMode(perms.Data))
+	if err != nil {
+		log.Warning("Failed to normalize permissions in '%s': %s.\n", dir, err)
+	}
+}
+
+// checkForeignFiles warns about files in `dir` that are owned by other users and reports
+// whether there are none.
+func checkForeignFiles(dir string) bool {
+	foreign, err := util.FindForeignFiles(dir)
+	if err != nil {
+		log.Warning("Failed to check file ownership in '%s': %s.\n", dir, err)
+		return true
+	}
+	if len(foreign) == 0 {
+		return true
+	}
+
+	const maxListed = 10
+	listed := foreign
+	if len(listed) > maxListed {
+		listed = listed[:maxListed]
+	}
+	log.Warning("Found %d files owned by other users (e.g., from a build running as root inside a container):\n  %s\n", len(foreign), strings.Join(listed, "\n  "))
+	log.Log("Run 'sudo chown -R %d:%d %s' to take ownership of these files.\n", os.Getuid(), os.Getgid(), dir)
+	return false
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var flagsCmd = &cobra.Command{
+	Use:   "flags [build flags] [--config=NAME]",
+	Short: "Lists all build flags and their values",
+	Long: `Lists all build flags with their current and default values and where the current value
+comes from. Build flags given as arguments and the flags of the build config selected with
+--config are taken into account, just like for 'dbt build'.`,
+	RunE: runFlags,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var flagsConfig string
+
+func init() {
+	rootCmd.AddCommand(flagsCmd)
+	flagsCmd.Flags().StringVar(&flagsConfig, "config", "", "Show the flags of build config NAME")
+	flagsCmd.RegisterFlagCompletionFunc("config", completeConfigNames)
+}
+
+func runFlags(cmd *cobra.Command, args []string) error {
+	if flagsConfig != "" {
+		args = append(args, fmt.Sprintf("%s=%s", configFlagName, flagsConfig))
+	}
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if len(patterns) > 0 {
+		log.Warning("Ignoring target patterns: %s.\n", strings.Join(patterns, " "))
+	}
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+
+	for _, name := range sortMapKeys(genOutput.Flags) {
+		flag := genOutput.Flags[name]
+		fmt.Printf("%s='%s' [%s]", name, flag.Value, flag.Type)
+		if flag.Source != "" {
+			fmt.Printf(" (%s)", flag.Source)
+		}
+		if flag.Source != "default" && flag.Default != "" && flag.Default != flag.Value {
+			fmt.Printf(" default='%s'", flag.Default)
+		}
+		if len(flag.AllowedValues) > 0 {
+			fmt.Printf(" ('%s')", strings.Join(flag.AllowedValues, "', '"))
+		}
+		if flag.Description != "" {
+			fmt.Printf(" // %s", flag.Description)
+		}
+		fmt.Println()
+	}
+
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	relOutputDir, err := filepath.Rel(workingDir, outputDir)
+	if err != nil {
+		relOutputDir = outputDir
+	}
+	fmt.Printf("\nOutput directory: %s\n", relOutputDir)
+	return nil
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const testHistoryFileName = "test-history.json"
+
+// Number of runs per test that are recorded and that flakiness scores are computed from.
+const maxTestRuns = 50
+
+// Number of runs a test needs before it can be quarantined unless 'min-runs' is configured.
+const defaultFlakyMinRuns = 10
+
+type testRun struct {
+	Time   time.Time
+	Passed bool
+}
+
+// testHistory maps the ID of each test to its most recent runs, oldest first.
+type testHistory map[string][]testRun
+
+var reportFlaky bool
+var includeQuarantined bool
+
+func testHistoryFilePath() (string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	stateDir, err := workspaceStateDir(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(stateDir, testHistoryFileName), nil
+}
+
+func readTestHistory() (testHistory, error) {
+	filePath, err := testHistoryFilePath()
+	if err != nil {
+		return nil, err
+	}
+	history := testHistory{}
+	if util.FileExists(filePath) {
+		if err := util.ReadJson(filePath, &history); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// recordTestResults records the results of the tests among `actions` executed by the last ninja
+// run. Tests that did not run (e.g., because ninja stopped after another failure) are not recorded.
+func recordTestResults(targets []string, actions []action) error {
+	tests := map[string]string{}
+	for _, name := range targets {
+		tests[name+"#test"] = targetID(name)
+	}
+	now := time.Now()
+	history, err := readTestHistory()
+	if err != nil {
+		return err
+	}
+	recorded := false
+	for _, action := range actions {
+		for _, output := range action.Outputs {
+			id, isTest := tests[output]
+			if !isTest {
+				continue
+			}
+			runs := append(history[id], testRun{Time: now, Passed: !action.Failed})
+			if len(runs) > maxTestRuns {
+				runs = runs[len(runs)-maxTestRuns:]
+			}
+			history[id] = runs
+			recorded = true
+		}
+	}
+	if !recorded {
+		return nil
+	}
+	filePath, err := testHistoryFilePath()
+	if err != nil {
+		return err
+	}
+	return util.WriteJson(filePath, &history)
+}
+
+// flakinessScore returns the fraction of consecutive `runs` with different results. Tests that
+// always pass or always fail have a score of 0, tests that alternate between passing and failing
+// have a score of 1.
+func flakinessScore(runs []testRun) float64 {
+	if len(runs) < 2 {
+		return 0
+	}
+	flips := 0
+	for idx := 1; idx < len(runs); idx++ {
+		if runs[idx].Passed != runs[idx-1].Passed {
+			flips++
+		}
+	}
+	return float64(flips) / float64(len(runs)-1)
+}
+
+// isQuarantined reports whether the test `id` with `runs` is quarantined by `config`.
+func isQuarantined(id string, runs []testRun, config module.FlakyTests) bool {
+	if config.QuarantineThreshold <= 0 {
+		return false
+	}
+	for _, allowed := range config.Allowlist {
+		if targetID(allowed) == id {
+			return false
+		}
+	}
+	minRuns := config.MinRuns
+	if minRuns <= 0 {
+		minRuns = defaultFlakyMinRuns
+	}
+	return len(runs) >= minRuns && flakinessScore(runs) >= config.QuarantineThreshold
+}
+
+// skipQuarantinedTests returns `targets` without the quarantined tests, unless
+// --include-quarantined is used.
+func skipQuarantinedTests(targets []string) ([]string, error) {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return nil, err
+	}
+	config := moduleFile.FlakyTests
+	if includeQuarantined || config.QuarantineThreshold <= 0 {
+		return targets, nil
+	}
+	history, err := readTestHistory()
+	if err != nil {
+		return nil, err
+	}
+	remaining := []string{}
+	for _, name := range targets {
+		runs := history[targetID(name)]
+		if isQuarantined(targetID(name), runs, config) {
+			log.Warning("Skipping quarantined test '%s' with flakiness score %.2f.\n", targetID(name), flakinessScore(runs))
+			continue
+		}
+		remaining = append(remaining, name)
+	}
+	return remaining, nil
+}
+
+// printFlakyTests prints all tests with a flakiness score above 0, flakiest tests first.
+func printFlakyTests() error {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return err
+	}
+	config := moduleFile.FlakyTests
+	history, err := readTestHistory()
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for id, runs := range history {
+		if flakinessScore(runs) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		log.Log("No flaky tests have been recorded.\n")
+		return nil
+	}
+	sort.Strings(ids)
+	sort.SliceStable(ids, func(i, j int) bool {
+		return flakinessScore(history[ids[i]]) > flakinessScore(history[ids[j]])
+	})
+
+	fmt.Printf("  %-50s %6s %5s %8s  %s\n", "TEST", "SCORE", "RUNS", "FAILURES", "STATUS")
+	for _, id := range ids {
+		runs := history[id]
+		failures := 0
+		for _, run := range runs {
+			if !run.Passed {
+				failures++
+			}
+		}
+		status := ""
+		if isQuarantined(id, runs, config) {
+			status = "quarantined"
+		}
+		fmt.Printf("  %-50s %6.2f %5d %8d  %s\n", id, flakinessScore(runs), len(runs), failures, status)
+	}
+	return nil
+}
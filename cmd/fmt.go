@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [--check]",
+	Args:  cobra.NoArgs,
+	Short: "Formats the BUILD.go and RULES files of the workspace module",
+	Long: `Formats all BUILD.go and RULES files of the workspace module with gofmt. In addition,
+imports are grouped into standard library imports and all other imports, and consecutive
+top-level variable declarations in BUILD.go files (i.e., build targets) are sorted by name.
+With --check, the files are not changed, but the command fails if any file is not formatted.`,
+	RunE: runFmt,
+}
+
+var fmtCheck bool
+
+func init() {
+	rootCmd.AddCommand(fmtCmd)
+	fmtCmd.Flags().BoolVar(&fmtCheck, "check", false, "Only report files that are not formatted")
+}
+
+func runFmt(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	workspaceModule, err := module.OpenModule(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	buildFiles, err := module.ListBuildFiles(workspaceModule)
+	if err != nil {
+		return err
+	}
+	rules, err := module.ListRules(workspaceModule)
+	if err != nil {
+		return err
+	}
+	files := append(buildFiles, rules...)
+
+	unformatted := 0
+	failed := 0
+	for _, file := range files {
+		relPath, _ := filepath.Rel(workingDir, file.SourcePath)
+		src, err := util.ReadFile(file.SourcePath)
+		if err != nil {
+			return err
+		}
+		formatted, err := formatBuildSource(src, path.Base(file.SourcePath) == "BUILD.go")
+		if err != nil {
+			log.Error("Failed to format '%s': %s.\n", relPath, err)
+			failed++
+			continue
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+		unformatted++
+		if fmtCheck {
+			fmt.Println(relPath)
+			continue
+		}
+		if err := util.WriteFile(file.SourcePath, formatted); err != nil {
+			return err
+		}
+		log.Debug("Formatted '%s'.\n", relPath)
+	}
+
+	if failed > 0 {
+		return log.Errorf("Failed to format %d files.\n", failed)
+	}
+	if fmtCheck && unformatted > 0 {
+		return log.Errorf("%d of %d files are not formatted. Run 'dbt fmt' to format them.\n", unformatted, len(files))
+	}
+	if fmtCheck {
+		log.Success("All %d files are formatted.\n", len(files))
+		return nil
+	}
+	log.Success("Formatted %d of %d files.\n", unformatted, len(files))
+	return nil
+}
+
+// formatBuildSource formats `src` with gofmt, groups its imports and, for BUILD.go files, sorts
+// consecutive top-level variable declarations by name.
+func formatBuildSource(src []byte, isBuildFile bool) ([]byte, error) {
+	src, err := format.Source(src)
+	if err != nil {
+		return nil, err
+	}
+	if src, err = groupImports(src); err != nil {
+		return nil, err
+	}
+	if isBuildFile {
+		if src, err = sortVarDecls(src); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(src)
+}
+
+// sourceChunk is a range of the source that is moved as a whole.
+type sourceChunk struct {
+	key   string
+	start int
+	end   int
+}
+
+// groupImports rewrites import blocks so that standard library imports come first, followed by
+// all other imports. Both groups are sorted and separated by an empty line. Blocks containing
+// comments that do not belong to an import are left untouched.
+func groupImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []byte
+	last := 0
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || !genDecl.Lparen.IsValid() || len(genDecl.Specs) == 0 {
+			continue
+		}
+		chunks := []sourceChunk{}
+		for _, spec := range genDecl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			importPath, _ := strconv.Unquote(importSpec.Path.Value)
+			chunks = append(chunks, specChunk(fset, importPath, importSpec.Doc, importSpec.Pos(), importSpec.End(), importSpec.Comment))
+		}
+		if hasStrayComments(fset, file, chunks, fset.Position(genDecl.Lparen).Offset, fset.Position(genDecl.Rparen).Offset) {
+			continue
+		}
+
+		std := []sourceChunk{}
+		other := []sourceChunk{}
+		for _, chunk := range chunks {
+			if isStdPackage(chunk.key) {
+				std = append(std, chunk)
+			} else {
+				other = append(other, chunk)
+			}
+		}
+		groups := []string{}
+		for _, group := range [][]sourceChunk{std, other} {
+			if len(group) > 0 {
+				groups = append(groups, joinChunks(src, sortChunks(group), "\n"))
+			}
+		}
+
+		start := fset.Position(genDecl.Lparen).Offset + 1
+		end := fset.Position(genDecl.Rparen).Offset
+		result = append(result, src[last:start]...)
+		result = append(result, "\n"+strings.Join(groups, "\n\n")+"\n"...)
+		last = end
+	}
+	return append(result, src[last:]...), nil
+}
+
+// isStdPackage reports whether `importPath` refers to a package of the Go standard library.
+func isStdPackage(importPath string) bool {
+	pkg, err := build.Default.Import(importPath, "", build.FindOnly)
+	return err == nil && pkg.Goroot
+}
+
+// sortVarDecls sorts runs of consecutive top-level variable declarations by name. Declarations
+// separated by other declarations or by comments that do not belong to a declaration are sorted
+// separately.
+func sortVarDecls(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := [][]sourceChunk{}
+	run := []sourceChunk{}
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		isSingleVar := ok && genDecl.Tok == token.VAR && !genDecl.Lparen.IsValid() &&
+			len(genDecl.Specs) == 1 && len(genDecl.Specs[0].(*ast.ValueSpec).Names) == 1
+		if !isSingleVar {
+			runs = append(runs, run)
+			run = []sourceChunk{}
+			continue
+		}
+		valueSpec := genDecl.Specs[0].(*ast.ValueSpec)
+		chunk := specChunk(fset, valueSpec.Names[0].Name, genDecl.Doc, genDecl.Pos(), genDecl.End(), valueSpec.Comment)
+		if len(run) > 0 && hasStrayComments(fset, file, []sourceChunk{run[len(run)-1], chunk}, run[len(run)-1].start, chunk.end) {
+			runs = append(runs, run)
+			run = []sourceChunk{}
+		}
+		run = append(run, chunk)
+	}
+	runs = append(runs, run)
+
+	var result []byte
+	last := 0
+	for _, run := range runs {
+		if len(run) < 2 {
+			continue
+		}
+		result = append(result, src[last:run[0].start]...)
+		result = append(result, joinChunks(src, sortChunks(run), "\n\n")...)
+		last = run[len(run)-1].end
+	}
+	return append(result, src[last:]...), nil
+}
+
+// specChunk returns the chunk of a declaration including its doc comment and line comment.
+func specChunk(fset *token.FileSet, key string, doc *ast.CommentGroup, pos, end token.Pos, comment *ast.CommentGroup) sourceChunk {
+	if doc != nil {
+		pos = doc.Pos()
+	}
+	if comment != nil {
+		end = comment.End()
+	}
+	return sourceChunk{key: key, start: fset.Position(pos).Offset, end: fset.Position(end).Offset}
+}
+
+// hasStrayComments reports whether there are comments between `start` and `end` that are not part of any of the `chunks`.
+func hasStrayComments(fset *token.FileSet, file *ast.File, chunks []sourceChunk, start, end int) bool {
+	for _, group := range file.Comments {
+		offset := fset.Position(group.Pos()).Offset
+		if offset < start || offset >= end {
+			continue
+		}
+		inChunk := false
+		for _, chunk := range chunks {
+			if offset >= chunk.start && offset < chunk.end {
+				inChunk = true
+			}
+		}
+		if !inChunk {
+			return true
+		}
+	}
+	return false
+}
+
+func sortChunks(chunks []sourceChunk) []sourceChunk {
+	sorted := append([]sourceChunk{}, chunks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].key < sorted[j].key
+	})
+	return sorted
+}
+
+func joinChunks(src []byte, chunks []sourceChunk, separator string) string {
+	parts := []string{}
+	for _, chunk := range chunks {
+		parts = append(parts, string(src[chunk.start:chunk.end]))
+	}
+	return strings.Join(parts, separator)
+}
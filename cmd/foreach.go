@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var foreachCmd = &cobra.Command{
+	Use:   "foreach [--module=PATTERN...] [--parallel=N] -- COMMAND...",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Runs a shell command in every module of the workspace",
+	Long: `Runs COMMAND with 'sh -c' in the root directory of every module of the workspace, e.g.
+'dbt foreach -- git status --short'. A single argument is run as a shell script, e.g.
+'dbt foreach -- "git log -1 | cat"'; multiple arguments are quoted and run as one command.
+The commands run in parallel. Their output is collected
+and printed per module in the order of the module names once all commands have finished.
+The name of the module is passed to the command in the DBT_MODULE environment variable.
+With --module, only the modules whose names match one of the glob patterns run the command.
+The command fails if the command failed in any module.`,
+	RunE: runForeach,
+}
+
+var foreachModules []string
+var foreachParallel int
+
+func init() {
+	rootCmd.AddCommand(foreachCmd)
+	foreachCmd.Flags().StringSliceVar(&foreachModules, "module", nil, "Only run the command in modules matching the glob pattern")
+	foreachCmd.Flags().IntVar(&foreachParallel, "parallel", runtime.NumCPU(), "Run the command in N modules at a time")
+}
+
+// foreachResult is the outcome of running the command in a module.
+type foreachResult struct {
+	name   string
+	output []byte
+	err    error
+}
+
+// foreachModuleMatches returns whether the module `name` matches any of the patterns given with
+// --module. All modules match if there are no patterns.
+func foreachModuleMatches(name string) (bool, error) {
+	if len(foreachModules) == 0 {
+		return true, nil
+	}
+	for _, pattern := range foreachModules {
+		matches, err := path.Match(pattern, name)
+		if err != nil {
+			return false, log.ErrorfWithCode(log.ExitUsage, nil, "Invalid module pattern '%s': %s.\n", pattern, err)
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func runForeach(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, name := range sortMapKeys(modules) {
+		matches, err := foreachModuleMatches(name)
+		if err != nil {
+			return err
+		}
+		if matches {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "No module matches '%s'.\n", strings.Join(foreachModules, "', '"))
+	}
+	parallel := foreachParallel
+	if parallel <= 0 || parallel > len(names) {
+		parallel = len(names)
+	}
+
+	// A single argument is a script, e.g. 'dbt foreach -- "git status | head"'. Multiple arguments
+	// are the words of a command and are quoted so that the shell does not split them again.
+	command := args[0]
+	if len(args) > 1 {
+		command = strings.Join(shellEscapePaths(args), " ")
+	}
+	log.Debug("Running '%s' in %d modules, %d at a time.\n", command, len(names), parallel)
+	results := make([]foreachResult, len(names))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for idx, name := range names {
+		shellCmd := exec.Command("sh", "-c", command)
+		shellCmd.Dir = modules[name].RootPath()
+		shellCmd.Env = append(os.Environ(), "DBT_MODULE="+name)
+		wg.Add(1)
+		go func(idx int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			output, err := shellCmd.CombinedOutput()
+			results[idx] = foreachResult{name: name, output: output, err: err}
+		}(idx, name)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for _, result := range results {
+		fmt.Printf("==> %s <==\n", result.name)
+		os.Stdout.Write(result.output)
+		if len(result.output) > 0 && result.output[len(result.output)-1] != '\n' {
+			fmt.Println()
+		}
+		if result.err != nil {
+			log.Warning("The command failed in module '%s': %s.\n", result.name, result.err)
+			failed = append(failed, result.name)
+		}
+	}
+	if len(failed) > 0 {
+		return log.Errorf("The command failed in %d of %d modules: %s.\n", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	log.Success("The command succeeded in all %d modules.\n", len(results))
+	return nil
+}
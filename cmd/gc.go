@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const lastUsedFileName = ".last-used"
+
+var gcCmd = &cobra.Command{
+	Use:   "gc [--days=N] [--keep-current] [--dry-run]",
+	Args:  cobra.NoArgs,
+	Short: "Removes output directories that have not been used recently",
+	Long: `Removes all output directories in the BUILD/ directory that have not been used by a build
+within the given number of days and reports how much disk space was freed.`,
+	RunE: runGc,
+}
+
+var gcDays int
+var gcKeepCurrent bool
+var gcDryRun bool
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().IntVar(&gcDays, "days", 30, "Remove output directories not used within N days")
+	gcCmd.Flags().BoolVar(&gcKeepCurrent, "keep-current", false, "Keep the output directory of the most recent build")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Only list the output directories that would be removed")
+}
+
+// markOutputDirUsed records that `outputDir` has been used by a build just now.
+func markOutputDirUsed(outputDir string) error {
+	return util.WriteFile(path.Join(outputDir, lastUsedFileName), []byte(time.Now().Format(time.RFC3339)))
+}
+
+func runGc(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	if !util.DirExists(buildDir) {
+		log.Log("There is no %s/ directory. Nothing to do.\n", buildDirName)
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -gcDays)
+	current := ""
+	if gcKeepCurrent {
+		history, err := readHistory()
+		if err != nil {
+			return err
+		}
+		if len(history) > 0 {
+			current = history[0].OutputDir
+		}
+	}
+
+	stale, err := staleOutputDirs(buildDir, cutoff, current)
+	if err != nil {
+		return err
+	}
+
+	freed := int64(0)
+	for _, outputDir := range stale {
+		size := dirSize(outputDir)
+		relPath, _ := filepath.Rel(buildDir, outputDir)
+		fmt.Printf("  %9s  %s/%s\n", formatSize(size), buildDirName, relPath)
+		if gcDryRun {
+			continue
+		}
+		if err := os.RemoveAll(outputDir); err != nil {
+			checkForeignFiles(outputDir)
+			return log.Errorf("Failed to remove '%s': %s.\n", outputDir, err)
+		}
+		freed += size
+	}
+
+	if gcDryRun {
+		log.Log("%d output directories would be removed.\n", len(stale))
+		return nil
+	}
+	removeDanglingOutputDirLinks(buildDir)
+	log.Success("Removed %d output directories and freed %s.\n", len(stale), formatSize(freed))
+	return nil
+}
+
+// staleOutputDirs returns the output directories in `buildDir` that have not been used by a build
+// since `cutoff`. The output directory `current` is never stale.
+func staleOutputDirs(buildDir string, cutoff time.Time, current string) ([]string, error) {
+	// Output directories are identified by their last-used file.
+	lastUsed := map[string]time.Time{}
+	err := filepath.Walk(buildDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != lastUsedFileName {
+			return err
+		}
+		data, err := util.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		timestamp, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err != nil {
+			log.Warning("Failed to parse '%s': %s.\n", filePath, err)
+			timestamp = time.Now()
+		}
+		lastUsed[path.Dir(filePath)] = timestamp
+		return nil
+	})
+	if err != nil {
+		return nil, log.Errorf("Failed to search '%s' for output directories: %s.\n", buildDir, err)
+	}
+
+	// Output directories can be nested (e.g., for builds for multiple platforms). A directory is
+	// only stale if all output directories inside it are stale as well.
+	stale := []string{}
+	for _, outputDir := range sortMapKeys(lastUsed) {
+		isStale := true
+		for otherDir, timestamp := range lastUsed {
+			isNested := otherDir == outputDir || strings.HasPrefix(otherDir, outputDir+"/")
+			if isNested && (!timestamp.Before(cutoff) || otherDir == current) {
+				isStale = false
+			}
+		}
+		// Directories nested in a stale directory are removed together with it.
+		for _, staleDir := range stale {
+			if strings.HasPrefix(outputDir, staleDir+"/") {
+				isStale = false
+			}
+		}
+		if isStale {
+			stale = append(stale, outputDir)
+		}
+	}
+	return stale, nil
+}
+
+func dirSize(dir string) int64 {
+	size := int64(0)
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// updateGoldens makes golden-output tests rewrite their golden files instead of comparing against them.
+var updateGoldens bool
+
+// snapshotGoldens returns the current content of the golden files of `targets`. Golden files
+// that do not exist yet are mapped to nil.
+func snapshotGoldens(targets []string, allTargets map[string]target) (map[string][]byte, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	goldens := map[string][]byte{}
+	for _, name := range targets {
+		for _, golden := range allTargets[name].Goldens {
+			if !path.IsAbs(golden) {
+				golden = path.Join(workspaceRoot, golden)
+			}
+			content, err := ioutil.ReadFile(golden)
+			if err != nil {
+				content = nil
+			}
+			goldens[golden] = content
+		}
+	}
+	return goldens, nil
+}
+
+// reportGoldenChanges prints a summary of the golden files that differ from the `previous` snapshot.
+func reportGoldenChanges(previous map[string][]byte) error {
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, golden := range sortMapKeys(previous) {
+		relPath, _ := filepath.Rel(workingDir, golden)
+		content, err := ioutil.ReadFile(golden)
+		switch {
+		case err != nil:
+			log.Warning("Golden file '%s' was not written.\n", relPath)
+		case previous[golden] == nil:
+			fmt.Printf("  created  %s (%d lines)\n", relPath, len(splitLines(string(content))))
+			changed++
+		case string(previous[golden]) != string(content):
+			added, removed := countChangedLines(string(previous[golden]), string(content))
+			fmt.Printf("  updated  %s (+%d -%d lines)\n", relPath, added, removed)
+			changed++
+		}
+	}
+
+	if changed == 0 {
+		log.Success("All %d golden files are up to date.\n", len(previous))
+		return nil
+	}
+	log.Success("Updated %d of %d golden files. Review the changes before committing them.\n", changed, len(previous))
+	return nil
+}
+
+// countChangedLines returns the number of lines that were added and removed, ignoring their order.
+func countChangedLines(before, after string) (int, int) {
+	counts := map[string]int{}
+	for _, line := range splitLines(before) {
+		counts[line]--
+	}
+	for _, line := range splitLines(after) {
+		counts[line]++
+	}
+	added, removed := 0, 0
+	for _, count := range counts {
+		if count > 0 {
+			added += count
+		} else {
+			removed -= count
+		}
+	}
+	return added, removed
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const fileStatesFileName = "file-states.json"
+
+// fileState records the modification time, size and content hash of a source file.
+type fileState struct {
+	ModTime time.Time
+	Size    int64
+	Hash    string
+}
+
+func fileStatesFilePath() (string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(workspaceRoot, buildDirName, fileStatesFileName), nil
+}
+
+// restoreModTimes resets the modification times of all source files in the workspace whose
+// content is identical to the content at the time of the previous build. This keeps ninja from
+// rebuilding targets only because files have been touched (e.g., by switching git branches back
+// and forth). It returns the current states of all files, which must be recorded with
+// recordFileStates once ninja has run.
+func restoreModTimes() (map[string]fileState, error) {
+	filePath, err := fileStatesFilePath()
+	if err != nil {
+		return nil, err
+	}
+	previous := map[string]fileState{}
+	if util.FileExists(filePath) {
+		if err := util.ReadJson(filePath, &previous); err != nil {
+			return nil, err
+		}
+	}
+
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]fileState{}
+	restored := 0
+	for _, mod := range modules {
+		rootPath := mod.RootPath()
+		err := util.WalkSymlink(rootPath, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				relPath, _ := filepath.Rel(rootPath, filePath)
+				if relPath == ".git" || relPath == buildDirName || relPath == util.DepsDirName {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			prev, exists := previous[filePath]
+			if exists && prev.ModTime.Equal(info.ModTime()) && prev.Size == info.Size() {
+				current[filePath] = prev
+				return nil
+			}
+
+			hash, err := hashFile(filePath)
+			if err != nil {
+				return err
+			}
+			if exists && prev.Size == info.Size() && prev.Hash == hash {
+				if err := os.Chtimes(filePath, prev.ModTime, prev.ModTime); err != nil {
+					return err
+				}
+				current[filePath] = prev
+				restored++
+				return nil
+			}
+			current[filePath] = fileState{ModTime: info.ModTime(), Size: info.Size(), Hash: hash}
+			return nil
+		})
+		if err != nil {
+			return nil, log.Errorf("Failed to restore modification times in '%s': %s.\n", rootPath, err)
+		}
+	}
+
+	log.Debug("Restored the modification times of %d unchanged files.\n", restored)
+	return current, nil
+}
+
+// recordFileStates stores the file `states` for the next build.
+func recordFileStates(states map[string]fileState) error {
+	filePath, err := fileStatesFilePath()
+	if err != nil {
+		return err
+	}
+	return util.WriteJson(filePath, &states)
+}
+
+func hashFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const historyFileName = "history.json"
+const maxHistoryEntries = 100
+
+type buildEvent struct {
+	Time       time.Time
+	WorkingDir string
+	OutputDir  string
+	Args       []string
+	Flags      map[string]string
+	Targets    []string
+	Duration   time.Duration
+	Success    bool
+	// Interrupted reports whether the build was interrupted by SIGINT or SIGTERM.
+	Interrupted bool
+	// GeneratorDuration is the time spent running the generator before ninja was started.
+	GeneratorDuration time.Duration
+	// GeneratorFailed reports whether the generator failed, in which case ninja did not run.
+	GeneratorFailed bool
+	// Actions is the number of actions that ninja ran and FailedActions the number of them that
+	// failed.
+	Actions       int
+	FailedActions int
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Lists recent builds",
+	Long: `Lists recent builds in this workspace. Builds are numbered starting with 1 for the most recent one.
+'dbt history diff A B' shows how the build flags differ between builds A and B.`,
+	Args: cobra.NoArgs,
+	RunE: runHistory,
+}
+
+var historyDiffCmd = &cobra.Command{
+	Use:   "diff A B",
+	Short: "Shows how the build flags differ between two builds",
+	Long:  `Shows how the build flags differ between two builds.`,
+	Args:  cobra.ExactArgs(2),
+	RunE:  runHistoryDiff,
+}
+
+var lastCmd = &cobra.Command{
+	Use:   "last [--rerun]",
+	Short: "Shows the most recent build",
+	Long:  `Shows the most recent build and optionally runs it again.`,
+	Args:  cobra.NoArgs,
+	RunE:  runLast,
+}
+
+var historyLength int
+var rerun bool
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVarP(&historyLength, "number", "n", 10, "Number of builds to list")
+	historyCmd.AddCommand(historyDiffCmd)
+
+	rootCmd.AddCommand(lastCmd)
+	lastCmd.Flags().BoolVar(&rerun, "rerun", false, "Run the most recent build again")
+}
+
+func historyFilePath() (string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return "", err
+	}
+	stateDir, err := workspaceStateDir(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(stateDir, historyFileName), nil
+}
+
+// readHistory returns all recorded builds, most recent first.
+func readHistory() ([]buildEvent, error) {
+	filePath, err := historyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	events := []buildEvent{}
+	if util.FileExists(filePath) {
+		if err := util.ReadJson(filePath, &events); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// lastNinjaBuild returns the most recent of the `events` in which ninja ran, whose actions are
+// recorded in its output directory.
+func lastNinjaBuild(events []buildEvent) (buildEvent, bool) {
+	for _, event := range events {
+		if !event.GeneratorFailed {
+			return event, true
+		}
+	}
+	return buildEvent{}, false
+}
+
+// recordBuildEvent prepends `event` to the workspace build history.
+func recordBuildEvent(event buildEvent) error {
+	history, err := readHistory()
+	if err != nil {
+		return err
+	}
+	events := append([]buildEvent{event}, history...)
+	if len(events) > maxHistoryEntries {
+		events = events[:maxHistoryEntries]
+	}
+	filePath, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+	return util.WriteJson(filePath, &events)
+}
+
+func (event buildEvent) commandLine() string {
+	return strings.Join(append([]string{"dbt"}, event.Args...), " ")
+}
+
+func (event buildEvent) status() string {
+	if event.Interrupted {
+		return "interrupted"
+	}
+	if event.GeneratorFailed {
+		return "generator failed"
+	}
+	return buildStatus(event.Success)
+}
+
+func buildStatus(success bool) string {
+	if success {
+		return "succeeded"
+	}
+	return "failed"
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	events, err := readHistory()
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		log.Log("No builds have been recorded yet.\n")
+		return nil
+	}
+	if historyLength >= 0 && len(events) > historyLength {
+		events = events[:historyLength]
+	}
+	for idx, event := range events {
+		fmt.Printf("%3d  %s  %9s  %-16s  %s\n", idx+1, event.Time.Format("2006-01-02 15:04:05"),
+			event.Duration.Round(time.Millisecond), event.status(), event.commandLine())
+	}
+	return nil
+}
+
+func runHistoryDiff(cmd *cobra.Command, args []string) error {
+	events, err := readHistory()
+	if err != nil {
+		return err
+	}
+	a, err := historyEvent(events, args[0])
+	if err != nil {
+		return err
+	}
+	b, err := historyEvent(events, args[1])
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for name := range a.Flags {
+		names[name] = true
+	}
+	for name := range b.Flags {
+		names[name] = true
+	}
+	sortedNames := []string{}
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	differences := 0
+	for _, name := range sortedNames {
+		valueA, inA := a.Flags[name]
+		valueB, inB := b.Flags[name]
+		switch {
+		case inA && !inB:
+			fmt.Printf("- %s='%s'\n", name, valueA)
+		case !inA && inB:
+			fmt.Printf("+ %s='%s'\n", name, valueB)
+		case valueA != valueB:
+			fmt.Printf("~ %s='%s' -> '%s'\n", name, valueA, valueB)
+		default:
+			continue
+		}
+		differences++
+	}
+	if differences == 0 {
+		log.Log("Builds %s and %s use the same build flags.\n", args[0], args[1])
+	}
+	return nil
+}
+
+func historyEvent(events []buildEvent, arg string) (buildEvent, error) {
+	idx, err := strconv.Atoi(arg)
+	if err != nil || idx < 1 || idx > len(events) {
+		return buildEvent{}, log.Errorf("'%s' does not refer to a recorded build. Run 'dbt history' to list all recorded builds.\n", arg)
+	}
+	return events[idx-1], nil
+}
+
+func runLast(cmd *cobra.Command, args []string) error {
+	events, err := readHistory()
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return log.Errorf("No builds have been recorded yet.\n")
+	}
+	event := events[0]
+
+	if !rerun {
+		fmt.Printf("Command:   %s\n", event.commandLine())
+		fmt.Printf("Directory: %s\n", event.WorkingDir)
+		fmt.Printf("Started:   %s\n", event.Time.Format(time.RFC1123))
+		fmt.Printf("Duration:  %s\n", event.Duration.Round(time.Millisecond))
+		fmt.Printf("Status:    %s\n", event.status())
+		if !event.GeneratorFailed {
+			fmt.Printf("Actions:   %d run, %d failed\n", event.Actions, event.FailedActions)
+		}
+		fmt.Printf("Targets:\n")
+		for _, target := range event.Targets {
+			fmt.Printf("  %s\n", targetID(target))
+		}
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return log.Errorf("Failed to determine the DBT executable: %s.\n", err)
+	}
+	log.Log("Running '%s' in '%s'.\n", event.commandLine(), event.WorkingDir)
+	rerunCmd := exec.Command(executable, event.Args...)
+	rerunCmd.Dir = event.WorkingDir
+	rerunCmd.Stdin = os.Stdin
+	rerunCmd.Stdout = os.Stdout
+	rerunCmd.Stderr = os.Stderr
+	if err := rerunCmd.Run(); err != nil {
+		return log.Errorf("Build failed: %s.\n", err)
+	}
+	return nil
+}
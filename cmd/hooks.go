@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const (
+	hookStagePreBuild  = "pre-build"
+	hookStagePostBuild = "post-build"
+)
+
+// runHooks runs all enabled hooks of the workspace module for `stage`. Hooks are run in the
+// workspace root in the order they are declared and learn about the build from environment variables.
+func runHooks(stage string, outputDir string, targets []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	disabled := map[string]bool{}
+	for _, name := range config.GetConfig().DisabledHooks {
+		disabled[name] = true
+	}
+
+	for _, hook := range moduleFile.Hooks {
+		if hook.Stage != hookStagePreBuild && hook.Stage != hookStagePostBuild {
+			return log.Errorf("Hook '%s' has unknown stage '%s'. Use '%s' or '%s'.\n", hook.Name, hook.Stage, hookStagePreBuild, hookStagePostBuild)
+		}
+		if hook.Stage != stage {
+			continue
+		}
+		if hook.Disabled || disabled[hook.Name] {
+			log.Debug("Skipping disabled %s hook '%s'.\n", stage, hook.Name)
+			continue
+		}
+
+		log.Log("Running %s hook '%s'.\n", stage, hook.Name)
+		log.Debug("Hook command: '%s'.\n", hook.Command)
+		hookCmd := exec.Command("sh", "-c", hook.Command)
+		hookCmd.Dir = workspaceRoot
+		hookCmd.Stdout = os.Stdout
+		hookCmd.Stderr = os.Stderr
+		hookCmd.Env = append(os.Environ(),
+			"DBT_WORKSPACE="+workspaceRoot,
+			"DBT_OUTPUT_DIR="+outputDir,
+			"DBT_TARGETS="+strings.Join(targets, " "))
+		if err := hookCmd.Run(); err != nil {
+			return log.Errorf("The %s hook '%s' failed: %s.\n", stage, hook.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const ideDirName = "IDE"
+
+var ideSetupCmd = &cobra.Command{
+	Use:   "ide-setup",
+	Args:  cobra.NoArgs,
+	Short: "Prepares a directory for editing BUILD.go and RULES/ files in an IDE",
+	Long: `Creates BUILD/IDE/, a Go workspace with the BUILD.go and RULES/ files of all modules at
+their import paths, as symbolic links to the source files, and a go.work file. Opening
+BUILD/IDE/ in an editor that uses gopls, e.g. VS Code, gives working imports, completion and
+go-to-definition across all modules. Edits through the links change the source files. Once
+created, the directory is updated whenever DBT runs the generator for a build.`,
+	RunE: runIdeSetup,
+}
+
+func init() {
+	rootCmd.AddCommand(ideSetupCmd)
+}
+
+func runIdeSetup(cmd *cobra.Command, args []string) error {
+	if err := dbt.CheckGoWorkSupport("'dbt ide-setup'"); err != nil {
+		return err
+	}
+	ctx, err := dbtContext()
+	if err != nil {
+		return err
+	}
+	ideDir := path.Join(ctx.WorkspaceRoot, buildDirName, ideDirName)
+	if err := util.MkdirAll(ideDir); err != nil {
+		return err
+	}
+	generator, err := dbt.PrepareGenerator(ctx)
+	if err != nil {
+		return err
+	}
+	if err := updateIdeDir(ctx.WorkspaceRoot, generator.Dir, generator.Sources); err != nil {
+		return err
+	}
+	log.Success("Open '%s' in your editor to edit the BUILD.go and %s/ files of all modules.\n", ideDir, rulesDirName)
+	return nil
+}
+
+// updateIdeDir brings the IDE directory in sync with the assembled generator directory once
+// 'dbt ide-setup' created it. The files that the generator directory overlays are symbolic links
+// to the source files instead, since gopls does not support overlay files, and a go.work file
+// makes the IDE directory a single Go workspace. The generated files are copied. Only links and
+// files that changed are replaced, so that editors watching the directory do not reload it on
+// every build.
+func updateIdeDir(workspaceRoot, generatorDir string, sources map[string]string) error {
+	ideDir := path.Join(workspaceRoot, buildDirName, ideDirName)
+	if !util.DirExists(ideDir) {
+		return nil
+	}
+
+	links := map[string]string{}
+	for overlaidPath, source := range sources {
+		links[path.Join(ideDir, strings.TrimPrefix(overlaidPath, generatorDir+"/"))] = source
+	}
+	copies := map[string]string{}
+	err := filepath.Walk(generatorDir, func(filePath string, file os.FileInfo, err error) error {
+		if err != nil || file.IsDir() || file.Name() == dbt.OverlayFileName {
+			return err
+		}
+		copies[path.Join(ideDir, strings.TrimPrefix(filePath, generatorDir+"/"))] = filePath
+		return nil
+	})
+	if err != nil {
+		return log.Errorf("Failed to read the generator directory '%s': %s.\n", generatorDir, err)
+	}
+
+	// Files that are neither linked nor copied are left over from earlier runs, except for the
+	// files of the Go workspace, which gopls and the user may change.
+	changed := 0
+	err = filepath.Walk(ideDir, func(filePath string, file os.FileInfo, err error) error {
+		if err != nil || file.IsDir() {
+			return err
+		}
+		_, isLink := links[filePath]
+		_, isCopy := copies[filePath]
+		if !isLink && !isCopy && filePath != path.Join(ideDir, dbt.WorkFileName) && filePath != path.Join(ideDir, dbt.WorkFileName+".sum") {
+			changed++
+			return os.Remove(filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return log.Errorf("Failed to update the IDE directory '%s': %s.\n", ideDir, err)
+	}
+	removeEmptyDirs(ideDir)
+
+	for linkPath, source := range links {
+		if target, err := os.Readlink(linkPath); err == nil && target == source {
+			continue
+		}
+		changed++
+		os.Remove(linkPath)
+		if err := util.MkdirAll(path.Dir(linkPath)); err != nil {
+			return err
+		}
+		if err := os.Symlink(source, linkPath); err != nil {
+			return log.Errorf("Failed to link '%s' to '%s': %s.\n", linkPath, source, err)
+		}
+	}
+	for copyPath, source := range copies {
+		data, err := util.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Lstat(copyPath); err == nil && info.Mode().IsRegular() {
+			if existing, err := ioutil.ReadFile(copyPath); err == nil && bytes.Equal(existing, data) {
+				continue
+			}
+		}
+		changed++
+		os.Remove(copyPath)
+		if err := util.WriteFile(copyPath, data); err != nil {
+			return err
+		}
+	}
+
+	if !util.FileExists(path.Join(ideDir, dbt.WorkFileName)) {
+		modules, err := module.GetAllModules(workspaceRoot)
+		if err != nil {
+			return err
+		}
+		if err := dbt.WriteWorkFile(ideDir, modules); err != nil {
+			return err
+		}
+	}
+	log.Debug("Updated %d files in the IDE directory '%s'.\n", changed, ideDir)
+	return nil
+}
+
+// removeEmptyDirs removes the empty directories below `dir`.
+func removeEmptyDirs(dir string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subDir := path.Join(dir, entry.Name())
+			removeEmptyDirs(subDir)
+			if remaining, err := ioutil.ReadDir(subDir); err == nil && len(remaining) == 0 {
+				os.Remove(subDir)
+			}
+		}
+	}
+}
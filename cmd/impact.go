@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// Number of nodes passed to a single 'ninja -t query' invocation.
+const impactQueryBatchSize = 500
+
+var impactCmd = &cobra.Command{
+	Use:   "impact",
+	Short: "Previews how many actions a change would invalidate",
+}
+
+var impactFlagCmd = &cobra.Command{
+	Use:   "flag NAME=VALUE... [patterns]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Reports the actions and targets that changing build flags would invalidate",
+	Long: `Reports how many actions and targets would have to be rebuilt if the given build flags
+were changed relative to the current flags. An action is invalidated if its command changes or if
+it depends on the output of an invalidated action. With target patterns, only the matching targets
+are listed. Nothing is built and the flags are not persisted.`,
+	RunE: runImpactFlag,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(impactCmd)
+	impactCmd.AddCommand(impactFlagCmd)
+}
+
+func runImpactFlag(cmd *cobra.Command, args []string) error {
+	patterns, changedInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if len(changedInput.CmdlineFlags) == 0 {
+		return log.Errorf("No build flags to change. Use 'dbt impact flag name=value'.\n")
+	}
+	_, currentInput, err := newGeneratorInput(patterns)
+	if err != nil {
+		return err
+	}
+	currentInput.PersistFlags = false
+	changedInput.PersistFlags = false
+
+	currentOutput, err := runGenerator(currentInput)
+	if err != nil {
+		return err
+	}
+	changedOutput, err := runGenerator(changedInput)
+	if err != nil {
+		return err
+	}
+	dir := currentInput.OutputDir
+	if currentOutput.BuildDir != "" {
+		dir = currentOutput.BuildDir
+	}
+
+	currentFile, err := writeImpactNinjaFile(dir, "current", currentOutput)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path.Join(dir, currentFile))
+	changedFile, err := writeImpactNinjaFile(dir, "changed", changedOutput)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path.Join(dir, changedFile))
+	currentSignatures, err := actionSignatures(dir, currentFile)
+	if err != nil {
+		return err
+	}
+	changedSignatures, err := actionSignatures(dir, changedFile)
+	if err != nil {
+		return err
+	}
+
+	// Actions are invalidated directly if their command changed.
+	invalidated := map[string]bool{}
+	queue := []string{}
+	for output, command := range changedSignatures {
+		if currentCommand, exists := currentSignatures[output]; !exists || currentCommand != command {
+			invalidated[output] = true
+			queue = append(queue, output)
+		}
+	}
+	directCount := len(queue)
+
+	// All actions and targets depending on invalidated outputs are invalidated as well.
+	for len(queue) > 0 {
+		batch := queue
+		if len(batch) > impactQueryBatchSize {
+			batch = batch[:impactQueryBatchSize]
+		}
+		queue = queue[len(batch):]
+		_, dependents := ninjaQuery(dir, changedFile, batch)
+		for _, outputs := range dependents {
+			for _, output := range outputs {
+				if !invalidated[output] {
+					invalidated[output] = true
+					queue = append(queue, output)
+				}
+			}
+		}
+	}
+
+	invalidatedActions := 0
+	for output := range changedSignatures {
+		if invalidated[output] {
+			invalidatedActions++
+		}
+	}
+	targets := sortMapKeys(changedOutput.Targets)
+	if len(patterns) > 0 {
+		if targets, err = selectTargets(patterns, modeBuild, changedOutput.Targets); err != nil {
+			return err
+		}
+		sort.Strings(targets)
+	}
+	invalidatedTargets := []string{}
+	for _, name := range targets {
+		if invalidated[name] {
+			invalidatedTargets = append(invalidatedTargets, name)
+		}
+	}
+
+	for _, name := range invalidatedTargets {
+		fmt.Printf("  %s\n", targetID(name))
+	}
+	log.Log("%d of %d actions would be invalidated (%d with changed commands).\n", invalidatedActions, len(changedSignatures), directCount)
+	log.Log("%d of %d targets would be invalidated.\n", len(invalidatedTargets), len(targets))
+	return nil
+}
+
+// writeImpactNinjaFile writes the ninja file of `output` next to the ninja file in `dir` and returns its name.
+func writeImpactNinjaFile(dir, name string, output generatorOutput) (string, error) {
+	fileName := fmt.Sprintf("impact-%s.ninja", name)
+	return fileName, util.WriteFile(path.Join(dir, fileName), []byte(output.NinjaFile))
+}
+
+// actionSignatures returns the command of each action in `ninjaFile`, keyed by the first output
+// of the action. Ninja reruns an action whenever its command changes.
+func actionSignatures(dir, ninjaFile string) (map[string]string, error) {
+	var stdout bytes.Buffer
+	if err := runNinja(dir, &stdout, []string{"-f", ninjaFile, "-t", "compdb"}); err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		Command string
+		Output  string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		return nil, log.Errorf("Failed to parse the actions of '%s': %s.\n", ninjaFile, err)
+	}
+	signatures := map[string]string{}
+	for _, entry := range entries {
+		// Phony edges have no command and are not actions.
+		if entry.Command != "" {
+			signatures[entry.Output] = entry.Command
+		}
+	}
+	return signatures, nil
+}
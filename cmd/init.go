@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// templateFileName is the name of the file in the root of a template repository that declares
+// the parameters of the template.
+const templateFileName = "TEMPLATE.yaml"
+
+// templateSuffix marks files whose content is rendered with the template parameters.
+const templateSuffix = ".tmpl"
+
+type templateParameter struct {
+	Name        string
+	Description string
+	Default     string
+}
+
+type workspaceTemplate struct {
+	Parameters []templateParameter
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init --from=URL [--revision=REV] [--values=FILE] [DIR]",
+	Args:  cobra.RangeArgs(0, 1),
+	Short: "Creates a new workspace from a template repository",
+	Long: `Creates a new workspace in DIR (default: the current directory) from a template repository.
+The parameters declared in the TEMPLATE.yaml file of the template are read from the values file
+or prompted for. Files ending in '.tmpl' and file names are rendered with the parameter values
+using Go templates, e.g. '{{.product}}'. All other files are copied unchanged. Afterwards, the
+dependencies of the new workspace are synced.`,
+	RunE: runInit,
+}
+
+var initFrom string
+var initRevision string
+var initValuesFile string
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initFrom, "from", "", "URL of the template repository")
+	initCmd.Flags().StringVar(&initRevision, "revision", "", "Revision of the template to use (default: the default branch of the template repository)")
+	initCmd.Flags().StringVar(&initValuesFile, "values", "", "YAML file with the values of the template parameters")
+	initCmd.MarkFlagRequired("from")
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	workspaceRoot := workingDir
+	if len(args) > 0 {
+		workspaceRoot = args[0]
+		if !path.IsAbs(workspaceRoot) {
+			workspaceRoot = path.Join(workingDir, workspaceRoot)
+		}
+	}
+	if entries, err := ioutil.ReadDir(workspaceRoot); err == nil && len(entries) > 0 {
+		return log.Errorf("Directory '%s' is not empty.\n", workspaceRoot)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "dbt-template-")
+	if err != nil {
+		return log.Errorf("Failed to create temporary directory: %s.\n", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	log.Log("Fetching template '%s'.\n", initFrom)
+	templateDir := path.Join(tmpDir, "template")
+	templateModule, err := module.CreateGitModule(templateDir, initFrom, "", module.CloneOptions{})
+	if err != nil {
+		return log.Errorf("Failed to fetch template: %s.\n", err)
+	}
+	// The clone is on the default branch of the template repository.
+	if initRevision != "" {
+		if err := templateModule.Checkout(initRevision); err != nil {
+			return err
+		}
+	}
+
+	var tmpl workspaceTemplate
+	if util.FileExists(path.Join(templateDir, templateFileName)) {
+		if err := util.ReadYaml(path.Join(templateDir, templateFileName), &tmpl); err != nil {
+			return err
+		}
+	}
+	values, err := templateValues(tmpl)
+	if err != nil {
+		return err
+	}
+
+	log.Log("Creating workspace in '%s'.\n", workspaceRoot)
+	if err := instantiateTemplate(templateDir, workspaceRoot, values); err != nil {
+		return err
+	}
+
+	if !util.DirExists(path.Join(workspaceRoot, ".git")) {
+		gitCmd := exec.Command("git", "init", "-q")
+		gitCmd.Dir = workspaceRoot
+		if output, err := gitCmd.CombinedOutput(); err != nil {
+			return log.Errorf("Failed to initialize git repository: %s.\n%s", err, output)
+		}
+	}
+
+	if util.FileExists(path.Join(workspaceRoot, util.ModuleFileName)) {
+		os.Chdir(workspaceRoot)
+		if err := runSync(cmd, []string{}); err != nil {
+			return err
+		}
+	}
+	log.Success("Created workspace '%s' from template '%s'.\n", workspaceRoot, initFrom)
+	return nil
+}
+
+// templateValues returns the values of the template parameters. Values are taken from the values
+// file, prompted for on interactive terminals or set to the parameter's default.
+func templateValues(tmpl workspaceTemplate) (map[string]string, error) {
+	values := map[string]string{}
+	if initValuesFile != "" {
+		if err := util.ReadYaml(initValuesFile, &values); err != nil {
+			return nil, err
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for _, param := range tmpl.Parameters {
+		if _, exists := values[param.Name]; exists {
+			continue
+		}
+		if !isInteractiveTerminal() {
+			if param.Default == "" {
+				return nil, log.Errorf("No value for template parameter '%s'. Provide it with --values.\n", param.Name)
+			}
+			values[param.Name] = param.Default
+			continue
+		}
+
+		prompt := param.Name
+		if param.Description != "" {
+			prompt = fmt.Sprintf("%s (%s)", param.Description, param.Name)
+		}
+		if param.Default != "" {
+			prompt = fmt.Sprintf("%s [%s]", prompt, param.Default)
+		}
+		fmt.Printf("%s: ", prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, log.Errorf("Failed to read value of template parameter '%s': %s.\n", param.Name, err)
+		}
+		value := strings.TrimSpace(line)
+		if value == "" {
+			value = param.Default
+		}
+		if value == "" {
+			return nil, log.Errorf("Template parameter '%s' must not be empty.\n", param.Name)
+		}
+		values[param.Name] = value
+	}
+	return values, nil
+}
+
+// instantiateTemplate copies all files of the template in `templateDir` to `workspaceRoot`,
+// rendering file names and the content of '.tmpl' files with `values`. Templates must not contain
+// symbolic links, and file names must not be rendered to paths outside of `workspaceRoot`.
+func instantiateTemplate(templateDir, workspaceRoot string, values map[string]string) error {
+	return filepath.Walk(templateDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return log.Errorf("Failed to instantiate template: %s.\n", err)
+		}
+		relPath, _ := filepath.Rel(templateDir, filePath)
+		if info.IsDir() && relPath == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || relPath == templateFileName {
+			return nil
+		}
+		// A link could make DBT copy any file the user can read into the new workspace.
+		if !info.Mode().IsRegular() {
+			return log.Errorf("Template file '%s' is not a regular file. Templates must not contain symbolic links.\n", relPath)
+		}
+
+		data, err := util.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(relPath, templateSuffix) {
+			relPath = strings.TrimSuffix(relPath, templateSuffix)
+			rendered, err := renderTemplate(relPath, string(data), values)
+			if err != nil {
+				return err
+			}
+			data = []byte(rendered)
+		}
+		if relPath, err = renderTemplate(relPath, relPath, values); err != nil {
+			return err
+		}
+		relPath = path.Clean(relPath)
+		if path.IsAbs(relPath) || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			return log.Errorf("The name of template file '%s' is rendered to '%s', which is outside of the workspace.\n", strings.TrimPrefix(filePath, templateDir+"/"), relPath)
+		}
+
+		targetPath := path.Join(workspaceRoot, relPath)
+		if err := util.WriteFile(targetPath, data); err != nil {
+			return err
+		}
+		if err := os.Chmod(targetPath, info.Mode().Perm()); err != nil {
+			return log.Errorf("Failed to change filemode of '%s': %s.\n", targetPath, err)
+		}
+		return nil
+	})
+}
+
+func renderTemplate(name, text string, values map[string]string) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", log.Errorf("Failed to parse template '%s': %s.\n", name, err)
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, values); err != nil {
+		return "", log.Errorf("Failed to render template '%s': %s.\n", name, err)
+	}
+	return buffer.String(), nil
+}
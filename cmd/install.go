@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const installManifestFileName = ".dbt-install-manifest.json"
+const defaultInstallDirName = "INSTALL"
+
+// installManifest lists the files installed into a prefix, relative to the prefix.
+type installManifest struct {
+	Files []string
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install [--prefix=DIR] [--symlink] patterns [build flags]",
+	Short: "Builds the targets and installs their outputs",
+	Long: `Builds the targets and copies their outputs into the prefix directory. Targets can declare
+where each of their outputs is installed, all other outputs are installed directly into the prefix.
+The installed files are recorded in a manifest in the prefix, which 'dbt uninstall' uses to remove them.`,
+	RunE: runInstall,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall [--prefix=DIR]",
+	Args:  cobra.NoArgs,
+	Short: "Removes all files installed by 'dbt install'",
+	Long:  `Removes all files that 'dbt install' recorded in the manifest of the prefix directory.`,
+	RunE:  runUninstall,
+}
+
+var installPrefix string
+var installSymlink bool
+
+func init() {
+	rootCmd.AddCommand(installCmd)
+	installCmd.Flags().StringVar(&installPrefix, "prefix", "", "Install into DIR (default: BUILD/INSTALL)")
+	installCmd.Flags().BoolVar(&installSymlink, "symlink", false, "Symlink the outputs instead of copying them")
+	addSetFlag(installCmd)
+
+	rootCmd.AddCommand(uninstallCmd)
+	uninstallCmd.Flags().StringVar(&installPrefix, "prefix", "", "Uninstall from DIR (default: BUILD/INSTALL)")
+}
+
+func installPrefixDir() (string, error) {
+	prefix := installPrefix
+	if prefix == "" {
+		workspaceRoot, err := util.GetWorkspaceRoot()
+		if err != nil {
+			return "", err
+		}
+		return path.Join(workspaceRoot, buildDirName, defaultInstallDirName), nil
+	}
+	if !path.IsAbs(prefix) {
+		workingDir, err := util.GetWorkingDir()
+		if err != nil {
+			return "", err
+		}
+		prefix = path.Join(workingDir, prefix)
+	}
+	return path.Clean(prefix), nil
+}
+
+func readInstallManifest(prefix string) (installManifest, error) {
+	manifest := installManifest{}
+	if manifestPath := path.Join(prefix, installManifestFileName); util.FileExists(manifestPath) {
+		if err := util.ReadJson(manifestPath, &manifest); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func runInstall(cmd *cobra.Command, args []string) error {
+	args, err := withSetFlags(args)
+	if err != nil {
+		return err
+	}
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "No targets specified.\n")
+	}
+	if err := runBuild(args, modeBuild, nil); err != nil {
+		return err
+	}
+
+	genInput.ListOutputs = true
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+	sort.Strings(targets)
+
+	// Maps install destinations relative to the prefix to the absolute paths of the outputs.
+	installs := map[string]string{}
+	for _, name := range targets {
+		target := genOutput.Targets[name]
+		targetInstalls := target.Installs
+		if len(targetInstalls) == 0 {
+			targetInstalls = map[string]string{}
+			for _, output := range target.Outputs {
+				targetInstalls[path.Base(output)] = output
+			}
+		}
+		for destination, output := range targetInstalls {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			destination = path.Clean(destination)
+			if path.IsAbs(destination) || destination == ".." || strings.HasPrefix(destination, "../") {
+				return log.Errorf("Target '%s' installs '%s' outside of the prefix.\n", name, destination)
+			}
+			if destination == "." {
+				return log.Errorf("Target '%s' installs '%s' to the prefix itself.\n", name, output)
+			}
+			if other, exists := installs[destination]; exists && other != output {
+				return log.Errorf("Both '%s' and '%s' are installed to '%s'.\n", other, output, destination)
+			}
+			installs[destination] = output
+		}
+	}
+
+	prefix, err := installPrefixDir()
+	if err != nil {
+		return err
+	}
+	manifest, err := readInstallManifest(prefix)
+	if err != nil {
+		return err
+	}
+	installed := map[string]bool{}
+	for _, file := range manifest.Files {
+		installed[file] = true
+	}
+	for _, destination := range sortMapKeys(installs) {
+		files, err := installOutput(installs[destination], prefix, destination)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			installed[file] = true
+		}
+	}
+
+	manifest.Files = sortMapKeys(installed)
+	if err := util.WriteJson(path.Join(prefix, installManifestFileName), &manifest); err != nil {
+		return err
+	}
+	log.Success("Installed %d outputs into '%s'.\n", len(installs), prefix)
+	return nil
+}
+
+// installOutput installs the file or directory `output` to `destination` inside `prefix` and
+// returns the installed files relative to the prefix.
+func installOutput(output, prefix, destination string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(output, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return log.Errorf("Failed to install '%s': %s.\n", output, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(output, filePath)
+		file := path.Join(destination, relPath)
+		if err := installFile(filePath, path.Join(prefix, file), info.Mode()); err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Installed '%s' to '%s'.\n", output, destination)
+	return files, nil
+}
+
+func installFile(source, destination string, mode os.FileMode) error {
+	if err := util.MkdirAll(path.Dir(destination)); err != nil {
+		return err
+	}
+	if err := os.Remove(destination); err != nil && !os.IsNotExist(err) {
+		return log.Errorf("Failed to replace '%s': %s.\n", destination, err)
+	}
+	if installSymlink {
+		if err := os.Symlink(source, destination); err != nil {
+			return log.Errorf("Failed to create symlink '%s': %s.\n", destination, err)
+		}
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return log.Errorf("Failed to open '%s': %s.\n", source, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return log.Errorf("Failed to create '%s': %s.\n", destination, err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return log.Errorf("Failed to copy '%s' to '%s': %s.\n", source, destination, err)
+	}
+	return nil
+}
+
+func runUninstall(cmd *cobra.Command, args []string) error {
+	prefix, err := installPrefixDir()
+	if err != nil {
+		return err
+	}
+	manifestPath := path.Join(prefix, installManifestFileName)
+	if !util.FileExists(manifestPath) {
+		return log.Errorf("There is no install manifest in '%s'.\n", prefix)
+	}
+	manifest, err := readInstallManifest(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		filePath := path.Join(prefix, file)
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return log.Errorf("Failed to remove '%s': %s.\n", filePath, err)
+		}
+		// Remove directories that became empty, but never the prefix itself.
+		for dir := path.Dir(filePath); dir != prefix && strings.HasPrefix(dir, prefix+"/"); dir = path.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	if err := os.Remove(manifestPath); err != nil {
+		return log.Errorf("Failed to remove '%s': %s.\n", manifestPath, err)
+	}
+	log.Success("Removed %d files from '%s'.\n", len(manifest.Files), prefix)
+	return nil
+}
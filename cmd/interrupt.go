@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+// interruptGracePeriod is how long a child process may take to terminate after DBT forwarded an
+// interruption to it before it is killed.
+const interruptGracePeriod = 10 * time.Second
+
+// errInterrupted is returned for child processes that DBT interrupted.
+var errInterrupted = errors.New("interrupted")
+
+// runInterruptible runs `cmd` and forwards SIGINT and SIGTERM that DBT receives meanwhile to it
+// instead of terminating DBT, so that DBT can clean up once the command terminated. With
+// `ownGroup`, the command runs in its own process group and the signals are forwarded to the whole
+// group. Commands that do not terminate within interruptGracePeriod are killed. It returns
+// errInterrupted if the command was interrupted.
+func runInterruptible(cmd *exec.Cmd, ownGroup bool) error {
+	if ownGroup {
+		startProcessGroup(cmd)
+	}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	name := path.Base(cmd.Path)
+	pid := cmd.Process.Pid
+	var kill <-chan time.Time
+	for {
+		select {
+		case err := <-done:
+			if kill != nil {
+				return errInterrupted
+			}
+			return err
+		case sig := <-signals:
+			if kill == nil {
+				log.Warning("Interrupted. Waiting for '%s' to terminate.\n", name)
+				kill = time.After(interruptGracePeriod)
+			}
+			// Processes in the same process group as DBT already got SIGINT from the terminal, but
+			// forwarding it again is harmless.
+			signalProcess(pid, ownGroup, sig)
+		case <-kill:
+			log.Warning("'%s' did not terminate within %s. Killing it.\n", name, interruptGracePeriod)
+			signalProcess(pid, ownGroup, os.Kill)
+		}
+	}
+}
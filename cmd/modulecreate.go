@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const defaultModuleRoot = "modules"
+
+// Content of the files of a new module. The package name replaces all "%[1]s", the module
+// name all "%[2]s".
+const moduleRulesStub = `package %[1]s
+
+import (
+	"fmt"
+
+	"dbt-rules/RULES/core"
+)
+
+// Copy copies Src to Out.
+type Copy struct {
+	Out core.OutPath
+	Src core.Path
+}
+
+// Build implements core.BuildRule.
+func (rule Copy) Build(ctx core.Context) {
+	ctx.AddBuildStep(core.BuildStep{
+		Out:   rule.Out,
+		In:    rule.Src,
+		Cmd:   fmt.Sprintf("cp %%q %%q", rule.Src, rule.Out),
+		Descr: fmt.Sprintf("CP %%s", rule.Out),
+	})
+}
+`
+
+const moduleBuildFileStub = `package %[1]s
+
+import "%[2]s/RULES/%[1]s"
+
+var example = %[1]s.Copy{
+	Out: out("example.txt"),
+	Src: in("example.txt"),
+}
+`
+
+const moduleExampleFile = "This file is copied by the example target in BUILD.go.\n"
+
+var modulesCreateCmd = &cobra.Command{
+	Use:   "create NAME [--root=DIR] [--git]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Creates a new module in the workspace",
+	Long: `Creates the skeleton of a new module in the module root DIR (default: 'modules' in the
+workspace root): a MODULE file, a RULES package with a stub build rule and a BUILD.go file with
+an example target. Unless DIR is already a module root, it is added to 'module-roots' in the
+MODULE file of the workspace, so that the new module is part of the workspace right away.`,
+	RunE: runModulesCreate,
+}
+
+var moduleCreateRoot string
+var moduleCreateGit bool
+
+func init() {
+	modulesCmd.AddCommand(modulesCreateCmd)
+	modulesCreateCmd.Flags().StringVar(&moduleCreateRoot, "root", defaultModuleRoot, "Module root to create the module in, relative to the workspace root")
+	modulesCreateCmd.Flags().BoolVar(&moduleCreateGit, "git", false, "Initialize a git repository in the new module")
+}
+
+func runModulesCreate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := checkName(name); err != nil {
+		return err
+	}
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modulePaths, err := module.GetAllModulePaths(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	if existing, exists := modulePaths[name]; exists {
+		return log.Errorf("Module '%s' already exists in '%s'.\n", name, existing.Path)
+	}
+
+	root := moduleCreateRoot
+	if !path.IsAbs(root) {
+		root = path.Join(workspaceRoot, root)
+	}
+	root = path.Clean(root)
+	if root == path.Join(workspaceRoot, util.DepsDirName) {
+		return log.Errorf("Modules in %s/ are managed by 'dbt sync'. Choose another module root.\n", util.DepsDirName)
+	}
+	modulePath := path.Join(root, name)
+	if util.DirExists(modulePath) {
+		return log.Errorf("Directory '%s' already exists.\n", modulePath)
+	}
+
+	pkg := strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	if err := util.MkdirAll(path.Join(modulePath, rulesDirName, pkg)); err != nil {
+		return err
+	}
+	if err := module.WriteModuleFile(modulePath, module.ModuleFile{Dependencies: map[string]module.Dependency{}}); err != nil {
+		return err
+	}
+	files := map[string]string{
+		path.Join(modulePath, rulesDirName, pkg, pkg+".go"): fmt.Sprintf(moduleRulesStub, pkg, name),
+		path.Join(modulePath, buildFileName):                fmt.Sprintf(moduleBuildFileStub, pkg, name),
+		path.Join(modulePath, "example.txt"):                moduleExampleFile,
+	}
+	for filePath, content := range files {
+		if err := util.WriteFile(filePath, []byte(content)); err != nil {
+			return err
+		}
+	}
+
+	if moduleCreateGit {
+		gitCmd := exec.Command("git", "init", "-q")
+		gitCmd.Dir = modulePath
+		if output, err := gitCmd.CombinedOutput(); err != nil {
+			return log.Errorf("Failed to initialize git repository: %s.\n%s", err, output)
+		}
+	}
+
+	if err := registerModuleRoot(workspaceRoot, root); err != nil {
+		return err
+	}
+	log.Success("Created module '%s' in '%s'.\n", name, modulePath)
+	return nil
+}
+
+// registerModuleRoot adds `root` to the module roots of the workspace unless it is one already.
+func registerModuleRoot(workspaceRoot, root string) error {
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	for _, existing := range moduleFile.ModuleRoots {
+		if !path.IsAbs(existing) {
+			existing = path.Join(workspaceRoot, existing)
+		}
+		if path.Clean(existing) == root {
+			return nil
+		}
+	}
+	declared := root
+	if relative := strings.TrimPrefix(root, workspaceRoot+"/"); relative != root {
+		declared = relative
+	}
+	moduleFile.ModuleRoots = append(moduleFile.ModuleRoots, declared)
+	if err := module.WriteModuleFile(workspaceRoot, moduleFile); err != nil {
+		return err
+	}
+	log.Log("Added module root '%s' to the %s file of the workspace.\n", declared, util.ModuleFileName)
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var modulesCmd = &cobra.Command{
+	Use:     "modules",
+	Aliases: []string{"module"},
+	Short:   "Inspects and creates the modules of the workspace",
+}
+
+var modulesListCmd = &cobra.Command{
+	Use:   "list",
+	Args:  cobra.NoArgs,
+	Short: "Lists all modules of the workspace and where they resolved from",
+	Long: `Lists all modules of the workspace together with their path and the directory they were found
+in: the workspace itself, the DEPS/ directory or one of the module roots declared with
+'module-roots' in the MODULE file. Modules with the same name in module roots of lower
+precedence are listed as shadowed.`,
+	RunE: runModulesList,
+}
+
+func init() {
+	rootCmd.AddCommand(modulesCmd)
+	modulesCmd.AddCommand(modulesListCmd)
+}
+
+func runModulesList(cmd *cobra.Command, args []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modulePaths, err := module.GetAllModulePaths(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	names := sortMapKeys(modulePaths)
+
+	sources := map[string]string{}
+	nameWidth, pathWidth := len("NAME"), len("PATH")
+	for _, name := range names {
+		modulePath := modulePaths[name]
+		switch modulePath.Root {
+		case workspaceRoot:
+			sources[name] = "workspace"
+		case path.Join(workspaceRoot, util.DepsDirName):
+			sources[name] = util.DepsDirName + "/"
+		default:
+			sources[name] = modulePath.Root
+		}
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+		if len(modulePath.Path) > pathWidth {
+			pathWidth = len(modulePath.Path)
+		}
+	}
+
+	fmt.Printf("%-*s  %-*s  %s\n", nameWidth, "NAME", pathWidth, "PATH", "SOURCE")
+	for _, name := range names {
+		fmt.Printf("%-*s  %-*s  %s\n", nameWidth, name, pathWidth, modulePaths[name].Path, sources[name])
+		for _, shadowed := range modulePaths[name].Shadowed {
+			fmt.Printf("%-*s  %-*s  %s\n", nameWidth, "", pathWidth, shadowed, "(shadowed)")
+		}
+	}
+	return nil
+}
+
+// readWorkspaceModuleFile returns the MODULE file of the workspace.
+func readWorkspaceModuleFile() (module.ModuleFile, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return module.ModuleFile{}, err
+	}
+	return module.ReadModuleFile(workspaceRoot)
+}
+
+// workspaceModules returns all modules of the workspace by name.
+func workspaceModules() (map[string]module.Module, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	return module.GetAllModules(workspaceRoot)
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// The oldest ninja version that supports all features used by DBT.
+var minNinjaVersion = [3]int{1, 10, 0}
+
+// The ninja release that is downloaded if ninja is not installed.
+const pinnedNinjaVersion = "1.11.1"
+const ninjaReleaseUrl = "https://github.com/ninja-build/ninja/releases/download/v%s/%s"
+
+// ninjaReleaseDigests are the SHA256 digests of the archives of the pinned ninja release by
+// platform. Downloaded archives with another digest are rejected.
+var ninjaReleaseDigests = map[string]string{
+	"ninja-linux.zip": "b901ba96e486dce377f9a070ed4ef3f79deb45f4ffe2938f8e7ddc69cfb3df77",
+	"ninja-mac.zip":   "482ecb23c59ae3d4f158029112de172dd96bb0e97549c4b1ca32d8fad11f873e",
+}
+
+// ninjaBinFlag overrides the ninja binary set in the DBT configuration file.
+var ninjaBinFlag string
+
+// ninjaBin is the ninja binary, resolved on first use.
+var ninjaBin string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&ninjaBinFlag, "ninja-bin", "", "path to the ninja binary")
+}
+
+// getNinjaBin returns the path of the ninja binary to use. It is taken from the --ninja-bin flag,
+// the DBT configuration file or PATH (in this order). If ninja can not be found, a pinned release
+// is downloaded (unless disabled in the DBT configuration file).
+func getNinjaBin() (string, error) {
+	if ninjaBin != "" {
+		return ninjaBin, nil
+	}
+
+	bin := findNinjaBin()
+	if bin == "" {
+		if !config.GetConfig().NinjaDownload {
+			return "", util.Fail(util.NinjaNotFound, nil, "Could not find ninja.\n")
+		}
+		var err error
+		if bin, err = downloadNinja(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := checkNinjaVersion(bin); err != nil {
+		return "", err
+	}
+	ninjaBin = bin
+	return ninjaBin, nil
+}
+
+// findNinjaBin returns the ninja binary from the --ninja-bin flag, the DBT configuration file or
+// PATH, or an empty string if there is none.
+func findNinjaBin() string {
+	bin := ninjaBinFlag
+	if bin == "" {
+		bin = config.GetConfig().NinjaBin
+	}
+	if bin == "" {
+		if pathBin, err := exec.LookPath("ninja"); err == nil {
+			bin = pathBin
+		}
+	}
+	return bin
+}
+
+func checkNinjaVersion(bin string) error {
+	versionString, supported, err := ninjaVersion(bin)
+	if err != nil {
+		return log.Errorf("Failed to determine the version of ninja: %s.\n", err)
+	}
+	log.Debug("Using ninja %s from '%s'.\n", versionString, bin)
+	if !supported {
+		return log.Errorf("'%s' has version %s, but DBT requires ninja >= %d.%d.%d.\n", bin, versionString, minNinjaVersion[0], minNinjaVersion[1], minNinjaVersion[2])
+	}
+	return nil
+}
+
+// ninjaVersion returns the version of the ninja binary `bin` and whether DBT supports it.
+func ninjaVersion(bin string) (string, bool, error) {
+	output, err := exec.Command(bin, "--version").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("running '%s --version' failed: %s", bin, err)
+	}
+	versionString := strings.TrimSpace(string(output))
+
+	version := [3]int{}
+	for idx, part := range strings.SplitN(versionString, ".", 4) {
+		if idx >= len(version) {
+			break
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return versionString, false, fmt.Errorf("failed to parse ninja version '%s'", versionString)
+		}
+		version[idx] = number
+	}
+
+	for idx := range version {
+		if version[idx] != minNinjaVersion[idx] {
+			return versionString, version[idx] > minNinjaVersion[idx], nil
+		}
+	}
+	return versionString, true, nil
+}
+
+// downloadNinja downloads the pinned ninja release into the user's cache directory (unless it
+// has been downloaded before), verifies its digest and returns the path of the binary.
+func downloadNinja() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", log.Errorf("Could not find ninja and failed to locate the cache directory to download it to: %s.\n", err)
+	}
+	bin := path.Join(cacheDir, "dbt", "ninja-"+pinnedNinjaVersion, "ninja")
+	if util.FileExists(bin) {
+		return bin, nil
+	}
+
+	archiveName := ""
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "linux/amd64":
+		archiveName = "ninja-linux.zip"
+	case "darwin/amd64", "darwin/arm64":
+		archiveName = "ninja-mac.zip"
+	default:
+		return "", util.Fail(util.NinjaNotFound, nil, "Could not find ninja and there is no ninja release for %s/%s.\n", runtime.GOOS, runtime.GOARCH)
+	}
+
+	url := fmt.Sprintf(ninjaReleaseUrl, pinnedNinjaVersion, archiveName)
+	log.Log("Could not find ninja. Downloading '%s'.\n", url)
+	response, err := http.Get(url)
+	if err != nil {
+		return "", log.Errorf("Failed to download ninja: %s.\n", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", log.Errorf("Failed to download ninja: %s.\n", response.Status)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", log.Errorf("Failed to download ninja: %s.\n", err)
+	}
+	if digest := fmt.Sprintf("%x", sha256.Sum256(data)); digest != ninjaReleaseDigests[archiveName] {
+		return "", log.Errorf("The downloaded '%s' has the SHA256 digest %s instead of %s. Install ninja manually.\n", url, digest, ninjaReleaseDigests[archiveName])
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", log.Errorf("Failed to open ninja archive: %s.\n", err)
+	}
+	for _, file := range archive.File {
+		if file.Name != "ninja" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return "", log.Errorf("Failed to extract ninja: %s.\n", err)
+		}
+		defer reader.Close()
+		content, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return "", log.Errorf("Failed to extract ninja: %s.\n", err)
+		}
+		if err := util.WriteFile(bin, content); err != nil {
+			return "", err
+		}
+		if err := os.Chmod(bin, 0755); err != nil {
+			return "", log.Errorf("Failed to change filemode of '%s': %s.\n", bin, err)
+		}
+		return bin, nil
+	}
+
+	return "", log.Errorf("The ninja archive does not contain a ninja binary.\n")
+}
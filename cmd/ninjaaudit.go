@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+// auditNinja makes builds audit the generated ninja file for unescaped input before building.
+var auditNinja bool
+
+// Variables that ninja defines for every build statement.
+var ninjaBuiltinVariables = map[string]bool{"in": true, "in_newline": true, "out": true}
+
+// ninjaEscape escapes `text` for use as a path or variable value in a ninja file. Ninja paths
+// can not contain newlines.
+func ninjaEscape(text string) string {
+	return strings.NewReplacer("$", "$$", " ", "$ ", ":", "$:").Replace(text)
+}
+
+// ninjaStatement is a top-level statement of a ninja file with its indented bindings.
+type ninjaStatement struct {
+	line int
+	// kind is the keyword of the statement ("rule", "build", "pool", "default", "include",
+	// "subninja") or "let" for variable definitions.
+	kind     string
+	text     string
+	bindings []ninjaBinding
+}
+
+type ninjaBinding struct {
+	line  int
+	key   string
+	value string
+}
+
+// parseNinjaFile splits `ninjaFile` into statements. Continued lines are joined, comments are dropped.
+func parseNinjaFile(ninjaFile string) []ninjaStatement {
+	statements := []ninjaStatement{}
+	lines := strings.Split(ninjaFile, "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		lineNumber := idx + 1
+		line := lines[idx]
+		for continuesOnNextLine(line) && idx+1 < len(lines) {
+			idx++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[idx], " ")
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, " ") {
+			parts := strings.SplitN(trimmed, "=", 2)
+			if len(statements) > 0 && len(parts) == 2 {
+				current := &statements[len(statements)-1]
+				current.bindings = append(current.bindings, ninjaBinding{
+					line:  lineNumber,
+					key:   strings.TrimSpace(parts[0]),
+					value: strings.TrimLeft(parts[1], " "),
+				})
+			}
+			continue
+		}
+
+		statement := ninjaStatement{line: lineNumber, kind: "let", text: trimmed}
+		for _, keyword := range []string{"rule", "build", "pool", "default", "include", "subninja"} {
+			if strings.HasPrefix(trimmed, keyword+" ") {
+				statement.kind = keyword
+				statement.text = strings.TrimSpace(strings.TrimPrefix(trimmed, keyword))
+			}
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// ninjaVariableRefs returns the names of the variables referenced in `text` and all invalid $-escapes.
+func ninjaVariableRefs(text string) ([]string, []string) {
+	names := []string{}
+	invalid := []string{}
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] != '$' {
+			continue
+		}
+		idx++
+		if idx == len(text) {
+			invalid = append(invalid, "$")
+			break
+		}
+		switch c := text[idx]; {
+		case c == '$' || c == ' ' || c == ':':
+		case c == '{':
+			end := strings.IndexByte(text[idx:], '}')
+			if end < 0 {
+				invalid = append(invalid, text[idx-1:])
+				return names, invalid
+			}
+			names = append(names, text[idx+1:idx+end])
+			idx += end
+		case isNinjaVariableChar(c):
+			start := idx
+			for idx < len(text) && isNinjaVariableChar(text[idx]) {
+				idx++
+			}
+			names = append(names, text[start:idx])
+			idx--
+		default:
+			invalid = append(invalid, text[idx-1:idx+1])
+		}
+	}
+	return names, invalid
+}
+
+func isNinjaVariableChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+// evaluateNinjaPaths splits `text` into paths at unescaped spaces and evaluates them with `vars`.
+func evaluateNinjaPaths(text string, vars map[string]string) []string {
+	paths := []string{}
+	current := ""
+	for idx := 0; idx < len(text); idx++ {
+		c := text[idx]
+		switch {
+		case c == ' ':
+			if current != "" {
+				paths = append(paths, current)
+			}
+			current = ""
+		case c != '$' || idx+1 == len(text):
+			current += string(c)
+		case text[idx+1] == '{' && strings.IndexByte(text[idx:], '}') > 0:
+			end := idx + strings.IndexByte(text[idx:], '}')
+			current += vars[text[idx+2:end]]
+			idx = end
+		case isNinjaVariableChar(text[idx+1]):
+			end := idx + 1
+			for end < len(text) && isNinjaVariableChar(text[end]) {
+				end++
+			}
+			current += vars[text[idx+1:end]]
+			idx = end - 1
+		default:
+			current += string(text[idx+1])
+			idx++
+		}
+	}
+	if current != "" {
+		paths = append(paths, current)
+	}
+	return paths
+}
+
+// splitBuildStatement splits the text of a build statement at the first unescaped colon.
+func splitBuildStatement(text string) (string, string) {
+	for idx := 0; idx < len(text); idx++ {
+		if text[idx] == '$' {
+			idx++
+		} else if text[idx] == ':' {
+			return text[:idx], text[idx+1:]
+		}
+	}
+	return text, ""
+}
+
+// auditNinjaFile reports variable references that ninja would silently expand to empty strings,
+// invalid $-escapes and outputs of targets that are not produced by any build statement. These are
+// usually caused by rules that emit paths or other input without escaping '$', spaces, colons or
+// newlines. The build fails if any problem is found.
+func auditNinjaFile(outputDir string, output generatorOutput) error {
+	statements := parseNinjaFile(output.NinjaFile)
+	globals := map[string]string{}
+	// Rule bindings can reference the bindings of the rule and of all build statements using the rule.
+	ruleVars := map[string]map[string]bool{}
+	for _, statement := range statements {
+		switch statement.kind {
+		case "let":
+			parts := strings.SplitN(statement.text, "=", 2)
+			if len(parts) == 2 {
+				globals[strings.TrimSpace(parts[0])] = strings.Join(evaluateNinjaPaths(strings.TrimLeft(parts[1], " "), globals), " ")
+			}
+		case "rule":
+			if ruleVars[statement.text] == nil {
+				ruleVars[statement.text] = map[string]bool{}
+			}
+			for _, binding := range statement.bindings {
+				ruleVars[statement.text][binding.key] = true
+			}
+		case "build":
+			_, inputs := splitBuildStatement(statement.text)
+			fields := strings.Fields(inputs)
+			if len(fields) == 0 {
+				continue
+			}
+			rule := fields[0]
+			if ruleVars[rule] == nil {
+				ruleVars[rule] = map[string]bool{}
+			}
+			for _, binding := range statement.bindings {
+				ruleVars[rule][binding.key] = true
+			}
+		}
+	}
+
+	problems := []string{}
+	check := func(line int, context, text string, scopes ...map[string]bool) {
+		names, invalid := ninjaVariableRefs(text)
+		for _, escape := range invalid {
+			problems = append(problems, fmt.Sprintf("line %d: %s contains the invalid escape '%s'", line, context, escape))
+		}
+	names:
+		for _, name := range names {
+			if _, exists := globals[name]; exists {
+				continue
+			}
+			for _, scope := range scopes {
+				if scope[name] {
+					continue names
+				}
+			}
+			problems = append(problems, fmt.Sprintf("line %d: %s references the undefined variable '%s'", line, context, name))
+		}
+	}
+
+	nodes := map[string]bool{}
+	for _, statement := range statements {
+		switch statement.kind {
+		case "let":
+			check(statement.line, "the variable definition", statement.text)
+		case "rule":
+			for _, binding := range statement.bindings {
+				check(binding.line, fmt.Sprintf("'%s' of rule '%s'", binding.key, statement.text), binding.value, ruleVars[statement.text], ninjaBuiltinVariables)
+			}
+		case "build":
+			// Bindings of build statements are evaluated in the file scope, paths can also reference the bindings.
+			edgeVars := map[string]string{}
+			edgeScope := map[string]bool{}
+			for _, binding := range statement.bindings {
+				check(binding.line, fmt.Sprintf("'%s' of the build statement", binding.key), binding.value)
+				edgeVars[binding.key] = strings.Join(evaluateNinjaPaths(binding.value, globals), " ")
+				edgeScope[binding.key] = true
+			}
+			check(statement.line, "the build statement", statement.text, edgeScope)
+			for name, value := range globals {
+				if _, exists := edgeVars[name]; !exists {
+					edgeVars[name] = value
+				}
+			}
+			outputs, _ := splitBuildStatement(statement.text)
+			for _, node := range evaluateNinjaPaths(outputs, edgeVars) {
+				nodes[path.Clean(node)] = true
+			}
+		default:
+			check(statement.line, fmt.Sprintf("the %s statement", statement.kind), statement.text)
+		}
+	}
+
+	for _, name := range sortMapKeys(output.Targets) {
+		for _, targetOutput := range output.Targets[name].Outputs {
+			if !strings.ContainsAny(targetOutput, "$ :\n") {
+				continue
+			}
+			relPath := targetOutput
+			if path.IsAbs(targetOutput) && strings.HasPrefix(targetOutput, outputDir+"/") {
+				relPath = strings.TrimPrefix(targetOutput, outputDir+"/")
+			}
+			if !nodes[path.Clean(targetOutput)] && !nodes[path.Clean(relPath)] {
+				problems = append(problems, fmt.Sprintf("output '%s' of target '%s' is not produced by any build statement", targetOutput, targetID(name)))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		log.Success("The ninja file contains no unescaped input.\n")
+		return nil
+	}
+	for _, problem := range problems {
+		log.Warning("%s.\n", problem)
+	}
+	return log.Errorf("The ninja file contains %d problems, most likely caused by rules that do not escape '$', spaces, colons or newlines.\n", len(problems))
+}
+
+// reportNinjaConflicts reports rules that are defined more than once, which ninja rejects, and
+// top-level variables that are redefined with a different value, which silently changes the value
+// for all statements that follow. Both usually mean that two RULES packages emit the same global
+// definitions.
+func reportNinjaConflicts(ninjaFile string) {
+	ruleLines := map[string][]int{}
+	variableLines := map[string][]int{}
+	variableValues := map[string]string{}
+	for _, statement := range parseNinjaFile(ninjaFile) {
+		switch statement.kind {
+		case "rule":
+			ruleLines[statement.text] = append(ruleLines[statement.text], statement.line)
+		case "let":
+			parts := strings.SplitN(statement.text, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			name := strings.TrimSpace(parts[0])
+			value := strings.TrimLeft(parts[1], " ")
+			if previous, exists := variableValues[name]; !exists || previous != value {
+				variableLines[name] = append(variableLines[name], statement.line)
+			}
+			variableValues[name] = value
+		}
+	}
+
+	for _, name := range sortMapKeys(ruleLines) {
+		if lines := ruleLines[name]; len(lines) > 1 {
+			log.Error("Rule '%s' is defined more than once (lines %s).\n", name, formatLineNumbers(lines))
+		}
+	}
+	for _, name := range sortMapKeys(variableLines) {
+		if lines := variableLines[name]; len(lines) > 1 {
+			log.Warning("Variable '%s' is redefined with different values (lines %s).\n", name, formatLineNumbers(lines))
+		}
+	}
+}
+
+func formatLineNumbers(lines []int) string {
+	numbers := []string{}
+	for _, line := range lines {
+		numbers = append(numbers, fmt.Sprint(line))
+	}
+	return strings.Join(numbers, ", ")
+}
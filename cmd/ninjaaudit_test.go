@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// hostileFileNames are paths with characters that are special to ninja or the shell.
+var hostileFileNames = []string{
+	"plain/file.txt",
+	"with space/file name.txt",
+	"dollar/$HOME/$$x",
+	"dollar/${out}",
+	"colon/c:file:name",
+	"quote/it's \"quoted\"",
+	"mixed/$ :a b:$",
+	"glob/*?[a]",
+	"semicolon/a;b&c|d",
+	"backslash/a\\b",
+}
+
+func TestNinjaEscapeHasNoVariableReferences(t *testing.T) {
+	for _, name := range hostileFileNames {
+		names, invalid := ninjaVariableRefs(ninjaEscape(name))
+		if len(names) != 0 || len(invalid) != 0 {
+			t.Errorf("ninjaEscape(%q) references variables %q and has invalid escapes %q", name, names, invalid)
+		}
+	}
+}
+
+func TestNinjaEscapeRoundTrip(t *testing.T) {
+	for _, name := range hostileFileNames {
+		if expanded := expandNinjaText(ninjaEscape(name), nil); expanded != name {
+			t.Errorf("expandNinjaText(ninjaEscape(%q)) = %q", name, expanded)
+		}
+	}
+}
+
+func TestNinjaEscapeIsOnePath(t *testing.T) {
+	for _, name := range hostileFileNames {
+		escaped := ninjaEscape(name)
+		if paths := evaluateNinjaPaths(escaped, nil); !reflect.DeepEqual(paths, []string{name}) {
+			t.Errorf("evaluateNinjaPaths(%q) = %q, want one path %q", escaped, paths, name)
+		}
+		statement := escaped + ": phony " + escaped
+		if outputs, inputs := splitBuildStatement(statement); outputs != escaped || inputs != " phony "+escaped {
+			t.Errorf("splitBuildStatement(%q) = %q, %q", statement, outputs, inputs)
+		}
+	}
+}
+
+func TestShellEscapePaths(t *testing.T) {
+	escaped := shellEscapePaths(append([]string{""}, hostileFileNames...))
+	for idx, name := range append([]string{""}, hostileFileNames...) {
+		output, err := exec.Command("sh", "-c", `printf '%s' `+escaped[idx]).Output()
+		if err != nil {
+			t.Fatalf("sh -c %q: %s", escaped[idx], err)
+		}
+		if string(output) != name {
+			t.Errorf("shellEscapePaths(%q) = %q, which the shell reads as %q", name, escaped[idx], output)
+		}
+	}
+}
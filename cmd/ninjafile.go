@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const invalidNinjaFileName = "build.ninja.invalid"
+const lastGoodOutputFileName = "last-good-output.json"
+
+// useLastGood makes builds reuse the last generator output that produced a valid ninja file
+// instead of running the generator.
+var useLastGood bool
+
+// addUseLastGoodFlag registers the `--use-last-good` flag on `cmd`.
+func addUseLastGoodFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&useLastGood, "use-last-good", false, "Skip the generator and build with the last known-good ninja file")
+}
+
+// generateOrReuse runs the generator, unless `--use-last-good` was given, in which case the last
+// known-good generator output for the output directory is returned.
+func generateOrReuse(input generatorInput) (generatorOutput, error) {
+	if !useLastGood {
+		return runGenerator(input)
+	}
+
+	lastGoodPath := path.Join(input.OutputDir, lastGoodOutputFileName)
+	if !util.FileExists(lastGoodPath) {
+		return generatorOutput{}, log.Errorf("There is no known-good ninja file for output directory '%s'.\n", input.OutputDir)
+	}
+	log.Warning("Skipping the generator and using the last known-good ninja file. Changes to BUILD.go files are ignored.\n")
+	var output generatorOutput
+	err := util.ReadJson(lastGoodPath, &output)
+	return output, err
+}
+
+// writeNinjaFile writes the ninja file of `output` to `outputDir`. The ninja file is first written
+// to a temporary file and only replaces the existing ninja file once ninja has parsed it
+// successfully, so that a failing generator never leaves a truncated ninja file behind.
+func writeNinjaFile(outputDir string, output generatorOutput) error {
+	ninjaFilePath := path.Join(outputDir, ninjaFileName)
+	tmpFilePath := ninjaFilePath + ".tmp"
+	log.Debug("Ninja file: %s.\n", ninjaFilePath)
+	ninjaFile := output.NinjaFile
+	if strings.Contains(ninjaFile, resourceClassVar) || strings.Contains(ninjaFile, resourceTimeoutVar) {
+		bin, err := os.Executable()
+		if err != nil {
+			return log.Errorf("Failed to locate the dbt binary: %s.\n", err)
+		}
+		if ninjaFile, err = applyResourceClasses(ninjaFile, bin); err != nil {
+			return err
+		}
+	}
+	digest, err := environmentDigest(outputDir)
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		ninjaFile = addEnvironmentDigest(ninjaFile, digest)
+	}
+	if err := util.WriteFile(tmpFilePath, []byte(ninjaFile)); err != nil {
+		return err
+	}
+	reportNinjaConflicts(output.NinjaFile)
+
+	// Listing all targets makes ninja parse the whole file without building anything.
+	var stdout bytes.Buffer
+	if err := tryRunNinja(outputDir, &stdout, []string{"-f", path.Base(tmpFilePath), "-t", "targets", "all"}); err != nil {
+		invalidFilePath := path.Join(outputDir, invalidNinjaFileName)
+		if err := os.Rename(tmpFilePath, invalidFilePath); err != nil {
+			return log.Errorf("Failed to rename '%s': %s.\n", tmpFilePath, err)
+		}
+		return log.ErrorfWithCode(log.ExitGenerator, nil, "The generated ninja file is invalid and has been kept as '%s'. Use --use-last-good to build with the last known-good ninja file.\n", invalidFilePath)
+	}
+
+	cacheConfig, err := remoteCacheConfig()
+	if err != nil {
+		return err
+	}
+	if cacheConfig.URL != "" {
+		err = enableRemoteCache(outputDir, path.Base(tmpFilePath), cacheConfig, output.Toolchains)
+	} else {
+		err = disableRemoteCache(outputDir)
+	}
+	if err != nil {
+		return err
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		return log.Errorf("Failed to locate the dbt binary: %s.\n", err)
+	}
+	data, err := util.ReadFile(tmpFilePath)
+	if err != nil {
+		return err
+	}
+	wrapped, numRules := wrapCacheableRules(string(data), bin)
+	if err := util.WriteFile(tmpFilePath, []byte(wrapped)); err != nil {
+		return err
+	}
+	log.Debug("Wrapped %d rules for the remote cache.\n", numRules)
+
+	if err := os.Rename(tmpFilePath, ninjaFilePath); err != nil {
+		return log.Errorf("Failed to rename '%s' to '%s': %s.\n", tmpFilePath, ninjaFilePath, err)
+	}
+	if !useLastGood {
+		return util.WriteJson(path.Join(outputDir, lastGoodOutputFileName), &output)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const actualNinjaFileName = "build.ninja.actual"
+
+// Placeholders for the machine-specific paths in golden ninja files.
+const (
+	outputDirPlaceholder     = "<OUTPUT_DIR>"
+	workspaceRootPlaceholder = "<WORKSPACE>"
+)
+
+// emitNinjaOnly makes builds stop after writing the ninja file.
+var emitNinjaOnly bool
+
+// ninjaGoldenFile is the golden file that the generated ninja file is compared with if not empty.
+var ninjaGoldenFile string
+
+// normalizeNinjaFile replaces the paths of the output directory and the workspace root in
+// `ninjaFile` with placeholders, so that ninja files generated in different workspaces can be
+// compared.
+func normalizeNinjaFile(ninjaFile, outputDir, workspaceRoot string) string {
+	ninjaFile = strings.ReplaceAll(ninjaFile, outputDir, outputDirPlaceholder)
+	return strings.ReplaceAll(ninjaFile, workspaceRoot, workspaceRootPlaceholder)
+}
+
+// checkNinjaGolden compares the ninja file generated by the rules with the golden file `golden`
+// and fails with a diff if they differ. With --update-goldens, the golden file is rewritten or
+// created instead. A missing golden file fails the check, so that a mistyped path or a golden file
+// that was never committed does not let CI pass.
+func checkNinjaGolden(golden, outputDir string, genOutput generatorOutput) error {
+	if !path.IsAbs(golden) {
+		workingDir, err := util.GetWorkingDir()
+		if err != nil {
+			return err
+		}
+		golden = path.Join(workingDir, golden)
+	}
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	actual := normalizeNinjaFile(genOutput.NinjaFile, outputDir, workspaceRoot)
+	if updateGoldens {
+		if err := util.WriteFile(golden, []byte(actual)); err != nil {
+			return err
+		}
+		log.Success("Wrote the golden ninja file '%s'.\n", golden)
+		return nil
+	}
+	if !util.FileExists(golden) {
+		return log.Errorf("The golden file '%s' does not exist. Use --update-goldens to create it.\n", golden)
+	}
+	expected, err := util.ReadFile(golden)
+	if err != nil {
+		return err
+	}
+	if string(expected) == actual {
+		log.Success("The ninja file matches the golden file '%s'.\n", golden)
+		return nil
+	}
+
+	actualPath := path.Join(outputDir, actualNinjaFileName)
+	if err := util.WriteFile(actualPath, []byte(actual)); err != nil {
+		return err
+	}
+	diffCmd := exec.Command("git", "diff", "--no-index", "--no-color", "--", golden, actualPath)
+	// git diff exits with status 1 if the files differ.
+	output, _ := diffCmd.CombinedOutput()
+	return log.Errorf("The ninja file differs from the golden file '%s' and has been kept as '%s'. Use --update-goldens to accept the changes.\n%s", golden, actualPath, output)
+}
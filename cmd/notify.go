@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// Builds shorter than this are not notified about unless 'min-duration' is configured.
+const defaultNotificationMinDuration = time.Minute
+
+const webhookTimeout = 10 * time.Second
+
+// buildNotification is the payload POSTed to the notification webhook.
+type buildNotification struct {
+	Command    string
+	WorkingDir string
+	OutputDir  string
+	Targets    []string
+	Success    bool
+	Time       time.Time
+	// Duration is the duration of the build in seconds.
+	Duration float64
+}
+
+// notificationConfig returns the notification settings of the workspace, overridden by the ones
+// in the DBT configuration file of the user. The webhook is only taken from the DBT configuration,
+// since it receives information about the user.
+func notificationConfig() (config.Notifications, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return config.Notifications{}, err
+	}
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return config.Notifications{}, err
+	}
+	notifications := moduleFile.Notifications
+	if notifications.Webhook != "" {
+		log.Warning("Ignoring the notification webhook in the %s file. It can only be set in the DBT configuration file of the user.\n", util.ModuleFileName)
+	}
+	userNotifications := config.GetConfig().Notifications
+	if userNotifications.MinDuration != "" {
+		notifications.MinDuration = userNotifications.MinDuration
+	}
+	notifications.Webhook = userNotifications.Webhook
+	notifications.Desktop = notifications.Desktop || userNotifications.Desktop
+	return notifications, nil
+}
+
+// notifyBuildResult sends a desktop notification and POSTs to the webhook (if configured) once a
+// build that took long enough has finished. Failing to notify never fails the build.
+func notifyBuildResult(event buildEvent) {
+	notifications, err := notificationConfig()
+	if err != nil {
+		log.Warning("Failed to read the notification settings: %s.\n", err)
+		return
+	}
+	if !notifications.Desktop && notifications.Webhook == "" {
+		return
+	}
+	minDuration := defaultNotificationMinDuration
+	if notifications.MinDuration != "" {
+		if minDuration, err = time.ParseDuration(notifications.MinDuration); err != nil {
+			log.Warning("Invalid notification 'min-duration' '%s': %s.\n", notifications.MinDuration, err)
+			return
+		}
+	}
+	duration := event.GeneratorDuration + event.Duration
+	if duration < minDuration {
+		return
+	}
+
+	if notifications.Desktop {
+		title := fmt.Sprintf("DBT build %s", event.status())
+		message := fmt.Sprintf("'%s' %s after %s.", event.commandLine(), event.status(), duration.Round(time.Second))
+		if err := sendDesktopNotification(title, message); err != nil {
+			log.Warning("Failed to send desktop notification: %s.\n", err)
+		}
+	}
+	if notifications.Webhook != "" {
+		notification := buildNotification{
+			Command:    event.commandLine(),
+			WorkingDir: event.WorkingDir,
+			OutputDir:  event.OutputDir,
+			Targets:    event.Targets,
+			Success:    event.Success,
+			Time:       event.Time,
+			Duration:   duration.Seconds(),
+		}
+		if err := postWebhook(notifications.Webhook, notification); err != nil {
+			log.Warning("Failed to notify webhook '%s': %s.\n", notifications.Webhook, err)
+		}
+	}
+}
+
+func sendDesktopNotification(title, message string) error {
+	var notifyCmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		notifyCmd = exec.Command("notify-send", title, message)
+	case "darwin":
+		notifyCmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title))
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	if output, err := notifyCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func postWebhook(webhookURL string, notification buildNotification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: webhookTimeout}
+	response, err := client.Post(webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("%s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// latestLinkName is the name of the symlink in BUILD/ to the output directory of the last
+// successful build.
+const latestLinkName = "latest"
+
+// updateOutputDirLinks points the symlinks BUILD/latest and, for builds with a build config,
+// BUILD/<config> to `outputDir`.
+func updateOutputDirLinks(outputDir, configName string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	names := []string{latestLinkName}
+	if configName != "" {
+		names = append(names, configName)
+	}
+	target := outputDir
+	if relPath, err := filepath.Rel(buildDir, outputDir); err == nil && relPath != ".." && !strings.HasPrefix(relPath, "../") {
+		target = relPath
+	}
+	for _, name := range names {
+		linkPath := path.Join(buildDir, name)
+		if info, err := os.Lstat(linkPath); err == nil && info.Mode()&os.ModeSymlink == 0 {
+			log.Warning("Not linking '%s' to the output directory, because it is not a symlink.\n", linkPath)
+			continue
+		}
+		// The new link replaces the old one atomically, so that scripts never see it missing.
+		tmpPath := linkPath + ".tmp"
+		os.Remove(tmpPath)
+		if err := os.Symlink(target, tmpPath); err != nil {
+			log.Warning("Failed to create '%s': %s.\n", tmpPath, err)
+			continue
+		}
+		if err := os.Rename(tmpPath, linkPath); err != nil {
+			log.Warning("Failed to update '%s': %s.\n", linkPath, err)
+		}
+	}
+	return nil
+}
+
+// removeDanglingOutputDirLinks removes the symlinks in `buildDir` whose output directory no
+// longer exists.
+func removeDanglingOutputDirLinks(buildDir string) {
+	files, err := ioutil.ReadDir(buildDir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		linkPath := path.Join(buildDir, file.Name())
+		if file.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if _, err := os.Stat(linkPath); os.IsNotExist(err) {
+			os.Remove(linkPath)
+		}
+	}
+}
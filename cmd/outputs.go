@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/daedaleanai/dbt/log"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var outputsCmd = &cobra.Command{
+	Use:   "outputs [patterns] [build flags] [--dir]",
+	Short: "Prints the output files of the targets",
+	Long: `Prints the absolute paths of the output files of the targets without building them.
+The build flags must match the ones used to build the targets. With --dir, the output directory
+for the build flags is printed instead. BUILD/latest links to the output directory of the last
+successful build and BUILD/<config> to the one of the last successful build with that config.`,
+	RunE: runOutputs,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeOutputs)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var outputsDir bool
+
+func init() {
+	rootCmd.AddCommand(outputsCmd)
+	outputsCmd.Flags().BoolVar(&outputsDir, "dir", false, "Print the output directory for the build flags")
+}
+
+func runOutputs(cmd *cobra.Command, args []string) error {
+	if outputsDir {
+		outputDir, err := outputDirForFlags(args)
+		if err != nil {
+			return err
+		}
+		fmt.Println(outputDir)
+		return nil
+	}
+	outputs, err := targetOutputs(args)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		fmt.Println(output)
+	}
+	return nil
+}
+
+// outputDirForFlags returns the output directory of builds with the build flags in `args`.
+func outputDirForFlags(args []string) (string, error) {
+	_, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return "", err
+	}
+	genInput.PersistFlags = false
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return "", err
+	}
+	if genOutput.BuildDir != "" {
+		return genOutput.BuildDir, nil
+	}
+	return genInput.OutputDir, nil
+}
+
+// targetOutputs returns the absolute paths of the output files of all targets matching the
+// patterns in `args` when built with the build flags in `args`.
+func targetOutputs(args []string) ([]string, error) {
+	outputsByTarget, err := outputsOfTargets(args)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []string{}
+	for _, name := range sortMapKeys(outputsByTarget) {
+		outputs = append(outputs, outputsByTarget[name]...)
+	}
+	return outputs, nil
+}
+
+// outputsOfTargets maps all targets matching the patterns in `args` to the absolute paths of their
+// output files when built with the build flags in `args`.
+func outputsOfTargets(args []string) (map[string][]string, error) {
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, log.ErrorfWithCode(log.ExitUsage, nil, "No targets specified.\n")
+	}
+	genInput.ListOutputs = true
+	// Looking up outputs, e.g. of another build config, must not change the flags of the next build.
+	genInput.PersistFlags = false
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, log.Errorf("No targets match the given patterns.\n")
+	}
+
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+	outputs := map[string][]string{}
+	for _, name := range targets {
+		outputs[name] = []string{}
+		for _, output := range genOutput.Targets[name].Outputs {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			outputs[name] = append(outputs[name], output)
+		}
+	}
+	return outputs, nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+// isInteractiveTerminal reports whether stdin and stdout are connected to a terminal.
+func isInteractiveTerminal() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether `file` is connected to a terminal.
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// pickTargets lets the user interactively select targets and flag values and returns them as
+// command-line arguments. It uses fzf if it is installed and a numbered prompt otherwise.
+func pickTargets(mode mode, genOutput generatorOutput) []string {
+	entries := []string{}
+	for _, name := range sortMapKeys(genOutput.Targets) {
+		target := genOutput.Targets[name]
+		if skipTarget(mode, target) {
+			continue
+		}
+		entry := targetID(name)
+		if target.Description != "" {
+			entry = fmt.Sprintf("%s\t%s", entry, target.Description)
+		}
+		entries = append(entries, entry)
+	}
+	for _, name := range sortMapKeys(genOutput.Flags) {
+		for _, value := range genOutput.Flags[name].AllowedValues {
+			entries = append(entries, fmt.Sprintf("%s=%s\t%s", name, value, genOutput.Flags[name].Description))
+		}
+	}
+
+	var selected []string
+	if _, err := exec.LookPath("fzf"); err == nil {
+		selected = pickWithFzf(entries)
+	} else {
+		selected = pickWithPrompt(entries)
+	}
+
+	args := []string{}
+	for _, entry := range selected {
+		args = append(args, strings.SplitN(entry, "\t", 2)[0])
+	}
+	sort.SliceStable(args, func(i, j int) bool {
+		// Targets first, flags last.
+		return !strings.Contains(args[i], "=") && strings.Contains(args[j], "=")
+	})
+	return args
+}
+
+func pickWithFzf(entries []string) []string {
+	var stdout bytes.Buffer
+	fzfCmd := exec.Command("fzf", "--multi", "--delimiter=\t", "--prompt=dbt> ", "--header=TAB selects multiple targets and flags")
+	fzfCmd.Stdin = strings.NewReader(strings.Join(entries, "\n"))
+	fzfCmd.Stdout = &stdout
+	fzfCmd.Stderr = os.Stderr
+	if err := fzfCmd.Run(); err != nil {
+		// fzf exits with a non-zero code if the selection was aborted.
+		log.Debug("fzf did not return a selection: %s.\n", err)
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(stdout.String()), "\n")
+}
+
+func pickWithPrompt(entries []string) []string {
+	for idx, entry := range entries {
+		parts := strings.SplitN(entry, "\t", 2)
+		fmt.Printf("%4d  %s", idx+1, parts[0])
+		if len(parts) > 1 && parts[1] != "" {
+			fmt.Printf("  (%s)", parts[1])
+		}
+		fmt.Println()
+	}
+	fmt.Print("\nSelect targets and flags (numbers separated by spaces): ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil
+	}
+
+	selected := []string{}
+	for _, field := range strings.Fields(line) {
+		idx, err := strconv.Atoi(field)
+		if err != nil || idx < 1 || idx > len(entries) {
+			log.Warning("Ignoring invalid selection '%s'.\n", field)
+			continue
+		}
+		selected = append(selected, entries[idx-1])
+	}
+	return selected
+}
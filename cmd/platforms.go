@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// platformsFlagName is a reserved build flag that builds the targets for several platforms
+// in a single invocation. For each platform, the generator is run with `platform=<name>`
+// and the outputs are placed in a platform-specific subdirectory of the output directory.
+const platformsFlagName = "platforms"
+const platformFlagName = "platform"
+
+// platformNinjaFileName is the name of the ninja file of a platform that the ninja file of a
+// multi-platform build includes.
+const platformNinjaFileName = "platform.ninja"
+
+// platformBuild collects the targets of a multi-platform build while the generator runs for
+// each of the platforms.
+type platformBuild struct {
+	// platform is the platform that the generator currently runs for.
+	platform string
+	// targets maps the platforms to the names of their selected targets.
+	targets map[string][]string
+	// ninjaTargets are the targets of all platforms to pass to ninja.
+	ninjaTargets []string
+}
+
+// pendingPlatforms makes runBuild add the selected targets to the multi-platform build instead of
+// building them.
+var pendingPlatforms *platformBuild
+
+// add adds the selected targets `targets` of the current platform and the corresponding ninja
+// targets `ninjaTargets`. Ninja targets with relative paths are relative to the output directory
+// of the platform.
+func (build *platformBuild) add(targets, ninjaTargets []string) {
+	build.targets[build.platform] = append(build.targets[build.platform], targets...)
+	for _, target := range ninjaTargets {
+		if !path.IsAbs(target) {
+			target = path.Join(build.platform, target)
+		}
+		build.ninjaTargets = append(build.ninjaTargets, target)
+	}
+}
+
+// targetIDs returns the IDs of the targets of all platforms, each followed by its platform.
+func (build *platformBuild) targetIDs() []string {
+	ids := []string{}
+	for _, platform := range sortMapKeys(build.targets) {
+		for _, id := range targetIDs(build.targets[platform]) {
+			ids = append(ids, fmt.Sprintf("%s (%s)", id, platform))
+		}
+	}
+	return ids
+}
+
+// splitPlatforms removes the `platforms=` flag from `args` and returns the listed platforms
+// together with the remaining arguments.
+func splitPlatforms(args []string) ([]string, []string) {
+	platforms := []string{}
+	remaining := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, platformsFlagName+"=") {
+			remaining = append(remaining, arg)
+			continue
+		}
+		for _, platform := range strings.Split(strings.TrimPrefix(arg, platformsFlagName+"="), ",") {
+			if platform = strings.TrimSpace(platform); platform != "" {
+				platforms = append(platforms, platform)
+			}
+		}
+	}
+	return platforms, remaining
+}
+
+// checkMultiPlatformBuild fails for the modes and flags that process the outputs of the targets
+// of a single platform after the build.
+func checkMultiPlatformBuild(mode mode) error {
+	if mode == modeCoverage {
+		return log.Errorf("Coverage reports are not supported for builds for multiple platforms.\n")
+	}
+	flags := map[string]bool{
+		"--commands":       commandList,
+		"--compdb":         commandDb,
+		"--graph":          dependencyGraph,
+		"--sbom":           sbomFormat != "",
+		"--sign":           signOutputs,
+		"--update-goldens": updateGoldens,
+	}
+	for _, name := range sortMapKeys(flags) {
+		if flags[name] {
+			return log.Errorf("%s is not supported for builds for multiple platforms.\n", name)
+		}
+	}
+	if updateWarnings {
+		return log.Errorf("The warnings baseline can not be updated by builds for multiple platforms.\n")
+	}
+	return nil
+}
+
+// runMultiPlatformBuild runs the generator once per platform, each into its own output directory,
+// and builds the targets of all platforms with a single ninja invocation. The ninja file in the
+// output directory includes the ninja files of the platforms with "subninja".
+func runMultiPlatformBuild(platforms, args []string, mode mode, modeArgs []string) error {
+	if err := checkMultiPlatformBuild(mode); err != nil {
+		return err
+	}
+	_, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+
+	build := &platformBuild{targets: map[string][]string{}}
+	generatorStartTime := time.Now()
+	for _, platform := range platforms {
+		if strings.Contains(platform, "/") {
+			return log.Errorf("Platform name '%s' must not contain '/'.\n", platform)
+		}
+		log.Log("Generating the ninja file for platform '%s'.\n", platform)
+		// The platform-specific flags come last so that they take precedence.
+		platformArgs := append(append([]string{}, args...),
+			fmt.Sprintf("%s=%s", platformFlagName, platform),
+			fmt.Sprintf("%s=%s", outputDirFlagName, path.Join(outputDir, platform)))
+		build.platform = platform
+		pendingPlatforms = build
+		err := runBuild(platformArgs, mode, modeArgs)
+		pendingPlatforms = nil
+		if err != nil {
+			return err
+		}
+	}
+	generatorDuration := time.Since(generatorStartTime)
+
+	if err := writePlatformsNinjaFile(outputDir, platforms); err != nil {
+		return err
+	}
+	if emitNinjaOnly {
+		log.Success("Wrote '%s'.\n", path.Join(outputDir, ninjaFileName))
+		return nil
+	}
+	if len(build.ninjaTargets) == 0 {
+		return nil
+	}
+
+	console := mode == modeRun && progress == nil && isTerminal(os.Stdout)
+	stdout, bar := ninjaStdout(console)
+	progress.Emit(progressEvent{Phase: phaseBuild, Targets: build.targetIDs()})
+	var ninjaOutput bytes.Buffer
+	if !console {
+		stdout = io.MultiWriter(stdout, &ninjaOutput)
+	}
+	logOffset := ninjaLogSize(outputDir)
+	workingDir, err := util.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	ninjaErr := tryRunNinja(outputDir, stdout, append(ninjaOptionArgs(), build.ninjaTargets...))
+	bar.Finish()
+	interrupted := ninjaErr == errInterrupted
+	progress.Emit(progressEvent{Phase: phaseDone, Targets: build.targetIDs(), Success: ninjaErr == nil, Interrupted: interrupted})
+
+	actions, err := recordActions(outputDir, logOffset, ninjaOutput.String())
+	if err != nil {
+		return err
+	}
+	if err := recordCacheStats(outputDir, actions); err != nil {
+		return err
+	}
+	failedActions := 0
+	for _, action := range actions {
+		if action.Failed {
+			failedActions++
+		}
+	}
+	event := buildEvent{
+		Time:              startTime,
+		WorkingDir:        workingDir,
+		OutputDir:         outputDir,
+		Args:              os.Args[1:],
+		Flags:             genInput.CmdlineFlags,
+		Targets:           build.targetIDs(),
+		Duration:          time.Since(startTime),
+		Success:           ninjaErr == nil,
+		Interrupted:       interrupted,
+		GeneratorDuration: generatorDuration,
+		Actions:           len(actions),
+		FailedActions:     failedActions,
+	}
+	if err := recordBuildEvent(event); err != nil {
+		return err
+	}
+	notifyBuildResult(event)
+	if interrupted {
+		return log.ErrorfWithCode(log.ExitInterrupted, nil, "The build was interrupted.\n")
+	}
+	if ninjaErr != nil {
+		return log.ErrorfWithCode(log.ExitNinja, nil, "Running ninja failed: %s\n", ninjaErr)
+	}
+	if !console {
+		allTargets := []string{}
+		for _, platform := range platforms {
+			allTargets = append(allTargets, build.targets[platform]...)
+		}
+		if err := checkWarnings(ninjaOutput.String(), allTargets); err != nil {
+			return err
+		}
+	}
+	if config.GetConfig().Permissions.Normalize {
+		normalizeBuildPermissions(outputDir)
+	}
+	if mode != modeClean {
+		for _, platform := range platforms {
+			if err := runHooks(hookStagePostBuild, path.Join(outputDir, platform), build.targets[platform]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePlatformsNinjaFile writes the ninja file of a multi-platform build to `outputDir`. For each
+// platform, the ninja file in its subdirectory is rewritten to be included with "subninja". Pools
+// are global in ninja, so they are declared once by the including ninja file.
+func writePlatformsNinjaFile(outputDir string, platforms []string) error {
+	pools := map[string]ninjaStatement{}
+	var ninjaFile strings.Builder
+	for _, platform := range platforms {
+		platformDir := path.Join(outputDir, platform)
+		data, err := util.ReadFile(path.Join(platformDir, ninjaFileName))
+		if err != nil {
+			return err
+		}
+		platformFile, platformPools := prefixNinjaFile(string(data), platform)
+		for _, pool := range platformPools {
+			if declared, exists := pools[pool.text]; exists && formatNinjaStatement(declared) != formatNinjaStatement(pool) {
+				return log.Errorf("The platforms declare the ninja pool '%s' differently.\n", pool.text)
+			}
+			pools[pool.text] = pool
+		}
+		if err := util.WriteFile(path.Join(platformDir, platformNinjaFileName), []byte(platformFile)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&ninjaFile, "subninja %s\n", ninjaEscape(path.Join(platform, platformNinjaFileName)))
+	}
+	var pooled strings.Builder
+	for _, name := range sortMapKeys(pools) {
+		pooled.WriteString(formatNinjaStatement(pools[name]))
+	}
+	return util.WriteFile(path.Join(outputDir, ninjaFileName), []byte(pooled.String()+ninjaFile.String()))
+}
+
+// prefixNinjaFile rewrites the ninja file `ninjaFile` of the platform `platform` to be included
+// with "subninja" by a ninja file in the parent directory. Ninja resolves the paths of included
+// files relative to the directory it runs in, so the relative paths of build, default, include
+// and subninja statements are prefixed with the platform's subdirectory. Paths that refer to
+// variables and the commands of rules are kept as they are. The pool declarations are removed
+// from the ninja file and returned separately.
+func prefixNinjaFile(ninjaFile, platform string) (string, []ninjaStatement) {
+	prefix := ninjaEscape(platform) + "/"
+	pools := []ninjaStatement{}
+	var prefixed strings.Builder
+	for _, statement := range parseNinjaFile(ninjaFile) {
+		switch statement.kind {
+		case "pool":
+			pools = append(pools, statement)
+			continue
+		case "build":
+			outputs, inputs := splitBuildStatement(statement.text)
+			// The first word after the colon is the rule.
+			statement.text = prefixNinjaPaths(outputs, prefix, 0) + ": " + prefixNinjaPaths(inputs, prefix, 1)
+		case "default", "include", "subninja":
+			statement.text = prefixNinjaPaths(statement.text, prefix, 0)
+		}
+		prefixed.WriteString(formatNinjaStatement(statement))
+	}
+	return prefixed.String(), pools
+}
+
+// prefixNinjaPaths prefixes the relative paths in the space-separated list `text` with `prefix`,
+// skipping the first `skip` words.
+func prefixNinjaPaths(text, prefix string, skip int) string {
+	words := splitNinjaPaths(text)
+	for idx, word := range words {
+		if idx < skip || word == "|" || word == "||" || word == "|@" || strings.HasPrefix(word, "/") {
+			continue
+		}
+		if names, _ := ninjaVariableRefs(word); len(names) > 0 {
+			continue
+		}
+		words[idx] = prefix + word
+	}
+	return strings.Join(words, " ")
+}
+
+// splitNinjaPaths splits `text` at unescaped spaces without evaluating it.
+func splitNinjaPaths(text string) []string {
+	words := []string{}
+	current := ""
+	for idx := 0; idx < len(text); idx++ {
+		switch {
+		case text[idx] == ' ':
+			if current != "" {
+				words = append(words, current)
+			}
+			current = ""
+		case text[idx] == '$' && idx+1 < len(text):
+			current += text[idx : idx+2]
+			idx++
+		default:
+			current += string(text[idx])
+		}
+	}
+	if current != "" {
+		words = append(words, current)
+	}
+	return words
+}
+
+// formatNinjaStatement returns the text of `statement` in a ninja file.
+func formatNinjaStatement(statement ninjaStatement) string {
+	var text strings.Builder
+	if statement.kind != "let" {
+		text.WriteString(statement.kind + " ")
+	}
+	text.WriteString(statement.text + "\n")
+	for _, binding := range statement.bindings {
+		fmt.Fprintf(&text, "  %s = %s\n", binding.key, binding.value)
+	}
+	return text.String()
+}
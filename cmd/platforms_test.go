@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+)
+
+const platformNinjaFile = `pool link
+  depth = 2
+rule cc
+  command = cc -c $in -o $out
+  pool = link
+build /abs/with$ space.o out/a.o: cc src.c | $dir/h.h || gen
+build app/main: phony /abs/with$ space.o out/a.o
+default app/main
+`
+
+const prefixedPlatformNinjaFile = `rule cc
+  command = cc -c $in -o $out
+  pool = link
+build /abs/with$ space.o armv7/out/a.o: cc armv7/src.c | $dir/h.h || armv7/gen
+build armv7/app/main: phony /abs/with$ space.o armv7/out/a.o
+default armv7/app/main
+`
+
+func TestPrefixNinjaFile(t *testing.T) {
+	prefixed, pools := prefixNinjaFile(platformNinjaFile, "armv7")
+	if prefixed != prefixedPlatformNinjaFile {
+		t.Errorf("prefixNinjaFile() =\n%s\nwant\n%s", prefixed, prefixedPlatformNinjaFile)
+	}
+	if len(pools) != 1 || formatNinjaStatement(pools[0]) != "pool link\n  depth = 2\n" {
+		t.Errorf("prefixNinjaFile() returned the pools %v", pools)
+	}
+}
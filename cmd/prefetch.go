@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var prefetchCmd = &cobra.Command{
+	Use:   "prefetch",
+	Args:  cobra.NoArgs,
+	Short: "Downloads everything the next sync and build need ahead of time",
+	Long: `Updates the local mirror with all dependencies of the workspace, downloads the pinned ninja
+release if ninja is not installed and runs the generator once for every build config of the
+workspace, which fills the Go build cache. Checked-out modules and output directories are not
+changed. The command is meant to be run from cron jobs or login hooks, so that the first sync
+and build of the day are fast even on slow networks. Outside of a workspace, only ninja is
+downloaded.`,
+	RunE: runPrefetch,
+}
+
+func init() {
+	rootCmd.AddCommand(prefetchCmd)
+}
+
+func runPrefetch(cmd *cobra.Command, args []string) error {
+	if findNinjaBin() == "" && config.GetConfig().NinjaDownload {
+		ninjaBin, err := downloadNinja()
+		if err != nil {
+			return err
+		}
+		log.Success("Ninja is available at '%s'.\n", ninjaBin)
+	}
+
+	workspaceRoot, err := util.FindWorkspaceRoot()
+	if err != nil {
+		log.Log("Not inside a workspace. Skipping the dependencies and the generator.\n")
+		return nil
+	}
+	failures, err := prefetchDependencies(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	if failures > 0 {
+		return log.Errorf("Failed to update the mirror of %d dependencies.\n", failures)
+	}
+	if err := prefetchGenerator(workspaceRoot); err != nil {
+		return err
+	}
+	log.Success("Prefetching done.\n")
+	return nil
+}
+
+// prefetchDependencies updates the local mirror with the dependencies of all modules in the
+// workspace and returns the number of dependencies that could not be updated.
+func prefetchDependencies(workspaceRoot string) (int, error) {
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return 0, err
+	}
+	dependencies := map[string]module.Dependency{}
+	for _, mod := range modules {
+		moduleFile, err := module.ReadModuleFile(mod.RootPath())
+		if err != nil {
+			return 0, err
+		}
+		for _, dep := range moduleFile.Dependencies {
+			dependencies[dep.URL] = dep
+		}
+	}
+
+	failures := 0
+	for _, url := range sortMapKeys(dependencies) {
+		log.Log("Updating the mirror of '%s'.\n", url)
+		hasMirror, err := module.UpdateMirror(url, dependencies[url].Type)
+		if !hasMirror && err == nil {
+			log.Warning("No local mirror is configured. Set 'mirror' in the DBT configuration file to prefetch dependencies.\n")
+			return 0, nil
+		}
+		if err != nil {
+			log.Warning("Failed to update the mirror of '%s': %s.\n", url, err)
+			failures++
+		}
+	}
+	return failures, nil
+}
+
+// prefetchGenerator runs the generator for every build config of the workspace (or once with
+// the default flags if there are none).
+func prefetchGenerator(workspaceRoot string) error {
+	dbtRulesDir := path.Join(workspaceRoot, util.DepsDirName, dbtRulesDirName)
+	if !module.IsQuickstartWorkspace(workspaceRoot) && !util.DirExists(dbtRulesDir) {
+		log.Warning("%s/ does not contain %s. Run 'dbt sync' before prefetching for the generator.\n", util.DepsDirName, dbtRulesDirName)
+		return nil
+	}
+
+	moduleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	configArgs := [][]string{{}}
+	if configs := moduleFile.Configs; len(configs) > 0 {
+		configArgs = [][]string{}
+		for _, name := range sortMapKeys(configs) {
+			configArgs = append(configArgs, []string{fmt.Sprintf("%s=%s", configFlagName, name)})
+		}
+	}
+
+	for _, args := range configArgs {
+		_, genInput, err := newGeneratorInput(args)
+		if err != nil {
+			return err
+		}
+		// Prefetching must not change the flags persisted for the next build.
+		genInput.PersistFlags = false
+		log.Log("Running the generator for output directory '%s'.\n", genInput.OutputDir)
+		if _, err := runGenerator(genInput); err != nil {
+			return err
+		}
+	}
+	return nil
+}
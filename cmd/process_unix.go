@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+	"unsafe"
+)
+
+// startProcessGroup makes `cmd` run in a process group of its own.
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// detachProcess makes `cmd` run in a session of its own, detached from the terminal.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// signalProcess sends `sig` to the process `pid` or, with `group`, to its process group. Failures
+// are ignored, the process may have terminated already.
+func signalProcess(pid int, group bool, sig os.Signal) {
+	if group {
+		pid = -pid
+	}
+	syscall.Kill(pid, sig.(syscall.Signal))
+}
+
+// replaceProcess runs `bin` with the arguments `args` and the environment `env` in place of DBT.
+// It only returns if that fails.
+func replaceProcess(bin string, args, env []string) error {
+	return syscall.Exec(bin, append([]string{bin}, args...), env)
+}
+
+// terminalWidth returns the number of columns of the terminal `file` is connected to.
+func terminalWidth(file *os.File) int {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 || size.cols == 0 {
+		return defaultTerminalWidth
+	}
+	return int(size.cols)
+}
+
+// daemonSocketDirOwner returns the uid of the owner of the directory of the daemon socket
+// `socketPath`.
+func daemonSocketDirOwner(socketPath string) (int, error) {
+	info, err := os.Lstat(path.Dir(socketPath))
+	if err != nil {
+		return -1, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok {
+		return -1, fmt.Errorf("'%s' is not a directory", path.Dir(socketPath))
+	}
+	return int(stat.Uid), nil
+}
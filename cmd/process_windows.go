@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+)
+
+// startProcessGroup does nothing, because Ctrl+C reaches all processes attached to the console on
+// Windows.
+func startProcessGroup(cmd *exec.Cmd) {}
+
+// detachProcess does nothing, because processes on Windows outlive the console they started from.
+func detachProcess(cmd *exec.Cmd) {}
+
+// signalProcess kills the process `pid` for os.Kill. Other signals can not be sent on Windows and
+// are ignored, processes attached to the console got Ctrl+C already. Process groups are not
+// supported, `group` only kills the process itself.
+func signalProcess(pid int, group bool, sig os.Signal) {
+	if sig != os.Kill {
+		return
+	}
+	if process, err := os.FindProcess(pid); err == nil {
+		process.Kill()
+	}
+}
+
+// replaceProcess runs `bin` with the arguments `args` and the environment `env` and exits with
+// its exit code, because Windows can not replace the running process. It only returns if `bin`
+// can not be started.
+func replaceProcess(bin string, args, env []string) error {
+	cmd := exec.Command(bin, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	cmd.Wait()
+	os.Exit(cmd.ProcessState.ExitCode())
+	return nil
+}
+
+// terminalWidth returns the default width, the console size is not queried on Windows.
+func terminalWidth(file *os.File) int {
+	return defaultTerminalWidth
+}
+
+// daemonSocketDirOwner returns the uid of DBT, because files have no owning uid on Windows.
+func daemonSocketDirOwner(socketPath string) (int, error) {
+	info, err := os.Lstat(path.Dir(socketPath))
+	if err != nil {
+		return -1, err
+	}
+	if !info.IsDir() {
+		return -1, fmt.Errorf("'%s' is not a directory", path.Dir(socketPath))
+	}
+	return os.Getuid(), nil
+}
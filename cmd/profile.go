@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+type traceEvent struct {
+	Name     string `json:"name"`
+	Phase    string `json:"ph"`
+	Time     int64  `json:"ts"`
+	Duration int64  `json:"dur"`
+	Pid      int    `json:"pid"`
+	Tid      int    `json:"tid"`
+}
+
+type trace struct {
+	TraceEvents []traceEvent `json:"traceEvents"`
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile [--trace=FILE]",
+	Args:  cobra.NoArgs,
+	Short: "Shows where the time of the last build was spent",
+	Long: `Shows how much time the last build spent in the generator and in ninja, the slowest actions
+and the critical path (the longest chain of dependent actions). With --trace, a trace of all
+actions is written in the Chrome trace format, which can be opened in chrome://tracing.`,
+	RunE: runProfile,
+}
+
+var profileLength int
+var profileTraceFile string
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.Flags().IntVarP(&profileLength, "number", "n", 10, "Number of slowest actions to list")
+	profileCmd.Flags().StringVar(&profileTraceFile, "trace", "", "Write a Chrome trace to FILE")
+}
+
+func runProfile(cmd *cobra.Command, args []string) error {
+	history, err := readHistory()
+	if err != nil {
+		return err
+	}
+	event, exists := lastNinjaBuild(history)
+	if !exists {
+		return log.Errorf("No builds have been recorded yet.\n")
+	}
+	actionsFilePath := path.Join(event.OutputDir, actionsFileName)
+	if !util.FileExists(actionsFilePath) {
+		return log.Errorf("No actions have been recorded for the last build.\n")
+	}
+	var actions actionLog
+	if err := util.ReadJson(actionsFilePath, &actions); err != nil {
+		return err
+	}
+
+	fmt.Printf("Build:     %s\n", event.commandLine())
+	fmt.Printf("Generator: %s\n", event.GeneratorDuration.Round(time.Millisecond))
+	fmt.Printf("Ninja:     %s (%d actions)\n", event.Duration.Round(time.Millisecond), len(actions.Actions))
+
+	slowest := append([]action{}, actions.Actions...)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].Duration > slowest[j].Duration
+	})
+	if profileLength >= 0 && len(slowest) > profileLength {
+		slowest = slowest[:profileLength]
+	}
+	fmt.Println("\nSlowest actions:")
+	for _, action := range slowest {
+		fmt.Printf("  %9s  %s\n", action.Duration.Round(time.Millisecond), strings.Join(action.Outputs, " "))
+	}
+
+	criticalPath := findCriticalPath(actions)
+	total := time.Duration(0)
+	for _, action := range criticalPath {
+		total += action.Duration
+	}
+	fmt.Printf("\nCritical path (%s):\n", total.Round(time.Millisecond))
+	for _, action := range criticalPath {
+		fmt.Printf("  %9s  %s\n", action.Duration.Round(time.Millisecond), strings.Join(action.Outputs, " "))
+	}
+
+	if profileTraceFile != "" {
+		tracePath := profileTraceFile
+		if !path.IsAbs(tracePath) {
+			workingDir, err := util.GetWorkingDir()
+			if err != nil {
+				return err
+			}
+			tracePath = path.Join(workingDir, tracePath)
+		}
+		if err := util.WriteJson(tracePath, buildTrace(event, actions)); err != nil {
+			return err
+		}
+		log.Success("Wrote trace to '%s'.\n", tracePath)
+	}
+	return nil
+}
+
+// findCriticalPath returns the chain of dependent actions with the longest total duration,
+// starting with the action that ran first.
+func findCriticalPath(actions actionLog) []action {
+	outputs := []string{}
+	producers := map[string]int{}
+	for idx, action := range actions.Actions {
+		for _, output := range action.Outputs {
+			producers[output] = idx
+		}
+		if !action.Failed {
+			outputs = append(outputs, action.Outputs[0])
+		}
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+	inputs := ninjaInputs(actions.Dir, outputs)
+
+	// Actions only depend on actions of the same build, as all others were up to date.
+	longest := map[int]time.Duration{}
+	next := map[int]int{}
+	var visit func(idx int) time.Duration
+	visit = func(idx int) time.Duration {
+		if duration, exists := longest[idx]; exists {
+			return duration
+		}
+		next[idx] = -1
+		longestDep := time.Duration(0)
+		for _, input := range inputs[actions.Actions[idx].Outputs[0]] {
+			dep, exists := producers[input]
+			if !exists || dep == idx {
+				continue
+			}
+			if duration := visit(dep); duration > longestDep {
+				longestDep = duration
+				next[idx] = dep
+			}
+		}
+		longest[idx] = actions.Actions[idx].Duration + longestDep
+		return longest[idx]
+	}
+
+	last := 0
+	for idx := range actions.Actions {
+		if visit(idx) > visit(last) {
+			last = idx
+		}
+	}
+
+	chain := []action{}
+	for idx := last; idx >= 0; idx = next[idx] {
+		chain = append([]action{actions.Actions[idx]}, chain...)
+	}
+	return chain
+}
+
+// buildTrace converts the actions of a build into a Chrome trace. Actions are assigned to lanes
+// so that actions running in parallel do not overlap.
+func buildTrace(event buildEvent, actions actionLog) *trace {
+	result := &trace{TraceEvents: []traceEvent{{
+		Name:     "generator",
+		Phase:    "X",
+		Duration: event.GeneratorDuration.Microseconds(),
+		Pid:      1,
+	}}}
+
+	sorted := []action{}
+	for _, action := range actions.Actions {
+		if !action.Failed {
+			sorted = append(sorted, action)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	laneEnds := []time.Duration{}
+	for _, action := range sorted {
+		lane := 0
+		for lane < len(laneEnds) && laneEnds[lane] > action.Start {
+			lane++
+		}
+		if lane == len(laneEnds) {
+			laneEnds = append(laneEnds, 0)
+		}
+		laneEnds[lane] = action.Start + action.Duration
+
+		result.TraceEvents = append(result.TraceEvents, traceEvent{
+			Name:     strings.Join(action.Outputs, " "),
+			Phase:    "X",
+			Time:     (event.GeneratorDuration + action.Start).Microseconds(),
+			Duration: action.Duration.Microseconds(),
+			Pid:      1,
+			Tid:      lane + 1,
+		})
+	}
+	return result
+}
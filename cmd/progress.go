@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+const (
+	phaseGenerate = "generate"
+	phaseBuild    = "build"
+	phaseDone     = "done"
+)
+
+// ninjaStatusFormat is passed to ninja via NINJA_STATUS so that progress can be parsed from its output.
+const ninjaStatusFormat = "[%f/%t] "
+
+var ninjaStatusRegexp = regexp.MustCompile(`^\[(\d+)/(\d+)\] (.*)$`)
+
+type progressEvent struct {
+	Phase       string
+	Completed   int      `json:",omitempty"`
+	Total       int      `json:",omitempty"`
+	Description string   `json:",omitempty"`
+	Targets     []string `json:",omitempty"`
+	Success     bool     `json:",omitempty"`
+	Interrupted bool     `json:",omitempty"`
+}
+
+// progressReporter writes newline-delimited JSON progress events.
+type progressReporter struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+}
+
+var progressFd int
+var progressSocket string
+
+// progress is the active progress reporter. It is nil if no progress should be reported.
+var progress *progressReporter
+
+func openProgressReporter() (*progressReporter, error) {
+	if progressFd >= 0 && progressSocket != "" {
+		return nil, log.ErrorfWithCode(log.ExitUsage, nil, "--progress-fd and --progress-socket can not be used together.\n")
+	}
+	if progressFd >= 0 {
+		file := os.NewFile(uintptr(progressFd), "progress")
+		if file == nil {
+			return nil, log.Errorf("File descriptor %d is not valid.\n", progressFd)
+		}
+		return &progressReporter{out: file}, nil
+	}
+	if progressSocket != "" {
+		conn, err := net.Dial("unix", progressSocket)
+		if err != nil {
+			return nil, log.Errorf("Failed to connect to progress socket '%s': %s.\n", progressSocket, err)
+		}
+		return &progressReporter{out: conn}, nil
+	}
+	return nil, nil
+}
+
+// Emit writes a single progress event. It is a no-op on a nil reporter.
+func (p *progressReporter) Emit(event progressEvent) {
+	if p == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warning("Failed to encode progress event: %s.\n", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.out.Write(append(data, '\n')); err != nil {
+		log.Debug("Failed to write progress event: %s.\n", err)
+	}
+}
+
+// Close closes the underlying file descriptor or socket. It is a no-op on a nil reporter.
+func (p *progressReporter) Close() {
+	if p == nil {
+		return
+	}
+	p.out.Close()
+}
+
+// ninjaProgressWriter forwards ninja's output to `out` and emits a progress event
+// for each status line.
+type ninjaProgressWriter struct {
+	out      io.Writer
+	reporter *progressReporter
+	line     []byte
+}
+
+func (w *ninjaProgressWriter) Write(data []byte) (int, error) {
+	w.line = append(w.line, data...)
+	for {
+		idx := bytes.IndexByte(w.line, '\n')
+		if idx < 0 {
+			break
+		}
+		w.parseLine(string(w.line[:idx]))
+		w.line = w.line[idx+1:]
+	}
+	return w.out.Write(data)
+}
+
+func (w *ninjaProgressWriter) parseLine(line string) {
+	matches := ninjaStatusRegexp.FindStringSubmatch(line)
+	if matches == nil {
+		return
+	}
+	completed, _ := strconv.Atoi(matches[1])
+	total, _ := strconv.Atoi(matches[2])
+	w.reporter.Emit(progressEvent{
+		Phase:       phaseBuild,
+		Completed:   completed,
+		Total:       total,
+		Description: matches[3],
+	})
+}
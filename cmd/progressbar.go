@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultTerminalWidth = 80
+
+// partialLineDelay is how long an incomplete line, e.g. a prompt of an action, is held back before
+// it is printed in place of the progress bar.
+const partialLineDelay = 500 * time.Millisecond
+
+// progressBar renders ninja's status lines as a single line that is redrawn in place. All other
+// output of ninja (e.g., compiler errors and warnings) is printed above the progress bar.
+type progressBar struct {
+	out       io.Writer
+	width     int
+	startTime time.Time
+	status    string
+
+	mutex sync.Mutex
+	line  []byte
+	// shown is the number of bytes of `line` that were printed before the line was complete.
+	shown int
+	timer *time.Timer
+}
+
+func newProgressBar(out *os.File) *progressBar {
+	return &progressBar{out: out, width: terminalWidth(out), startTime: time.Now()}
+}
+
+func (bar *progressBar) Write(data []byte) (int, error) {
+	bar.mutex.Lock()
+	defer bar.mutex.Unlock()
+	bar.line = append(bar.line, data...)
+	for {
+		idx := bytes.IndexByte(bar.line, '\n')
+		if idx < 0 {
+			break
+		}
+		if bar.shown > 0 {
+			// The start of the line replaced the progress bar already.
+			fmt.Fprintf(bar.out, "%s\n%s", bar.line[bar.shown:idx], bar.status)
+			bar.shown = 0
+		} else {
+			bar.printLine(string(bar.line[:idx]))
+		}
+		bar.line = bar.line[idx+1:]
+	}
+	if len(bar.line) > bar.shown && bar.timer == nil {
+		bar.timer = time.AfterFunc(partialLineDelay, bar.printPartialLine)
+	}
+	return len(data), nil
+}
+
+// printPartialLine prints the incomplete line in place of the progress bar up to the last complete
+// rune, so that output without a newline (e.g., a prompt) does not stay hidden.
+func (bar *progressBar) printPartialLine() {
+	bar.mutex.Lock()
+	defer bar.mutex.Unlock()
+	bar.timer = nil
+	end := completeRunesLen(bar.line)
+	if end <= bar.shown {
+		return
+	}
+	if bar.shown == 0 {
+		fmt.Fprint(bar.out, "\r\033[K")
+	}
+	bar.out.Write(bar.line[bar.shown:end])
+	bar.shown = end
+}
+
+// completeRunesLen returns the length of the longest prefix of `data` that does not end with an
+// incomplete UTF-8 encoded rune.
+func completeRunesLen(data []byte) int {
+	for idx := len(data) - 1; idx >= 0 && idx >= len(data)-utf8.UTFMax; idx-- {
+		if utf8.RuneStart(data[idx]) {
+			if !utf8.FullRune(data[idx:]) {
+				return idx
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+func (bar *progressBar) printLine(line string) {
+	matches := ninjaStatusRegexp.FindStringSubmatch(line)
+	if matches == nil {
+		fmt.Fprintf(bar.out, "\r\033[K%s\n%s", line, bar.status)
+		return
+	}
+
+	completed, _ := strconv.Atoi(matches[1])
+	total, _ := strconv.Atoi(matches[2])
+	status := fmt.Sprintf("[%d/%d]", completed, total)
+	if completed > 0 && total > 0 {
+		elapsed := time.Since(bar.startTime)
+		eta := elapsed * time.Duration(total-completed) / time.Duration(completed)
+		status = fmt.Sprintf("%s %3d%% ETA %s", status, completed*100/total, eta.Round(time.Second))
+	}
+	status = fmt.Sprintf("%s %s", status, matches[3])
+	// Truncate at a rune boundary, so that the terminal does not show a broken character.
+	if runes := []rune(status); len(runes) >= bar.width {
+		status = string(runes[:bar.width-1])
+	}
+	bar.status = status
+	fmt.Fprintf(bar.out, "\r\033[K%s", bar.status)
+}
+
+// Finish prints any incomplete line and removes the progress bar. It is a no-op on a nil progress bar.
+func (bar *progressBar) Finish() {
+	if bar == nil {
+		return
+	}
+	bar.mutex.Lock()
+	defer bar.mutex.Unlock()
+	if bar.timer != nil {
+		bar.timer.Stop()
+		bar.timer = nil
+	}
+	if bar.shown > 0 {
+		fmt.Fprintf(bar.out, "%s\n", bar.line[bar.shown:])
+		bar.shown = 0
+		return
+	}
+	fmt.Fprint(bar.out, "\r\033[K")
+	if len(bar.line) > 0 {
+		fmt.Fprintf(bar.out, "%s\n", bar.line)
+	}
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// reverseDep is a target that depends on the queried targets or source file. Depth is 1 for
+// direct dependents.
+type reverseDep struct {
+	Target string
+	Depth  int
+}
+
+var rdepsCmd = &cobra.Command{
+	Use:   "rdeps TARGET|FILE [build flags] [--depth=N] [--json]",
+	Short: "Lists the targets that depend on a target or source file",
+	Long: `Lists all targets that transitively depend on the targets matching TARGET or on the source
+file FILE, together with the number of dependency edges between them. For a source file, the
+targets whose build statements use the file directly or through generated files are found in the
+ninja file, and targets that depend on one of them count as their dependents. With --depth, only
+dependents up to that distance are listed. With --json, the list is printed as a JSON array.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runRdeps,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Files are completed as well, since rdeps accepts source files.
+		suggestions, directive := completeBuildArgs(toComplete, modeBuild)
+		if directive == cobra.ShellCompDirectiveError {
+			return nil, directive
+		}
+		return suggestions, cobra.ShellCompDirectiveDefault
+	},
+}
+
+var rdepsDepth int
+var rdepsJson bool
+
+func init() {
+	rootCmd.AddCommand(rdepsCmd)
+	rdepsCmd.Flags().IntVar(&rdepsDepth, "depth", 0, "Only list dependents up to N dependency edges away (default: all)")
+	rdepsCmd.Flags().BoolVar(&rdepsJson, "json", false, "Print the dependents as JSON")
+}
+
+func runRdeps(cmd *cobra.Command, args []string) error {
+	// A first argument naming an existing file is a source file, everything else is passed on.
+	sourceFile := ""
+	if candidate := args[0]; !strings.Contains(candidate, "=") {
+		if !path.IsAbs(candidate) {
+			workingDir, err := util.GetWorkingDir()
+			if err != nil {
+				return err
+			}
+			candidate = path.Join(workingDir, candidate)
+		}
+		if util.FileExists(candidate) {
+			sourceFile = path.Clean(candidate)
+			args = args[1:]
+		}
+	}
+
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	if sourceFile == "" && len(patterns) == 0 {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "No target or source file specified.\n")
+	}
+	genInput.ListDependencies = true
+	genInput.PersistFlags = false
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	outputDir := genInput.OutputDir
+	if genOutput.BuildDir != "" {
+		outputDir = genOutput.BuildDir
+	}
+
+	dependents := map[string][]string{}
+	for name, target := range genOutput.Targets {
+		for _, dep := range append(append([]string{}, target.Deps...), target.Tools...) {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	// Depths of the roots are 0 and not listed.
+	depths := map[string]int{}
+	queue := []string{}
+	if sourceFile != "" {
+		users, err := sourceFileUsers(sourceFile, outputDir, genOutput)
+		if err != nil {
+			return err
+		}
+		for _, name := range users {
+			depths[name] = 1
+			queue = append(queue, name)
+		}
+	} else {
+		if err := checkArgs(patterns, nil, modeBuild, genOutput.Targets, genOutput.Flags); err != nil {
+			return err
+		}
+		targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+		if err != nil {
+			return err
+		}
+		for _, name := range targets {
+			depths[name] = 0
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if rdepsDepth > 0 && depths[name] >= rdepsDepth {
+			continue
+		}
+		for _, dependent := range dependents[name] {
+			if _, visited := depths[dependent]; !visited {
+				depths[dependent] = depths[name] + 1
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	rdeps := []reverseDep{}
+	for name, depth := range depths {
+		if depth > 0 {
+			rdeps = append(rdeps, reverseDep{Target: targetID(name), Depth: depth})
+		}
+	}
+	sort.Slice(rdeps, func(i, j int) bool {
+		if rdeps[i].Depth != rdeps[j].Depth {
+			return rdeps[i].Depth < rdeps[j].Depth
+		}
+		return rdeps[i].Target < rdeps[j].Target
+	})
+
+	if rdepsJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(rdeps)
+		return nil
+	}
+	for _, rdep := range rdeps {
+		fmt.Printf("  %3d  %s\n", rdep.Depth, rdep.Target)
+	}
+	log.Log("%d targets depend on %s.\n", len(rdeps), rdepsSubject(sourceFile, patterns))
+	return nil
+}
+
+func rdepsSubject(sourceFile string, patterns []string) string {
+	if sourceFile != "" {
+		return fmt.Sprintf("'%s'", sourceFile)
+	}
+	return fmt.Sprintf("'%s'", strings.Join(targetIDs(patterns), "', '"))
+}
+
+// sourceFileUsers returns the targets whose outputs depend on `file` according to the ninja file
+// of `genOutput` and the dependencies discovered by ninja in `outputDir`, excluding targets that
+// only use `file` through one of their dependencies.
+func sourceFileUsers(file, outputDir string, genOutput generatorOutput) ([]string, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	modulePaths, err := module.GetAllModulePaths(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]bool{}
+	queue := []string{}
+	visit := func(node string) {
+		if !nodes[node] {
+			nodes[node] = true
+			queue = append(queue, node)
+		}
+	}
+	visit(file)
+	for _, alias := range moduleFiles(file, modulePaths) {
+		visit(alias.path)
+	}
+
+	dependents := ninjaDependents(genOutput.NinjaFile, outputDir)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[node] {
+			visit(path.Clean(dependent))
+		}
+	}
+
+	users := map[string]bool{}
+	for name := range genOutput.Targets {
+		if nodes[name] {
+			users[name] = true
+		}
+	}
+	direct := []string{}
+	for name := range users {
+		usesDep := false
+		for _, dep := range genOutput.Targets[name].Deps {
+			usesDep = usesDep || users[dep]
+		}
+		if !usesDep {
+			direct = append(direct, name)
+		}
+	}
+	if len(users) == 0 {
+		log.Warning("No target uses '%s'.\n", file)
+	}
+	return direct, nil
+}
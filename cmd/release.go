@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const releaseDirName = "RELEASE"
+
+// releaseSignatureSuffixes are the suffixes of the detached signatures that sign commands write
+// next to the artifacts, which are published along with them.
+var releaseSignatureSuffixes = []string{".sig", ".asc"}
+
+type releaseProduct struct {
+	Name        string
+	Targets     []string
+	Flags       map[string]string
+	Destination string
+}
+
+type releaseManifest struct {
+	Products []releaseProduct
+	// Sign is a shell command run for each artifact. "{}" is replaced by the path of the artifact.
+	Sign                  string
+	VerifyReproducibility bool `yaml:"verify-reproducibility"`
+}
+
+type releaseResult struct {
+	Product      string
+	Artifacts    int
+	Reproducible string
+	Signed       string
+	Published    string
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release [--manifest=FILE]",
+	Args:  cobra.NoArgs,
+	Short: "Builds, verifies, signs and publishes all products of a release manifest",
+	Long: `Builds all products listed in a release manifest with their respective build flags,
+optionally verifies that each product builds reproducibly, signs all artifacts and copies
+them to their destinations. A report is printed at the end.`,
+	RunE: runRelease,
+}
+
+var releaseManifestPath string
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+	releaseCmd.Flags().StringVar(&releaseManifestPath, "manifest", "release.yaml", "Release manifest")
+}
+
+func runRelease(cmd *cobra.Command, args []string) error {
+	manifestPath := releaseManifestPath
+	if !path.IsAbs(manifestPath) {
+		workingDir, err := util.GetWorkingDir()
+		if err != nil {
+			return err
+		}
+		manifestPath = path.Join(workingDir, manifestPath)
+	}
+	var manifest releaseManifest
+	if err := util.ReadYaml(manifestPath, &manifest); err != nil {
+		return err
+	}
+	if len(manifest.Products) == 0 {
+		return log.Errorf("Release manifest '%s' does not list any products.\n", manifestPath)
+	}
+
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	releaseDir := path.Join(workspaceRoot, buildDirName, releaseDirName)
+	results := []releaseResult{}
+	built := [][]string{}
+	failed := false
+	for _, product := range manifest.Products {
+		log.IndentationLevel = 0
+		log.Log("Releasing %s\n", product.Name)
+		log.IndentationLevel = 1
+
+		if product.Name == "" || strings.Contains(product.Name, "/") {
+			return log.Errorf("Product name '%s' must not be empty or contain '/'.\n", product.Name)
+		}
+		if len(product.Targets) == 0 {
+			return log.Errorf("Product '%s' does not list any targets.\n", product.Name)
+		}
+
+		outputDir := path.Join(releaseDir, product.Name)
+		args := releaseBuildArgs(product)
+		result := releaseResult{
+			Product:      product.Name,
+			Reproducible: "skipped",
+			Signed:       "skipped",
+			Published:    "skipped",
+		}
+
+		var artifacts map[string]string
+		if manifest.VerifyReproducibility {
+			// The product is built twice from scratch into the same output directory, and the
+			// outputs of the first build are released.
+			verifyDir := outputDir + "-verify"
+			digests, _, err := buildTwice(args, outputDir, verifyDir)
+			if err != nil {
+				return err
+			}
+			if err := os.Rename(path.Join(verifyDir, "first"), outputDir); err != nil {
+				return log.Errorf("Failed to move the outputs of product '%s': %s.\n", product.Name, err)
+			}
+			if err := util.RemoveDir(verifyDir); err != nil {
+				return err
+			}
+			if artifacts, err = releaseArtifacts(args, outputDir); err != nil {
+				return err
+			}
+			result.Reproducible = "yes"
+			for _, relPath := range sortMapKeys(artifacts) {
+				if digests[1][relPath] != artifacts[relPath] {
+					log.Error("Artifact '%s' differs between two builds.\n", relPath)
+					result.Reproducible = "NO"
+					failed = true
+				}
+			}
+		} else {
+			if err := runBuild(append(args, fmt.Sprintf("%s=%s", outputDirFlagName, outputDir)), modeBuild, nil); err != nil {
+				return err
+			}
+			var err error
+			if artifacts, err = releaseArtifacts(args, outputDir); err != nil {
+				return err
+			}
+		}
+		result.Artifacts = len(artifacts)
+
+		published := sortMapKeys(artifacts)
+		if manifest.Sign != "" {
+			result.Signed = "yes"
+			for _, relPath := range sortMapKeys(artifacts) {
+				// Stale signatures of earlier releases must not be published.
+				for _, suffix := range releaseSignatureSuffixes {
+					os.Remove(path.Join(outputDir, relPath+suffix))
+				}
+				signCmd := strings.ReplaceAll(manifest.Sign, "{}", path.Join(outputDir, relPath))
+				log.Debug("Running '%s'.\n", signCmd)
+				if err := runShellCommand(signCmd); err != nil {
+					log.Error("Signing '%s' failed: %s.\n", relPath, err)
+					result.Signed = "FAILED"
+					failed = true
+				}
+				for _, suffix := range releaseSignatureSuffixes {
+					if util.FileExists(path.Join(outputDir, relPath+suffix)) {
+						published = append(published, relPath+suffix)
+					}
+				}
+			}
+		}
+
+		results = append(results, result)
+		built = append(built, published)
+	}
+
+	// Only publish once all products have been built, verified and signed successfully.
+	log.IndentationLevel = 0
+	for idx, product := range manifest.Products {
+		if failed || product.Destination == "" {
+			continue
+		}
+		destination := product.Destination
+		if !path.IsAbs(destination) {
+			destination = path.Join(path.Dir(manifestPath), destination)
+		}
+		outputDir := path.Join(releaseDir, product.Name)
+		for _, relPath := range built[idx] {
+			if err := copyArtifact(path.Join(outputDir, relPath), path.Join(destination, relPath)); err != nil {
+				return err
+			}
+		}
+		results[idx].Published = destination
+	}
+
+	printReleaseReport(results)
+	if failed {
+		return log.Errorf("Release failed.\n")
+	}
+	log.Success("Release done.\n")
+	return nil
+}
+
+// releaseBuildArgs returns the targets and build flags of `product` as arguments of 'dbt build'.
+func releaseBuildArgs(product releaseProduct) []string {
+	args := append([]string{}, product.Targets...)
+	for _, name := range sortMapKeys(product.Flags) {
+		args = append(args, fmt.Sprintf("%s=%s", name, product.Flags[name]))
+	}
+	return args
+}
+
+// releaseArtifacts returns the SHA256 digests of the artifacts of the product built with `args`
+// into `outputDir` by path relative to `outputDir`.
+func releaseArtifacts(args []string, outputDir string) (map[string]string, error) {
+	args = append(append([]string{}, args...), fmt.Sprintf("%s=%s", outputDirFlagName, outputDir))
+	outputs, err := targetOutputs(args)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := map[string]string{}
+	for _, output := range outputs {
+		data, err := util.ReadFile(output)
+		if err != nil {
+			return nil, err
+		}
+		artifacts[strings.TrimPrefix(output, outputDir+"/")] = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+	return artifacts, nil
+}
+
+func copyArtifact(source, dest string) error {
+	stat, err := os.Stat(source)
+	if err != nil {
+		return log.Errorf("Failed to read artifact '%s': %s.\n", source, err)
+	}
+	if err := util.CopyFile(source, dest); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest, stat.Mode()); err != nil {
+		return log.Errorf("Failed to change filemode of '%s': %s.\n", dest, err)
+	}
+	log.Debug("Published '%s'.\n", dest)
+	return nil
+}
+
+func runShellCommand(command string) error {
+	shellCmd := exec.Command("/bin/sh", "-c", command)
+	shellCmd.Stdout = os.Stdout
+	shellCmd.Stderr = os.Stderr
+	return shellCmd.Run()
+}
+
+func printReleaseReport(results []releaseResult) {
+	fmt.Println("\nRelease report:")
+	fmt.Printf("  %-20s %-10s %-13s %-8s %s\n", "PRODUCT", "ARTIFACTS", "REPRODUCIBLE", "SIGNED", "PUBLISHED")
+	for _, result := range results {
+		fmt.Printf("  %-20s %-10d %-13s %-8s %s\n", result.Product, result.Artifacts, result.Reproducible, result.Signed, result.Published)
+	}
+}
@@ -0,0 +1,926 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/netrc"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const remoteCacheFileName = "remote-cache.json"
+const remoteCacheHitsFileName = "remote-cache-hits.log"
+const remoteCacheCredentialsFileName = "remote-cache-credentials.json"
+
+// remoteCacheActionsDirName is the directory in the output directory that holds the command and
+// inputs of each action in a file of its own, so that the wrapper of an action only reads its own.
+const remoteCacheActionsDirName = "remote-cache-actions"
+
+// Version of the key and manifest format. Changing it invalidates all cached entries.
+const remoteCacheVersion = 2
+
+// Timeout of a single request to the remote cache.
+const remoteCacheTimeout = 5 * time.Minute
+
+// Number of outputs passed to a single 'ninja -t query' invocation when collecting action inputs.
+const remoteCacheQueryBatchSize = 500
+
+// Placeholders for machine-specific paths in commands, dependencies and depfiles, so that
+// workspaces checked out in different locations share cache entries.
+const remoteCacheWorkspacePlaceholder = "@DBT_WORKSPACE@"
+const remoteCacheOutputDirPlaceholder = "@DBT_OUTPUT_DIR@"
+
+var errRemoteCacheMiss = errors.New("not found")
+
+// The parts of wrapped commands around the invocation of 'dbt cache fetch' and the original command.
+const remoteCacheWrapperPrefix = "if test -f " + remoteCacheFileName + " && "
+const remoteCacheWrapperInfix = " ) && { test ! -f " + remoteCacheFileName + " || "
+
+var remoteCacheClient = &http.Client{Timeout: remoteCacheTimeout}
+
+// remoteCacheState is written to the output directory when the ninja file is generated and read by
+// the 'dbt cache fetch' and 'dbt cache store' commands that ninja runs for each cacheable action.
+type remoteCacheState struct {
+	Config        module.RemoteCache
+	WorkspaceRoot string
+	OutputDir     string
+	// Host is the operating system and architecture of the machine, which the outputs of actions
+	// may depend on without it showing in their commands.
+	Host string
+	// Toolchains maps the names of the toolchains of the build to their versions.
+	Toolchains map[string]string
+	// Minimal makes fetches write placeholders instead of the outputs that are not needed locally.
+	Minimal bool
+}
+
+// remoteCacheCredentials authenticate the requests to the remote cache. DBT resolves them from its
+// environment and ~/.netrc before running ninja and writes them to a file in the output directory
+// that only the remote cache wrappers read, so that they never enter the environment of actions.
+type remoteCacheCredentials struct {
+	// Token is the bearer token for HTTP requests.
+	Token string `json:",omitempty"`
+	// User and Password authenticate HTTP requests without a token.
+	User     string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	// The AWS credentials and region for S3 requests.
+	AWSAccessKeyID     string `json:",omitempty"`
+	AWSSecretAccessKey string `json:",omitempty"`
+	AWSSessionToken    string `json:",omitempty"`
+	AWSRegion          string `json:",omitempty"`
+}
+
+// remoteCacheAction is the normalized command and the inputs of an action. It is stored in the
+// remote cache actions directory under the digest of the first output of the action.
+type remoteCacheAction struct {
+	Command string
+	Inputs  []string
+	// Download makes fetches download the outputs even with --remote-download=minimal, because
+	// actions that are never cached read them.
+	Download bool `json:",omitempty"`
+	// CachedInputs are the inputs produced by cacheable actions. With --remote-download=minimal,
+	// they are downloaded before the action runs.
+	CachedInputs []string `json:",omitempty"`
+}
+
+// remoteCacheManifest describes the outputs of an action. It is stored under the key of the
+// action, the content of the outputs is stored under their digests.
+type remoteCacheManifest struct {
+	Outputs []remoteCacheBlob
+	// Depfile is the digest of the normalized depfile written by the action, if any.
+	Depfile string
+	// Deps maps the dependencies listed in the depfile to their digests. Cached outputs are only
+	// used if all dependencies are unchanged.
+	Deps map[string]string
+}
+
+type remoteCacheBlob struct {
+	Digest string
+	Mode   os.FileMode
+}
+
+// remoteCacheBackend stores blobs under keys.
+type remoteCacheBackend interface {
+	// get returns errRemoteCacheMiss if there is no blob for `key`.
+	get(key string) ([]byte, error)
+	put(key string, data []byte) error
+}
+
+var cacheFetchCmd = &cobra.Command{
+	Use:         "fetch [--depfile=FILE] [--rspfile=FILE] -- OUTPUTS...",
+	Args:        cobra.MinimumNArgs(1),
+	Short:       "Downloads the outputs of an action from the remote cache",
+	Hidden:      true,
+	Annotations: actionHelperAnnotations,
+	RunE:        runCacheFetch,
+}
+
+var cacheStoreCmd = &cobra.Command{
+	Use:         "store [--depfile=FILE] [--rspfile=FILE] -- OUTPUTS...",
+	Args:        cobra.MinimumNArgs(1),
+	Short:       "Uploads the outputs of an action to the remote cache",
+	Hidden:      true,
+	Annotations: actionHelperAnnotations,
+	Run:         runCacheStore,
+}
+
+var cacheDepfile string
+var cacheRspfile string
+
+func init() {
+	cacheCmd.AddCommand(cacheFetchCmd)
+	cacheCmd.AddCommand(cacheStoreCmd)
+	for _, cmd := range []*cobra.Command{cacheFetchCmd, cacheStoreCmd} {
+		cmd.Flags().StringVar(&cacheDepfile, "depfile", "", "Depfile written by the action")
+		cmd.Flags().StringVar(&cacheRspfile, "rspfile", "", "Response file read by the action")
+	}
+}
+
+// remoteCacheConfig returns the remote cache configured in the MODULE file of the workspace,
+// overridden by the DBT configuration and the DBT_REMOTE_CACHE_URL and DBT_REMOTE_CACHE_READ_ONLY
+// environment variables.
+func remoteCacheConfig() (module.RemoteCache, error) {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return module.RemoteCache{}, err
+	}
+	cacheConfig := moduleFile.RemoteCache
+	if userConfig := config.GetConfig().RemoteCache; userConfig.URL != "" {
+		cacheConfig.URL = userConfig.URL
+		cacheConfig.ReadOnly = userConfig.ReadOnly
+	} else if userConfig.ReadOnly {
+		cacheConfig.ReadOnly = true
+	}
+	if cacheURL, exists := os.LookupEnv("DBT_REMOTE_CACHE_URL"); exists {
+		cacheConfig.URL = cacheURL
+	}
+	if readOnly := os.Getenv("DBT_REMOTE_CACHE_READ_ONLY"); readOnly != "" {
+		cacheConfig.ReadOnly = readOnly != "0" && readOnly != "false"
+	}
+	return cacheConfig, nil
+}
+
+// enableRemoteCache records the commands and inputs of all actions in `ninjaFile`, so that the
+// wrapped commands of cacheable rules download the outputs of an action from the remote cache
+// instead of running it if possible and upload the outputs of all actions they run.
+func enableRemoteCache(outputDir, ninjaFile string, cacheConfig module.RemoteCache, toolchains map[string]string) error {
+	if _, err := newRemoteCacheBackend(cacheConfig, remoteCacheCredentials{}); err != nil {
+		return log.Errorf("Invalid remote cache: %s.\n", err)
+	}
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+
+	state := remoteCacheState{
+		Config:        cacheConfig,
+		WorkspaceRoot: workspaceRoot,
+		OutputDir:     outputDir,
+		Host:          runtime.GOOS + "/" + runtime.GOARCH,
+		Toolchains:    toolchains,
+		Minimal:       remoteDownload == remoteDownloadMinimal,
+	}
+	local := map[string]bool{}
+	cachedInputs := map[string][]string{}
+	if state.Minimal {
+		data, err := util.ReadFile(path.Join(outputDir, ninjaFile))
+		if err != nil {
+			return err
+		}
+		local, cachedInputs = planRemoteDownloads(string(data))
+	}
+	// Placeholders of outputs that are needed locally now are removed, so that ninja fetches them.
+	err = removeRemotePlaceholders(outputDir, func(output string) bool {
+		return !state.Minimal || local[output]
+	})
+	if err != nil {
+		return err
+	}
+	actionsDir := path.Join(outputDir, remoteCacheActionsDirName)
+	if err := util.RemoveDir(actionsDir); err != nil {
+		return err
+	}
+	if err := util.MkdirAll(actionsDir); err != nil {
+		return err
+	}
+	commands, err := actionSignatures(outputDir, ninjaFile)
+	if err != nil {
+		return err
+	}
+	outputs := sortMapKeys(commands)
+	for start := 0; start < len(outputs); start += remoteCacheQueryBatchSize {
+		end := start + remoteCacheQueryBatchSize
+		if end > len(outputs) {
+			end = len(outputs)
+		}
+		inputs, _ := ninjaQuery(outputDir, ninjaFile, outputs[start:end])
+		for _, output := range outputs[start:end] {
+			sort.Strings(inputs[output])
+			err := util.WriteJson(remoteCacheActionPath(outputDir, output), &remoteCacheAction{
+				Command:      state.normalize(commands[output]),
+				Inputs:       inputs[output],
+				Download:     local[output],
+				CachedInputs: cachedInputs[output],
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := util.WriteJson(path.Join(outputDir, remoteCacheFileName), &state); err != nil {
+		return err
+	}
+	log.Debug("Using remote cache '%s'.\n", cacheConfig.URL)
+	return nil
+}
+
+// disableRemoteCache removes the remote cache state of `outputDir`, which makes the wrapped
+// commands of cacheable rules run the original commands only.
+func disableRemoteCache(outputDir string) error {
+	os.Remove(path.Join(outputDir, remoteCacheFileName))
+	if err := removeRemotePlaceholders(outputDir, func(string) bool { return true }); err != nil {
+		return err
+	}
+	return util.RemoveDir(path.Join(outputDir, remoteCacheActionsDirName))
+}
+
+// resolveRemoteCacheCredentials returns the credentials for the remote cache `cacheConfig` from the
+// environment of DBT and ~/.netrc.
+func resolveRemoteCacheCredentials(cacheConfig module.RemoteCache) remoteCacheCredentials {
+	credentials := remoteCacheCredentials{
+		Token:              os.Getenv("DBT_REMOTE_CACHE_TOKEN"),
+		AWSAccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		AWSSecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		AWSSessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	for _, variable := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if credentials.AWSRegion == "" {
+			credentials.AWSRegion = os.Getenv(variable)
+		}
+	}
+	if credentials.Token == "" {
+		if auth := netrc.GetAuthForUrl(cacheConfig.URL); auth != nil {
+			credentials.User, credentials.Password = auth.User, auth.Password
+		}
+	}
+	return credentials
+}
+
+// writeRemoteCacheCredentials writes the credentials for the remote cache of the output directory
+// `dir`, if it uses one, to a file that only the user can read. It returns the path of the file,
+// which has to be removed once ninja terminated, or an empty string.
+func writeRemoteCacheCredentials(dir string) (string, error) {
+	statePath := path.Join(dir, remoteCacheFileName)
+	if !util.FileExists(statePath) {
+		return "", nil
+	}
+	var state remoteCacheState
+	if err := util.ReadJson(statePath, &state); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(resolveRemoteCacheCredentials(state.Config))
+	if err != nil {
+		return "", log.Errorf("Failed to serialize the remote cache credentials: %s.\n", err)
+	}
+	credentialsPath := path.Join(dir, remoteCacheCredentialsFileName)
+	os.Remove(credentialsPath)
+	if err := ioutil.WriteFile(credentialsPath, data, 0600); err != nil {
+		return "", log.Errorf("Failed to write '%s': %s.\n", credentialsPath, err)
+	}
+	return credentialsPath, nil
+}
+
+// readRemoteCacheCredentials returns the credentials that DBT wrote to the current output
+// directory before running ninja.
+func readRemoteCacheCredentials() remoteCacheCredentials {
+	var credentials remoteCacheCredentials
+	if data, err := ioutil.ReadFile(remoteCacheCredentialsFileName); err == nil {
+		json.Unmarshal(data, &credentials)
+	}
+	return credentials
+}
+
+// wrapCacheableRules rewrites the command of each cacheable rule in `ninjaFile` to first try to
+// fetch the outputs from the remote cache and to store the outputs after running the original
+// command. The wrapper only calls DBT if the output directory has a remote cache state, so that
+// the commands are the same whether or not a remote cache is configured and enabling it never
+// makes ninja rerun actions. Rules that run in the console, regenerate the ninja file, report
+// dependencies through their output or have commands that can not safely be wrapped are left
+// unchanged.
+func wrapCacheableRules(ninjaFile, bin string) (string, int) {
+	bin = ninjaEscape(fmt.Sprintf("'%s'", strings.ReplaceAll(bin, "'", `'\''`)))
+	lines := strings.Split(ninjaFile, "\n")
+	numRules := 0
+	for idx := 0; idx < len(lines); idx++ {
+		if !strings.HasPrefix(lines[idx], "rule ") {
+			continue
+		}
+
+		// The bindings of a rule are indented below the rule. Lines ending in '$' continue on the next line.
+		bindings := map[string]string{}
+		commandLine := -1
+		for idx+1 < len(lines) {
+			line := lines[idx+1]
+			trimmed := strings.TrimSpace(line)
+			if !strings.HasPrefix(line, " ") && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			idx++
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			parts := strings.SplitN(trimmed, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			key := strings.TrimSpace(parts[0])
+			bindings[key] = strings.TrimSpace(parts[1])
+			for continuesOnNextLine(lines[idx]) && idx+1 < len(lines) {
+				bindings[key] = ""
+				idx++
+			}
+			if key == "command" {
+				commandLine = idx
+			}
+		}
+
+		command := bindings["command"]
+		if command == "" || strings.Contains(command, "#") || bindings["generator"] != "" ||
+			bindings["deps"] == "msvc" || bindings["pool"] == "console" {
+			continue
+		}
+		indent := lines[commandLine][:strings.Index(lines[commandLine], "command")]
+		args := `--depfile "$depfile" --rspfile "$rspfile" -- $out`
+		lines[commandLine] = fmt.Sprintf("%scommand = %s%s cache fetch %s; then :; else ( %s%s%s cache store %s; }; fi",
+			indent, remoteCacheWrapperPrefix, bin, args, command, remoteCacheWrapperInfix, bin, args)
+		numRules++
+	}
+	return strings.Join(lines, "\n"), numRules
+}
+
+// unwrapCommand returns the original command of an action whose command `command` was wrapped by
+// wrapCacheableRules and prefixed by addEnvironmentDigest.
+func unwrapCommand(command string) string {
+	if strings.HasPrefix(command, remoteCacheWrapperPrefix) {
+		start := strings.Index(command, "; else ( ")
+		end := strings.LastIndex(command, remoteCacheWrapperInfix)
+		if start >= 0 && end > start {
+			command = command[start+len("; else ( ") : end]
+		}
+	}
+	return environmentDigestRegexp.ReplaceAllString(command, "")
+}
+
+// continuesOnNextLine reports whether `line` ends in an unescaped '$'.
+func continuesOnNextLine(line string) bool {
+	trailing := len(line) - len(strings.TrimRight(line, "$"))
+	return trailing%2 == 1
+}
+
+// reportRemoteCacheHits reports how many actions of the last ninja run in `dir` were downloaded
+// from the remote cache.
+func reportRemoteCacheHits(dir string) {
+	hitsFilePath := path.Join(dir, remoteCacheHitsFileName)
+	if !util.FileExists(hitsFilePath) {
+		return
+	}
+	data, err := util.ReadFile(hitsFilePath)
+	if err != nil {
+		log.Warning("Failed to read the remote cache hits: %s.\n", err)
+		return
+	}
+	hits := strings.Count(string(data), "\n")
+	os.Remove(hitsFilePath)
+	log.Log("Downloaded the outputs of %d actions from the remote cache.\n", hits)
+}
+
+func (state remoteCacheState) normalize(text string) string {
+	text = strings.ReplaceAll(text, state.OutputDir, remoteCacheOutputDirPlaceholder)
+	return strings.ReplaceAll(text, state.WorkspaceRoot, remoteCacheWorkspacePlaceholder)
+}
+
+func (state remoteCacheState) denormalize(text string) string {
+	text = strings.ReplaceAll(text, remoteCacheWorkspacePlaceholder, state.WorkspaceRoot)
+	return strings.ReplaceAll(text, remoteCacheOutputDirPlaceholder, state.OutputDir)
+}
+
+// key returns the key of `action`, which covers the host, the toolchains, its command, its
+// response file and the content of its inputs. Dependencies discovered while running the action
+// are checked using the manifest.
+func (state remoteCacheState) key(action remoteCacheAction) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "dbt remote cache v%d\n%s\n", remoteCacheVersion, state.Host)
+	for _, name := range sortMapKeys(state.Toolchains) {
+		fmt.Fprintf(hash, "toolchain %s %s\n", name, state.Toolchains[name])
+	}
+	fmt.Fprintf(hash, "%s\n", action.Command)
+	if cacheRspfile != "" {
+		rspfile, _ := ioutil.ReadFile(cacheRspfile)
+		fmt.Fprintf(hash, "%s\n", state.normalize(string(rspfile)))
+	}
+	for _, input := range action.Inputs {
+		fmt.Fprintf(hash, "%s %s\n", state.normalize(input), fileDigest(input))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// remoteCacheActionPath returns the path of the file describing the action producing `output` in
+// the output directory `dir`.
+func remoteCacheActionPath(dir, output string) string {
+	return path.Join(dir, remoteCacheActionsDirName, fmt.Sprintf("%x.json", sha256.Sum256([]byte(output))))
+}
+
+// loadRemoteCacheAction returns the remote cache state of the current output directory and the
+// action producing `output`. It returns false if the action is not known.
+func loadRemoteCacheAction(output string) (remoteCacheState, remoteCacheAction, bool) {
+	var state remoteCacheState
+	var action remoteCacheAction
+	actionPath := remoteCacheActionPath(".", output)
+	if !util.FileExists(remoteCacheFileName) || !util.FileExists(actionPath) {
+		return state, action, false
+	}
+	if util.ReadJson(remoteCacheFileName, &state) != nil || util.ReadJson(actionPath, &action) != nil {
+		return state, action, false
+	}
+	return state, action, true
+}
+
+// runCacheFetch downloads the outputs of an action and exits with a non-zero status if they
+// are not available, in which case ninja runs the action. With --remote-download=minimal, it writes
+// placeholders instead of outputs that are not needed locally and downloads the inputs of actions
+// that have to run.
+func runCacheFetch(cmd *cobra.Command, args []string) error {
+	state, action, exists := loadRemoteCacheAction(args[0])
+	if !exists {
+		os.Exit(1)
+	}
+	backend, err := newRemoteCacheBackend(state.Config, readRemoteCacheCredentials())
+	if err != nil {
+		os.Exit(1)
+	}
+	miss := func() {
+		if state.Minimal {
+			if _, err := materializeRemotePlaceholders(backend, action.CachedInputs); err != nil {
+				log.Warning("Failed to download the inputs of '%s'. %s", args[0], err)
+			}
+		}
+		os.Exit(1)
+	}
+
+	key := state.key(action)
+	data, err := backend.get("ac/" + key)
+	if err != nil {
+		if err != errRemoteCacheMiss {
+			log.Warning("Failed to query the remote cache for '%s': %s.\n", args[0], err)
+		}
+		miss()
+	}
+	var manifest remoteCacheManifest
+	if err := json.Unmarshal(data, &manifest); err != nil || len(manifest.Outputs) != len(args) {
+		miss()
+	}
+	for dep, digest := range manifest.Deps {
+		if fileDigest(state.denormalize(dep)) != digest {
+			log.Debug("Dependency '%s' of '%s' changed.\n", dep, args[0])
+			miss()
+		}
+	}
+	if manifest.Depfile != "" && cacheDepfile != "" {
+		data, err := fetchBlob(backend, manifest.Depfile)
+		if err != nil {
+			log.Warning("Failed to download '%s' from the remote cache: %s.\n", cacheDepfile, err)
+			miss()
+		}
+		if err := writeFileAtomically(cacheDepfile, []byte(state.denormalize(string(data))), 0644); err != nil {
+			return err
+		}
+	}
+	if state.Minimal && !action.Download {
+		if err := writeRemotePlaceholders(args, manifest.Outputs); err != nil {
+			return err
+		}
+		recordRemoteCacheHit(args[0])
+		return nil
+	}
+
+	// All outputs are downloaded before any of them is written, so that a failed download never
+	// leaves a mix of old and new outputs behind.
+	contents := [][]byte{}
+	for _, blob := range manifest.Outputs {
+		data, err := fetchBlob(backend, blob.Digest)
+		if err == errRemoteCacheMiss {
+			// Local caches evict blobs independently of the manifests referring to them.
+			log.Debug("Output of '%s' is missing in the remote cache.\n", args[0])
+			miss()
+		}
+		if err != nil {
+			log.Warning("Failed to download '%s' from the remote cache: %s.\n", args[0], err)
+			miss()
+		}
+		contents = append(contents, data)
+	}
+	for idx, output := range args {
+		if err := writeFileAtomically(output, contents[idx], manifest.Outputs[idx].Mode); err != nil {
+			return err
+		}
+	}
+	recordRemoteCacheHit(args[0])
+	return nil
+}
+
+// recordRemoteCacheHit records that the outputs of the action producing `output` were found in
+// the remote cache.
+func recordRemoteCacheHit(output string) {
+	hitsFile, err := os.OpenFile(remoteCacheHitsFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		fmt.Fprintln(hitsFile, output)
+		hitsFile.Close()
+	}
+}
+
+// runCacheStore uploads the outputs of an action that ninja ran. Failures never fail the build.
+func runCacheStore(cmd *cobra.Command, args []string) {
+	state, action, exists := loadRemoteCacheAction(args[0])
+	if !exists || state.Config.ReadOnly {
+		return
+	}
+	backend, err := newRemoteCacheBackend(state.Config, readRemoteCacheCredentials())
+	if err != nil {
+		return
+	}
+
+	manifest := remoteCacheManifest{Deps: map[string]string{}}
+	blobs := map[string][]byte{}
+	for _, output := range args {
+		info, err := os.Lstat(output)
+		if err != nil || !info.Mode().IsRegular() {
+			log.Debug("Not caching '%s', because '%s' is not a regular file.\n", args[0], output)
+			return
+		}
+		data, err := util.ReadFile(output)
+		if err != nil {
+			log.Warning("Not caching '%s': %s.\n", args[0], err)
+			return
+		}
+		digest := fmt.Sprintf("%x", sha256.Sum256(data))
+		blobs[digest] = data
+		manifest.Outputs = append(manifest.Outputs, remoteCacheBlob{Digest: digest, Mode: info.Mode().Perm()})
+	}
+	if cacheDepfile != "" && util.FileExists(cacheDepfile) {
+		depfile, err := util.ReadFile(cacheDepfile)
+		if err != nil {
+			log.Warning("Not caching '%s': %s.\n", args[0], err)
+			return
+		}
+		for _, dep := range parseDepfile(depfile) {
+			digest := fileDigest(dep)
+			if digest == "" {
+				log.Debug("Not caching '%s', because dependency '%s' does not exist.\n", args[0], dep)
+				return
+			}
+			manifest.Deps[state.normalize(dep)] = digest
+		}
+		normalized := []byte(state.normalize(string(depfile)))
+		manifest.Depfile = fmt.Sprintf("%x", sha256.Sum256(normalized))
+		blobs[manifest.Depfile] = normalized
+	}
+
+	// The manifest is uploaded last, so that it never refers to missing blobs.
+	for _, digest := range sortMapKeys(blobs) {
+		if err := backend.put("cas/"+digest, blobs[digest]); err != nil {
+			log.Warning("Failed to upload '%s' to the remote cache: %s.\n", args[0], err)
+			return
+		}
+	}
+	data, _ := json.Marshal(&manifest)
+	if err := backend.put("ac/"+state.key(action), data); err != nil {
+		log.Warning("Failed to upload '%s' to the remote cache: %s.\n", args[0], err)
+	}
+}
+
+// fetchBlob downloads the blob with `digest` and verifies its content.
+func fetchBlob(backend remoteCacheBackend, digest string) ([]byte, error) {
+	data, err := backend.get("cas/" + digest)
+	if err != nil {
+		return nil, err
+	}
+	if fmt.Sprintf("%x", sha256.Sum256(data)) != digest {
+		return nil, fmt.Errorf("blob '%s' is corrupt", digest)
+	}
+	return data, nil
+}
+
+func writeFileAtomically(filePath string, data []byte, mode os.FileMode) error {
+	if err := util.MkdirAll(path.Dir(filePath)); err != nil {
+		return err
+	}
+	tmpFilePath := filePath + ".dbt-cache.tmp"
+	if err := ioutil.WriteFile(tmpFilePath, data, mode); err != nil {
+		return log.Errorf("Failed to write '%s': %s.\n", tmpFilePath, err)
+	}
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		return log.Errorf("Failed to rename '%s' to '%s': %s.\n", tmpFilePath, filePath, err)
+	}
+	return nil
+}
+
+// fileDigest returns the SHA256 digest of the file at `filePath` or an empty string if the file
+// can not be read. The digest of a placeholder is the digest of the output it stands for.
+func fileDigest(filePath string) string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	if blob, isPlaceholder := parseRemotePlaceholder(data); isPlaceholder {
+		return blob.Digest
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// parseDepfile returns the dependencies listed in a Makefile-style depfile.
+func parseDepfile(depfile []byte) []string {
+	text := strings.ReplaceAll(string(depfile), "\\\n", " ")
+	text = strings.ReplaceAll(text, "\\ ", "\x00")
+	deps := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		colon := strings.Index(line, ": ")
+		if colon < 0 {
+			continue
+		}
+		for _, dep := range strings.Fields(line[colon+2:]) {
+			dep = strings.ReplaceAll(dep, "\x00", " ")
+			if !seen[dep] {
+				seen[dep] = true
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+func newRemoteCacheBackend(cacheConfig module.RemoteCache, credentials remoteCacheCredentials) (remoteCacheBackend, error) {
+	cacheURL, err := neturl.Parse(cacheConfig.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch cacheURL.Scheme {
+	case "http", "https":
+		return httpCacheBackend{baseURL: strings.TrimSuffix(cacheConfig.URL, "/"), credentials: credentials}, nil
+	case "s3":
+		return newS3CacheBackend(cacheURL, cacheConfig, credentials), nil
+	case "file":
+		return fileCacheBackend{dir: cacheURL.Path}, nil
+	default:
+		return nil, fmt.Errorf("unsupported URL '%s', use an http(s)://, s3:// or file:// URL", cacheConfig.URL)
+	}
+}
+
+// fileCacheBackend stores blobs in a local directory, e.g. to share outputs between several
+// workspaces on the same machine.
+type fileCacheBackend struct {
+	dir string
+}
+
+func (backend fileCacheBackend) get(key string) ([]byte, error) {
+	blobPath := path.Join(backend.dir, key)
+	data, err := ioutil.ReadFile(blobPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errRemoteCacheMiss
+	}
+	if err == nil {
+		// The modification time records the last use for pruneFileCache.
+		now := time.Now()
+		os.Chtimes(blobPath, now, now)
+	}
+	return data, err
+}
+
+// pruneFileCache removes the least recently used blobs from the local cache in `dir` until it is
+// smaller than `maxSize` bytes. It returns the number of removed blobs.
+func pruneFileCache(dir string, maxSize int64) int {
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	files := []cacheFile{}
+	var size int64
+	filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, cacheFile{filePath, info.Size(), info.ModTime()})
+			size += info.Size()
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	removed := 0
+	for _, file := range files {
+		if size <= maxSize {
+			break
+		}
+		if err := os.Remove(file.path); err == nil {
+			size -= file.size
+			removed++
+		}
+	}
+	return removed
+}
+
+func (backend fileCacheBackend) put(key string, data []byte) error {
+	blobPath := path.Join(backend.dir, key)
+	if err := os.MkdirAll(path.Dir(blobPath), 0775); err != nil {
+		return err
+	}
+	// Blobs are written atomically, since concurrent builds may read them at any time.
+	tmpFile, err := ioutil.TempFile(path.Dir(blobPath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := tmpFile.Chmod(0664); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), blobPath)
+}
+
+// httpCacheBackend stores blobs on an HTTP server supporting GET and PUT requests. Requests are
+// authenticated with the bearer token in DBT_REMOTE_CACHE_TOKEN or with credentials from ~/.netrc.
+// Like credentials.ForURL, it never sends credentials over plain HTTP.
+type httpCacheBackend struct {
+	baseURL     string
+	credentials remoteCacheCredentials
+}
+
+func (backend httpCacheBackend) get(key string) ([]byte, error) {
+	return backend.do(http.MethodGet, key, nil)
+}
+
+func (backend httpCacheBackend) put(key string, data []byte) error {
+	_, err := backend.do(http.MethodPut, key, data)
+	return err
+}
+
+func (backend httpCacheBackend) do(method, key string, data []byte) ([]byte, error) {
+	blobURL := backend.baseURL + "/" + key
+	request, err := http.NewRequest(method, blobURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if request.URL.Scheme != "https" {
+		log.Debug("Not sending credentials to '%s' over plain HTTP.\n", request.URL.Host)
+	} else if backend.credentials.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+backend.credentials.Token)
+	} else if backend.credentials.User != "" {
+		request.SetBasicAuth(backend.credentials.User, backend.credentials.Password)
+	}
+	return doRemoteCacheRequest(request)
+}
+
+// s3CacheBackend stores blobs in an S3 bucket. Requests are signed with the credentials in the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables. Without
+// credentials, requests are anonymous, which allows reading from public buckets.
+type s3CacheBackend struct {
+	baseURL         string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func newS3CacheBackend(cacheURL *neturl.URL, cacheConfig module.RemoteCache, credentials remoteCacheCredentials) s3CacheBackend {
+	region := cacheConfig.Region
+	if region == "" {
+		region = credentials.AWSRegion
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// Custom endpoints (e.g., of S3-compatible storage) use path-style URLs, AWS uses virtual-hosted-style URLs.
+	prefix := strings.Trim(cacheURL.Path, "/")
+	baseURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cacheURL.Host, region)
+	if cacheConfig.Endpoint != "" {
+		baseURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(cacheConfig.Endpoint, "/"), cacheURL.Host)
+	}
+	if prefix != "" {
+		baseURL = baseURL + "/" + prefix
+	}
+	return s3CacheBackend{
+		baseURL:         baseURL,
+		region:          region,
+		accessKeyID:     credentials.AWSAccessKeyID,
+		secretAccessKey: credentials.AWSSecretAccessKey,
+		sessionToken:    credentials.AWSSessionToken,
+	}
+}
+
+func (backend s3CacheBackend) get(key string) ([]byte, error) {
+	return backend.do(http.MethodGet, key, nil)
+}
+
+func (backend s3CacheBackend) put(key string, data []byte) error {
+	_, err := backend.do(http.MethodPut, key, data)
+	return err
+}
+
+func (backend s3CacheBackend) do(method, key string, data []byte) ([]byte, error) {
+	request, err := http.NewRequest(method, backend.baseURL+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if backend.accessKeyID != "" {
+		backend.sign(request, fmt.Sprintf("%x", sha256.Sum256(data)), time.Now())
+	}
+	return doRemoteCacheRequest(request)
+}
+
+// sign adds an AWS Signature Version 4 covering the host and all headers of `request`.
+func (backend s3CacheBackend) sign(request *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	request.Header.Set("x-amz-date", now.Format("20060102T150405Z"))
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+	if backend.sessionToken != "" {
+		request.Header.Set("x-amz-security-token", backend.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := sortMapKeys(headers)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, backend.region)
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%x",
+		request.Header.Get("x-amz-date"), scope, sha256.Sum256([]byte(canonicalRequest)))
+	signingKey := []byte("AWS4" + backend.secretAccessKey)
+	for _, part := range []string{date, backend.region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, signingKey)
+		mac.Write([]byte(part))
+		signingKey = mac.Sum(nil)
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		backend.accessKeyID, scope, signedHeaders, signingKey))
+}
+
+func doRemoteCacheRequest(request *http.Request) ([]byte, error) {
+	response, err := remoteCacheClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, errRemoteCacheMiss
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s returned status %s", request.Method, request.URL.Redacted(), response.Status)
+	}
+	return body, nil
+}
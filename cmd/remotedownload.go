@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// Values of --remote-download. With "minimal", the outputs of actions found in the remote cache are
+// only downloaded if they are needed locally.
+const remoteDownloadAll = "all"
+const remoteDownloadMinimal = "minimal"
+
+// remotePlaceholdersFileName lists the placeholders written to the output directory, one per line.
+const remotePlaceholdersFileName = "remote-cache-placeholders.log"
+
+// remotePlaceholderHeader starts the placeholder files that are written instead of the outputs of
+// cached actions that are not downloaded. It is followed by the JSON encoded blob of the output.
+const remotePlaceholderHeader = "dbt remote cache placeholder v1\n"
+
+// Placeholders are small, larger files are never read to check whether they are placeholders.
+const maxRemotePlaceholderSize = 1024
+
+var remoteDownload = remoteDownloadAll
+
+var cacheMaterializeCmd = &cobra.Command{
+	Use:   "materialize PATHS...",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Downloads outputs that builds with --remote-download=minimal left in the remote cache",
+	Long: `Downloads the outputs that builds with --remote-download=minimal left in the remote
+cache and replaced by placeholders. Paths that are not placeholders are ignored.`,
+	RunE: runCacheMaterialize,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheMaterializeCmd)
+}
+
+func checkRemoteDownload() error {
+	if remoteDownload != remoteDownloadAll && remoteDownload != remoteDownloadMinimal {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "Unknown remote download mode '%s'. Use '%s' or '%s'.\n", remoteDownload, remoteDownloadAll, remoteDownloadMinimal)
+	}
+	return nil
+}
+
+// planRemoteDownloads determines which outputs of the cacheable actions in `ninjaFile` are needed
+// locally, because actions that are never cached read them. It also returns the outputs of
+// cacheable actions that each cacheable action reads, by its first output, directly or through
+// phony edges.
+func planRemoteDownloads(ninjaFile string) (map[string]bool, map[string][]string) {
+	wrapped, _ := wrapCacheableRules(ninjaFile, "dbt")
+	_, rules, edges := parseNinjaEdges(wrapped)
+	isCacheable := func(edge ninjaEdge) bool {
+		for _, binding := range rules[edge.rule].bindings {
+			if binding.key == "command" {
+				return strings.HasPrefix(binding.value, remoteCacheWrapperPrefix)
+			}
+		}
+		return false
+	}
+
+	phonyDeps := map[string][]string{}
+	cachedOutputs := map[string]bool{}
+	for _, edge := range edges {
+		for _, output := range edge.outputs {
+			if edge.rule == "phony" {
+				phonyDeps[output] = edge.deps
+			} else if isCacheable(edge) {
+				cachedOutputs[output] = true
+			}
+		}
+	}
+	cachedDeps := func(deps []string) []string {
+		result := []string{}
+		seen := map[string]bool{}
+		for len(deps) > 0 {
+			dep := deps[0]
+			deps = deps[1:]
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if cachedOutputs[dep] {
+				result = append(result, dep)
+			}
+			deps = append(deps, phonyDeps[dep]...)
+		}
+		return result
+	}
+
+	local := map[string]bool{}
+	cachedInputs := map[string][]string{}
+	for _, edge := range edges {
+		if edge.rule == "phony" || len(edge.outputs) == 0 {
+			continue
+		}
+		inputs := cachedDeps(edge.deps)
+		if isCacheable(edge) {
+			cachedInputs[edge.outputs[0]] = inputs
+			continue
+		}
+		for _, input := range inputs {
+			local[input] = true
+		}
+	}
+	// The outputs of an action are downloaded together.
+	for _, edge := range edges {
+		for _, output := range edge.outputs {
+			if local[output] {
+				for _, output := range edge.outputs {
+					local[output] = true
+				}
+				break
+			}
+		}
+	}
+	return local, cachedInputs
+}
+
+// readRemotePlaceholder returns the blob that the placeholder at `filePath` stands for. It returns
+// false if the file is not a placeholder.
+func readRemotePlaceholder(filePath string) (remoteCacheBlob, bool) {
+	var blob remoteCacheBlob
+	info, err := os.Lstat(filePath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxRemotePlaceholderSize {
+		return blob, false
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return blob, false
+	}
+	return parseRemotePlaceholder(data)
+}
+
+func parseRemotePlaceholder(data []byte) (remoteCacheBlob, bool) {
+	var blob remoteCacheBlob
+	if !bytes.HasPrefix(data, []byte(remotePlaceholderHeader)) {
+		return blob, false
+	}
+	if json.Unmarshal(data[len(remotePlaceholderHeader):], &blob) != nil || blob.Digest == "" {
+		return blob, false
+	}
+	return blob, true
+}
+
+// writeRemotePlaceholders writes placeholders for the outputs `outputs` of an action found in the
+// remote cache and records them in the current output directory.
+func writeRemotePlaceholders(outputs []string, blobs []remoteCacheBlob) error {
+	for idx, output := range outputs {
+		data, _ := json.Marshal(&blobs[idx])
+		if err := writeFileAtomically(output, append([]byte(remotePlaceholderHeader), data...), blobs[idx].Mode); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(remotePlaceholdersFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return log.Errorf("Failed to open '%s': %s.\n", remotePlaceholdersFileName, err)
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, strings.Join(outputs, "\n")); err != nil {
+		return log.Errorf("Failed to write '%s': %s.\n", remotePlaceholdersFileName, err)
+	}
+	return nil
+}
+
+// materializeRemotePlaceholders downloads the outputs that the placeholders among `paths` stand
+// for. The modification times of the placeholders are kept, so that ninja does not consider the
+// actions reading them out of date.
+func materializeRemotePlaceholders(backend remoteCacheBackend, paths []string) (int, error) {
+	materialized := 0
+	for _, filePath := range paths {
+		blob, isPlaceholder := readRemotePlaceholder(filePath)
+		if !isPlaceholder {
+			continue
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return materialized, log.Errorf("Failed to stat '%s': %s.\n", filePath, err)
+		}
+		data, err := fetchBlob(backend, blob.Digest)
+		if err != nil {
+			// Removing the placeholder makes the next build run the action.
+			os.Remove(filePath)
+			return materialized, log.Errorf("Failed to download '%s' from the remote cache: %s.\n", filePath, err)
+		}
+		if err := writeFileAtomically(filePath, data, blob.Mode); err != nil {
+			return materialized, err
+		}
+		if err := os.Chtimes(filePath, info.ModTime(), info.ModTime()); err != nil {
+			return materialized, log.Errorf("Failed to set the modification time of '%s': %s.\n", filePath, err)
+		}
+		materialized++
+	}
+	return materialized, nil
+}
+
+// removeRemotePlaceholders removes the placeholders in the output directory `outputDir` for which
+// `remove` returns true, so that ninja runs or fetches their actions again.
+func removeRemotePlaceholders(outputDir string, remove func(output string) bool) error {
+	listPath := path.Join(outputDir, remotePlaceholdersFileName)
+	if !util.FileExists(listPath) {
+		return nil
+	}
+	data, err := util.ReadFile(listPath)
+	if err != nil {
+		return err
+	}
+	kept := []string{}
+	for _, output := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		filePath := output
+		if !path.IsAbs(filePath) {
+			filePath = path.Join(outputDir, filePath)
+		}
+		if _, isPlaceholder := readRemotePlaceholder(filePath); !isPlaceholder {
+			continue
+		}
+		if remove(output) {
+			os.Remove(filePath)
+		} else {
+			kept = append(kept, output)
+		}
+	}
+	if len(kept) == 0 {
+		os.Remove(listPath)
+		return nil
+	}
+	return util.WriteFile(listPath, []byte(strings.Join(kept, "\n")+"\n"))
+}
+
+// materializeTargetOutputs downloads the outputs of the targets `targets` that a build with
+// --remote-download=minimal left in the remote cache of the output directory `outputDir`.
+func materializeTargetOutputs(outputDir string, targets []string, allTargets map[string]target) error {
+	statePath := path.Join(outputDir, remoteCacheFileName)
+	if !util.FileExists(statePath) {
+		return nil
+	}
+	var state remoteCacheState
+	if err := util.ReadJson(statePath, &state); err != nil {
+		return err
+	}
+	backend, err := newRemoteCacheBackend(state.Config, resolveRemoteCacheCredentials(state.Config))
+	if err != nil {
+		return log.Errorf("Invalid remote cache: %s.\n", err)
+	}
+	outputs := []string{}
+	for _, name := range targets {
+		for _, output := range allTargets[name].Outputs {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			outputs = append(outputs, output)
+		}
+	}
+	materialized, err := materializeRemotePlaceholders(backend, outputs)
+	if materialized > 0 {
+		log.Log("Downloaded %d outputs of the targets from the remote cache.\n", materialized)
+	}
+	return err
+}
+
+func runCacheMaterialize(cmd *cobra.Command, args []string) error {
+	for _, arg := range args {
+		filePath, err := filepath.Abs(arg)
+		if err != nil {
+			return log.Errorf("Failed to resolve '%s': %s.\n", arg, err)
+		}
+		if _, isPlaceholder := readRemotePlaceholder(filePath); !isPlaceholder {
+			continue
+		}
+		// The remote cache state is kept in the output directory that contains the placeholder.
+		statePath := ""
+		for dir := path.Dir(filePath); dir != "/" && statePath == ""; dir = path.Dir(dir) {
+			if util.FileExists(path.Join(dir, remoteCacheFileName)) {
+				statePath = path.Join(dir, remoteCacheFileName)
+			}
+		}
+		if statePath == "" {
+			return log.Errorf("'%s' is not in an output directory that uses a remote cache.\n", arg)
+		}
+		var state remoteCacheState
+		if err := util.ReadJson(statePath, &state); err != nil {
+			return err
+		}
+		backend, err := newRemoteCacheBackend(state.Config, resolveRemoteCacheCredentials(state.Config))
+		if err != nil {
+			return log.Errorf("Invalid remote cache: %s.\n", err)
+		}
+		if _, err := materializeRemotePlaceholders(backend, []string{filePath}); err != nil {
+			return err
+		}
+		log.Success("Downloaded '%s'.\n", arg)
+	}
+	return nil
+}
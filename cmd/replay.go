@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const actionsFileName = "actions.json"
+const ninjaLogFileName = ".ninja_log"
+
+// maxQueryNodes limits the number of nodes passed to a single 'ninja -t query' invocation.
+const maxQueryNodes = 500
+
+// Variables of the environment of ninja that are recorded with the actions. Other variables may
+// hold credentials and are not persisted.
+var recordedEnvVars = []string{"PATH", "HOME", "LANG", "LANGUAGE", "TZ", "TMPDIR", "SOURCE_DATE_EPOCH"}
+var recordedEnvPrefixes = []string{"LC_"}
+
+// failedExitCodeRegexp matches the exit code that ninja >= 1.12 adds to the reports of failed steps.
+var failedExitCodeRegexp = regexp.MustCompile(`^\[code=(-?\d+)\] `)
+
+type action struct {
+	ID       int
+	Outputs  []string
+	Command  string
+	Inputs   map[string]string
+	Start    time.Duration // Relative to the start of the ninja run.
+	Duration time.Duration
+	Failed   bool
+	// ExitCode is the exit code of the command, or -1 if it failed and ninja did not report it.
+	ExitCode int
+	// Output is the output of the command. Ninja only attributes the output of failed commands
+	// to their step, so it is empty for successful actions.
+	Output string
+}
+
+type actionLog struct {
+	Dir string
+	// Env holds the variables of the environment of ninja listed in recordedEnvVars and set in the
+	// MODULE file.
+	Env     []string
+	Actions []action
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [ACTION] [--shell]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Re-executes a single action of the last build",
+	Long: `Re-executes a single action of the last build in isolation, using the same working
+directory and environment. Actions are identified by their number or by one of their outputs.
+Without arguments, all actions of the last build are listed.`,
+	RunE: runReplay,
+}
+
+var replayShell bool
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().BoolVar(&replayShell, "shell", false, "Start an interactive shell in the environment of the action instead")
+}
+
+// ninjaLogSize returns the size of the ninja log in `dir`, so that entries added by a subsequent
+// ninja run can be identified.
+func ninjaLogSize(dir string) int64 {
+	stat, err := os.Stat(path.Join(dir, ninjaLogFileName))
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
+
+// recordActions stores metadata for all actions executed by the last ninja run in `dir`.
+// Successful actions are taken from the ninja log starting at `logOffset`, failed actions
+// are parsed from ninja's `output`. The commands and input digests of all actions are resolved from
+// the ninja file. It returns the recorded actions.
+func recordActions(dir string, logOffset int64, output string) ([]action, error) {
+	actions := append(readNinjaLog(dir, logOffset), parseFailedActions(output)...)
+
+	if len(actions) > 0 {
+		commands := ninjaCommands(dir)
+		outputs := []string{}
+		for _, action := range actions {
+			outputs = append(outputs, action.Outputs[0])
+		}
+		inputs := ninjaInputs(dir, outputs)
+		digests := map[string]string{}
+		for idx := range actions {
+			actions[idx].ID = idx + 1
+			if actions[idx].Command == "" {
+				actions[idx].Command = commands[actions[idx].Outputs[0]]
+			}
+			actions[idx].Inputs = inputDigests(dir, inputs[actions[idx].Outputs[0]], digests)
+		}
+	}
+
+	env, err := recordedEnvironment(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = util.WriteJson(path.Join(dir, actionsFileName), &actionLog{
+		Dir:     dir,
+		Env:     env,
+		Actions: actions,
+	})
+	return actions, err
+}
+
+// recordedEnvironment returns the variables of the environment of ninja in `dir` that are recorded
+// with the actions.
+func recordedEnvironment(dir string) ([]string, error) {
+	recorded := map[string]bool{}
+	for _, name := range recordedEnvVars {
+		recorded[name] = true
+	}
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return nil, err
+	}
+	for name := range moduleFile.Environment.Vars {
+		recorded[name] = true
+	}
+	ninjaEnv, err := ninjaEnvironment(dir)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{}
+	for _, entry := range ninjaEnv {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if recorded[name] || hasAnyPrefix(name, recordedEnvPrefixes) {
+			env = append(env, entry)
+		}
+	}
+	return env, nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readNinjaLog(dir string, offset int64) []action {
+	file, err := os.Open(path.Join(dir, ninjaLogFileName))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil
+	}
+
+	// Each entry has the format: start (ms) <TAB> end (ms) <TAB> mtime <TAB> output <TAB> command hash.
+	// Steps with multiple outputs have one entry per output.
+	actions := []action{}
+	byHash := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		if idx, exists := byHash[fields[4]+fields[0]]; exists {
+			actions[idx].Outputs = append(actions[idx].Outputs, fields[3])
+			continue
+		}
+		start, _ := strconv.Atoi(fields[0])
+		end, _ := strconv.Atoi(fields[1])
+		byHash[fields[4]+fields[0]] = len(actions)
+		actions = append(actions, action{
+			Outputs:  []string{fields[3]},
+			Start:    time.Duration(start) * time.Millisecond,
+			Duration: time.Duration(end-start) * time.Millisecond,
+		})
+	}
+	return actions
+}
+
+// parseFailedActions extracts failed steps from ninja's output, which reports them as
+// "FAILED: <outputs>", followed by the command and the output of the command.
+func parseFailedActions(output string) []action {
+	actions := []action{}
+	lines := strings.Split(output, "\n")
+	for idx := 0; idx < len(lines); idx++ {
+		if !strings.HasPrefix(lines[idx], "FAILED: ") {
+			continue
+		}
+		failed := action{Failed: true, ExitCode: -1}
+		outputs := strings.TrimPrefix(lines[idx], "FAILED: ")
+		if match := failedExitCodeRegexp.FindStringSubmatch(outputs); match != nil {
+			failed.ExitCode, _ = strconv.Atoi(match[1])
+			outputs = strings.TrimPrefix(outputs, match[0])
+		}
+		failed.Outputs = strings.Fields(outputs)
+		if idx+1 < len(lines) {
+			idx++
+			failed.Command = lines[idx]
+		}
+		commandOutput := []string{}
+		for idx+1 < len(lines) && !ninjaStatusRegexp.MatchString(lines[idx+1]) && !strings.HasPrefix(lines[idx+1], "ninja: ") && !strings.HasPrefix(lines[idx+1], "FAILED: ") {
+			idx++
+			commandOutput = append(commandOutput, lines[idx])
+		}
+		failed.Output = strings.Join(commandOutput, "\n")
+		if len(failed.Outputs) > 0 {
+			actions = append(actions, failed)
+		}
+	}
+	return actions
+}
+
+func ninjaCommand(dir, output string) string {
+	var stdout bytes.Buffer
+	if err := tryRunNinja(dir, &stdout, []string{"-t", "commands", "-s", output}); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+// ninjaCommands returns the commands of all steps in `dir` by their outputs. Steps without inputs
+// are missing, their commands are resolved with ninjaCommand on replay.
+func ninjaCommands(dir string) map[string]string {
+	var stdout bytes.Buffer
+	commands := map[string]string{}
+	if err := tryRunNinja(dir, &stdout, []string{"-t", "compdb"}); err != nil {
+		return commands
+	}
+	entries := []struct {
+		Command string `json:"command"`
+		Output  string `json:"output"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		log.Debug("Failed to parse the compilation database of '%s': %s.\n", dir, err)
+		return commands
+	}
+	for _, entry := range entries {
+		commands[entry.Output] = entry.Command
+	}
+	return commands
+}
+
+// inputDigests returns the SHA256 digests of the files `inputs` of a step in `dir`. Digests are
+// looked up in and added to `cache`, since many steps share inputs.
+func inputDigests(dir string, inputs []string, cache map[string]string) map[string]string {
+	digests := map[string]string{}
+	for _, input := range inputs {
+		if digest, exists := cache[input]; exists {
+			if digest != "" {
+				digests[input] = digest
+			}
+			continue
+		}
+		filePath := input
+		if !path.IsAbs(filePath) {
+			filePath = path.Join(dir, filePath)
+		}
+		cache[input] = ""
+		if data, err := os.ReadFile(filePath); err == nil {
+			cache[input] = fmt.Sprintf("%x", sha256.Sum256(data))
+			digests[input] = cache[input]
+		}
+	}
+	return digests
+}
+
+// ninjaInputs returns the explicit, implicit and order-only inputs of the steps producing `outputs`.
+func ninjaInputs(dir string, outputs []string) map[string][]string {
+	inputs := map[string][]string{}
+	for start := 0; start < len(outputs); start += maxQueryNodes {
+		end := start + maxQueryNodes
+		if end > len(outputs) {
+			end = len(outputs)
+		}
+		chunk, _ := ninjaQuery(dir, "", outputs[start:end])
+		for output, outputInputs := range chunk {
+			inputs[output] = outputInputs
+		}
+	}
+	return inputs
+}
+
+// ninjaQuery returns the inputs of the steps producing `nodes` and the outputs of the steps that
+// use `nodes` as inputs according to `ninjaFile` (or the default ninja file if empty).
+func ninjaQuery(dir, ninjaFile string, nodes []string) (map[string][]string, map[string][]string) {
+	var stdout bytes.Buffer
+	inputs := map[string][]string{}
+	dependents := map[string][]string{}
+	args := []string{"-t", "query"}
+	if ninjaFile != "" {
+		args = append([]string{"-f", ninjaFile}, args...)
+	}
+	if err := tryRunNinja(dir, &stdout, append(args, nodes...)); err != nil {
+		return inputs, dependents
+	}
+
+	// For each node, the query output has an unindented "<node>:" line, followed by the inputs
+	// indented below an "input:" line and the dependent outputs below an "outputs:" line.
+	current := ""
+	inInputs := false
+	inOutputs := false
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case !strings.HasPrefix(line, " "):
+			current = strings.TrimSuffix(line, ":")
+			inInputs = false
+			inOutputs = false
+		case strings.HasPrefix(trimmed, "input:"):
+			inInputs = true
+			inOutputs = false
+		case strings.HasPrefix(trimmed, "outputs:"):
+			inInputs = false
+			inOutputs = true
+		case inInputs:
+			input := strings.TrimPrefix(strings.TrimPrefix(trimmed, "| "), "|| ")
+			inputs[current] = append(inputs[current], input)
+		case inOutputs:
+			dependents[current] = append(dependents[current], trimmed)
+		}
+	}
+	return inputs, dependents
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	history, err := readHistory()
+	if err != nil {
+		return err
+	}
+	event, exists := lastNinjaBuild(history)
+	if !exists {
+		return log.Errorf("No builds have been recorded yet.\n")
+	}
+	actionsFilePath := path.Join(event.OutputDir, actionsFileName)
+	if !util.FileExists(actionsFilePath) {
+		return log.Errorf("No actions have been recorded for the last build.\n")
+	}
+	var actions actionLog
+	if err := util.ReadJson(actionsFilePath, &actions); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		for _, action := range actions.Actions {
+			status := ""
+			if action.Failed {
+				status = " (failed)"
+			}
+			fmt.Printf("%4d  %s%s\n", action.ID, strings.Join(action.Outputs, " "), status)
+		}
+		return nil
+	}
+
+	selected := findAction(actions.Actions, args[0])
+	if selected == nil {
+		return log.Errorf("Action '%s' was not part of the last build. Run 'dbt replay' to list all actions.\n", args[0])
+	}
+
+	if selected.Command == "" {
+		selected.Command = ninjaCommand(actions.Dir, selected.Outputs[0])
+	}
+	for input, digest := range selected.Inputs {
+		filePath := input
+		if !path.IsAbs(filePath) {
+			filePath = path.Join(actions.Dir, filePath)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil || fmt.Sprintf("%x", sha256.Sum256(data)) != digest {
+			log.Warning("Input '%s' has changed since the last build.\n", input)
+		}
+	}
+
+	var replay *exec.Cmd
+	if replayShell {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		log.Log("Starting '%s' in '%s'. The action's command is:\n%s\n", shell, actions.Dir, selected.Command)
+		replay = exec.Command(shell)
+	} else {
+		log.Log("Running: %s\n", selected.Command)
+		replay = exec.Command("/bin/sh", "-c", selected.Command)
+	}
+	// Only part of the environment is recorded, the action runs in the current environment of ninja.
+	env, err := ninjaEnvironment(actions.Dir)
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, entry := range env {
+		current[entry] = true
+	}
+	for _, entry := range actions.Env {
+		if !current[entry] {
+			log.Warning("The environment differs from the last build in '%s'.\n", strings.SplitN(entry, "=", 2)[0])
+		}
+	}
+	replay.Dir = actions.Dir
+	replay.Env = env
+	replay.Stdin = os.Stdin
+	replay.Stdout = os.Stdout
+	replay.Stderr = os.Stderr
+	startTime := time.Now()
+	err = replay.Run()
+	if replayShell {
+		return nil
+	}
+	log.Log("Action took %s (%s in the last build).\n", time.Since(startTime).Round(time.Millisecond), selected.Duration)
+	if err != nil {
+		return log.Errorf("Action failed: %s.\n", err)
+	}
+	log.Success("Action succeeded.\n")
+	return nil
+}
+
+func findAction(actions []action, id string) *action {
+	for idx := range actions {
+		if strconv.Itoa(actions[idx].ID) == id {
+			return &actions[idx]
+		}
+		for _, output := range actions[idx].Outputs {
+			if output == id {
+				return &actions[idx]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// Variables of build statements through which rules annotate actions with the resources they
+// need. Actions of the same resource class share a ninja pool, whose depth is derived from the
+// CPUs and memory (in MiB) an action of the class needs. The timeout is in seconds.
+const (
+	resourceClassVar   = "dbt_resource_class"
+	resourceCpusVar    = "dbt_cpus"
+	resourceMemoryVar  = "dbt_memory_mb"
+	resourceTimeoutVar = "dbt_timeout"
+)
+
+// resourcePoolPrefix is prepended to the names of resource classes to name their ninja pools, so
+// that they never collide with the pools that rules declare themselves.
+const resourcePoolPrefix = "dbt_rc_"
+
+// resourceClassNameRegexp matches the names of resource classes, which must be valid in ninja
+// pool names.
+var resourceClassNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Time between terminating and killing an action that timed out.
+const watchdogGracePeriod = 5 * time.Second
+
+var watchdogCmd = &cobra.Command{
+	Use:         "watchdog --timeout=SECONDS --pgid=PGID",
+	Args:        cobra.NoArgs,
+	Short:       "Terminates the process group of an action that runs longer than its timeout",
+	Hidden:      true,
+	Annotations: actionHelperAnnotations,
+	Run:         runWatchdog,
+}
+
+var watchdogTimeout string
+var watchdogPgid int
+
+func init() {
+	rootCmd.AddCommand(watchdogCmd)
+	watchdogCmd.Flags().StringVar(&watchdogTimeout, "timeout", "", "Timeout of the action in seconds (empty for none)")
+	watchdogCmd.Flags().IntVar(&watchdogPgid, "pgid", 0, "Process group of the action")
+}
+
+// resourceClass collects the resources declared by the actions of a resource class.
+type resourceClass struct {
+	cpus     int
+	memoryMB int
+}
+
+// applyResourceClasses assigns the build statements of `ninjaFile` that declare a resource class
+// to a ninja pool per class and wraps the commands of rules with actions that declare a timeout
+// (or whose class has one) with a watchdog. It returns the rewritten ninja file.
+func applyResourceClasses(ninjaFile, bin string) (string, error) {
+	moduleFile, err := readWorkspaceModuleFile()
+	if err != nil {
+		return "", err
+	}
+	config := moduleFile.ResourceClasses
+	classTimeouts := map[string]int{}
+	for name, class := range config {
+		if class.Timeout == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(class.Timeout)
+		if err != nil {
+			return "", log.Errorf("Invalid timeout '%s' of resource class '%s': %s.\n", class.Timeout, name, err)
+		}
+		classTimeouts[name] = int(timeout.Seconds())
+	}
+
+	lines := strings.Split(ninjaFile, "\n")
+	output := []string{}
+	classes := map[string]*resourceClass{}
+	timedRules := map[string]bool{}
+	for idx := 0; idx < len(lines); idx++ {
+		if !strings.HasPrefix(lines[idx], "build ") {
+			output = append(output, lines[idx])
+			continue
+		}
+
+		// A build statement may continue on the next lines and is followed by its indented bindings.
+		statement := lines[idx]
+		output = append(output, lines[idx])
+		for continuesOnNextLine(lines[idx]) && idx+1 < len(lines) {
+			idx++
+			statement = strings.TrimSuffix(statement, "$") + lines[idx]
+			output = append(output, lines[idx])
+		}
+		bindings := map[string]string{}
+		for idx+1 < len(lines) && strings.HasPrefix(lines[idx+1], " ") {
+			idx++
+			output = append(output, lines[idx])
+			if parts := strings.SplitN(strings.TrimSpace(lines[idx]), "=", 2); len(parts) == 2 {
+				bindings[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+
+		name := bindings[resourceClassVar]
+		if name != "" && !resourceClassNameRegexp.MatchString(name) {
+			return "", log.Errorf("Invalid resource class '%s' in '%s'. Resource classes may only contain letters, digits, '_', '.' and '-'.\n", name, statement)
+		}
+		if name != "" {
+			class, exists := classes[name]
+			if !exists {
+				class = &resourceClass{}
+				classes[name] = class
+			}
+			if cpus, _ := strconv.Atoi(bindings[resourceCpusVar]); cpus > class.cpus {
+				class.cpus = cpus
+			}
+			if memoryMB, _ := strconv.Atoi(bindings[resourceMemoryVar]); memoryMB > class.memoryMB {
+				class.memoryMB = memoryMB
+			}
+			if _, hasPool := bindings["pool"]; !hasPool {
+				output = append(output, fmt.Sprintf("  pool = %s%s", resourcePoolPrefix, name))
+			}
+		}
+		if _, hasTimeout := bindings[resourceTimeoutVar]; !hasTimeout && classTimeouts[name] > 0 {
+			bindings[resourceTimeoutVar] = strconv.Itoa(classTimeouts[name])
+			output = append(output, fmt.Sprintf("  %s = %d", resourceTimeoutVar, classTimeouts[name]))
+		}
+		if bindings[resourceTimeoutVar] != "" {
+			_, inputs := splitBuildStatement(strings.TrimPrefix(statement, "build "))
+			if fields := strings.Fields(inputs); len(fields) > 0 {
+				timedRules[fields[0]] = true
+			}
+		}
+	}
+
+	// Pools have to be declared before they are used.
+	pools := []string{}
+	for _, name := range sortMapKeys(classes) {
+		depth := resourceClassDepth(classes[name], config[name])
+		log.Debug("Resource class '%s' runs %d actions in parallel.\n", name, depth)
+		pools = append(pools, fmt.Sprintf("pool %s%s", resourcePoolPrefix, name), fmt.Sprintf("  depth = %d", depth), "")
+	}
+	output = wrapTimedRules(output, timedRules, bin)
+	return strings.Join(append(pools, output...), "\n"), nil
+}
+
+// resourceClassDepth returns the number of actions of `class` that can run in parallel on this
+// machine, unless `config` sets it explicitly.
+func resourceClassDepth(class *resourceClass, config module.ResourceClass) int {
+	if config.Depth > 0 {
+		return config.Depth
+	}
+	depth := runtime.NumCPU()
+	if class.cpus > 0 && runtime.NumCPU()/class.cpus < depth {
+		depth = runtime.NumCPU() / class.cpus
+	}
+	if totalMB := totalMemoryMB(); class.memoryMB > 0 && totalMB > 0 && totalMB/class.memoryMB < depth {
+		depth = totalMB / class.memoryMB
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return depth
+}
+
+// wrapTimedRules rewrites the commands of `rules` in the ninja file `lines` to run a watchdog
+// next to the original command, which terminates the action once its timeout has passed. Ninja
+// runs each action in its own process group, which the watchdog terminates as a whole. The
+// watchdog is killed once the command finishes, since ninja waits until the output of the action
+// is closed. Rules that run in the console or whose commands can not safely be wrapped are left
+// unchanged.
+func wrapTimedRules(lines []string, rules map[string]bool, bin string) []string {
+	bin = ninjaEscape(fmt.Sprintf("'%s'", strings.ReplaceAll(bin, "'", `'\''`)))
+	for idx := 0; idx < len(lines); idx++ {
+		if !strings.HasPrefix(lines[idx], "rule ") || !rules[strings.TrimSpace(strings.TrimPrefix(lines[idx], "rule "))] {
+			continue
+		}
+		commandLine := -1
+		console := false
+		for idx+1 < len(lines) && strings.HasPrefix(lines[idx+1], " ") {
+			idx++
+			trimmed := strings.TrimSpace(lines[idx])
+			if strings.HasPrefix(trimmed, "command") && strings.Contains(trimmed, "=") && !continuesOnNextLine(lines[idx]) {
+				commandLine = idx
+			}
+			if strings.ReplaceAll(trimmed, " ", "") == "pool=console" {
+				console = true
+			}
+		}
+		if commandLine < 0 || console {
+			continue
+		}
+		parts := strings.SplitN(lines[commandLine], "=", 2)
+		command := strings.TrimSpace(parts[1])
+		if strings.Contains(command, "#") {
+			continue
+		}
+		lines[commandLine] = fmt.Sprintf("%s= %s watchdog --timeout=$%s --pgid=$$$$ & ( %s ); dbt_status=$$?; kill -9 $$! 2>/dev/null; exit $$dbt_status",
+			parts[0], bin, resourceTimeoutVar, command)
+	}
+	return lines
+}
+
+// totalMemoryMB returns the physical memory of the machine in MiB or 0 if it is unknown.
+func totalMemoryMB() int {
+	if file, err := os.Open("/proc/meminfo"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemTotal:" {
+				kB, _ := strconv.Atoi(fields[1])
+				return kB / 1024
+			}
+		}
+	}
+	if output, err := exec.Command("sysctl", "-n", "hw.memsize").Output(); err == nil {
+		bytes, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+		return bytes / (1024 * 1024)
+	}
+	return 0
+}
+
+func runWatchdog(cmd *cobra.Command, args []string) {
+	seconds, err := strconv.Atoi(watchdogTimeout)
+	if err != nil || seconds <= 0 || watchdogPgid <= 0 {
+		return
+	}
+	// The watchdog is part of the process group it terminates and is killed with SIGKILL instead.
+	signal.Ignore(syscall.SIGTERM)
+	time.Sleep(time.Duration(seconds) * time.Second)
+	fmt.Fprintf(os.Stderr, "Action timed out after %ds and was terminated.\n", seconds)
+	signalProcess(watchdogPgid, true, syscall.SIGTERM)
+	// Ninja waits for the output of the action to be closed, which the watchdog keeps open as well.
+	os.Stdout.Close()
+	os.Stderr.Close()
+	time.Sleep(watchdogGracePeriod)
+	signalProcess(watchdogPgid, true, os.Kill)
+}
@@ -1,9 +1,9 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
+	"github.com/daedaleanai/dbt/config"
 	"github.com/daedaleanai/dbt/log"
 	"github.com/daedaleanai/dbt/util"
 
@@ -16,14 +16,46 @@ var rootCmd = &cobra.Command{
 	Long: `The Daedalean Build Tool (dbt) helps setting up workspaces consisting
 of multiple modules (git repositories), managing dependencies between modules, and
 building build targets defined in those modules.`,
-	Version: fmt.Sprintf("v%d.%d.%d", util.DbtVersion[0], util.DbtVersion[1], util.DbtVersion[2]),
+	Version: currentDbtVersion(),
 }
 
+// actionHelperAnnotation marks commands that ninja runs as part of build actions.
+const actionHelperAnnotation = "dbt-action-helper"
+
+var actionHelperAnnotations = map[string]string{actionHelperAnnotation: "true"}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	rootCmd.PersistentFlags().BoolVarP(&log.Verbose, "verbose", "v", false, "print debug output")
-	if rootCmd.Execute() != nil {
-		os.Exit(1)
+	rootCmd.PersistentFlags().StringVar(&util.WorkspaceRootOverride, "workspace", "", "root directory of the workspace to operate on")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// The command-line is valid once the command runs. Errors of the command are printed by
+		// Execute instead of cobra, without the usage of the command.
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		// Helpers that ninja runs for every action must start quickly and must not be replaced by
+		// another version of DBT.
+		if cmd.Annotations[actionHelperAnnotation] != "" {
+			return nil
+		}
+		if !cmd.Flags().Changed("verbose") {
+			log.Verbose = config.GetConfig().Verbose
+		}
+		// 'dbt upgrade' installs the required version and must not be replaced by it.
+		if cmd != selfUpgradeCmd {
+			return checkRequiredVersion()
+		}
+		return nil
+	}
+	// Errors are returned up to here and mapped to the exit code of DBT. Cobra has already printed
+	// errors about invalid command-lines.
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+	if cmd.SilenceErrors {
+		log.Exit(err)
 	}
+	os.Exit(log.ExitUsage)
 }
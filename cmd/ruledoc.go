@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+// Formats of the rule documentation.
+const (
+	ruleDocFormatText     = "text"
+	ruleDocFormatMarkdown = "markdown"
+	ruleDocFormatJSON     = "json"
+)
+
+var ruledocCmd = &cobra.Command{
+	Use:   "ruledoc [NAME...] [--format=text|markdown|json]",
+	Short: "Documents the build rules of all modules",
+	Long: `Parses the RULES packages of all modules of the workspace and prints the documentation of each
+rule, i.e. each exported struct type with a Build method, with its fields, their types and doc
+comments. With
+NAME, only the rules whose name (e.g. 'cc.Binary') or package (e.g. 'dbt-rules/RULES/cc')
+contains one of the NAMEs are printed.`,
+	RunE: runRuledoc,
+}
+
+var ruledocFormat string
+
+func init() {
+	rootCmd.AddCommand(ruledocCmd)
+	ruledocCmd.Flags().StringVar(&ruledocFormat, "format", ruleDocFormatText, "Print the documentation as 'text', 'markdown' or 'json'")
+}
+
+type ruleFieldDoc struct {
+	Name string
+	Type string
+	Doc  string
+}
+
+type ruleDoc struct {
+	// Package is the import path of the RULES package, e.g. "dbt-rules/RULES/cc".
+	Package string
+	// Name is qualified with the package name, e.g. "cc.Binary".
+	Name   string
+	Doc    string
+	Fields []ruleFieldDoc
+}
+
+// commentText returns the text of the comment groups in one line.
+func commentText(groups ...*ast.CommentGroup) string {
+	for _, group := range groups {
+		if text := strings.Join(strings.Fields(group.Text()), " "); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// parseRuleDocs returns the documentation of the rules in the RULES package in `dir`, whose import
+// path is `importPath`. Rules are the exported struct types that implement core.BuildRule, i.e.
+// that have a Build method of their own or embed a type of the package that has one.
+func parseRuleDocs(dir, importPath string, files []string) []ruleDoc {
+	fileSet := token.NewFileSet()
+	astFiles := []*ast.File{}
+	for _, file := range files {
+		astFile, err := parser.ParseFile(fileSet, file, nil, parser.ParseComments)
+		if err != nil {
+			log.Warning("Skipping '%s': %s.\n", file, err)
+			continue
+		}
+		astFiles = append(astFiles, astFile)
+	}
+	if len(astFiles) == 0 {
+		return nil
+	}
+	pkg, err := doc.NewFromFiles(fileSet, astFiles, importPath)
+	if err != nil {
+		log.Warning("Skipping the package in '%s': %s.\n", dir, err)
+		return nil
+	}
+
+	hasBuild := map[string]bool{}
+	for _, docType := range pkg.Types {
+		for _, method := range docType.Methods {
+			if method.Name == "Build" {
+				hasBuild[docType.Name] = true
+			}
+		}
+	}
+
+	docs := []ruleDoc{}
+	for _, docType := range pkg.Types {
+		for _, spec := range docType.Decl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok || typeSpec.Name.Name != docType.Name {
+				continue
+			}
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok || !isBuildRule(docType.Name, structType, hasBuild) {
+				continue
+			}
+			rule := ruleDoc{
+				Package: importPath,
+				Name:    pkg.Name + "." + docType.Name,
+				Doc:     strings.TrimSpace(docType.Doc),
+				Fields:  []ruleFieldDoc{},
+			}
+			for _, field := range structType.Fields.List {
+				fieldType := types.ExprString(field.Type)
+				names := []string{}
+				for _, name := range field.Names {
+					names = append(names, name.Name)
+				}
+				if len(names) == 0 {
+					// Embedded fields are named after their unqualified type.
+					typeName := strings.TrimPrefix(fieldType, "*")
+					names = []string{typeName[strings.LastIndex(typeName, ".")+1:]}
+				}
+				for _, name := range names {
+					if !ast.IsExported(name) {
+						continue
+					}
+					rule.Fields = append(rule.Fields, ruleFieldDoc{Name: name, Type: fieldType, Doc: commentText(field.Doc, field.Comment)})
+				}
+			}
+			docs = append(docs, rule)
+		}
+	}
+	return docs
+}
+
+// isBuildRule returns whether the struct type `name` has a Build method, either of its own or
+// promoted from an embedded type of the same package. `hasBuild` holds the types of the package
+// with a Build method of their own.
+func isBuildRule(name string, structType *ast.StructType, hasBuild map[string]bool) bool {
+	if hasBuild[name] {
+		return true
+	}
+	for _, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		if hasBuild[strings.TrimPrefix(types.ExprString(field.Type), "*")] {
+			return true
+		}
+	}
+	return false
+}
+
+// collectRuleDocs returns the documentation of all rules of all modules of the workspace, sorted by
+// package and name.
+func collectRuleDocs() ([]ruleDoc, error) {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return nil, err
+	}
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	docs := []ruleDoc{}
+	for _, name := range sortMapKeys(modules) {
+		filesByDir := map[string][]string{}
+		importPaths := map[string]string{}
+		rules, err := module.ListRules(modules[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range rules {
+			if strings.HasSuffix(file.SourcePath, "_test.go") {
+				continue
+			}
+			dir := path.Dir(file.SourcePath)
+			filesByDir[dir] = append(filesByDir[dir], file.SourcePath)
+			importPaths[dir] = path.Dir(file.CopyPath)
+		}
+		for _, dir := range sortMapKeys(filesByDir) {
+			docs = append(docs, parseRuleDocs(dir, importPaths[dir], filesByDir[dir])...)
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		if docs[i].Package != docs[j].Package {
+			return docs[i].Package < docs[j].Package
+		}
+		return docs[i].Name < docs[j].Name
+	})
+	return docs, nil
+}
+
+func runRuledoc(cmd *cobra.Command, args []string) error {
+	if ruledocFormat != ruleDocFormatText && ruledocFormat != ruleDocFormatMarkdown && ruledocFormat != ruleDocFormatJSON {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "Unknown format '%s'. Use '%s', '%s' or '%s'.\n", ruledocFormat, ruleDocFormatText, ruleDocFormatMarkdown, ruleDocFormatJSON)
+	}
+
+	allDocs, err := collectRuleDocs()
+	if err != nil {
+		return err
+	}
+	docs := []ruleDoc{}
+	for _, rule := range allDocs {
+		matches := len(args) == 0
+		for _, arg := range args {
+			if strings.Contains(rule.Name, arg) || strings.Contains(rule.Package, arg) {
+				matches = true
+			}
+		}
+		if matches {
+			docs = append(docs, rule)
+		}
+	}
+	if len(docs) == 0 && len(args) > 0 {
+		return log.Errorf("No rules match '%s'.\n", strings.Join(args, "', '"))
+	}
+
+	switch ruledocFormat {
+	case ruleDocFormatJSON:
+		data, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			return log.Errorf("Failed to serialize the documentation: %s.\n", err)
+		}
+		fmt.Println(string(data))
+	case ruleDocFormatMarkdown:
+		printRuleDocsMarkdown(docs)
+	default:
+		printRuleDocsText(docs)
+	}
+	return nil
+}
+
+func printRuleDocsText(docs []ruleDoc) {
+	for idx, rule := range docs {
+		if idx > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%s)\n", rule.Name, rule.Package)
+		for _, line := range strings.Split(rule.Doc, "\n") {
+			if line != "" {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+		nameWidth, typeWidth := 0, 0
+		for _, field := range rule.Fields {
+			if len(field.Name) > nameWidth {
+				nameWidth = len(field.Name)
+			}
+			if len(field.Type) > typeWidth {
+				typeWidth = len(field.Type)
+			}
+		}
+		for _, field := range rule.Fields {
+			line := fmt.Sprintf("    %-*s  %-*s", nameWidth, field.Name, typeWidth, field.Type)
+			if field.Doc != "" {
+				line += "  // " + field.Doc
+			}
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	}
+}
+
+func printRuleDocsMarkdown(docs []ruleDoc) {
+	for idx, rule := range docs {
+		if idx > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("## %s\n\n", rule.Name)
+		fmt.Printf("`import \"%s\"`\n\n", rule.Package)
+		if rule.Doc != "" {
+			fmt.Printf("%s\n\n", rule.Doc)
+		}
+		if len(rule.Fields) == 0 {
+			continue
+		}
+		fmt.Println("| Field | Type | Description |")
+		fmt.Println("| --- | --- | --- |")
+		for _, field := range rule.Fields {
+			fmt.Printf("| `%s` | `%s` | %s |\n", field.Name, field.Type, strings.ReplaceAll(field.Doc, "|", "\\|"))
+		}
+	}
+}
@@ -8,9 +8,9 @@ var runCmd = &cobra.Command{
 	Use:   "run [patterns] [build flags] [: run args]",
 	Short: "Builds and runs the targets",
 	Long:  `Builds and runs the targets.`,
-	Run:   runRun,
+	RunE:  runRun,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return completeBuildArgs(toComplete, modeRun), cobra.ShellCompDirectiveNoFileComp
+		return completeBuildArgs(toComplete, modeRun)
 	},
 	DisableFlagsInUseLine: true,
 }
@@ -18,9 +18,12 @@ var runCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().SetInterspersed(false)
+	addSetFlag(runCmd)
+	addUseLastGoodFlag(runCmd)
+	addNoStampFlag(runCmd)
 }
 
-func runRun(cmd *cobra.Command, args []string) {
+func runRun(cmd *cobra.Command, args []string) error {
 	runArgs := []string{}
 	buildArgs := args
 	for idx, arg := range args {
@@ -30,5 +33,9 @@ func runRun(cmd *cobra.Command, args []string) {
 			break
 		}
 	}
-	runBuild(buildArgs, modeRun, runArgs)
+	buildArgs, err := withSetFlags(buildArgs)
+	if err != nil {
+		return err
+	}
+	return runBuild(buildArgs, modeRun, runArgs)
 }
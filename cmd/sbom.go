@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/provenance"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// sbomFormat is the format of the software bill of materials that builds write if not empty.
+var sbomFormat string
+
+func checkSBOMFormat() error {
+	if sbomFormat == "" {
+		return nil
+	}
+	for _, format := range provenance.Formats {
+		if sbomFormat == format {
+			return nil
+		}
+	}
+	return log.ErrorfWithCode(log.ExitUsage, nil, "Unknown SBOM format '%s'. Use '%s'.\n", sbomFormat, strings.Join(provenance.Formats, "' or '"))
+}
+
+// sbomModules returns the name, URL and checked out commit of all modules of the workspace.
+func sbomModules(workspaceRoot string) ([]provenance.Module, error) {
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	result := []provenance.Module{}
+	for _, name := range sortMapKeys(modules) {
+		mod := modules[name]
+		entry := provenance.Module{Name: name}
+		if _, isGit := mod.(module.GitModule); isGit {
+			// Workspaces without a remote or without commits are still described.
+			if url, err := runGitInDir(mod.RootPath(), "config", "--get", "remote.origin.url"); err == nil {
+				entry.URL = redactURLCredentials(url)
+			}
+			if commit, err := runGitInDir(mod.RootPath(), "rev-parse", "HEAD"); err == nil {
+				entry.Commit = commit
+			}
+			status, _ := runGitInDir(mod.RootPath(), "status", "--porcelain")
+			entry.Dirty = status != ""
+		} else {
+			url, err := mod.URL()
+			if err != nil {
+				return nil, err
+			}
+			if entry.Commit, err = mod.Head(); err != nil {
+				return nil, err
+			}
+			entry.URL = redactURLCredentials(url)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// targetClosure returns the target `name` and all targets it depends on or uses as tools.
+func targetClosure(name string, targets map[string]target) []string {
+	visited := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		queue = append(queue, targets[current].Deps...)
+		queue = append(queue, targets[current].Tools...)
+	}
+	return sortMapKeys(visited)
+}
+
+// fileSHA256 returns the SHA256 digest of the file at `filePath` without reading the whole file
+// into memory.
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", log.Errorf("Failed to read file '%s': %s.\n", filePath, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", log.Errorf("Failed to read file '%s': %s.\n", filePath, err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// mergeStrings returns the sorted union of `a` and `b`.
+func mergeStrings(a, b []string) []string {
+	union := map[string]bool{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		union[s] = true
+	}
+	return sortMapKeys(union)
+}
+
+// writeSBOM writes the software bill of materials of the outputs of `targets` to the output
+// directory. Each output is attributed to the modules and toolchains of the targets it was built
+// from. Outputs of several targets are listed once, attributed to the first target and the
+// modules and toolchains of all of them.
+func writeSBOM(outputDir string, targets []string, genOutput generatorOutput) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modules, err := sbomModules(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	manifest := provenance.Manifest{
+		Name:    path.Base(workspaceRoot),
+		Created: time.Now(),
+		Tool:    "dbt",
+		Version: currentDbtVersion(),
+		Modules: modules,
+		Flags:   map[string]string{},
+	}
+	for name, flag := range genOutput.Flags {
+		manifest.Flags[name] = flag.Value
+	}
+
+	toolchains := map[string]bool{}
+	artifactIndices := map[string]int{}
+	for _, name := range targets {
+		modules, targetToolchains := map[string]bool{}, map[string]bool{}
+		for _, dep := range targetClosure(name, genOutput.Targets) {
+			modules[moduleOf(dep)] = true
+			if toolchain := genOutput.Targets[dep].Toolchain; toolchain != "" {
+				targetToolchains[toolchain] = true
+				toolchains[toolchain] = true
+			}
+		}
+		outputs := append([]string{}, genOutput.Targets[name].Outputs...)
+		sort.Strings(outputs)
+		for _, output := range outputs {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			if info, err := os.Stat(output); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			relPath, err := filepath.Rel(outputDir, output)
+			if err != nil {
+				relPath = output
+			}
+			if idx, exists := artifactIndices[relPath]; exists {
+				artifact := &manifest.Artifacts[idx]
+				artifact.Modules = mergeStrings(artifact.Modules, sortMapKeys(modules))
+				artifact.Toolchains = mergeStrings(artifact.Toolchains, sortMapKeys(targetToolchains))
+				continue
+			}
+			digest, err := fileSHA256(output)
+			if err != nil {
+				return err
+			}
+			artifactIndices[relPath] = len(manifest.Artifacts)
+			manifest.Artifacts = append(manifest.Artifacts, provenance.Artifact{
+				Path:       relPath,
+				SHA256:     digest,
+				Target:     targetID(name),
+				Modules:    sortMapKeys(modules),
+				Toolchains: sortMapKeys(targetToolchains),
+			})
+		}
+	}
+	for _, name := range sortMapKeys(toolchains) {
+		manifest.Toolchains = append(manifest.Toolchains, provenance.Toolchain{Name: name, Version: genOutput.Toolchains[name]})
+	}
+
+	data, err := manifest.Encode(sbomFormat)
+	if err != nil {
+		return log.Errorf("Failed to create the software bill of materials: %s.\n", err)
+	}
+	sbomPath := path.Join(outputDir, provenance.FileName(sbomFormat))
+	if err := util.WriteFile(sbomPath, data); err != nil {
+		return err
+	}
+	log.Success("Wrote the software bill of materials to '%s'.\n", sbomPath)
+	return nil
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+
+	"github.com/daedaleanai/cobra"
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest [modules] [: go test args]",
+	Short: "Runs the Go tests of the build rules",
+	Long: `Runs 'go test' for all RULES/ packages of the given modules (or all modules if none are given)
+in the same assembled context that is used to build targets.`,
+	RunE:                  runSelftest,
+	ValidArgsFunction:     completeSelftestArgs,
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+	selftestCmd.Flags().SetInterspersed(false)
+}
+
+func runSelftest(cmd *cobra.Command, args []string) error {
+	goTestArgs := []string{}
+	moduleNames := args
+	for idx, arg := range args {
+		if arg == ":" {
+			goTestArgs = args[idx+1:]
+			moduleNames = args[:idx]
+			break
+		}
+	}
+
+	ctx, err := dbtContext()
+	if err != nil {
+		return err
+	}
+	modules, err := module.GetAllModules(ctx.WorkspaceRoot)
+	if err != nil {
+		return err
+	}
+	if len(moduleNames) == 0 {
+		moduleNames = sortMapKeys(modules)
+	}
+
+	generator, err := dbt.PrepareGenerator(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, moduleName := range moduleNames {
+		mod, exists := modules[moduleName]
+		if !exists {
+			return log.Errorf("There is no module '%s' in the workspace.\n", moduleName)
+		}
+
+		goModules, err := module.ListGoModules(mod)
+		if err != nil {
+			return err
+		}
+		for _, goMod := range goModules {
+			goModDir := path.Join(generator.Dir, goMod.Name)
+			if !hasOverlaidFiles(generator.Sources, path.Join(goModDir, rulesDirName)) {
+				continue
+			}
+
+			log.Log("Testing %s/%s\n", goMod.Name, rulesDirName)
+			testArgs := append(append([]string{}, goTestArgs...), "./"+rulesDirName+"/...")
+			log.Debug("Running 'go test %s' in '%s'.\n", strings.Join(testArgs, " "), goModDir)
+			testCmd := generator.GoCommand("test", testArgs...)
+			testCmd.Dir = goModDir
+			testCmd.Stdout = os.Stdout
+			testCmd.Stderr = os.Stderr
+			if err := testCmd.Run(); err != nil {
+				failed = append(failed, goMod.Name)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return log.Errorf("Tests failed for: %s.\n", strings.Join(failed, ", "))
+	}
+	log.Success("All tests passed.\n")
+	return nil
+}
+
+// hasOverlaidFiles returns true if any of the overlaid `sources` is located inside `dir`.
+func hasOverlaidFiles(sources map[string]string, dir string) bool {
+	for overlaidPath := range sources {
+		if strings.HasPrefix(overlaidPath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func completeSelftestArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	modules, err := workspaceModules()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions := []string{}
+	for name := range modules {
+		completions = append(completions, name)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
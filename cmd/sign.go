@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// Tools that sign build outputs.
+const (
+	signingToolGPG     = "gpg"
+	signingToolCosign  = "cosign"
+	signingToolCommand = "command"
+)
+
+// signOutputs makes builds sign the outputs of signable targets.
+var signOutputs bool
+
+// checkSigningConfig fails if the signing configuration is incomplete.
+func checkSigningConfig() error {
+	signing := config.GetConfig().Signing
+	switch signing.Tool {
+	case signingToolGPG:
+	case signingToolCosign:
+		if signing.Key == "" {
+			return log.ErrorfWithCode(log.ExitUsage, nil, "Signing with cosign requires 'signing.key' in the DBT configuration.\n")
+		}
+	case signingToolCommand:
+		if signing.Command == "" {
+			return log.ErrorfWithCode(log.ExitUsage, nil, "Signing with a command requires 'signing.command' in the DBT configuration.\n")
+		}
+	case "":
+		return log.ErrorfWithCode(log.ExitUsage, nil, "--sign requires 'signing.tool' in the DBT configuration.\n")
+	default:
+		return log.ErrorfWithCode(log.ExitUsage, nil, "Unknown signing tool '%s'. Use '%s', '%s' or '%s'.\n", signing.Tool, signingToolGPG, signingToolCosign, signingToolCommand)
+	}
+	return nil
+}
+
+// signatureSuffix returns the suffix of the detached signatures that `tool` writes next to the
+// signed files.
+func signatureSuffix(tool string) string {
+	if tool == signingToolGPG {
+		return ".asc"
+	}
+	return ".sig"
+}
+
+// signingCommand returns the command that signs `file` and writes the signature to `signature`. The
+// command runs in the workspace root.
+func signingCommand(signing config.Signing, workspaceRoot, file, signature, target string) *exec.Cmd {
+	var cmd *exec.Cmd
+	switch signing.Tool {
+	case signingToolGPG:
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", signature}
+		if signing.Key != "" {
+			args = append(args, "--local-user", signing.Key)
+		}
+		cmd = exec.Command("gpg", append(args, file)...)
+	case signingToolCosign:
+		cmd = exec.Command("cosign", "sign-blob", "--yes", "--key", signing.Key, "--output-signature", signature, file)
+	default:
+		cmd = exec.Command("sh", "-c", signing.Command)
+	}
+	cmd.Dir = workspaceRoot
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"DBT_SIGN_FILE="+file,
+		"DBT_SIGN_SIGNATURE="+signature,
+		"DBT_SIGN_TARGET="+targetID(target),
+		"DBT_SIGN_KEY="+signing.Key)
+	return cmd
+}
+
+// signTargetOutputs writes detached signatures next to the outputs of the signable targets among
+// `targets`. All outputs are signed again, since the modification time of an existing signature
+// does not tell whether it was made for the current content, key or tool.
+func signTargetOutputs(outputDir string, targets []string, genOutput generatorOutput) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	signing := config.GetConfig().Signing
+	signed := 0
+	for _, name := range targets {
+		if !genOutput.Targets[name].Signable {
+			continue
+		}
+		for _, output := range genOutput.Targets[name].Outputs {
+			if !path.IsAbs(output) {
+				output = path.Join(outputDir, output)
+			}
+			info, err := os.Stat(output)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			signature := output + signatureSuffix(signing.Tool)
+			os.Remove(signature)
+			log.Debug("Signing '%s'.\n", output)
+			if err := signingCommand(signing, workspaceRoot, output, signature, name).Run(); err != nil {
+				os.Remove(signature)
+				return log.Errorf("Failed to sign '%s' of target '%s' with %s: %s.\n", output, targetID(name), signing.Tool, err)
+			}
+			signed++
+		}
+	}
+	if signed == 0 {
+		log.Log("No outputs of signable targets to sign.\n")
+		return nil
+	}
+	log.Success("Signed %d outputs with %s.\n", signed, signing.Tool)
+	return nil
+}
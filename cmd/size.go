@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const sizeBaselineFileName = "SIZES.yaml"
+
+type sizeBaseline struct {
+	// Sizes maps target IDs to the total size of their outputs in bytes.
+	Sizes map[string]int64
+}
+
+var sizeCmd = &cobra.Command{
+	Use:   "size [patterns] [build flags] [--compare=CONFIG | --baseline=FILE] [--update-baseline]",
+	Short: "Reports the sizes of the outputs of the targets",
+	Long: `Reports the total size in bytes of the output files of each target matching the patterns.
+The targets are not built, so they must have been built with the same build flags before.
+
+The sizes are compared with the ones of the same targets built with the build config CONFIG
+if --compare is given, or else with the baseline in the SIZES.yaml file in the workspace root
+(or the file given with --baseline) if it exists. With --update-baseline, the sizes are recorded
+in the baseline instead, keeping the sizes of other targets. With --max-growth, the command
+fails if a target grew by more than PERCENT percent.`,
+	RunE: runSize,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sizeCompareConfig, sizeBaselineFile string
+var sizeUpdateBaseline bool
+var sizeMaxGrowth float64
+
+func init() {
+	rootCmd.AddCommand(sizeCmd)
+	sizeCmd.Flags().StringVar(&sizeCompareConfig, "compare", "", "Compare with the targets built with build config CONFIG")
+	sizeCmd.Flags().StringVar(&sizeBaselineFile, "baseline", "", "Compare with the baseline in FILE instead of "+sizeBaselineFileName)
+	sizeCmd.Flags().BoolVar(&sizeUpdateBaseline, "update-baseline", false, "Record the sizes in the baseline")
+	sizeCmd.Flags().Float64Var(&sizeMaxGrowth, "max-growth", -1, "Fail if a target grew by more than PERCENT percent")
+}
+
+// targetSizes returns the total size of the outputs of all targets matching the patterns in `args`
+// by target ID. Targets whose outputs have not all been built are missing.
+func targetSizes(args []string) ([]string, map[string]int64, error) {
+	outputs, err := outputsOfTargets(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := []string{}
+	sizes := map[string]int64{}
+	for _, name := range sortMapKeys(outputs) {
+		id := targetID(name)
+		ids = append(ids, id)
+		size, built := int64(0), true
+		for _, output := range outputs[name] {
+			if _, err := os.Stat(output); err != nil {
+				built = false
+				break
+			}
+			size += dirSize(output)
+		}
+		if built {
+			sizes[id] = size
+		}
+	}
+	return ids, sizes, nil
+}
+
+func sizeBaselinePath() (string, error) {
+	if sizeBaselineFile == "" {
+		workspaceRoot, err := util.GetWorkspaceRoot()
+		return path.Join(workspaceRoot, sizeBaselineFileName), err
+	}
+	if path.IsAbs(sizeBaselineFile) {
+		return sizeBaselineFile, nil
+	}
+	workingDir, err := util.GetWorkingDir()
+	return path.Join(workingDir, sizeBaselineFile), err
+}
+
+// referenceSizes returns the sizes to compare with and a description of where they come from, or
+// nil if there is nothing to compare with.
+func referenceSizes(args []string) (map[string]int64, string, error) {
+	if sizeCompareConfig != "" {
+		// The targets are compared with the same patterns built with the flags of the config.
+		compareArgs := []string{}
+		for _, arg := range args {
+			if !strings.Contains(arg, "=") && !strings.HasPrefix(arg, "@") {
+				compareArgs = append(compareArgs, arg)
+			}
+		}
+		_, sizes, err := targetSizes(append(compareArgs, "@"+sizeCompareConfig))
+		return sizes, fmt.Sprintf("build config '%s'", sizeCompareConfig), err
+	}
+	baselinePath, err := sizeBaselinePath()
+	if err != nil {
+		return nil, "", err
+	}
+	if !util.FileExists(baselinePath) {
+		if sizeBaselineFile != "" {
+			return nil, "", log.Errorf("The baseline '%s' does not exist.\n", baselinePath)
+		}
+		return nil, "", nil
+	}
+	var baseline sizeBaseline
+	if err := util.ReadYaml(baselinePath, &baseline); err != nil {
+		return nil, "", err
+	}
+	return baseline.Sizes, fmt.Sprintf("baseline '%s'", baselinePath), nil
+}
+
+func runSize(cmd *cobra.Command, args []string) error {
+	if sizeCompareConfig != "" && (sizeBaselineFile != "" || sizeUpdateBaseline) {
+		return log.ErrorfWithCode(log.ExitUsage, nil, "--compare cannot be combined with --baseline or --update-baseline.\n")
+	}
+	ids, sizes, err := targetSizes(args)
+	if err != nil {
+		return err
+	}
+
+	if sizeUpdateBaseline {
+		baselinePath, err := sizeBaselinePath()
+		if err != nil {
+			return err
+		}
+		baseline := sizeBaseline{Sizes: map[string]int64{}}
+		if util.FileExists(baselinePath) {
+			if err := util.ReadYaml(baselinePath, &baseline); err != nil {
+				return err
+			}
+		}
+		if baseline.Sizes == nil {
+			baseline.Sizes = map[string]int64{}
+		}
+		for id, size := range sizes {
+			baseline.Sizes[id] = size
+		}
+		if err := util.WriteYaml(baselinePath, &baseline); err != nil {
+			return err
+		}
+		log.Success("Recorded the sizes of %d targets in '%s'.\n", len(sizes), baselinePath)
+		return nil
+	}
+
+	reference, source, err := referenceSizes(args)
+	if err != nil {
+		return err
+	}
+	if reference != nil {
+		log.Log("Comparing with the %s.\n", source)
+	}
+
+	rows := [][]string{{"TARGET", "SIZE"}}
+	if reference != nil {
+		rows[0] = append(rows[0], "REFERENCE", "CHANGE")
+	}
+	grown := []string{}
+	for _, id := range ids {
+		size, built := sizes[id]
+		row := []string{id, "not built"}
+		if built {
+			row[1] = fmt.Sprint(size)
+		}
+		if reference != nil {
+			refSize, hasRef := reference[id]
+			row = append(row, "-", "-")
+			if hasRef {
+				row[2] = fmt.Sprint(refSize)
+			}
+			if built && hasRef {
+				row[3] = formatSizeChange(size, refSize)
+				if sizeMaxGrowth >= 0 && float64(size-refSize) > float64(refSize)*sizeMaxGrowth/100 {
+					grown = append(grown, id)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	printSizeTable(rows)
+
+	if len(sizes) < len(ids) {
+		log.Warning("%d targets have not been built with these build flags.\n", len(ids)-len(sizes))
+	}
+	if len(grown) > 0 {
+		return log.Errorf("%d targets grew by more than %g%%: %s.\n", len(grown), sizeMaxGrowth, strings.Join(grown, ", "))
+	}
+	return nil
+}
+
+// formatSizeChange formats the change from `refSize` to `size` in bytes and percent.
+func formatSizeChange(size, refSize int64) string {
+	if refSize == 0 {
+		return fmt.Sprintf("%+d", size-refSize)
+	}
+	return fmt.Sprintf("%+d (%+.1f%%)", size-refSize, float64(size-refSize)*100/float64(refSize))
+}
+
+func printSizeTable(rows [][]string) {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for idx, field := range row {
+			if len(field) > widths[idx] {
+				widths[idx] = len(field)
+			}
+		}
+	}
+	for _, row := range rows {
+		line := []string{}
+		for idx, field := range row {
+			// The target IDs are left-aligned, the numbers right-aligned.
+			if idx == 0 {
+				line = append(line, fmt.Sprintf("%-*s", widths[idx], field))
+			} else {
+				line = append(line, fmt.Sprintf("%*s", widths[idx], field))
+			}
+		}
+		fmt.Println(strings.Join(line, "  "))
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const stampFileName = "stamp.txt"
+
+// noStamp makes builds write fixed values to the stamp file so that stamped outputs only depend
+// on their sources and can be cached.
+var noStamp bool
+
+// addNoStampFlag registers the `--nostamp` flag on `cmd`.
+func addNoStampFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noStamp, "nostamp", false, "Write fixed values to the stamp file to keep stamped outputs cacheable")
+}
+
+// writeStampFile writes the build metadata (the commit of the workspace, whether it has
+// uncommitted changes, the time of the build and the user) to the stamp file in `outputDir` and
+// returns its path. Rules make the actions that embed the metadata depend on the stamp file. The
+// file is only rewritten if its content changes, so with `--nostamp` it never triggers rebuilds.
+func writeStampFile(outputDir string) (string, error) {
+	stamp := map[string]string{
+		"BUILD_SCM_REVISION": "unknown",
+		"BUILD_SCM_STATUS":   "unstamped",
+		"BUILD_TIMESTAMP":    "0",
+		"BUILD_USER":         "unknown",
+	}
+	if !noStamp {
+		workspaceRoot, err := util.GetWorkspaceRoot()
+		if err != nil {
+			return "", err
+		}
+		stamp["BUILD_SCM_STATUS"] = "unknown"
+		if revision, err := runGitInDir(workspaceRoot, "rev-parse", "HEAD"); err == nil {
+			stamp["BUILD_SCM_REVISION"] = revision
+			stamp["BUILD_SCM_STATUS"] = "clean"
+		} else {
+			log.Debug("Failed to determine the commit of the workspace: %s.\n", err)
+		}
+		if status, err := runGitInDir(workspaceRoot, "status", "--porcelain"); err == nil && status != "" {
+			stamp["BUILD_SCM_STATUS"] = "modified"
+		}
+		stamp["BUILD_TIMESTAMP"] = fmt.Sprint(time.Now().Unix())
+		if current, err := user.Current(); err == nil {
+			stamp["BUILD_USER"] = current.Username
+		}
+	}
+
+	var content strings.Builder
+	for _, key := range sortMapKeys(stamp) {
+		fmt.Fprintf(&content, "%s %s\n", key, stamp[key])
+	}
+
+	stampFilePath := path.Join(outputDir, stampFileName)
+	if current, err := ioutil.ReadFile(stampFilePath); err == nil && string(current) == content.String() {
+		return stampFilePath, nil
+	}
+	return stampFilePath, util.WriteFile(stampFilePath, []byte(content.String()))
+}
+
+// runGitInDir runs a git command in `dir` and returns its trimmed stdout.
+func runGitInDir(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
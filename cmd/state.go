@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+// workspaceStateDir returns the directory that keeps the state of DBT for the workspace
+// `workspaceRoot` that has to survive 'dbt clean', e.g. the build history. It is located in the
+// state directory of the user ($XDG_STATE_HOME or ~/.local/state), so that other users of a shared
+// workspace can not change it, and is named after the real path of the workspace.
+func workspaceStateDir(workspaceRoot string) (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", log.Errorf("Failed to locate the state directory of the user: %s.\n", err)
+		}
+		stateHome = path.Join(homeDir, ".local", "state")
+	}
+	if realRoot, err := filepath.EvalSymlinks(workspaceRoot); err == nil {
+		workspaceRoot = realRoot
+	}
+	digest := sha256.Sum256([]byte(workspaceRoot))
+	return path.Join(stateHome, "dbt", "workspaces", fmt.Sprintf("%s-%x", path.Base(workspaceRoot), digest[:6])), nil
+}
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"sort"
+	"strconv"
 
 	"github.com/daedaleanai/dbt/log"
 	"github.com/daedaleanai/dbt/module"
@@ -21,7 +23,7 @@ var syncCmd = &cobra.Command{
 	Short: "Recursively clones and updates modules to satisfy all dependencies.",
 	Long: `Recursively clones and updates modules to satisfy the dependencies
 declared in the MODULE files of each module, starting from the top-level MODULE file.`,
-	Run: runSync,
+	RunE: runSync,
 }
 
 var update bool
@@ -36,16 +38,29 @@ func init() {
 	rootCmd.AddCommand(syncCmd)
 }
 
-func runSync(cmd *cobra.Command, args []string) {
+// maxResolutionRestarts limits how often the dependency resolution is restarted.
+const maxResolutionRestarts = 100
+
+func runSync(cmd *cobra.Command, args []string) error {
 	if update && strict {
-		log.Fatal("--update and --strict can not be used together.\n")
+		return log.ErrorfWithCode(log.ExitUsage, nil, "--update and --strict can not be used together.\n")
 	}
 
-	workspaceRoot := util.GetWorkspaceRoot()
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
 	log.Debug("Workspace: %s.\n", workspaceRoot)
 
-	workspaceModuleFile := module.ReadModuleFile(workspaceRoot)
-	workspaceModuleName := module.OpenModule(workspaceRoot).Name()
+	workspaceModuleFile, err := module.ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	workspaceModule, err := module.OpenModule(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	workspaceModuleName := workspaceModule.Name()
 	log.Debug("Workspace module name: '%s\n", workspaceModuleName)
 
 	workspaceModuleSymlink := ""
@@ -54,130 +69,251 @@ func runSync(cmd *cobra.Command, args []string) {
 		workspaceModuleSymlink = path.Join(workspaceRoot, util.DepsDirName, workspaceModuleName)
 		if !util.DirExists(workspaceModuleSymlink) {
 			log.Debug("Creating symlink for the workspace module: '%s/%s' -> '%s'.\n", util.DepsDirName, workspaceModuleName, workspaceRoot)
-			util.MkdirAll(path.Dir(workspaceModuleSymlink))
+			if err := util.MkdirAll(path.Dir(workspaceModuleSymlink)); err != nil {
+				return err
+			}
 			err := os.Symlink("..", workspaceModuleSymlink)
 			if err != nil {
-				log.Fatal("Failed to create symlink for workspace module: %s.\n", err)
+				return log.Errorf("Failed to create symlink for workspace module: %s.\n", err)
 			}
 		}
 	}
 
-	errorFunc := func(format string, a ...interface{}) {
+	errorFunc := func(format string, a ...interface{}) error {
 		log.Error(format, a...)
-		log.Fatal("Use --ignore-errors to ignore this error.\n")
+		return log.ErrorfWithCode(log.ExitDependencies, nil, "Use --ignore-errors to ignore this error.\n")
 	}
 	if ignoreErrors {
-		errorFunc = log.Warning
+		errorFunc = func(format string, a ...interface{}) error {
+			log.Warning(format, a...)
+			return nil
+		}
 	}
 
-	// Modules that have been processed.
-	done := map[string]bool{}
-
 	// Modules that have been fetched.
 	fetched := map[string]bool{}
 
-	// Modules that still need to be processed.
-	queue := []string{workspaceRoot}
-
-	// Pinned dependency URLs / hashes.
-	pinnedUrls := map[string]string{}
-	pinnedHashes := map[string]string{}
-
-	for len(queue) > 0 {
-		modulePath := queue[0]
-		queue = queue[1:]
-		if done[modulePath] {
-			continue
-		}
-		done[modulePath] = true
-
-		moduleName := path.Base(modulePath)
-		log.IndentationLevel = 0
-		log.Log("Processing %s\n", moduleName)
-		log.IndentationLevel = 1
-
-		moduleFile := module.ReadModuleFile(modulePath)
-
-		if len(moduleFile.Dependencies) == 0 {
-			log.IndentationLevel = 1
-			log.Log("Has no dependencies\n\n")
-			continue
-		}
-
-		for _, name := range dependencyNames(moduleFile) {
-			log.IndentationLevel = 1
-			log.Log("Depends on %s\n", name)
-			log.IndentationLevel = 2
-
-			dep := moduleFile.Dependencies[name]
-			depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
-			queue = append(queue, depModulePath)
-
-			// Check that the dependency URL matches the pinned URL for that module.
-			if _, isUrlPinned := pinnedUrls[name]; !isUrlPinned {
-				pinnedUrls[name] = dep.URL
-				log.Debug("Pinning URL to '%s'.\n", dep.URL)
-			}
-			if dep.URL != pinnedUrls[name] {
-				errorFunc("Dependency requires URL '%s', but URL has been pinned to '%s'.\n", dep.URL, pinnedUrls[name])
-			}
-
-			// Check that the on-disk module has the same URL.
-			depModule := module.OpenOrCreateModule(depModulePath, dep.URL, dep.Type)
-			if depModule.URL() != dep.URL {
-				errorFunc("Dependency requires URL '%s', but the on-disk module has URL '%s'.\n", dep.URL, depModule.URL())
-			}
-
-			// Make sure we have the latest changes and the working tree is clean.
-			if _, hasBeenFetched := fetched[depModulePath]; !hasBeenFetched {
-				depModule.Fetch()
-				fetched[depModulePath] = true
-			}
-			if depModule.IsDirty() {
-				errorFunc("The exiting module has local changes.\n")
-			}
-
-			// Determine the commit hash for this dependency.
+	// Pinned dependency URLs / selected hashes. The hashes required by the workspace module are
+	// pinned. For all other dependencies, the highest version required by any module is selected.
+	var pinnedUrls, selectedHashes, selectedVersions map[string]string
+	var workspacePins map[string]bool
 
-			// In --strict mode all hashes must be set in the MODULE file.
-			if strict && dep.Hash == "" {
-				errorFunc("Hash must not be empty in --strict mode.\n")
-			}
-
-			// Resolve the version string to a hash if we are currently processsing the
-			// workspace module (only one module is "done") and the hash is not set yet or
-			// --update is used to force re-resolution of the version string to a hash.
-			if (update || dep.Hash == "") && len(done) == 1 {
-				dep.Hash = depModule.RevParse(dep.Version)
-				log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, dep.Hash[:7])
+	// Modules that have been processed.
+	var done map[string]bool
+
+	// A selected hash is only ever replaced by a newer one. If a module has already been processed
+	// when a newer version of it is selected, its dependencies might have changed and the resolution
+	// is restarted from the workspace module. The newer versions are kept as lower bounds across
+	// restarts, everything else is resolved again, so that requirements of versions that are no
+	// longer selected do not linger.
+	upgradedHashes := map[string]string{}
+	upgradedVersions := map[string]string{}
+	restarts := 0
+resolution:
+	for {
+		pinnedUrls = map[string]string{}
+		selectedHashes = map[string]string{}
+		selectedVersions = map[string]string{}
+		workspacePins = map[string]bool{}
+		done = map[string]bool{}
+
+		// Modules that still need to be processed.
+		queue := []string{workspaceRoot}
+
+		for len(queue) > 0 {
+			modulePath := queue[0]
+			queue = queue[1:]
+			if done[modulePath] {
+				continue
 			}
+			done[modulePath] = true
 
-			log.Log("Using hash '%s' for version '%s'.\n", dep.Hash[:7], dep.Version)
+			moduleName := path.Base(modulePath)
+			log.IndentationLevel = 0
+			log.Log("Processing %s\n", moduleName)
+			log.IndentationLevel = 1
 
-			// Check that the dependency hash is part of the tree that is referenced by the version string.
-			if !depModule.IsAncestor(dep.Hash, dep.Version) {
-				errorFunc(
-					"The dependency hash ('%s') is not an ancestor of the commit ('%s') the version string ('%s') currently resolves to.\n",
-					dep.Hash[:7], depModule.RevParse(dep.Version)[:7], dep.Version)
+			moduleFile, err := module.ReadModuleFile(modulePath)
+			if err != nil {
+				return err
 			}
 
-			// Check the dependency hash against the fixed hash for that module.
-			if _, isHashPinned := pinnedHashes[name]; !isHashPinned {
-				pinnedHashes[name] = dep.Hash
-			}
-			pinnedHash := pinnedHashes[name]
-			if dep.Hash != pinnedHash {
-				errorFunc("Dependency requires hash '%s', but hash has been pinned to '%s'.\n", dep.Hash[:7], pinnedHash[:7])
+			if len(moduleFile.Dependencies) == 0 {
+				log.IndentationLevel = 1
+				log.Log("Has no dependencies\n\n")
+				continue
 			}
 
-			// Check out the pinned hash.
-			if depModule.Head() != pinnedHash {
-				log.Log("Checking out '%s'.\n", pinnedHash[:7])
-				depModule.Checkout(pinnedHash)
-				module.SetupModule(depModulePath)
+			for _, name := range dependencyNames(moduleFile) {
+				log.IndentationLevel = 1
+				log.Log("Depends on %s\n", name)
+				log.IndentationLevel = 2
+
+				dep := moduleFile.Dependencies[name]
+				depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
+				queue = append(queue, depModulePath)
+
+				// Check that the dependency URL matches the pinned URL for that module.
+				if _, isUrlPinned := pinnedUrls[name]; !isUrlPinned {
+					pinnedUrls[name] = dep.URL
+					log.Debug("Pinning URL to '%s'.\n", dep.URL)
+				}
+				if dep.URL != pinnedUrls[name] {
+					if err := errorFunc("Dependency requires URL '%s', but URL has been pinned to '%s'.\n", dep.URL, pinnedUrls[name]); err != nil {
+						return err
+					}
+				}
+
+				// Check that the on-disk module has the same URL.
+				depModule, err := module.OpenOrCreateDependency(depModulePath, dep)
+				if err != nil {
+					return err
+				}
+				depModuleURL, err := depModule.URL()
+				if err != nil {
+					return err
+				}
+				if depModuleURL != dep.URL {
+					if err := errorFunc("Dependency requires URL '%s', but the on-disk module has URL '%s'.\n", dep.URL, depModuleURL); err != nil {
+						return err
+					}
+				}
+
+				// Make sure we have the latest changes and the working tree is clean.
+				if _, hasBeenFetched := fetched[depModulePath]; !hasBeenFetched {
+					if _, err := depModule.Fetch(); err != nil {
+						return err
+					}
+					fetched[depModulePath] = true
+				}
+				isDirty, err := depModule.IsDirty()
+				if err != nil {
+					return err
+				}
+				if isDirty {
+					if err := errorFunc("The exiting module has local changes.\n"); err != nil {
+						return err
+					}
+				}
+
+				// Determine the commit hash for this dependency.
+
+				// In --strict mode all hashes must be set in the MODULE file.
+				if strict && dep.Hash == "" {
+					if err := errorFunc("Hash must not be empty in --strict mode.\n"); err != nil {
+						return err
+					}
+				}
+
+				// Resolve the version string to a hash if the hash is not set yet or if we are
+				// currently processsing the workspace module (only one module is "done") and
+				// --update is used to force re-resolution of the version string to a hash.
+				if dep.Hash == "" || (update && len(done) == 1) {
+					if dep.Hash, err = depModule.RevParse(dep.Version); err != nil {
+						return err
+					}
+					log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, dep.Hash[:7])
+				}
+
+				log.Log("Requires hash '%s' for version '%s'.\n", dep.Hash[:7], dep.Version)
+
+				// Check that the dependency hash is part of the tree that is referenced by the version string.
+				isAncestor, err := depModule.IsAncestor(dep.Hash, dep.Version)
+				if err != nil {
+					return err
+				}
+				if !isAncestor {
+					versionHash, err := depModule.RevParse(dep.Version)
+					if err != nil {
+						return err
+					}
+					err = errorFunc(
+						"The dependency hash ('%s') is not an ancestor of the commit ('%s') the version string ('%s') currently resolves to.\n",
+						dep.Hash[:7], versionHash[:7], dep.Version)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Reconcile the dependency hash with the hash selected for that module.
+				selectedHash, isSelected := selectedHashes[name]
+				switch {
+				case !isSelected:
+					selectedHashes[name] = dep.Hash
+					selectedVersions[name] = dep.Version
+					workspacePins[name] = len(done) == 1
+					upgradedHash, isUpgraded := upgradedHashes[name]
+					if isUpgraded && !workspacePins[name] && upgradedHash != dep.Hash {
+						isUpgradeNewer, err := isNewerVersion(depModule, dep.Hash, dep.Version, upgradedHash, upgradedVersions[name])
+						if err != nil {
+							return err
+						}
+						if isUpgradeNewer {
+							log.Log("Selecting hash '%s' over the older hash '%s'.\n", upgradedHash[:7], dep.Hash[:7])
+							selectedHashes[name] = upgradedHash
+							selectedVersions[name] = upgradedVersions[name]
+						}
+					}
+				case dep.Hash == selectedHash:
+				case workspacePins[name]:
+					log.Warning("Dependency requires hash '%s', but the workspace module pins hash '%s'.\n", dep.Hash[:7], selectedHash[:7])
+				default:
+					isDepNewer, err := isNewerVersion(depModule, selectedHash, selectedVersions[name], dep.Hash, dep.Version)
+					if err != nil {
+						return err
+					}
+					isSelectedNewer := false
+					if !isDepNewer {
+						if isSelectedNewer, err = isNewerVersion(depModule, dep.Hash, dep.Version, selectedHash, selectedVersions[name]); err != nil {
+							return err
+						}
+					}
+					switch {
+					case isDepNewer:
+						log.Log("Selecting hash '%s' over the older hash '%s'.\n", dep.Hash[:7], selectedHash[:7])
+						selectedHashes[name] = dep.Hash
+						selectedVersions[name] = dep.Version
+						if done[depModulePath] {
+							upgradedHashes[name] = dep.Hash
+							upgradedVersions[name] = dep.Version
+							restarts++
+							if restarts > maxResolutionRestarts {
+								return log.ErrorfWithCode(log.ExitDependencies, nil, "The dependency resolution did not settle after %d restarts. "+
+									"Pin the versions of the dependencies in the workspace MODULE file.\n", maxResolutionRestarts)
+							}
+							log.IndentationLevel = 0
+							log.Log("\nRestarting the resolution with the new version of %s.\n\n", name)
+							continue resolution
+						}
+					case isSelectedNewer:
+						log.Log("Using the newer hash '%s' required by another module.\n", selectedHash[:7])
+					default:
+						err := errorFunc("Dependency requires hash '%s', which conflicts with hash '%s' required by another module. "+
+							"Pin a version in the workspace MODULE file to resolve the conflict.\n", dep.Hash[:7], selectedHash[:7])
+						if err != nil {
+							return err
+						}
+					}
+				}
+
+				// Check out the selected hash.
+				head, err := depModule.Head()
+				if err != nil {
+					return err
+				}
+				if head != selectedHashes[name] {
+					log.Log("Checking out '%s'.\n", selectedHashes[name][:7])
+					if err := depModule.Checkout(selectedHashes[name]); err != nil {
+						return err
+					}
+					if err := module.SetupModule(depModulePath); err != nil {
+						return err
+					}
+				}
+				log.Log("\n")
 			}
-			log.Log("\n")
 		}
+		break
 	}
 
 	log.IndentationLevel = 0
@@ -186,7 +322,7 @@ func runSync(cmd *cobra.Command, args []string) {
 	depsDir := path.Join(workspaceRoot, util.DepsDirName)
 	content, err := ioutil.ReadDir(depsDir)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		log.Fatal("%v", err)
+		return log.Errorf("%v", err)
 	}
 
 	if content != nil {
@@ -201,12 +337,15 @@ func runSync(cmd *cobra.Command, args []string) {
 
 	// Updated the MODULE file.
 	for name, dep := range workspaceModuleFile.Dependencies {
-		dep.Hash = pinnedHashes[name]
+		dep.Hash = selectedHashes[name]
 		workspaceModuleFile.Dependencies[name] = dep
 	}
-	module.WriteModuleFile(workspaceRoot, workspaceModuleFile)
+	if err := module.WriteModuleFile(workspaceRoot, workspaceModuleFile); err != nil {
+		return err
+	}
 
 	log.Success("Done.\n")
+	return nil
 }
 
 func dependencyNames(file module.ModuleFile) []string {
@@ -217,3 +356,36 @@ func dependencyNames(file module.ModuleFile) []string {
 	sort.Strings(names)
 	return names
 }
+
+// semverRegexp matches the numeric suffix of version strings like 'v1.2.3' or 'origin/release-1.2'.
+var semverRegexp = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?$`)
+
+// isNewerVersion reports whether `newHash` (required as `newVersion`) is newer than `oldHash`
+// (required as `oldVersion`). A commit is newer if it is a descendant of the other commit. For
+// commits on diverged branches, the numeric version strings are compared instead.
+func isNewerVersion(depModule module.Module, oldHash, oldVersion, newHash, newVersion string) (bool, error) {
+	oldIsAncestor, err := depModule.IsAncestor(oldHash, newHash)
+	if err != nil {
+		return false, err
+	}
+	newIsAncestor, err := depModule.IsAncestor(newHash, oldHash)
+	if err != nil {
+		return false, err
+	}
+	if oldIsAncestor || newIsAncestor {
+		return oldIsAncestor && !newIsAncestor, nil
+	}
+	oldMatch := semverRegexp.FindStringSubmatch(oldVersion)
+	newMatch := semverRegexp.FindStringSubmatch(newVersion)
+	if oldMatch == nil || newMatch == nil {
+		return false, nil
+	}
+	for idx := 1; idx < len(oldMatch); idx++ {
+		oldNumber, _ := strconv.Atoi(oldMatch[idx])
+		newNumber, _ := strconv.Atoi(newMatch[idx])
+		if oldNumber != newNumber {
+			return newNumber > oldNumber, nil
+		}
+	}
+	return false, nil
+}
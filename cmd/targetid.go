@@ -0,0 +1,28 @@
+package cmd
+
+import "strings"
+
+// Targets are identified by their path relative to the workspace source directory, e.g.
+// "src/libs/mylib.a". Everything DBT prints or records refers to targets by their canonical ID,
+// which is this name prefixed with "//" (e.g. "//src/libs/mylib.a"), so that the same target
+// can be found with grep in listings, logs, progress events and recorded builds. Names without
+// the "//" prefix were recorded by earlier versions of DBT and are still accepted.
+
+// targetID returns the canonical ID of the target `name`.
+func targetID(name string) string {
+	return "//" + targetName(name)
+}
+
+// targetIDs returns the canonical IDs of the targets `names`.
+func targetIDs(names []string) []string {
+	ids := []string{}
+	for _, name := range names {
+		ids = append(ids, targetID(name))
+	}
+	return ids
+}
+
+// targetName returns the name of the target with the canonical or legacy ID `id`.
+func targetName(id string) string {
+	return strings.TrimLeft(id, "/")
+}
@@ -8,9 +8,9 @@ var testCmd = &cobra.Command{
 	Use:   "test [patterns] [build flags] [: test args]",
 	Short: "Builds and tests the targets",
 	Long:  `Builds and tests the targets.`,
-	Run:   runTest,
+	RunE:  runTest,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return completeBuildArgs(toComplete, modeTest), cobra.ShellCompDirectiveNoFileComp
+		return completeBuildArgs(toComplete, modeTest)
 	},
 	DisableFlagsInUseLine: true,
 }
@@ -18,9 +18,19 @@ var testCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(testCmd)
 	testCmd.Flags().SetInterspersed(false)
+	testCmd.Flags().BoolVar(&updateGoldens, "update-goldens", false, "Rewrite the golden files of golden-output tests from the produced outputs")
+	testCmd.Flags().BoolVar(&reportFlaky, "report-flaky", false, "Report the flakiness scores of all tests instead of running tests")
+	testCmd.Flags().StringVar(&affectedBy, "affected-by", "", "Only run the tests affected by the changes since the git revision")
+	testCmd.Flags().BoolVar(&includeQuarantined, "include-quarantined", false, "Run quarantined flaky tests as well")
+	addSetFlag(testCmd)
+	addUseLastGoodFlag(testCmd)
+	addNoStampFlag(testCmd)
 }
 
-func runTest(cmd *cobra.Command, args []string) {
+func runTest(cmd *cobra.Command, args []string) error {
+	if reportFlaky {
+		return printFlakyTests()
+	}
 	testArgs := []string{}
 	buildArgs := args
 	for idx, arg := range args {
@@ -30,5 +40,9 @@ func runTest(cmd *cobra.Command, args []string) {
 			break
 		}
 	}
-	runBuild(buildArgs, modeTest, testArgs)
+	buildArgs, err := withSetFlags(buildArgs)
+	if err != nil {
+		return err
+	}
+	return runBuild(buildArgs, modeTest, testArgs)
 }
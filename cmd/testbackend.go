@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/pkg/dbt"
+)
+
+// testBackend runs the tests of the targets built with a toolchain or for an architecture.
+type testBackend = dbt.TestBackend
+
+// QEMU names of the architectures supported by Go.
+var qemuArchs = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "arm",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// Programs that come with QEMU but are not user mode emulators.
+var qemuTools = map[string]bool{
+	"qemu-edid":   true,
+	"qemu-ga":     true,
+	"qemu-img":    true,
+	"qemu-io":     true,
+	"qemu-keymap": true,
+	"qemu-nbd":    true,
+}
+
+// hostArch returns the QEMU name of the architecture DBT runs on.
+func hostArch() string {
+	if arch, exists := qemuArchs[runtime.GOARCH]; exists {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// resolveTestBackends returns the test backends declared in the MODULE file followed by a
+// QEMU user mode backend for each other architecture that a QEMU user mode emulator is
+// installed for.
+func resolveTestBackends(declared []module.TestBackend) ([]testBackend, error) {
+	backends := []testBackend{}
+	archs := map[string]bool{}
+	for _, backend := range declared {
+		if backend.Toolchain == "" && backend.Arch == "" {
+			return nil, log.Errorf("Test backend of type '%s' must set 'toolchain' or 'arch'.\n", backend.Type)
+		}
+		command, err := testBackendCommand(backend)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, testBackend{
+			Toolchain: backend.Toolchain,
+			Arch:      backend.Arch,
+			Command:   command,
+		})
+		archs[backend.Arch] = true
+	}
+
+	emulators := installedQemuUserEmulators()
+	for _, arch := range sortMapKeys(emulators) {
+		if arch == hostArch() || archs[arch] {
+			continue
+		}
+		backends = append(backends, testBackend{Arch: arch, Command: fmt.Sprintf("%s {} {args}", emulators[arch])})
+	}
+	return backends, nil
+}
+
+// testBackendCommand returns the command line that runs a test with `backend`.
+func testBackendCommand(backend module.TestBackend) (string, error) {
+	words := []string{}
+	switch backend.Type {
+	case "qemu-user":
+		if backend.Arch == "" {
+			return "", log.Errorf("Test backend of type 'qemu-user' must set 'arch'.\n")
+		}
+		words = append(words, fmt.Sprintf("qemu-%s", backend.Arch), backend.Args, "{}", "{args}")
+	case "qemu-system":
+		if backend.Arch == "" || backend.Machine == "" {
+			return "", log.Errorf("Test backend of type 'qemu-system' must set 'arch' and 'machine'.\n")
+		}
+		// Semihosting lets bare-metal tests print their results and exit with their status.
+		words = append(words, fmt.Sprintf("qemu-system-%s", backend.Arch), "-machine", backend.Machine,
+			"-nographic", "-monitor", "none", "-semihosting-config", "enable=on,target=native", backend.Args, "-kernel", "{}")
+	case "simulator":
+		if backend.Command == "" {
+			return "", log.Errorf("Test backend of type 'simulator' must set 'command'.\n")
+		}
+		words = append(words, backend.Command)
+		if !strings.Contains(backend.Command, "{}") {
+			words = append(words, "{}")
+		}
+		if !strings.Contains(backend.Command, "{args}") {
+			words = append(words, "{args}")
+		}
+	default:
+		return "", log.Errorf("Unknown test backend type '%s'. Use 'qemu-user', 'qemu-system' or 'simulator'.\n", backend.Type)
+	}
+	return strings.Join(strings.Fields(strings.Join(words, " ")), " "), nil
+}
+
+// installedQemuUserEmulators returns the QEMU user mode emulators (e.g., 'qemu-aarch64' or
+// 'qemu-aarch64-static') in PATH by architecture. Emulators in earlier PATH entries win.
+func installedQemuUserEmulators() map[string]string {
+	emulators := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(file.Name(), "-static")
+			if !strings.HasPrefix(name, "qemu-") || qemuTools[name] || file.Mode()&0111 == 0 {
+				continue
+			}
+			arch := strings.TrimPrefix(name, "qemu-")
+			if _, exists := emulators[arch]; !exists && !strings.Contains(arch, "-") {
+				emulators[arch] = file.Name()
+			}
+		}
+	}
+	return emulators
+}
+
+// testBackendFor returns the test backend that the rules use for `target`.
+func testBackendFor(target target, backends []testBackend) (testBackend, bool) {
+	for _, backend := range backends {
+		if backend.Toolchain != "" && backend.Toolchain == target.Toolchain {
+			return backend, true
+		}
+	}
+	if target.Arch == "" || target.Arch == hostArch() {
+		return testBackend{}, false
+	}
+	for _, backend := range backends {
+		if backend.Arch == target.Arch {
+			return backend, true
+		}
+	}
+	return testBackend{}, false
+}
+
+// checkTestBackends reports tests that are built for another architecture but can not be run by
+// any test backend, and warns if the generator can not use test backends at all.
+func checkTestBackends(targets []string, backends []testBackend, genOutput generatorOutput) {
+	if genOutput.ProtocolVersion < 12 {
+		if moduleFile, err := readWorkspaceModuleFile(); err == nil && len(moduleFile.TestBackends) > 0 {
+			log.Warning("The generator does not support test backends. Update dbt-rules to use them.\n")
+		}
+		return
+	}
+	for _, name := range targets {
+		target := genOutput.Targets[name]
+		if backend, exists := testBackendFor(target, backends); exists {
+			log.Debug("Running '%s' with '%s'.\n", targetID(name), backend.Command)
+		} else if target.Arch != "" && target.Arch != hostArch() {
+			log.Warning("Test '%s' is built for '%s', but there is no test backend for it. Install 'qemu-%s' or declare a backend in 'test-backends'.\n", targetID(name), target.Arch, target.Arch)
+		}
+	}
+}
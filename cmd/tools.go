@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/daedaleanai/dbt/log"
+)
+
+// checkTools fails if `targets`, their dependencies or the tools they use transitively use tools
+// that are not declared as targets or that are built for another architecture than the host,
+// since their actions could not run them.
+func checkTools(targets []string, genOutput generatorOutput) error {
+	if genOutput.ProtocolVersion < 14 {
+		return nil
+	}
+	visited := map[string]bool{}
+	queue := []string{}
+	visit := func(name string) {
+		if !visited[name] {
+			visited[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for _, name := range targets {
+		visit(name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dep := range genOutput.Targets[name].Deps {
+			visit(dep)
+		}
+		for _, tool := range genOutput.Targets[name].Tools {
+			toolTarget, exists := genOutput.Targets[tool]
+			if !exists {
+				return log.Errorf("Target '%s' uses tool '%s', which is not a target.\n", targetID(name), targetID(tool))
+			}
+			if toolTarget.Arch != "" && toolTarget.Arch != hostArch() {
+				return log.Errorf("Target '%s' uses tool '%s', which is built for '%s' and can not run on this '%s' machine.\n", targetID(name), targetID(tool), toolTarget.Arch, hostArch())
+			}
+			visit(tool)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const dbtPackagePath = "github.com/daedaleanai/dbt"
+
+// requiredVersionExecEnvVar is set when DBT runs the version required by the workspace in place of
+// another version, so that the required version never downloads and runs itself again.
+const requiredVersionExecEnvVar = "DBT_REQUIRED_VERSION_EXEC"
+
+var selfUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [VERSION] [--pin]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Replaces the running DBT binary with another version",
+	Long: `Installs VERSION of DBT with 'go install' and replaces the running DBT binary with it.
+VERSION is a release, e.g. 'v1.3.9', a version prefix, e.g. 'v1.3' for the latest v1.3.x
+release, or 'latest'. It defaults to the version required by the workspace or, if the workspace
+does not require one, the latest release. With --pin, the installed version is written to
+'required-version' in the '.dbtconfig' file of the workspace, so that everybody working in the
+workspace uses it.`,
+	RunE: runSelfUpgrade,
+}
+
+var selfUpgradePin bool
+
+func init() {
+	rootCmd.AddCommand(selfUpgradeCmd)
+	selfUpgradeCmd.Flags().BoolVar(&selfUpgradePin, "pin", false, "Require the installed version in the workspace")
+}
+
+func currentDbtVersion() string {
+	return fmt.Sprintf("v%d.%d.%d", util.DbtVersion[0], util.DbtVersion[1], util.DbtVersion[2])
+}
+
+// canonicalVersion adds the "v" prefix that go expects to `version` unless it is "latest".
+func canonicalVersion(version string) string {
+	if version == "latest" {
+		return version
+	}
+	return "v" + strings.TrimPrefix(version, "v")
+}
+
+// versionMatches returns whether the running version of DBT is `required`, which may omit the
+// patch or the minor version.
+func versionMatches(required string) (bool, error) {
+	parts := strings.Split(strings.TrimPrefix(required, "v"), ".")
+	if len(parts) > len(util.DbtVersion) {
+		return false, fmt.Errorf("invalid version '%s'", required)
+	}
+	for idx, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return false, fmt.Errorf("invalid version '%s'", required)
+		}
+		if uint(number) != util.DbtVersion[idx] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkRequiredVersion makes sure that the running version of DBT is the one required by the
+// configuration. Otherwise, it either runs the required version in its place, downloading it into
+// the user's cache directory first if necessary, or fails.
+func checkRequiredVersion() error {
+	required := config.GetConfig().RequiredVersion
+	if required == "" {
+		return nil
+	}
+	matches, err := versionMatches(required)
+	if err != nil {
+		return log.Errorf("Invalid 'required-version' in the DBT configuration: %s.\n", err)
+	}
+	if matches {
+		return nil
+	}
+	required = canonicalVersion(required)
+	if !config.GetConfig().VersionDownload || os.Getenv(requiredVersionExecEnvVar) != "" {
+		return log.Errorf("The workspace requires DBT %s, but this is DBT %s. Run 'dbt upgrade' to install the required version.\n", required, currentDbtVersion())
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return log.Errorf("The workspace requires DBT %s, but failed to locate the cache directory to download it to: %s.\n", required, err)
+	}
+	bin := path.Join(cacheDir, "dbt", "dbt-"+required, "dbt")
+	if !util.FileExists(bin) {
+		if !confirmVersionDownload(required) {
+			return log.Errorf("The workspace requires DBT %s, but this is DBT %s. Run 'dbt upgrade' to install the required version.\n", required, currentDbtVersion())
+		}
+		log.Log("The workspace requires DBT %s. Downloading it.\n", required)
+		if err := util.MkdirAll(path.Dir(bin)); err != nil {
+			return err
+		}
+		if err := installDbt(required, path.Dir(bin)); err != nil {
+			return log.Errorf("Failed to install DBT %s: %s.\n", required, err)
+		}
+	}
+	log.Debug("Running '%s' in place of DBT %s.\n", bin, currentDbtVersion())
+	env := append(os.Environ(), requiredVersionExecEnvVar+"=1")
+	err = replaceProcess(bin, os.Args[1:], env)
+	return log.Errorf("Failed to run DBT %s: %s.\n", required, err)
+}
+
+// confirmVersionDownload asks the user whether to download and run `version` of DBT on interactive
+// terminals. Elsewhere, enabling 'version-download' is taken as consent.
+func confirmVersionDownload(version string) bool {
+	if !isInteractiveTerminal() {
+		return true
+	}
+	fmt.Printf("The workspace requires DBT %s. Install %s@%s with 'go install' and run it? [y/N] ", version, dbtPackagePath, version)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// installDbt installs `version` of DBT into the directory `dir` with 'go install'.
+func installDbt(version, dir string) error {
+	goCmd := exec.Command("go", "install", fmt.Sprintf("%s@%s", dbtPackagePath, version))
+	goCmd.Env = append(os.Environ(), "GOBIN="+dir)
+	if output, err := goCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s\n%s", err, output)
+	}
+	return nil
+}
+
+// dbtBinaryVersion returns the version reported by the DBT binary `bin`.
+func dbtBinaryVersion(bin string) (string, error) {
+	output, err := exec.Command(bin, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	// The output reads "dbt version v1.2.3".
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no version reported")
+	}
+	return fields[len(fields)-1], nil
+}
+
+func runSelfUpgrade(cmd *cobra.Command, args []string) error {
+	version := "latest"
+	if required := config.GetConfig().RequiredVersion; required != "" {
+		version = canonicalVersion(required)
+	}
+	if len(args) > 0 {
+		version = canonicalVersion(args[0])
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		return log.Errorf("Failed to locate the DBT binary: %s.\n", err)
+	}
+	// The new binary is installed next to the running one, so that it can be renamed over it.
+	tmpDir, err := ioutil.TempDir(path.Dir(executable), ".dbt-upgrade-")
+	if err != nil {
+		return log.Errorf("Failed to create a temporary directory next to '%s': %s.\n", executable, err)
+	}
+	log.Log("Installing DBT %s.\n", version)
+	err = installDbt(version, tmpDir)
+	installed := version
+	if err == nil {
+		installed, err = dbtBinaryVersion(path.Join(tmpDir, "dbt"))
+	}
+	if err == nil {
+		err = os.Rename(path.Join(tmpDir, "dbt"), executable)
+	}
+	os.RemoveAll(tmpDir)
+	if err != nil {
+		return log.Errorf("Failed to upgrade '%s' to DBT %s: %s.\n", executable, version, err)
+	}
+	log.Success("Upgraded '%s' from DBT %s to %s.\n", executable, currentDbtVersion(), installed)
+
+	if selfUpgradePin {
+		return pinRequiredVersion(installed)
+	}
+	return nil
+}
+
+// pinRequiredVersion sets 'required-version' in the configuration file of the workspace to
+// `version`, keeping all other settings.
+func pinRequiredVersion(version string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	configFile := config.WorkspaceConfigFile(workspaceRoot)
+	settings := yaml.MapSlice{}
+	if util.FileExists(configFile) {
+		data, err := util.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return log.Errorf("Failed to parse '%s': %s.\n", configFile, err)
+		}
+	}
+	pinned := false
+	for idx := range settings {
+		if settings[idx].Key == "required-version" {
+			settings[idx].Value = version
+			pinned = true
+		}
+	}
+	if !pinned {
+		settings = append(settings, yaml.MapItem{Key: "required-version", Value: version})
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return log.Errorf("Failed to serialize '%s': %s.\n", configFile, err)
+	}
+	if err := util.WriteFile(configFile, data); err != nil {
+		return err
+	}
+	log.Success("Pinned DBT %s in '%s'.\n", version, configFile)
+	return nil
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const variantLogFileName = "variants.log"
+
+// Maximum number of failed actions listed per variant.
+const maxListedFailedActions = 5
+
+// variantResult is the outcome of building the targets in one variant workspace.
+type variantResult struct {
+	Dir           string
+	Success       bool
+	Duration      time.Duration
+	FailedActions []string
+	startTime     time.Time
+}
+
+var variantsCmd = &cobra.Command{
+	Use:   "variants [patterns] [build flags] [--variant=DIR...] [--parallel=N] [--cache-dir=DIR] [--cache-size=GIB]",
+	Short: "Builds the same targets in several variant workspaces",
+	Long: `Builds the targets in each of several workspaces, e.g. checkouts of the hardware variants of a
+product, and prints a matrix with the result of every variant. The workspaces are given with
+--variant or declared with 'variants' in the MODULE file of the current workspace. Variants are
+built in parallel and share the available CPUs. Unless a variant configures a remote cache, all
+variants share a local cache of action outputs in --cache-dir, so that actions that are identical
+across variants only run once. After the builds, the least recently used entries are removed from
+the cache until it is smaller than --cache-size. The output of each build is written to BUILD/variants.log in the
+variant workspace.`,
+	RunE: runVariants,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var variantDirs []string
+var variantsParallel int
+var variantsCacheDir string
+var variantsCacheSize int
+
+func init() {
+	rootCmd.AddCommand(variantsCmd)
+	variantsCmd.Flags().SetInterspersed(false)
+	variantsCmd.Flags().StringArrayVar(&variantDirs, "variant", nil, "Workspace of a variant to build (repeatable)")
+	variantsCmd.Flags().IntVar(&variantsParallel, "parallel", 0, "Number of variants to build at the same time (default: all)")
+	variantsCmd.Flags().StringVar(&variantsCacheDir, "cache-dir", defaultVariantsCacheDir(), "Directory of the action output cache shared by the variants (empty to disable)")
+	variantsCmd.Flags().IntVar(&variantsCacheSize, "cache-size", 10, "Maximum size of the shared action output cache in GiB")
+}
+
+func defaultVariantsCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(cacheDir, "dbt", "outputs")
+}
+
+func runVariants(cmd *cobra.Command, args []string) error {
+	dirs, err := resolveVariantDirs()
+	if err != nil {
+		return err
+	}
+	parallel := variantsParallel
+	if parallel <= 0 || parallel > len(dirs) {
+		parallel = len(dirs)
+	}
+	threads := runtime.NumCPU() / parallel
+	if threads < 1 {
+		threads = 1
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return log.Errorf("Failed to determine the dbt executable: %s.\n", err)
+	}
+
+	// All commands are prepared before any build starts, so that no build is left running if
+	// preparing one of them fails.
+	buildCmds := make([]*exec.Cmd, len(dirs))
+	logFiles := make([]*os.File, len(dirs))
+	for idx, dir := range dirs {
+		buildCmds[idx], logFiles[idx], err = variantBuildCommand(executable, dir, threads, args)
+		if err != nil {
+			for _, logFile := range logFiles[:idx] {
+				logFile.Close()
+			}
+			return err
+		}
+	}
+
+	log.Log("Building %d variants, %d at a time with %d threads each.\n", len(dirs), parallel, threads)
+	results := make([]variantResult, len(dirs))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for idx, dir := range dirs {
+		buildCmd, logFile := buildCmds[idx], logFiles[idx]
+		wg.Add(1)
+		go func(idx int, dir string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			startTime := time.Now()
+			err := buildCmd.Run()
+			logFile.Close()
+			results[idx] = variantResult{Dir: dir, Success: err == nil, Duration: time.Since(startTime), startTime: startTime}
+			log.Log("Variant '%s' %s after %s.\n", dir, buildStatus(results[idx].Success), results[idx].Duration.Round(time.Second))
+		}(idx, dir)
+	}
+	wg.Wait()
+	if variantsCacheDir != "" && util.DirExists(variantsCacheDir) {
+		if removed := pruneFileCache(variantsCacheDir, int64(variantsCacheSize)<<30); removed > 0 {
+			log.Log("Removed %d least recently used entries from the cache in '%s'.\n", removed, variantsCacheDir)
+		}
+	}
+	for idx := range results {
+		if !results[idx].Success {
+			results[idx].FailedActions = lastFailedActions(results[idx].Dir, results[idx].startTime)
+		}
+	}
+
+	printVariantMatrix(results)
+	failures := 0
+	for _, result := range results {
+		if !result.Success {
+			failures++
+		}
+	}
+	if failures > 0 {
+		return log.Errorf("%d of %d variants failed.\n", failures, len(results))
+	}
+	log.Success("All variants were built.\n")
+	return nil
+}
+
+// resolveVariantDirs returns the absolute paths of the variant workspaces given with --variant or,
+// if there are none, declared in the MODULE file of the current workspace.
+func resolveVariantDirs() ([]string, error) {
+	baseDir, err := util.GetWorkingDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs := variantDirs
+	if len(dirs) == 0 {
+		if workspaceRoot, err := util.FindWorkspaceRoot(); err == nil {
+			moduleFile, err := module.ReadModuleFile(workspaceRoot)
+			if err != nil {
+				return nil, err
+			}
+			baseDir = workspaceRoot
+			dirs = moduleFile.Variants
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, log.Errorf("No variants to build. Pass --variant=DIR or declare 'variants' in the %s file.\n", util.ModuleFileName)
+	}
+
+	resolved := []string{}
+	for _, dir := range dirs {
+		if !path.IsAbs(dir) {
+			dir = path.Join(baseDir, dir)
+		}
+		if !util.DirExists(dir) {
+			return nil, log.Errorf("Variant workspace '%s' does not exist.\n", dir)
+		}
+		resolved = append(resolved, path.Clean(dir))
+	}
+	return resolved, nil
+}
+
+// variantBuildCommand returns the command that runs 'dbt build' with `args` in the workspace `dir`
+// and the log file that the command writes its output to.
+func variantBuildCommand(executable, dir string, threads int, args []string) (*exec.Cmd, *os.File, error) {
+	moduleFile, err := module.ReadModuleFile(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	logFilePath := path.Join(dir, buildDirName, variantLogFileName)
+	if err := util.MkdirAll(path.Dir(logFilePath)); err != nil {
+		return nil, nil, err
+	}
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		return nil, nil, log.Errorf("Failed to create '%s': %s.\n", logFilePath, err)
+	}
+
+	buildArgs := append([]string{"build", "--workspace", dir, fmt.Sprintf("--threads=%d", threads)}, args...)
+	buildCmd := exec.Command(executable, buildArgs...)
+	buildCmd.Dir = dir
+	buildCmd.Stdout = logFile
+	buildCmd.Stderr = logFile
+	buildCmd.Env = os.Environ()
+	if _, exists := os.LookupEnv("DBT_REMOTE_CACHE_URL"); !exists && variantsCacheDir != "" && moduleFile.RemoteCache.URL == "" {
+		buildCmd.Env = append(buildCmd.Env, fmt.Sprintf("DBT_REMOTE_CACHE_URL=file://%s", variantsCacheDir))
+	}
+	return buildCmd, logFile, nil
+}
+
+// lastFailedActions returns the first output of each failed action of the last build in the
+// workspace `dir` if it started after `startTime`.
+func lastFailedActions(dir string, startTime time.Time) []string {
+	stateDir, err := workspaceStateDir(dir)
+	if err != nil {
+		return nil
+	}
+	historyFilePath := path.Join(stateDir, historyFileName)
+	if !util.FileExists(historyFilePath) {
+		return nil
+	}
+	events := []buildEvent{}
+	if util.ReadJson(historyFilePath, &events) != nil || len(events) == 0 || events[0].Time.Before(startTime) || events[0].GeneratorFailed {
+		return nil
+	}
+	actionsFilePath := path.Join(events[0].OutputDir, actionsFileName)
+	if !util.FileExists(actionsFilePath) {
+		return nil
+	}
+	var actions actionLog
+	if util.ReadJson(actionsFilePath, &actions) != nil {
+		return nil
+	}
+	failed := []string{}
+	for _, action := range actions.Actions {
+		if action.Failed {
+			failed = append(failed, action.Outputs[0])
+		}
+	}
+	return failed
+}
+
+// printVariantMatrix prints the result of every variant and the failed actions of failed variants.
+func printVariantMatrix(results []variantResult) {
+	width := len("VARIANT")
+	for _, result := range results {
+		if len(result.Dir) > width {
+			width = len(result.Dir)
+		}
+	}
+	fmt.Printf("  %-*s  %-9s  %9s  %6s\n", width, "VARIANT", "STATUS", "DURATION", "FAILED")
+	for _, result := range results {
+		fmt.Printf("  %-*s  %-9s  %9s  %6d\n", width, result.Dir, buildStatus(result.Success), result.Duration.Round(time.Second), len(result.FailedActions))
+	}
+	for _, result := range results {
+		if result.Success {
+			continue
+		}
+		fmt.Printf("\n%s (see '%s'):\n", result.Dir, path.Join(result.Dir, buildDirName, variantLogFileName))
+		if len(result.FailedActions) == 0 {
+			fmt.Printf("  The build failed before any action failed.\n")
+		}
+		for idx, output := range result.FailedActions {
+			if idx == maxListedFailedActions {
+				fmt.Printf("  ... and %d more failed actions\n", len(result.FailedActions)-idx)
+				break
+			}
+			fmt.Printf("  %s\n", output)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const verifyDirName = "VERIFY"
+
+// verifyDifference is an output that differs between the two builds of 'dbt verify'.
+type verifyDifference struct {
+	Output       string
+	Rule         string
+	FirstDigest  string
+	SecondDigest string
+}
+
+// verifyReport is the evidence of a 'dbt verify' run that --report writes.
+type verifyReport struct {
+	Time        time.Time
+	DbtVersion  string
+	Targets     []string
+	Flags       []string
+	Outputs     int
+	Differences []verifyDifference
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [patterns] [build flags] [--report=FILE] [--keep]",
+	Short: "Checks that the targets are built reproducibly",
+	Long: `Builds the targets matching the patterns (all targets by default) twice from scratch and
+byte-compares all outputs of all actions of both builds. Both builds use the same output
+directory, which is moved into BUILD/VERIFY/ after each build, so that outputs embedding their
+path are not reported. Stamping and the remote cache are disabled for both builds. The outputs
+that differ are listed with the ninja rule that produced them, and the command fails if there
+are any. With --report, a JSON report of the run is written to FILE. With --keep, the outputs of
+both builds are kept in BUILD/VERIFY/first and BUILD/VERIFY/second.`,
+	RunE: runVerify,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+}
+
+var verifyReportFile string
+var verifyKeep bool
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVar(&verifyReportFile, "report", "", "Write a JSON report to FILE")
+	verifyCmd.Flags().BoolVar(&verifyKeep, "keep", false, "Keep the outputs of both builds")
+	addSetFlag(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	args, err := withSetFlags(args)
+	if err != nil {
+		return err
+	}
+	patterns, genInput, err := newGeneratorInput(args)
+	if err != nil {
+		return err
+	}
+	genInput.PersistFlags = false
+	if len(patterns) == 0 {
+		patterns = []string{".*"}
+	}
+	genOutput, err := runGenerator(genInput)
+	if err != nil {
+		return err
+	}
+	targets, err := selectTargets(patterns, modeBuild, genOutput.Targets)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return log.Errorf("No targets match the given patterns.\n")
+	}
+	sort.Strings(targets)
+
+	flagArgs, err := buildFlagArgs(args)
+	if err != nil {
+		return err
+	}
+	buildArgs := append([]string{}, flagArgs...)
+	for _, target := range targets {
+		buildArgs = append(buildArgs, targetID(target))
+	}
+	log.Log("Building %d targets twice.\n", len(targets))
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	buildDir := path.Join(workspaceRoot, buildDirName)
+	verifyDir := path.Join(buildDir, verifyDirName)
+	digests, rules, err := buildTwice(buildArgs, path.Join(verifyDir, "build"), verifyDir)
+	if err != nil {
+		return err
+	}
+	if !verifyKeep {
+		if err := util.RemoveDir(verifyDir); err != nil {
+			return err
+		}
+	}
+	removeDanglingOutputDirLinks(buildDir)
+
+	report := verifyReport{
+		Time:        time.Now(),
+		DbtVersion:  currentDbtVersion(),
+		Targets:     targetIDs(targets),
+		Flags:       flagArgs,
+		Differences: []verifyDifference{},
+	}
+	for _, output := range sortMapKeys(digests[0]) {
+		rule := rules[output]
+		if rule == "" || rule == "phony" {
+			continue
+		}
+		report.Outputs++
+		if digests[1][output] != digests[0][output] {
+			report.Differences = append(report.Differences, verifyDifference{
+				Output:       output,
+				Rule:         rule,
+				FirstDigest:  digests[0][output],
+				SecondDigest: digests[1][output],
+			})
+		}
+	}
+	if report.Outputs == 0 {
+		return log.Errorf("The targets have no outputs to compare.\n")
+	}
+	if verifyReportFile != "" {
+		reportPath := verifyReportFile
+		if !path.IsAbs(reportPath) {
+			workingDir, err := util.GetWorkingDir()
+			if err != nil {
+				return err
+			}
+			reportPath = path.Join(workingDir, reportPath)
+		}
+		if err := util.WriteJson(reportPath, &report); err != nil {
+			return err
+		}
+		log.Log("Wrote the report to '%s'.\n", reportPath)
+	}
+
+	if len(report.Differences) == 0 {
+		log.Success("All %d outputs of %d targets are reproducible.\n", report.Outputs, len(targets))
+		return nil
+	}
+	byRule := map[string][]string{}
+	for _, difference := range report.Differences {
+		byRule[difference.Rule] = append(byRule[difference.Rule], difference.Output)
+	}
+	for _, rule := range sortMapKeys(byRule) {
+		fmt.Printf("Rule '%s' produced %d non-reproducible outputs:\n", rule, len(byRule[rule]))
+		for _, output := range byRule[rule] {
+			fmt.Printf("  %s\n", output)
+		}
+	}
+	return log.Errorf("%d of %d outputs differ between the two builds.\n", len(report.Differences), report.Outputs)
+}
+
+// buildTwice builds `buildArgs` twice from scratch into `outputDir` and moves the outputs of the
+// builds to `dir`/first and `dir`/second, so that outputs embedding their own path do not differ.
+// Stamping and the remote cache are disabled for both builds. It returns the SHA256 digests of
+// all outputs of both builds and the ninja rules that produced them, by path relative to
+// `outputDir`.
+func buildTwice(buildArgs []string, outputDir, dir string) ([2]map[string]string, map[string]string, error) {
+	// Both builds must run all actions and must not embed volatile build metadata.
+	noStamp = true
+	os.Setenv("DBT_REMOTE_CACHE_URL", "")
+
+	buildArgs = append(append([]string{}, buildArgs...), fmt.Sprintf("%s=%s", outputDirFlagName, outputDir))
+	var digests [2]map[string]string
+	var rules map[string]string
+	if err := util.RemoveDir(dir); err != nil {
+		return digests, rules, err
+	}
+	if err := util.RemoveDir(outputDir); err != nil {
+		return digests, rules, err
+	}
+	for idx, name := range []string{"first", "second"} {
+		log.Log("Building from scratch (%s build).\n", name)
+		if err := runBuild(buildArgs, modeBuild, nil); err != nil {
+			return digests, rules, err
+		}
+		buildDigests, err := outputDigests(outputDir)
+		if err != nil {
+			return digests, rules, err
+		}
+		digests[idx] = buildDigests
+		rules = map[string]string{}
+		for output, rule := range ninjaRules(outputDir) {
+			rules[strings.TrimPrefix(output, outputDir+"/")] = rule
+		}
+		if err := util.MkdirAll(dir); err != nil {
+			return digests, rules, err
+		}
+		if err := os.Rename(outputDir, path.Join(dir, name)); err != nil {
+			return digests, rules, log.Errorf("Failed to move the outputs of the %s build: %s.\n", name, err)
+		}
+	}
+	return digests, rules, nil
+}
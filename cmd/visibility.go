@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// Visibilities of targets besides patterns of packages, e.g. "//module/pkg" or "//module/pkg/...".
+const (
+	visibilityPublic = "public"
+	visibilityModule = "module"
+)
+
+// visibilityChecker decides which targets may depend on a target.
+type visibilityChecker struct {
+	modules map[string]module.Module
+	// defaults caches the default visibility of the targets of each module.
+	defaults map[string][]string
+}
+
+// moduleOf returns the name of the module that declares the target or package `name`.
+func moduleOf(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// visibility returns the visibility of the target `name`, which is the one declared by the target
+// or else the default visibility of its module.
+func (checker *visibilityChecker) visibility(name string, target target) ([]string, error) {
+	if len(target.Visibility) > 0 {
+		return target.Visibility, nil
+	}
+	moduleName := moduleOf(name)
+	visibility, exists := checker.defaults[moduleName]
+	if !exists {
+		if mod, found := checker.modules[moduleName]; found {
+			moduleFile, err := module.ReadModuleFile(mod.RootPath())
+			if err != nil {
+				return nil, err
+			}
+			visibility = moduleFile.DefaultVisibility
+		}
+		checker.defaults[moduleName] = visibility
+	}
+	return visibility, nil
+}
+
+// visibleTo returns whether the target `name` with `visibility` may be used by `user`. Targets are
+// always visible within their own package.
+func visibleTo(name string, visibility []string, user string) bool {
+	if len(visibility) == 0 || path.Dir(name) == path.Dir(user) {
+		return true
+	}
+	userPkg := path.Dir(user)
+	for _, entry := range visibility {
+		switch {
+		case entry == visibilityPublic:
+			return true
+		case entry == visibilityModule:
+			if moduleOf(name) == moduleOf(user) {
+				return true
+			}
+		case strings.HasSuffix(entry, "/..."):
+			pkg := targetName(strings.TrimSuffix(entry, "/..."))
+			if userPkg == pkg || strings.HasPrefix(userPkg, pkg+"/") {
+				return true
+			}
+		case targetName(entry) == userPkg:
+			return true
+		}
+	}
+	return false
+}
+
+// checkVisibilityEntries fails if the visibility of the target `name` contains entries that are
+// neither "public", "module" nor a package pattern.
+func checkVisibilityEntries(name string, visibility []string) error {
+	for _, entry := range visibility {
+		if entry != visibilityPublic && entry != visibilityModule && !strings.HasPrefix(entry, "//") {
+			return log.Errorf("Invalid visibility '%s' of target '%s'. Use '%s', '%s' or a package like '//module/pkg' or '//module/pkg/...'.\n",
+				entry, targetID(name), visibilityPublic, visibilityModule)
+		}
+	}
+	return nil
+}
+
+// checkVisibility fails if any of the `targets` or the targets they depend on or use as tools
+// depends on or uses as a tool a target that is not visible to it. Each violating dependency is
+// reported.
+func checkVisibility(targets []string, genOutput generatorOutput) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	modules, err := module.GetAllModules(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	checker := visibilityChecker{
+		modules:  modules,
+		defaults: map[string][]string{},
+	}
+	closure := map[string]bool{}
+	for _, name := range targets {
+		for _, member := range targetClosure(name, genOutput.Targets) {
+			closure[member] = true
+		}
+	}
+	violations := []string{}
+	for _, user := range sortMapKeys(closure) {
+		userTarget := genOutput.Targets[user]
+		for _, dep := range append(append([]string{}, userTarget.Deps...), userTarget.Tools...) {
+			depTarget, exists := genOutput.Targets[dep]
+			if !exists {
+				continue
+			}
+			visibility, err := checker.visibility(dep, depTarget)
+			if err != nil {
+				return err
+			}
+			if err := checkVisibilityEntries(dep, visibility); err != nil {
+				return err
+			}
+			if !visibleTo(dep, visibility, user) {
+				violations = append(violations, fmt.Sprintf("  %s -> %s (visibility: %s)", targetID(user), targetID(dep), strings.Join(visibility, ", ")))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return log.Errorf("%d dependencies are on targets that are not visible to the depending target:\n%s\n", len(violations), strings.Join(violations, "\n"))
+	}
+	return nil
+}
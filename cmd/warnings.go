@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+
+	"github.com/daedaleanai/cobra"
+)
+
+const warningsBaselineFileName = "WARNINGS.yaml"
+
+// Matches gcc / clang style warnings: "<file>:<line>:[<column>:] warning: <message>".
+var warningRegexp = regexp.MustCompile(`^(.+?):\d+:(?:\d+:)? warning: (.*)$`)
+
+type warningsBaseline struct {
+	// Targets maps the IDs of targets to their warnings, which map "<file>: <message>" to the
+	// number of occurences. Line numbers are not part of the key, so that unrelated changes to a
+	// file do not invalidate the baseline.
+	Targets map[string]map[string]int
+}
+
+var warningsCmd = &cobra.Command{
+	Use:   "warnings",
+	Short: "Manages the compiler warnings baseline",
+	Long: `Manages the compiler warnings baseline. If the workspace contains a WARNINGS.yaml file,
+builds fail if they produce compiler warnings that are not part of the baseline.`,
+}
+
+var warningsUpdateCmd = &cobra.Command{
+	Use:   "update [patterns] [build flags]",
+	Short: "Rebuilds the targets and records their compiler warnings in the baseline",
+	Long: `Rebuilds each of the targets from scratch and records its compiler warnings in the
+baseline. The warnings recorded for other targets are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		updateWarnings = true
+		return runBuild(args, modeBuild, nil)
+	},
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeBuildArgs(toComplete, modeBuild)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// updateWarnings makes runBuild rebuild the targets from scratch and record their warnings in the
+// baseline.
+var updateWarnings bool
+
+func init() {
+	rootCmd.AddCommand(warningsCmd)
+	warningsCmd.AddCommand(warningsUpdateCmd)
+}
+
+// parseWarnings counts the compiler warnings in ninja's `output`.
+func parseWarnings(workspaceRoot, output string) map[string]int {
+	warnings := map[string]int{}
+	for _, line := range strings.Split(output, "\n") {
+		matches := warningRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		file := strings.TrimPrefix(path.Clean(matches[1]), workspaceRoot+"/")
+		warnings[fmt.Sprintf("%s: %s", file, matches[2])]++
+	}
+	return warnings
+}
+
+// cleanForWarnings removes the outputs of `targets`, so that all warnings are reported again.
+func cleanForWarnings(dir string, targets []string) error {
+	var stdout bytes.Buffer
+	return runNinja(dir, &stdout, append([]string{"-t", "clean"}, targets...))
+}
+
+// readWarningsBaseline reads the baseline of the workspace, which is empty if there is none.
+func readWarningsBaseline(baselinePath string) (warningsBaseline, error) {
+	baseline := warningsBaseline{Targets: map[string]map[string]int{}}
+	if !util.FileExists(baselinePath) {
+		return baseline, nil
+	}
+	if err := util.ReadYaml(baselinePath, &baseline); err != nil {
+		return warningsBaseline{}, err
+	}
+	if baseline.Targets == nil {
+		baseline.Targets = map[string]map[string]int{}
+	}
+	return baseline, nil
+}
+
+// updateWarningsBaseline rebuilds each of the `targets` from scratch in the output directory `dir`
+// and records its warnings in the baseline. Targets are built one by one, since the warnings in
+// ninja's output can not be attributed to targets otherwise. The remote cache is disabled for
+// these builds, since cached outputs come without warnings. The next build enables it again.
+func updateWarningsBaseline(dir string, targets []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	baselinePath := path.Join(workspaceRoot, warningsBaselineFileName)
+	baseline, err := readWarningsBaseline(baselinePath)
+	if err != nil {
+		return err
+	}
+	if err := disableRemoteCache(dir); err != nil {
+		return err
+	}
+
+	numWarnings := 0
+	for _, target := range targets {
+		log.Log("Recording the warnings of '%s'.\n", targetID(target))
+		if err := cleanForWarnings(dir, []string{target}); err != nil {
+			return err
+		}
+		var output bytes.Buffer
+		if err := runNinja(dir, &output, []string{target}); err != nil {
+			return err
+		}
+		warnings := parseWarnings(workspaceRoot, output.String())
+		delete(baseline.Targets, targetID(target))
+		for _, count := range warnings {
+			numWarnings += count
+		}
+		if len(warnings) > 0 {
+			baseline.Targets[targetID(target)] = warnings
+		}
+	}
+	if err := util.WriteYaml(baselinePath, &baseline); err != nil {
+		return err
+	}
+	log.Success("Recorded %d warnings of %d targets in '%s'.\n", numWarnings, len(targets), warningsBaselineFileName)
+	return nil
+}
+
+// checkWarnings compares the warnings in ninja's `output` against the warnings recorded in the
+// baseline for `targets`.
+func checkWarnings(output string, targets []string) error {
+	workspaceRoot, err := util.GetWorkspaceRoot()
+	if err != nil {
+		return err
+	}
+	baselinePath := path.Join(workspaceRoot, warningsBaselineFileName)
+	if !util.FileExists(baselinePath) {
+		return nil
+	}
+	baseline, err := readWarningsBaseline(baselinePath)
+	if err != nil {
+		return err
+	}
+	// Targets that share sources report their warnings once per build, but each has them in the
+	// baseline. Summing up may therefore tolerate some new warnings, but never fails a build for
+	// warnings that are recorded.
+	allowed := map[string]int{}
+	for _, target := range targets {
+		for warning, count := range baseline.Targets[targetID(target)] {
+			allowed[warning] += count
+		}
+	}
+
+	warnings := parseWarnings(workspaceRoot, output)
+	newWarnings := 0
+	for _, warning := range sortMapKeys(warnings) {
+		if count := warnings[warning] - allowed[warning]; count > 0 {
+			log.Error("New warning (%dx): %s\n", count, warning)
+			newWarnings += count
+		}
+	}
+	if newWarnings > 0 {
+		return log.Errorf("The build produced %d warnings that are not part of the baseline in '%s'. Fix them or run 'dbt warnings update'.\n", newWarnings, warningsBaselineFileName)
+	}
+	return nil
+}
@@ -5,22 +5,154 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
 	"gopkg.in/yaml.v2"
 )
 
+// Permissions configures the normalization of file modes in the BUILD/ directory.
+type Permissions struct {
+	// Normalize enables normalization of output file modes after each build.
+	Normalize bool
+	// Executable is the mode applied to directories and files with any executable bit set.
+	Executable uint32
+	// Data is the mode applied to all other files.
+	Data uint32
+}
+
+// DaemonToken grants the holder of Token access to the generator daemon within Scopes.
+type DaemonToken struct {
+	Name   string
+	Token  string
+	Scopes []string
+}
+
+// Notifications configures notifications about finished builds.
+type Notifications struct {
+	// MinDuration is the duration (e.g., "2m") a build must take before a notification is sent.
+	MinDuration string `yaml:"min-duration,omitempty"`
+	// Desktop enables desktop notifications via notify-send (Linux) or osascript (macOS).
+	Desktop bool `yaml:"desktop,omitempty"`
+	// Webhook is a URL that a JSON description of the build is POSTed to.
+	Webhook string `yaml:"webhook,omitempty"`
+}
+
 type Config struct {
 	Mirror       string
-	PersistFlags bool `yaml:"persist-flags"`
+	PersistFlags bool        `yaml:"persist-flags"`
+	Permissions  Permissions `yaml:"permissions"`
+	Interactive  bool
+	// QuickstartRules is the URL that dbt-rules is fetched from for workspaces without a MODULE file.
+	QuickstartRules string `yaml:"quickstart-rules"`
+	// QuickstartRulesVersion is the version of dbt-rules that is checked out for workspaces without
+	// a MODULE file, so that their builds do not change when dbt-rules changes.
+	QuickstartRulesVersion string `yaml:"quickstart-rules-version"`
+	// NinjaBin is the path of the ninja binary. If empty, ninja is looked up in PATH.
+	NinjaBin string `yaml:"ninja-bin"`
+	// NinjaDownload enables downloading a pinned ninja release if ninja can not be found.
+	NinjaDownload bool `yaml:"ninja-download"`
+	// ContentHashes makes builds ignore modification times of files whose content did not change.
+	ContentHashes bool `yaml:"content-hashes"`
+	// DisabledHooks lists the names of workspace hooks that are not run.
+	DisabledHooks []string `yaml:"disabled-hooks"`
+	// DaemonTokens allow other users to access the generator daemon. If empty, the daemon only
+	// accepts requests from the user running it.
+	DaemonTokens []DaemonToken `yaml:"daemon-tokens"`
+	// GoWork makes the generator directory a single Go workspace with a go.work file instead of
+	// Go modules that reference each other with replace directives. It requires go >= 1.18.
+	GoWork bool `yaml:"go-work"`
+	// Notifications override the notification settings of the workspace.
+	Notifications Notifications `yaml:"notifications"`
+	// Jobs is the number of actions that run in parallel unless --threads is given. If 0, ninja
+	// decides based on the number of CPUs.
+	Jobs int `yaml:"jobs"`
+	// Verbose enables debug output unless --verbose is given.
+	Verbose bool `yaml:"verbose"`
+	// Flags are default values of build flags. They take precedence over the flags of the MODULE
+	// file, but not over persisted flags and flags given on the command-line.
+	Flags map[string]string `yaml:"flags"`
+	// RemoteCache overrides the remote cache of the workspace. The DBT_REMOTE_CACHE_URL and
+	// DBT_REMOTE_CACHE_READ_ONLY environment variables take precedence.
+	RemoteCache RemoteCache `yaml:"remote-cache"`
+	// RequiredVersion is the version of DBT that the workspace requires, e.g. "v1.3.9", or "v1.3"
+	// for any v1.3.x release. If empty, any version is accepted.
+	RequiredVersion string `yaml:"required-version"`
+	// VersionDownload makes DBT download and run the required version instead of failing if the
+	// running version does not match it.
+	VersionDownload bool `yaml:"version-download"`
+	// Credentials configure how the credentials for fetching modules from a host are resolved, by
+	// host name. They are only read from the configuration file of the user.
+	Credentials map[string]HostCredentials `yaml:"credentials"`
+	// Signing configures how 'dbt build --sign' signs the outputs of signable targets.
+	Signing Signing `yaml:"signing"`
+}
+
+// Signing configures the tool that writes detached signatures of build outputs.
+type Signing struct {
+	// Tool is "gpg", "cosign" or "command".
+	Tool string `yaml:"tool"`
+	// Key is the key to sign with: the key ID for gpg (if empty, the default key is used) or the
+	// key reference for cosign.
+	Key string `yaml:"key"`
+	// Command is the shell command that signs a file with the "command" tool. It finds the file in
+	// $DBT_SIGN_FILE and writes the signature to $DBT_SIGN_SIGNATURE.
+	Command string `yaml:"command"`
+}
+
+// HostCredentials configure the credentials for a host of modules.
+type HostCredentials struct {
+	// TokenEnv is the environment variable that holds an access token for the host. If empty,
+	// DBT_TOKEN_<HOST> is used, e.g. DBT_TOKEN_GITLAB_EXAMPLE_COM for "gitlab.example.com".
+	TokenEnv string `yaml:"token-env"`
+	// User is the user name sent together with the token. If empty, "oauth2" is used.
+	User string `yaml:"user"`
+	// Sources are the sources of credentials that are tried in order: "env", "git" (the git
+	// credential helpers) and "netrc". If empty, all sources are tried in this order.
+	Sources []string `yaml:"sources"`
+}
+
+// RemoteCache configures the remote cache that builds use.
+type RemoteCache struct {
+	URL      string `yaml:"url"`
+	ReadOnly bool   `yaml:"read-only"`
 }
 
 var environment map[string]string
 var config *Config
+var loadedFiles []string
 
 const configFileName string = "config.yaml"
 
+// workspaceConfigFileName is the name of the configuration file in the workspace root, which is
+// meant to be checked in.
+const workspaceConfigFileName string = ".dbtconfig"
+
+// workspaceSettings are the settings that the configuration file of the workspace may set, with
+// nested settings named "parent.child". Since the file comes with the workspace, settings that
+// decide which binaries DBT runs, where it fetches code from or where it sends credentials and
+// information about the user are only read from the configuration file of the user.
+var workspaceSettings = map[string]bool{
+	"persist-flags":              true,
+	"permissions":                true,
+	"interactive":                true,
+	"content-hashes":             true,
+	"disabled-hooks":             true,
+	"go-work":                    true,
+	"notifications.min-duration": true,
+	"notifications.desktop":      true,
+	"jobs":                       true,
+	"verbose":                    true,
+	"flags":                      true,
+	"remote-cache":               true,
+	"required-version":           true,
+	"signing.tool":               true,
+	"signing.key":                true,
+}
+
 func init() {
 	environment = make(map[string]string)
 	for _, v := range os.Environ() {
@@ -49,40 +181,166 @@ func getDbtConfigDir() (string, error) {
 	return "", fmt.Errorf("Unable to locate the configuration directory")
 }
 
-func loadConfiguration() Config {
+// loadConfiguration loads the configuration for the workspace at `workspaceRoot`, which may be
+// empty outside of a workspace. It returns the configuration and the paths of the configuration
+// files that were loaded.
+func loadConfiguration(workspaceRoot string) (Config, []string) {
 	config := Config{
-		PersistFlags: true,
+		PersistFlags:           true,
+		QuickstartRules:        "https://github.com/daedaleanai/dbt-rules.git",
+		QuickstartRulesVersion: "v1.10.0",
+		NinjaDownload:          true,
+		Permissions: Permissions{
+			Normalize:  false,
+			Executable: 0755,
+			Data:       0644,
+		},
 	}
 
-	configDir, err := getDbtConfigDir()
-	if err != nil {
-		log.Debug("Unable to find dbt config directory. Using default configuration\n")
-		return config
+	// The configuration file of the workspace provides defaults for everybody working in it, the
+	// configuration file of the user overrides them.
+	files := []string{}
+	if workspaceRoot != "" && loadConfigurationFile(&config, WorkspaceConfigFile(workspaceRoot), workspaceSettings) {
+		files = append(files, WorkspaceConfigFile(workspaceRoot))
 	}
+	if configDir, err := getDbtConfigDir(); err == nil {
+		if loadConfigurationFile(&config, path.Join(configDir, configFileName), nil) {
+			files = append(files, path.Join(configDir, configFileName))
+		}
+	} else {
+		log.Debug("Unable to find dbt config directory.\n")
+	}
+	applyEnvironment(&config)
 
-	configFilePath := path.Join(configDir, configFileName)
+	log.Debug("Running with configuration: %+v\n", config)
+	return config, files
+}
+
+// loadConfigurationFile overrides the settings of `config` with the ones in the file at
+// `configFilePath`. Missing and invalid files are ignored. Unless `allowed` is nil, settings that
+// are not in `allowed` are ignored with a warning. It reports whether the file was loaded.
+func loadConfigurationFile(config *Config, configFilePath string, allowed map[string]bool) bool {
 	configFileData, err := ioutil.ReadFile(configFilePath)
 	if err != nil {
 		log.Debug("Failed to read file '%s': %s.\n", configFilePath, err.Error())
-		return config
+		return false
 	}
 
-	err = yaml.Unmarshal(configFileData, &config)
-	if err != nil {
-		log.Debug("Error reading configuration file at `%s`: `%s`. Using default configuration\n", configFilePath, err)
-		return config
+	if allowed != nil {
+		settings := map[interface{}]interface{}{}
+		if err := yaml.Unmarshal(configFileData, &settings); err != nil {
+			log.Warning("Ignoring invalid configuration file '%s': %s.\n", configFilePath, err)
+			return false
+		}
+		filterSettings(settings, "", allowed, configFilePath)
+		if configFileData, err = yaml.Marshal(settings); err != nil {
+			log.Warning("Ignoring invalid configuration file '%s': %s.\n", configFilePath, err)
+			return false
+		}
 	}
 
+	loaded := *config
+	err = yaml.Unmarshal(configFileData, &loaded)
+	if err != nil {
+		log.Warning("Ignoring invalid configuration file '%s': %s.\n", configFilePath, err)
+		return false
+	}
+	*config = loaded
 	log.Debug("Loaded configuration from `%s`\n", configFilePath)
-	log.Debug("Running with configuration: %+v\n", config)
-	return config
+	return true
+}
+
+// filterSettings removes the settings that are not in `allowed` from `settings`, whose names
+// start with `prefix`, and warns about each of them.
+func filterSettings(settings map[interface{}]interface{}, prefix string, allowed map[string]bool, configFilePath string) {
+	keys := []interface{}{}
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	// Warnings are printed in a fixed order.
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	for _, key := range keys {
+		value := settings[key]
+		name := prefix + fmt.Sprint(key)
+		if allowed[name] {
+			continue
+		}
+		if nested, isMap := value.(map[interface{}]interface{}); isMap && hasAllowedChild(name, allowed) {
+			filterSettings(nested, name+".", allowed, configFilePath)
+			continue
+		}
+		log.Warning("Ignoring setting '%s' in '%s'. It can only be set in the configuration file of the user.\n", name, configFilePath)
+		delete(settings, key)
+	}
+}
+
+func hasAllowedChild(name string, allowed map[string]bool) bool {
+	for setting := range allowed {
+		if strings.HasPrefix(setting, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnvironment overrides the boolean, numeric and string settings of `config` with the
+// environment variables DBT_<SETTING>, e.g. DBT_JOBS for 'jobs' or DBT_PERSIST_FLAGS for
+// 'persist-flags'.
+func applyEnvironment(config *Config) {
+	value := reflect.ValueOf(config).Elem()
+	for idx := 0; idx < value.NumField(); idx++ {
+		switch value.Field(idx).Kind() {
+		case reflect.Bool, reflect.Int, reflect.Uint32, reflect.String:
+		default:
+			continue
+		}
+		variable := "DBT_" + strings.ToUpper(strings.ReplaceAll(settingName(value.Type().Field(idx)), "-", "_"))
+		envValue, exists := environment[variable]
+		if !exists {
+			continue
+		}
+		if err := yaml.Unmarshal([]byte(envValue), value.Field(idx).Addr().Interface()); err != nil {
+			log.Warning("Ignoring invalid value '%s' of %s: %s.\n", envValue, variable, err)
+			continue
+		}
+		log.Debug("Setting '%s' is overridden by %s.\n", settingName(value.Type().Field(idx)), variable)
+	}
+}
+
+// settingName returns the name of the setting stored in `field` in configuration files.
+func settingName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("yaml"), ",")[0]; tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
+
+// WorkspaceConfigFile returns the path of the configuration file of the workspace at
+// `workspaceRoot`.
+func WorkspaceConfigFile(workspaceRoot string) string {
+	return path.Join(workspaceRoot, workspaceConfigFileName)
+}
+
+// LoadedFiles returns the paths of the configuration files that were loaded, in the order they
+// were applied.
+func LoadedFiles() []string {
+	GetConfig()
+	return loadedFiles
 }
 
 func GetConfig() Config {
 	if config == nil {
-		loadedConfig := loadConfiguration()
-		config = &loadedConfig
+		workspaceRoot, _ := util.FindWorkspaceRoot()
+		loadedConfig, files := loadConfiguration(workspaceRoot)
+		config, loadedFiles = &loadedConfig, files
 	}
 
 	return *config
 }
+
+// Load loads the configuration for the workspace at `workspaceRoot` without caching it, e.g. for
+// a workspace other than the one DBT runs in.
+func Load(workspaceRoot string) Config {
+	loadedConfig, _ := loadConfiguration(workspaceRoot)
+	return loadedConfig
+}
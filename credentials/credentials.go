@@ -0,0 +1,158 @@
+// Package credentials resolves the credentials for fetching modules from private hosts. The
+// sources of credentials are tried in the order configured for the host in the DBT configuration.
+// The workspace configuration file can not configure credentials, see config.workspaceSettings, so
+// a workspace can not make DBT send the tokens of the user to other hosts.
+package credentials
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/netrc"
+)
+
+const defaultTokenUser = "oauth2"
+
+// Source looks up the credentials for a URL. It returns nil if it has none.
+type Source func(u *url.URL, hostConfig config.HostCredentials) *netrc.BasicAuth
+
+// Sources are the known sources of credentials by name. The default order is defaultSources.
+var Sources = map[string]Source{
+	"env":   fromEnvironment,
+	"git":   fromGitCredentialHelper,
+	"netrc": fromNetrc,
+}
+
+var defaultSources = []string{"env", "git", "netrc"}
+
+// TokenVariable returns the environment variable that holds the access token for `host`.
+func TokenVariable(host string) string {
+	if variable := config.GetConfig().Credentials[host].TokenEnv; variable != "" {
+		return variable
+	}
+	name := strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, host)
+	return "DBT_TOKEN_" + strings.ToUpper(name)
+}
+
+func fromEnvironment(u *url.URL, hostConfig config.HostCredentials) *netrc.BasicAuth {
+	token := os.Getenv(TokenVariable(u.Hostname()))
+	if token == "" {
+		return nil
+	}
+	user := hostConfig.User
+	if user == "" {
+		user = defaultTokenUser
+	}
+	return &netrc.BasicAuth{User: user, Password: token}
+}
+
+// fromGitCredentialHelper asks the credential helpers configured for git with 'git credential
+// fill'. Prompting the user is disabled.
+func fromGitCredentialHelper(u *url.URL, _ config.HostCredentials) *netrc.BasicAuth {
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=true")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		log.Debug("No credentials for '%s' from the git credential helpers: %s.\n", u.Host, err)
+		return nil
+	}
+	auth := netrc.BasicAuth{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if value := strings.TrimPrefix(line, "username="); value != line {
+			auth.User = value
+		} else if value := strings.TrimPrefix(line, "password="); value != line {
+			auth.Password = value
+		}
+	}
+	if auth.Password == "" {
+		return nil
+	}
+	return &auth
+}
+
+func fromNetrc(u *url.URL, _ config.HostCredentials) *netrc.BasicAuth {
+	return netrc.GetAuthForUrl(u.String())
+}
+
+// ForURL returns the credentials for `rawURL` from the first source configured for its host that
+// has any, or nil if none has.
+func ForURL(rawURL string) *netrc.BasicAuth {
+	return lookup(rawURL, nil)
+}
+
+// lookup is ForURL restricted to the sources in `only` unless it is nil. Credentials are never
+// sent over plain HTTP.
+func lookup(rawURL string, only map[string]bool) *netrc.BasicAuth {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	if u.Scheme == "http" {
+		log.Debug("Not sending credentials to '%s' over plain HTTP.\n", u.Host)
+		return nil
+	}
+	hostConfig := config.GetConfig().Credentials[u.Hostname()]
+	names := hostConfig.Sources
+	if len(names) == 0 {
+		names = defaultSources
+	}
+	for _, name := range names {
+		source, exists := Sources[name]
+		if !exists {
+			log.Warning("Ignoring unknown source of credentials '%s' for host '%s'.\n", name, u.Hostname())
+			continue
+		}
+		if only != nil && !only[name] {
+			continue
+		}
+		if auth := source(u, hostConfig); auth != nil {
+			log.Debug("Using credentials from '%s' for host '%s'.\n", name, u.Hostname())
+			return auth
+		}
+	}
+	return nil
+}
+
+// GitEnvironment returns the environment variables that make git send the access token for
+// `rawURL` from the environment, if there is one. Git consults its credential helpers and
+// ~/.netrc by itself.
+func GitEnvironment(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return nil
+	}
+	auth := lookup(rawURL, map[string]bool{"env": true})
+	if auth == nil {
+		return nil
+	}
+	header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(auth.User+":"+auth.Password))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		fmt.Sprintf("GIT_CONFIG_KEY_0=http.%s://%s/.extraHeader", u.Scheme, u.Host),
+		"GIT_CONFIG_VALUE_0=" + header,
+	}
+}
+
+// Hint explains how to configure credentials for the host of `rawURL`.
+func Hint(rawURL string) string {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("Provide credentials for '%s' with a git credential helper, in ~/.netrc or as a token in %s.", host, TokenVariable(host))
+}
@@ -4,5 +4,6 @@ go 1.16
 
 require (
 	github.com/daedaleanai/cobra v1.1.2
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0
 )
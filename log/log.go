@@ -1,7 +1,9 @@
 package log
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -12,8 +14,66 @@ var Verbose bool
 // IndentationLevel controls the amount of indentation of log messages.
 var IndentationLevel = 0
 
+// Output is where all messages are printed to.
+var Output io.Writer = os.Stderr
+
 var errorOccured = false
 
+// Exit codes of DBT.
+const (
+	// ExitFailure is the exit code of all errors without a more specific exit code.
+	ExitFailure = 1
+	// ExitUsage means that the command-line was invalid or DBT did not run inside a workspace.
+	ExitUsage = 2
+	// ExitGenerator means that the generator failed or reported errors.
+	ExitGenerator = 3
+	// ExitNinja means that ninja could not be run or a build action failed.
+	ExitNinja = 4
+	// ExitDependencies means that dependencies could not be fetched or are not checked out.
+	ExitDependencies = 5
+	// ExitInterrupted means that DBT was interrupted by SIGINT or SIGTERM while running the
+	// generator or ninja.
+	ExitInterrupted = 130
+)
+
+// FatalError is an error that terminates DBT. Functions return it up to the root command, which
+// prints it with its hints and exits with its exit code.
+type FatalError struct {
+	Message string
+	Hints   []string
+	// Code is the exit code of DBT for the error.
+	Code int
+}
+
+func (err *FatalError) Error() string {
+	return strings.TrimSuffix(strings.TrimSpace(err.Message), ".")
+}
+
+// Errorf returns a *FatalError with a formatted error message.
+func Errorf(format string, a ...interface{}) error {
+	return ErrorfWithCode(ExitFailure, nil, format, a...)
+}
+
+// ErrorfWithHints returns a *FatalError with a formatted error message followed by `hints`.
+func ErrorfWithHints(hints []string, format string, a ...interface{}) error {
+	return ErrorfWithCode(ExitFailure, hints, format, a...)
+}
+
+// ErrorfWithCode returns a *FatalError with a formatted error message followed by `hints` that
+// terminates DBT with the exit code `code`.
+func ErrorfWithCode(code int, hints []string, format string, a ...interface{}) error {
+	return &FatalError{Message: fmt.Sprintf(format, a...), Hints: hints, Code: code}
+}
+
+// ExitCode returns the exit code of DBT for the error `err`.
+func ExitCode(err error) int {
+	var fatal *FatalError
+	if errors.As(err, &fatal) {
+		return fatal.Code
+	}
+	return ExitFailure
+}
+
 // ErrorOccured reports whether any errors have occured.
 func ErrorOccured() bool {
 	return errorOccured
@@ -21,35 +81,52 @@ func ErrorOccured() bool {
 
 // Log prints an indented and formatted message to os.Stdout.
 func Log(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+format, a...)
+	fmt.Fprintf(Output, strings.Repeat("  ", IndentationLevel)+format, a...)
 }
 
 // Debug prints an indented and formatted debug message to os.Stdout if verbose output is selected.
 func Debug(format string, a ...interface{}) {
 	if Verbose {
-		fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+"\033[36mDebug: \033[0m"+format, a...)
+		fmt.Fprintf(Output, strings.Repeat("  ", IndentationLevel)+"\033[36mDebug: \033[0m"+format, a...)
 	}
 }
 
 // Success prints an indented and formatted success message to os.Stdout.
 func Success(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+"\033[32mSuccess: \033[0m"+format, a...)
+	fmt.Fprintf(Output, strings.Repeat("  ", IndentationLevel)+"\033[32mSuccess: \033[0m"+format, a...)
 }
 
 // Warning prints an indented and formatted warning to os.Stdout.
 func Warning(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+"\033[33mWarning: \033[0m"+format, a...)
+	Fwarning(Output, format, a...)
+}
+
+// Fwarning prints an indented and formatted warning to `out`.
+func Fwarning(out io.Writer, format string, a ...interface{}) {
+	fmt.Fprintf(out, strings.Repeat("  ", IndentationLevel)+"\033[33mWarning: \033[0m"+format, a...)
 }
 
 // Error prints an indented and formatted error message to os.Stdout.
 func Error(format string, a ...interface{}) {
 	errorOccured = true
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+"\033[31mError: \033[0m"+format, a...)
+	fmt.Fprintf(Output, strings.Repeat("  ", IndentationLevel)+"\033[31mError: \033[0m"+format, a...)
+}
+
+// Hint prints an indented and formatted suggestion how to resolve an error to os.Stdout.
+func Hint(format string, a ...interface{}) {
+	fmt.Fprintf(Output, strings.Repeat("  ", IndentationLevel)+"\033[35mHint: \033[0m"+format, a...)
 }
 
-// Fatal prints an indented and formatted error message to os.Stdout and terminates the program.
-func Fatal(format string, a ...interface{}) {
-	Error(format, a...)
-	fmt.Fprintf(os.Stderr, "\033[31mA fatal error occured. Exiting...\033[0m\n")
-	os.Exit(1)
+// Exit prints the error `err` with its hints and terminates the program with its exit code.
+func Exit(err error) {
+	var fatal *FatalError
+	if !errors.As(err, &fatal) {
+		fatal = &FatalError{Message: err.Error() + ".\n", Code: ExitFailure}
+	}
+	Error("%s", fatal.Message)
+	for _, hint := range fatal.Hints {
+		Hint("%s\n", hint)
+	}
+	fmt.Fprintf(Output, "\033[31mA fatal error occured. Exiting...\033[0m\n")
+	os.Exit(fatal.Code)
 }
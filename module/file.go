@@ -3,6 +3,7 @@ package module
 import (
 	"path"
 
+	"github.com/daedaleanai/dbt/config"
 	"github.com/daedaleanai/dbt/log"
 	"github.com/daedaleanai/dbt/util"
 )
@@ -18,6 +19,23 @@ type Dependency struct {
 	Version string
 	Hash    string
 	Type    string
+	// Clone configures how git dependencies are cloned to save time and disk space.
+	Clone CloneOptions `yaml:"clone,omitempty"`
+}
+
+// CloneOptions configure shallow, single-branch, partial and sparse clones of git dependencies.
+// They apply when the dependency is cloned into DEPS/.
+type CloneOptions struct {
+	// Depth limits the history to the given number of commits. Zero clones the full history.
+	Depth uint `yaml:"depth,omitempty"`
+	// SingleBranch only fetches the branch of the version string (e.g., "origin/main") or, for
+	// other versions, the default branch.
+	SingleBranch bool `yaml:"single-branch,omitempty"`
+	// Partial only downloads the file contents that are checked out.
+	Partial bool `yaml:"partial,omitempty"`
+	// Sparse are the directories to check out. The files in the root directory of the module are
+	// always checked out. If empty, all directories are checked out.
+	Sparse []string `yaml:"sparse,omitempty"`
 }
 
 type ModuleFile struct {
@@ -25,6 +43,126 @@ type ModuleFile struct {
 	Layout       string
 	Dependencies map[string]Dependency
 	Flags        map[string]string
+	// NamespaceRules makes the import path of RULES packages in the "cpp" layout
+	// include the module name (i.e., "<module>/<name>/RULES/..." instead of "<name>/RULES/...").
+	NamespaceRules bool `yaml:"namespace-rules,omitempty"`
+	// Configs are named sets of build flags that can be selected with the `config` build flag.
+	Configs map[string]BuildConfig `yaml:"configs,omitempty"`
+	// Hooks are shell commands that run before the generator and after successful builds.
+	Hooks []Hook `yaml:"hooks,omitempty"`
+	// RemoteCache configures a cache that shares the outputs of build actions between workspaces.
+	RemoteCache RemoteCache `yaml:"remote-cache,omitempty"`
+	// FlagOverrides set build flags for some targets only, e.g. to build third-party code with
+	// different warnings.
+	FlagOverrides []FlagOverride `yaml:"flag-overrides,omitempty"`
+	// Notifications configure notifications about long builds. The DBT configuration file of the
+	// user takes precedence. The webhook is only taken from the DBT configuration file.
+	Notifications config.Notifications `yaml:"notifications,omitempty"`
+	// ModuleRoots are additional directories (e.g., a shared read-only module store) whose
+	// subdirectories are modules of the workspace. Relative paths are relative to the workspace
+	// root. Modules in DEPS/ take precedence.
+	ModuleRoots []string `yaml:"module-roots,omitempty"`
+	// TestBackends run the tests of targets that are built for another architecture.
+	TestBackends []TestBackend `yaml:"test-backends,omitempty"`
+	// FlakyTests configures the quarantine of flaky tests.
+	FlakyTests FlakyTests `yaml:"flaky-tests,omitempty"`
+	// Variants are workspaces (e.g., checkouts of different hardware variants of a product) that
+	// 'dbt variants' builds side by side. Relative paths are relative to the workspace root.
+	Variants []string `yaml:"variants,omitempty"`
+	// Environment controls the environment that build commands run in.
+	Environment Environment `yaml:"environment,omitempty"`
+	// ResourceClasses configure the ninja pools of the resource classes that rules assign actions to.
+	ResourceClasses map[string]ResourceClass `yaml:"resource-classes,omitempty"`
+	// DefaultVisibility is the visibility of the targets of the module that do not declare one,
+	// e.g. ["module"] to keep them private to the module. If empty, targets are public.
+	DefaultVisibility []string `yaml:"default-visibility,omitempty"`
+}
+
+// BuildConfig is a named set of build flags. It inherits all flags of the config it extends.
+type BuildConfig struct {
+	Extends string            `yaml:"extends,omitempty"`
+	Flags   map[string]string `yaml:"flags,omitempty"`
+}
+
+// FlagOverride sets build flags for all targets matching a target pattern.
+type FlagOverride struct {
+	Targets string            `yaml:"targets"`
+	Flags   map[string]string `yaml:"flags"`
+}
+
+// Hook is a shell command that runs at a stage of every build in the workspace.
+type Hook struct {
+	Name string `yaml:"name"`
+	// Stage is either "pre-build" (before the generator runs) or "post-build" (after ninja succeeded).
+	Stage   string `yaml:"stage"`
+	Command string `yaml:"command"`
+	// Disabled hooks are not run.
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// RemoteCache configures where the outputs of build actions are uploaded to and downloaded from.
+type RemoteCache struct {
+	// URL is either an HTTP(S) URL or an S3 location of the form "s3://bucket/prefix".
+	URL string `yaml:"url,omitempty"`
+	// Region and Endpoint configure the S3 backend. By default, the AWS endpoint of the region is used.
+	Region   string `yaml:"region,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// ReadOnly disables uploads, e.g. for builds of untrusted changes.
+	ReadOnly bool `yaml:"read-only,omitempty"`
+}
+
+// TestBackend runs the tests of the targets built with a toolchain or for an architecture.
+// Backends for a toolchain take precedence over backends for an architecture.
+type TestBackend struct {
+	Toolchain string `yaml:"toolchain,omitempty"`
+	// Arch is the architecture as named by QEMU, e.g. "aarch64" or "riscv64".
+	Arch string `yaml:"arch,omitempty"`
+	// Type is "qemu-user", "qemu-system" or "simulator".
+	Type string `yaml:"type"`
+	// Machine is the machine emulated by "qemu-system" backends, e.g. "lm3s6965evb".
+	Machine string `yaml:"machine,omitempty"`
+	// Args are additional arguments passed to QEMU.
+	Args string `yaml:"args,omitempty"`
+	// Command is the command line of "simulator" backends. "{}" is replaced by the test binary and
+	// "{args}" by the arguments of the test.
+	Command string `yaml:"command,omitempty"`
+}
+
+// FlakyTests configures which tests are quarantined because of their flakiness score.
+type FlakyTests struct {
+	// QuarantineThreshold is the flakiness score from which on tests are quarantined, e.g. 0.2.
+	// Tests are never quarantined if it is 0.
+	QuarantineThreshold float64 `yaml:"quarantine-threshold,omitempty"`
+	// MinRuns is the number of recorded runs a test needs before it can be quarantined.
+	MinRuns int `yaml:"min-runs,omitempty"`
+	// Allowlist are the IDs of tests that are never quarantined.
+	Allowlist []string `yaml:"allowlist,omitempty"`
+}
+
+// Environment configures the environment of ninja and thus of all build commands.
+type Environment struct {
+	// Hermetic build commands do not inherit the environment of DBT. They only see PATH, HOME
+	// pointing to an empty directory in the build directory, the pinned variables and the
+	// variables that are passed through. LC_ALL and TZ are pinned to "C" and "UTC" unless
+	// configured otherwise.
+	Hermetic bool `yaml:"hermetic,omitempty"`
+	// Path are the directories of PATH. Relative paths are relative to the workspace root. The
+	// default for hermetic builds is "/usr/local/bin:/usr/bin:/bin".
+	Path []string `yaml:"path,omitempty"`
+	// Vars pin environment variables to fixed values, e.g. LANG or SOURCE_DATE_EPOCH.
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// Pass are the names of variables that hermetic build commands inherit from DBT.
+	Pass []string `yaml:"pass,omitempty"`
+}
+
+// ResourceClass configures how many actions of a resource class run at the same time and how
+// long they may take.
+type ResourceClass struct {
+	// Depth is the number of actions of the class that run in parallel. By default, it is derived
+	// from the CPUs and memory that the actions of the class declare.
+	Depth int `yaml:"depth,omitempty"`
+	// Timeout (e.g., "10m") applies to all actions of the class that do not declare one.
+	Timeout string `yaml:"timeout,omitempty"`
 }
 
 // MODULE file version 2
@@ -66,19 +204,21 @@ type v1ModuleFile struct {
 }
 
 // ReadModuleFile reads and parses module Dependencies from a MODULE file.
-func ReadModuleFile(modulePath string) ModuleFile {
+func ReadModuleFile(modulePath string) (ModuleFile, error) {
 	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
 	if !util.FileExists(moduleFilePath) {
 		log.Debug("Module has no %s file.\n", util.ModuleFileName)
 		return ModuleFile{
 			Version:      util.DbtVersion[1],
 			Dependencies: map[string]Dependency{},
-		}
+		}, nil
 	}
 
 	// Check MODULE file version.
 	var moduleFileVersion moduleFileVersion
-	util.ReadYaml(moduleFilePath, &moduleFileVersion)
+	if err := util.ReadYaml(moduleFilePath, &moduleFileVersion); err != nil {
+		return ModuleFile{}, err
+	}
 
 	switch moduleFileVersion.Version {
 	case 1:
@@ -88,21 +228,22 @@ func ReadModuleFile(modulePath string) ModuleFile {
 	case util.DbtVersion[1]:
 		return readV3ModuleFile(moduleFilePath)
 	default:
-		log.Fatal("MODULE file has version %d that requires a newer version of dbt\n", moduleFileVersion.Version)
-		return ModuleFile{}
+		return ModuleFile{}, log.Errorf("MODULE file has version %d that requires a newer version of dbt\n", moduleFileVersion.Version)
 	}
 }
 
 // WriteModuleFile serializes and writes a Module's Dependencies to a MODULE file.
-func WriteModuleFile(modulePath string, moduleFile ModuleFile) {
+func WriteModuleFile(modulePath string, moduleFile ModuleFile) error {
 	moduleFile.Version = util.DbtVersion[1]
 	moduleFilePath := path.Join(modulePath, util.ModuleFileName)
-	util.WriteYaml(moduleFilePath, moduleFile)
+	return util.WriteYaml(moduleFilePath, moduleFile)
 }
 
-func readV1ModuleFile(path string) ModuleFile {
+func readV1ModuleFile(path string) (ModuleFile, error) {
 	var v1ModuleFile v1ModuleFile
-	util.ReadYaml(path, &v1ModuleFile)
+	if err := util.ReadYaml(path, &v1ModuleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	moduleFile := ModuleFile{
 		Version:      util.DbtVersion[1],
@@ -115,12 +256,14 @@ func readV1ModuleFile(path string) ModuleFile {
 			Hash:    dep.Version.Hash,
 		}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
 
-func readV2ModuleFile(path string) ModuleFile {
+func readV2ModuleFile(path string) (ModuleFile, error) {
 	var v2ModuleFile v2ModuleFile
-	util.ReadYaml(path, &v2ModuleFile)
+	if err := util.ReadYaml(path, &v2ModuleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	moduleFile := ModuleFile{
 		Version:      util.DbtVersion[1],
@@ -134,17 +277,19 @@ func readV2ModuleFile(path string) ModuleFile {
 			Hash:    v2ModuleFile.PinnedDependencies[name].Hash,
 		}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
 
-func readV3ModuleFile(path string) ModuleFile {
+func readV3ModuleFile(path string) (ModuleFile, error) {
 	var moduleFile ModuleFile
-	util.ReadYaml(path, &moduleFile)
+	if err := util.ReadYaml(path, &moduleFile); err != nil {
+		return ModuleFile{}, err
+	}
 
 	// YAML decoding can produce `nil`` maps if the key is present in the YAML file
 	// but has no entries.
 	if moduleFile.Dependencies == nil {
 		moduleFile.Dependencies = map[string]Dependency{}
 	}
-	return moduleFile
+	return moduleFile, nil
 }
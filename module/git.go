@@ -3,12 +3,15 @@ package module
 import (
 	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"path"
 	"strings"
 
 	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/credentials"
 	"github.com/daedaleanai/dbt/log"
 	"github.com/daedaleanai/dbt/util"
 )
@@ -43,9 +46,11 @@ func getOrCreateGitMirror(url string) (*GitMirror, error) {
 		return &GitMirror{path: mirrorPath}, nil
 	}
 
-	util.MkdirAll(mirrorPath)
+	if err := util.MkdirAll(mirrorPath); err != nil {
+		return nil, err
+	}
 	mod := GitModule{mirrorPath, nil}
-	if err := mod.clone(url, true); err != nil {
+	if err := mod.clone(url, true, nil); err != nil {
 		return nil, err
 	}
 	log.Debug("Mirror cloned at '%s'.\n", mirrorPath)
@@ -54,8 +59,9 @@ func getOrCreateGitMirror(url string) (*GitMirror, error) {
 }
 
 // createGitModule creates a new GitModule in the given `modulePath`
-// by cloning the repository from `url`.
-func CreateGitModule(modulePath, url string) (Module, error) {
+// by cloning the repository from `url`. `options` configure the clone of a dependency with version
+// `version`.
+func CreateGitModule(modulePath, url, version string, options CloneOptions) (Module, error) {
 	// Figure out if there is a local mirror for it
 	mirror, err := getOrCreateGitMirror(url)
 	if err != nil {
@@ -63,16 +69,56 @@ func CreateGitModule(modulePath, url string) (Module, error) {
 	}
 
 	mod := GitModule{modulePath, mirror}
-	util.MkdirAll(modulePath)
-	if err := mod.clone(url, false); err != nil {
+	if err := util.MkdirAll(modulePath); err != nil {
+		return nil, err
+	}
+	if err := mod.clone(url, false, cloneArgs(options, version)); err != nil {
 		return nil, err
 	}
+	if len(options.Sparse) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--cone"}, options.Sparse...)
+		if _, stderr, err := mod.tryRunGitCommand(args...); err != nil {
+			os.RemoveAll(modulePath)
+			return nil, fmt.Errorf("%s: %s", err, stderr)
+		}
+	}
 
 	return mod, nil
 }
 
+// cloneArgs returns the arguments of 'git clone' that implement `options` for a dependency with
+// version `version`.
+func cloneArgs(options CloneOptions, version string) []string {
+	args := []string{}
+	if options.Depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", options.Depth), "--shallow-submodules")
+		if !options.SingleBranch {
+			// --depth implies --single-branch.
+			args = append(args, "--no-single-branch")
+		}
+	} else if options.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if options.SingleBranch && strings.HasPrefix(version, "origin/") {
+		args = append(args, "--branch", strings.TrimPrefix(version, "origin/"))
+	}
+	if options.Partial {
+		args = append(args, "--filter=blob:none")
+	}
+	if len(options.Sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+	return args
+}
+
+// Name returns the name of the repository. Repositories whose origin can not be determined are
+// named after their directory, like LocalModules.
 func (m GitModule) Name() string {
-	return strings.TrimSuffix(path.Base(m.URL()), ".git")
+	url, err := m.URL()
+	if err != nil {
+		return path.Base(m.path)
+	}
+	return strings.TrimSuffix(path.Base(url), ".git")
 }
 
 func (m GitModule) RootPath() string {
@@ -80,7 +126,7 @@ func (m GitModule) RootPath() string {
 }
 
 // URL returns the url of the underlying git repository.
-func (m GitModule) URL() string {
+func (m GitModule) URL() (string, error) {
 	return m.runGitCommand("config", "--get", "remote.origin.url")
 }
 
@@ -90,61 +136,148 @@ func (m GitModule) Mirror() *GitMirror {
 }
 
 // Head returns the commit hash of the HEAD of the underlying git repository.
-func (m GitModule) Head() string {
+func (m GitModule) Head() (string, error) {
 	return m.RevParse("HEAD")
 }
 
 // RevParse returns the commit hash for the commit referenced by `ref`.
-func (m GitModule) RevParse(ref string) string {
-	return string(m.runGitCommand("rev-list", "-n", "1", ref))
+func (m GitModule) RevParse(ref string) (string, error) {
+	return m.runGitCommand("rev-list", "-n", "1", ref)
 }
 
 // IsDirty returns whether the underlying repository has any uncommited changes.
-func (m GitModule) IsDirty() bool {
-	return len(m.runGitCommand("status", "-s")) > 0
+func (m GitModule) IsDirty() (bool, error) {
+	status, err := m.runGitCommand("status", "-s")
+	return len(status) > 0, err
 }
 
-// IsAncestor returns whether ancestor is an ancestor of rev in the commit tree.
-func (m GitModule) IsAncestor(ancestor, rev string) bool {
+// IsAncestor returns whether ancestor is an ancestor of rev in the commit tree. In shallow clones,
+// the full history is fetched if the truncated history does not connect the commits.
+func (m GitModule) IsAncestor(ancestor, rev string) (bool, error) {
 	_, _, err := m.tryRunGitCommand("merge-base", "--is-ancestor", ancestor, rev)
-	return err == nil
+	if err == nil {
+		return true, nil
+	}
+	shallow, shallowErr := m.isShallow()
+	if shallowErr != nil || !shallow {
+		return false, shallowErr
+	}
+	log.Log("Fetching the full history to find '%s'.\n", ancestor)
+	url, urlErr := m.URL()
+	if urlErr != nil {
+		return false, urlErr
+	}
+	if _, stderr, err := m.tryRunRemoteGitCommand(url, "fetch", "--unshallow", "--tags"); err != nil {
+		err = remoteError(url, stderr, err)
+		return false, log.ErrorfWithCode(log.ExitDependencies, remoteErrorHints(url, err), "Failed to fetch the history of '%s': %s.\n", url, err)
+	}
+	_, _, err = m.tryRunGitCommand("merge-base", "--is-ancestor", ancestor, rev)
+	return err == nil, nil
+}
+
+// isShallow returns whether the repository is a shallow clone.
+func (m GitModule) isShallow() (bool, error) {
+	shallow, err := m.runGitCommand("rev-parse", "--is-shallow-repository")
+	return shallow == "true", err
+}
+
+// Branch returns the name of the checked out branch or an empty string if HEAD is detached.
+func (m GitModule) Branch() string {
+	branch, _, err := m.tryRunGitCommand("symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return branch
+}
+
+// DirtyFiles returns the paths of all files with uncommited changes.
+func (m GitModule) DirtyFiles() ([]string, error) {
+	status, err := m.runGitCommand("status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) > 3 {
+			files = append(files, line[3:])
+		}
+	}
+	return files, nil
+}
+
+// AheadBehind returns the number of commits that HEAD is ahead of and behind its upstream branch.
+// It reports false if the checked out branch has no upstream branch.
+func (m GitModule) AheadBehind() (int, int, bool) {
+	counts, _, err := m.tryRunGitCommand("rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return 0, 0, false
+	}
+	var ahead, behind int
+	if _, err := fmt.Sscanf(counts, "%d %d", &ahead, &behind); err != nil {
+		return 0, 0, false
+	}
+	return ahead, behind, true
 }
 
 // Fetch fetches changes from the default remote and reports whether any updates have been fetched.
-func (m GitModule) Fetch() bool {
-	if m.IsDirty() {
+func (m GitModule) Fetch() (bool, error) {
+	if dirty, err := m.IsDirty(); err != nil || dirty {
 		// If the module has uncommited changes, it does not match any version.
-		log.Warning("The module has uncommited changes. Not fetching any changes.\n")
-		return false
+		if dirty {
+			log.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		}
+		return false, err
 	}
 
-	return len(m.runGitCommand("fetch", "--all", "--tags")) > 0
+	url, err := m.URL()
+	if err != nil {
+		return false, err
+	}
+	stdout, stderr, err := m.tryRunRemoteGitCommand(url, "fetch", "--all", "--tags")
+	if err != nil {
+		err = remoteError(url, stderr, err)
+		return false, log.ErrorfWithCode(log.ExitDependencies, remoteErrorHints(url, err), "Failed to fetch '%s': %s.\n", url, err)
+	}
+	return len(stdout) > 0, nil
 }
 
 // Checkout changes the current module's version to `ref`.
-func (m GitModule) Checkout(ref string) {
-	if m.IsDirty() {
+func (m GitModule) Checkout(ref string) error {
+	if dirty, err := m.IsDirty(); err != nil || dirty {
 		// If the module has uncommited changes, it does not match any version.
-		log.Debug("The module has uncommited changes.\n")
-		return
+		if dirty {
+			log.Debug("The module has uncommited changes.\n")
+		}
+		return err
 	}
 
-	m.runGitCommand("checkout", ref)
+	_, err := m.runGitCommand("checkout", ref)
+	return err
 }
 
-// Runs a git command with the specified arguments, exiting with an error message if the command
-// could not be executed
-func (m GitModule) runGitCommand(args ...string) string {
+// Runs a git command with the specified arguments, returning an error with the output of the
+// command if it could not be executed
+func (m GitModule) runGitCommand(args ...string) (string, error) {
 	stdout, stderr, err := m.tryRunGitCommand(args...)
 	if err != nil {
-		log.Fatal("Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
+		return "", log.ErrorfWithCode(log.ExitDependencies, nil, "Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
 	}
-	return stdout
+	return stdout, nil
 }
 
 // Tries to run a git subcommand and return stdout, stderr and an error if the process exited with
 // an exit code != 0
 func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
+	return m.tryRunGitCommandWithEnv(nil, args...)
+}
+
+// tryRunRemoteGitCommand is like tryRunGitCommand for commands that talk to the remote repository
+// at `url`. Access tokens for the host from the environment are passed to git.
+func (m GitModule) tryRunRemoteGitCommand(url string, args ...string) (string, string, error) {
+	return m.tryRunGitCommandWithEnv(credentials.GitEnvironment(url), args...)
+}
+
+func (m GitModule) tryRunGitCommandWithEnv(env []string, args ...string) (string, string, error) {
 	stderr := bytes.Buffer{}
 	stdout := bytes.Buffer{}
 	log.Debug("Running git command: git %s\n", strings.Join(args, " "))
@@ -152,28 +285,84 @@ func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	cmd.Dir = m.path
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	err := cmd.Run()
 	return strings.TrimSuffix(stdout.String(), "\n"), strings.TrimSuffix(stderr.String(), "\n"), err
 }
 
+// Errors of git commands talking to remote repositories that DBT tells apart.
+var (
+	ErrAuthentication     = errors.New("authentication failed")
+	ErrRepositoryNotFound = errors.New("repository not found")
+)
+
+// Messages of git and of the hosting services that indicate authentication failures or missing
+// repositories.
+var (
+	authenticationFailureMessages = []string{"Authentication failed", "could not read Username", "could not read Password",
+		"terminal prompts disabled", "Access denied", "HTTP Basic", "Permission denied (publickey)", "returned error: 401", "returned error: 403"}
+	repositoryNotFoundMessages = []string{"not found", "Not found", "does not appear to be a git repository", "does not exist",
+		"returned error: 404"}
+)
+
+// remoteError turns the failure `err` of a git command talking to `url`, which printed `stderr`,
+// into an error that wraps ErrAuthentication or ErrRepositoryNotFound if possible.
+func remoteError(url, stderr string, err error) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	detail := strings.TrimSpace(lines[len(lines)-1])
+	if detail == "" {
+		detail = err.Error()
+	}
+	for _, message := range authenticationFailureMessages {
+		if strings.Contains(stderr, message) {
+			return fmt.Errorf("%w for '%s' (%s)", ErrAuthentication, url, detail)
+		}
+	}
+	for _, message := range repositoryNotFoundMessages {
+		if strings.Contains(stderr, message) {
+			return fmt.Errorf("%w at '%s' (%s)", ErrRepositoryNotFound, url, detail)
+		}
+	}
+	return fmt.Errorf("%s: %s", err, detail)
+}
+
+// remoteErrorHints returns hints for resolving the error `err` of fetching from `url`.
+func remoteErrorHints(url string, err error) []string {
+	switch {
+	case errors.Is(err, ErrAuthentication):
+		return []string{credentials.Hint(url)}
+	case errors.Is(err, ErrRepositoryNotFound):
+		// Hosts report private repositories as missing to users without access.
+		return []string{"Check the URL. If the repository is private, check your access to it. " + credentials.Hint(url)}
+	}
+	return nil
+}
+
 // Clones a module from the given url at the specfied path location. If asMirror is passed, then a
 // mirror is created instead of a regular git repository.
 // If the git module has a mirror assigned, it will be used as the reference for the new git repository.
-func (m GitModule) clone(url string, asMirror bool) error {
+// `extraArgs` are passed to 'git clone' for regular repositories.
+func (m GitModule) clone(url string, asMirror bool, extraArgs []string) error {
+	var stderr string
 	var err error
 	if asMirror {
 		log.Debug("Cloning '%s' as mirror '%s'.\n", url, m.path)
-		_, _, err = m.tryRunGitCommand("clone", "--mirror", url, m.path)
+		_, stderr, err = m.tryRunRemoteGitCommand(url, "clone", "--mirror", url, m.path)
 	} else if m.mirror != nil {
 		log.Log("Cloning '%s' using mirror '%s'.\n", url, m.mirror.path)
-		_, _, err = m.tryRunGitCommand("clone", "--recursive", "--reference", m.mirror.path, url, m.path)
+		args := append(append([]string{"clone", "--recursive", "--reference", m.mirror.path}, extraArgs...), url, m.path)
+		_, stderr, err = m.tryRunRemoteGitCommand(url, args...)
 	} else {
 		log.Log("Cloning '%s'.\n", url)
-		_, _, err = m.tryRunGitCommand("clone", "--recursive", url, m.path)
+		args := append(append([]string{"clone", "--recursive"}, extraArgs...), url, m.path)
+		_, stderr, err = m.tryRunRemoteGitCommand(url, args...)
 	}
 	if err != nil {
 		// Leave clean state so that the operation can be retried
-		util.RemoveDir(m.path)
+		os.RemoveAll(m.path)
+		return remoteError(url, stderr, err)
 	}
-	return err
+	return nil
 }
@@ -0,0 +1,61 @@
+package module
+
+import (
+	"path"
+
+	"github.com/daedaleanai/dbt/log"
+)
+
+// LocalModule is a module that only exists in the workspace, e.g. a module created with
+// 'dbt modules create' in a module root. It is not checked out from a repository or archive and
+// therefore has no versions.
+type LocalModule struct {
+	path string
+}
+
+func (m LocalModule) Name() string {
+	return path.Base(m.RootPath())
+}
+
+func (m LocalModule) RootPath() string {
+	return m.path
+}
+
+// URL returns an empty string, since LocalModules have no origin.
+func (m LocalModule) URL() (string, error) {
+	return "", nil
+}
+
+// Head returns an empty string, since LocalModules have no versions.
+func (m LocalModule) Head() (string, error) {
+	return "", nil
+}
+
+// RevParse returns an empty string, since LocalModules have no versions.
+func (m LocalModule) RevParse(rev string) (string, error) {
+	return m.Head()
+}
+
+// IsDirty returns whether the module has any uncommited changes.
+// LocalModules never have any uncommited changes by definition.
+func (m LocalModule) IsDirty() (bool, error) {
+	return false, nil
+}
+
+func (m LocalModule) IsAncestor(ancestor, rev string) (bool, error) {
+	return true, nil
+}
+
+// Fetch does nothing on LocalModules and reports that no changes have been fetched.
+func (m LocalModule) Fetch() (bool, error) {
+	return false, nil
+}
+
+// Checkout changes the module's current version to `ref`.
+// LocalModules have no versions. Attempting to check out any version results in an error.
+func (m LocalModule) Checkout(hash string) error {
+	if hash != "" {
+		return log.ErrorfWithCode(log.ExitDependencies, nil, "Failed to checkout version '%s': module '%s' only exists in the workspace.\n", hash, m.Name())
+	}
+	return nil
+}
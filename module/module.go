@@ -37,20 +37,20 @@ type GoModule struct {
 // Module represents a checked-out module.
 type Module interface {
 	Name() string
-	URL() string
+	URL() (string, error)
 
-	Head() string
-	RevParse(rev string) string
-	IsDirty() bool
-	IsAncestor(ancestor, rev string) bool
+	Head() (string, error)
+	RevParse(rev string) (string, error)
+	IsDirty() (bool, error)
+	IsAncestor(ancestor, rev string) (bool, error)
 
-	Fetch() bool
-	Checkout(hash string)
+	Fetch() (bool, error)
+	Checkout(hash string) error
 
 	RootPath() string
 }
 
-func listGoModules(module Module, moduleFile ModuleFile) []GoModule {
+func listGoModules(module Module, moduleFile ModuleFile) ([]GoModule, error) {
 	modulePath := module.RootPath()
 	moduleName := path.Base(modulePath) // FIXME: interface method
 
@@ -65,10 +65,10 @@ func listGoModules(module Module, moduleFile ModuleFile) []GoModule {
 			Name: moduleName,
 			Deps: deps,
 		},
-	}
+	}, nil
 }
 
-func listGoModulesCpp(module Module, moduleFile ModuleFile) []GoModule {
+func listGoModulesCpp(module Module, moduleFile ModuleFile) ([]GoModule, error) {
 	modulePath := module.RootPath()
 	moduleName := path.Base(modulePath) // FIXME: interface method
 
@@ -88,28 +88,35 @@ func listGoModulesCpp(module Module, moduleFile ModuleFile) []GoModule {
 	rulesDirPath := path.Join(modulePath, rulesDirName)
 
 	if !util.DirExists(rulesDirPath) {
-		return result
+		return result, nil
 	}
 
 	files, err := ioutil.ReadDir(rulesDirPath)
 	if err != nil {
-		log.Fatal("Failed to read content of %s/ directory: %s.\n", rulesDirPath, err)
+		return nil, log.Errorf("Failed to read content of %s/ directory: %s.\n", rulesDirPath, err)
 	}
 
 	for _, file := range files {
 		if file.IsDir() {
+			name := file.Name()
+			if moduleFile.NamespaceRules {
+				name = path.Join(moduleName, name)
+			}
 			result = append(result, GoModule{
-				Name: file.Name(),
+				Name: name,
 				Deps: deps,
 			})
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func ListGoModules(module Module) []GoModule {
-	moduleFile := ReadModuleFile(module.RootPath())
+func ListGoModules(module Module) ([]GoModule, error) {
+	moduleFile, err := ReadModuleFile(module.RootPath())
+	if err != nil {
+		return nil, err
+	}
 	if moduleFile.Layout == "cpp" {
 		return listGoModulesCpp(module, moduleFile)
 	} else {
@@ -117,8 +124,24 @@ func ListGoModules(module Module) []GoModule {
 	}
 }
 
-func listBuildFiles(module Module) []GoFile {
+// moduleRootDirs returns the module roots declared in the MODULE file `moduleFile` of the module
+// in `modulePath` that are inside the module, relative to the module.
+func moduleRootDirs(modulePath string, moduleFile ModuleFile) map[string]bool {
+	roots := map[string]bool{}
+	for _, root := range moduleFile.ModuleRoots {
+		if path.IsAbs(root) {
+			root = strings.TrimPrefix(path.Clean(root), path.Clean(modulePath)+"/")
+		}
+		if !path.IsAbs(root) {
+			roots[path.Clean(root)] = true
+		}
+	}
+	return roots
+}
+
+func listBuildFiles(module Module, moduleFile ModuleFile) ([]GoFile, error) {
 	modulePath := module.RootPath()
+	moduleRoots := moduleRootDirs(modulePath, moduleFile)
 	result := []GoFile{}
 	moduleName := path.Base(modulePath) // FIXME: interface method
 	err := util.WalkSymlink(modulePath, func(filePath string, file os.FileInfo, err error) error {
@@ -133,6 +156,16 @@ func listBuildFiles(module Module) []GoFile {
 			return filepath.SkipDir
 		}
 
+		// Ignore nested workspaces.
+		if file.IsDir() && filePath != modulePath && util.FileExists(path.Join(filePath, util.WorkspaceMarkerFileName)) {
+			return filepath.SkipDir
+		}
+
+		// Ignore the module roots of the workspace, their modules contribute their own BUILD.go files.
+		if file.IsDir() && moduleRoots[relativeFilePath] {
+			return filepath.SkipDir
+		}
+
 		// Skip everything that is not a BUILD.go file.
 		if file.IsDir() || file.Name() != buildFileName {
 			return nil
@@ -150,14 +183,15 @@ func listBuildFiles(module Module) []GoFile {
 	})
 
 	if err != nil {
-		log.Fatal("Failed to process %s files for module %s: %s.\n", buildFileName, moduleName, err)
+		return nil, log.Errorf("Failed to process %s files for module %s: %s.\n", buildFileName, moduleName, err)
 	}
 
-	return result
+	return result, nil
 }
 
-func listBuildFilesCpp(module Module) []GoFile {
+func listBuildFilesCpp(module Module, moduleFile ModuleFile) ([]GoFile, error) {
 	modulePath := module.RootPath()
+	moduleRoots := moduleRootDirs(modulePath, moduleFile)
 	result := []GoFile{}
 	moduleName := path.Base(modulePath) // FIXME: interface method
 	err := util.WalkSymlink(modulePath, func(filePath string, file os.FileInfo, err error) error {
@@ -172,6 +206,16 @@ func listBuildFilesCpp(module Module) []GoFile {
 			return filepath.SkipDir
 		}
 
+		// Ignore nested workspaces.
+		if file.IsDir() && filePath != modulePath && util.FileExists(path.Join(filePath, util.WorkspaceMarkerFileName)) {
+			return filepath.SkipDir
+		}
+
+		// Ignore the module roots of the workspace, their modules contribute their own BUILD.go files.
+		if file.IsDir() && moduleRoots[relativeFilePath] {
+			return filepath.SkipDir
+		}
+
 		// Skip everything that is not a BUILD.go file.
 		if file.IsDir() || file.Name() != buildFileName {
 			return nil
@@ -194,20 +238,20 @@ func listBuildFilesCpp(module Module) []GoFile {
 	})
 
 	if err != nil {
-		log.Fatal("Failed to process %s files for module %s: %s.\n", buildFileName, moduleName, err)
+		return nil, log.Errorf("Failed to process %s files for module %s: %s.\n", buildFileName, moduleName, err)
 	}
 
-	return result
+	return result, nil
 }
 
-func listRules(module Module) []GoFile {
+func listRules(module Module) ([]GoFile, error) {
 	modulePath := module.RootPath()
 	rulesDirPath := path.Join(modulePath, rulesDirName)
 	result := []GoFile{}
 	moduleName := path.Base(modulePath) // FIXME: interface method
 
 	if !util.DirExists(rulesDirPath) {
-		return result
+		return result, nil
 	}
 
 	err := filepath.Walk(rulesDirPath, func(filePath string, file os.FileInfo, err error) error {
@@ -229,19 +273,19 @@ func listRules(module Module) []GoFile {
 	})
 
 	if err != nil {
-		log.Fatal("Failed to process %s/ files for module '%s': %s.\n", rulesDirName, moduleName, err)
+		return nil, log.Errorf("Failed to process %s/ files for module '%s': %s.\n", rulesDirName, moduleName, err)
 	}
-	return result
+	return result, nil
 }
 
-func listRulesCpp(module Module) []GoFile {
+func listRulesCpp(module Module, moduleFile ModuleFile) ([]GoFile, error) {
 	modulePath := module.RootPath()
 	rulesDirPath := path.Join(modulePath, rulesDirName)
 	result := []GoFile{}
 	moduleName := path.Base(modulePath) // FIXME: interface method
 
 	if !util.DirExists(rulesDirPath) {
-		return result
+		return result, nil
 	}
 
 	err := filepath.Walk(rulesDirPath, func(filePath string, file os.FileInfo, err error) error {
@@ -262,6 +306,9 @@ func listRulesCpp(module Module) []GoFile {
 		name := parts[1]
 		parts[1] = rulesDirName
 		parts[0] = name
+		if moduleFile.NamespaceRules {
+			parts = append([]string{moduleName}, parts...)
+		}
 
 		relativeFilePath = strings.Join(parts, "/")
 
@@ -273,56 +320,87 @@ func listRulesCpp(module Module) []GoFile {
 	})
 
 	if err != nil {
-		log.Fatal("Failed to process %s/ files for module '%s': %s.\n", rulesDirName, moduleName, err)
+		return nil, log.Errorf("Failed to process %s/ files for module '%s': %s.\n", rulesDirName, moduleName, err)
 	}
-	return result
+	return result, nil
 }
 
-func ListRules(module Module) []GoFile {
-	moduleFile := ReadModuleFile(module.RootPath())
+func ListRules(module Module) ([]GoFile, error) {
+	moduleFile, err := ReadModuleFile(module.RootPath())
+	if err != nil {
+		return nil, err
+	}
 	if moduleFile.Layout == "cpp" {
-		return listRulesCpp(module)
+		return listRulesCpp(module, moduleFile)
 	} else {
 		return listRules(module)
 	}
 }
 
-func ListBuildFiles(module Module) []GoFile {
-	moduleFile := ReadModuleFile(module.RootPath())
+func ListBuildFiles(module Module) ([]GoFile, error) {
+	moduleFile, err := ReadModuleFile(module.RootPath())
+	if err != nil {
+		return nil, err
+	}
 	if moduleFile.Layout == "cpp" {
-		return listBuildFilesCpp(module)
+		return listBuildFilesCpp(module, moduleFile)
 	} else {
-		return listBuildFiles(module)
+		return listBuildFiles(module, moduleFile)
 	}
 }
 
 // OpenModule opens a module checked out on disk.
-func OpenModule(modulePath string) Module {
+func OpenModule(modulePath string) (Module, error) {
 	log.Debug("Opening module '%s'.\n", modulePath)
 
+	isGitRepository := util.DirExists(path.Join(modulePath, ".git")) || util.FileExists(path.Join(modulePath, ".git"))
+	if isGitRepository && !hasGitOrigin(modulePath) && util.FileExists(path.Join(modulePath, util.ModuleFileName)) {
+		log.Debug("Found git repository without origin. Expecting this to be a LocalModule.\n")
+		return LocalModule{path: modulePath}, nil
+	}
+
 	if util.DirExists(path.Join(modulePath, ".git")) {
 		log.Debug("Found '.git' directory. Expecting this to be a GitModule.\n")
-		module := GitModule{path: modulePath}
-		mirror, _ := getOrCreateGitMirror(module.URL())
-		return GitModule{path: modulePath, mirror: mirror}
+		return openGitModule(modulePath)
 	}
 
 	if util.FileExists(path.Join(modulePath, ".git")) {
 		log.Debug("Found '.git' worktree file. Expecting this to be a GitModule.\n")
-		module := GitModule{path: modulePath}
-		mirror, _ := getOrCreateGitMirror(module.URL())
-		return GitModule{path: modulePath, mirror: mirror}
+		return openGitModule(modulePath)
 	}
 
 	if util.FileExists(path.Join(modulePath, tarMetadataFileName)) {
 		log.Debug("Found '%s' file. Expecting this to be a TarModule.\n", tarMetadataFileName)
-		module := TarModule{path: modulePath}
-		mirror, _ := getOrCreateTarMirror(module.URL())
-		return TarModule{path: modulePath, mirror: mirror}
+		url, err := TarModule{path: modulePath}.URL()
+		if err != nil {
+			return nil, err
+		}
+		mirror, _ := getOrCreateTarMirror(url)
+		return TarModule{path: modulePath, mirror: mirror}, nil
 	}
 
-	log.Fatal("Module appears to be broken. Remove the module directory and rerun 'dbt sync'.\n")
-	return nil
+	if util.FileExists(path.Join(modulePath, util.ModuleFileName)) {
+		log.Debug("Found '%s' file. Expecting this to be a LocalModule.\n", util.ModuleFileName)
+		return LocalModule{path: modulePath}, nil
+	}
+
+	return nil, log.ErrorfWithCode(log.ExitDependencies, nil, "Module appears to be broken. Remove the module directory and rerun 'dbt sync'.\n")
+}
+
+// openGitModule opens the git repository in `modulePath` together with its mirror.
+func openGitModule(modulePath string) (Module, error) {
+	url, err := GitModule{path: modulePath}.URL()
+	if err != nil {
+		return nil, err
+	}
+	mirror, _ := getOrCreateGitMirror(url)
+	return GitModule{path: modulePath, mirror: mirror}, nil
+}
+
+// hasGitOrigin reports whether the git repository in `modulePath` has an origin remote.
+func hasGitOrigin(modulePath string) bool {
+	_, _, err := GitModule{path: modulePath}.tryRunGitCommand("config", "--get", "remote.origin.url")
+	return err == nil
 }
 
 type ModuleType uint
@@ -332,31 +410,37 @@ const (
 	TarGzModuleType
 )
 
-func determineModuleType(url, moduleTypeString string) ModuleType {
+func determineModuleType(url, moduleTypeString string) (ModuleType, error) {
 	if moduleTypeString == "git" {
-		return GitModuleType
+		return GitModuleType, nil
 	} else if moduleTypeString == "tar.gz" {
-		return TarGzModuleType
+		return TarGzModuleType, nil
 	} else if moduleTypeString != "" {
-		log.Fatal("Invalid module type '%s'.\n", moduleTypeString)
+		return GitModuleType, log.Errorf("Invalid module type '%s'.\n", moduleTypeString)
 	}
 
 	if strings.HasSuffix(url, ".git") {
 		log.Debug("Module URL ends in '.git'. Trying to create a new git module.\n")
-		return GitModuleType
+		return GitModuleType, nil
 	}
 	if strings.HasSuffix(url, ".tar.gz") {
 		log.Debug("Module URL ends in '.tar.gz'. Trying to create a new TarModule.\n")
-		return TarGzModuleType
+		return TarGzModuleType, nil
 	}
 
-	log.Fatal("Failed to determine module type from dependency url '%s'.\n", url)
-	return GitModuleType // Just because golang is not clever enough to notice that this is unreachable.
+	return GitModuleType, log.Errorf("Failed to determine module type from dependency url '%s'.\n", url)
 }
 
 // OpenOrCreateModule tries to open the module in `modulePath`. If the `modulePath` directory does
 // not yet exists, it tries to create a new module by cloning / downloading the module from `url`.
-func OpenOrCreateModule(modulePath string, url string, moduleTypeString string) Module {
+func OpenOrCreateModule(modulePath string, url string, moduleTypeString string) (Module, error) {
+	return OpenOrCreateDependency(modulePath, Dependency{URL: url, Type: moduleTypeString})
+}
+
+// OpenOrCreateDependency is like OpenOrCreateModule for the dependency `dep`. Git dependencies
+// are cloned according to their clone options.
+func OpenOrCreateDependency(modulePath string, dep Dependency) (Module, error) {
+	url, moduleTypeString := dep.URL, dep.Type
 	log.Debug("Opening or creating module '%s' from url '%s'.\n", modulePath, url)
 	if util.DirExists(modulePath) {
 		log.Debug("Module directory exists.\n")
@@ -365,36 +449,60 @@ func OpenOrCreateModule(modulePath string, url string, moduleTypeString string)
 
 	log.Debug("Module directory does not exists.\n")
 
-	moduleType := determineModuleType(url, moduleTypeString)
+	moduleType, err := determineModuleType(url, moduleTypeString)
+	if err != nil {
+		return nil, err
+	}
 
 	if moduleType == GitModuleType {
-		module, err := CreateGitModule(modulePath, url)
+		module, err := CreateGitModule(modulePath, url, dep.Version, dep.Clone)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create git module: %s.\n", err)
+			return nil, log.ErrorfWithCode(log.ExitDependencies, remoteErrorHints(url, err), "Failed to create git module: %s.\n", err)
 		}
-		SetupModule(modulePath)
-		return module
+		return module, SetupModule(modulePath)
 	} else if moduleType == TarGzModuleType {
 		module, err := createTarModule(modulePath, url)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create tar module: %s.\n", err)
+			return nil, log.ErrorfWithCode(log.ExitDependencies, remoteErrorHints(url, err), "Failed to create tar module: %s.\n", err)
 		}
-		SetupModule(modulePath)
-		return module
+		return module, SetupModule(modulePath)
 	}
 
-	log.Fatal("Unhandled module type %v\n", moduleType)
-	return nil
+	return nil, log.Errorf("Unhandled module type %v\n", moduleType)
+}
+
+// UpdateMirror brings the local mirror of the module at `url` up to date without touching any
+// checked-out module. Git mirrors are created or fetched, archives are downloaded unless they are
+// already in the mirror. It reports whether a local mirror is configured.
+func UpdateMirror(url string, moduleTypeString string) (bool, error) {
+	moduleType, err := determineModuleType(url, moduleTypeString)
+	if err != nil {
+		return false, err
+	}
+	if moduleType == TarGzModuleType {
+		mirror, err := getOrCreateTarMirror(url)
+		return mirror != nil, err
+	}
+
+	mirror, err := getOrCreateGitMirror(url)
+	if mirror == nil || err != nil {
+		return mirror != nil, err
+	}
+	_, stderr, err := GitModule{path: mirror.path}.tryRunRemoteGitCommand(url, "remote", "update", "--prune")
+	if err != nil {
+		return true, remoteError(url, stderr, err)
+	}
+	return true, nil
 }
 
 // SetupModule runs the SETUP.go file in the root directory of `mod` (it if exists).
-func SetupModule(modulePath string) {
+func SetupModule(modulePath string) error {
 	setupFilePath := path.Join(modulePath, setupFileName)
 	if !util.FileExists(setupFilePath) {
 		log.Debug("Module has no %s file. Nothing to do.\n", setupFileName)
-		return
+		return nil
 	}
 
 	log.Debug("Running 'go run %s'.\n", setupFilePath)
@@ -408,37 +516,105 @@ func SetupModule(modulePath string) {
 	err := cmd.Run()
 
 	if ctx.Err() == context.DeadlineExceeded {
-		log.Fatal("Running %s timed out: %s.\n: %s.\n", setupFileName, ctx.Err())
+		return log.Errorf("Running %s timed out: %s.\n", setupFileName, ctx.Err())
 	}
 	if err != nil {
-		log.Fatal("Running %s failed: %s.\n", setupFileName, err)
+		return log.Errorf("Running %s failed: %s.\n", setupFileName, err)
 	}
 	log.Success("Module is set up.\n")
+	return nil
+}
+
+// ModulePath is the location a module of the workspace resolved to.
+type ModulePath struct {
+	Path string
+	// Root is the directory the module was found in: the workspace root, DEPS/ or a module root.
+	Root string
+	// Shadowed are the paths of modules with the same name in module roots of lower precedence.
+	Shadowed []string
 }
 
 // GetAllModules return all the names and modules in the workspace
-func GetAllModules(workspaceRoot string) map[string]Module {
-	depsDir := path.Join(workspaceRoot, util.DepsDirName)
-	if !util.DirExists(depsDir) {
-		log.Warning("There is no %s/ directory in the workspace. Try running 'dbt sync' first.\n", util.DepsDirName)
-		return nil
+func GetAllModules(workspaceRoot string) (map[string]Module, error) {
+	if IsQuickstartWorkspace(workspaceRoot) {
+		return getQuickstartModules(workspaceRoot)
 	}
-	files, err := ioutil.ReadDir(depsDir)
+
+	modulePaths, err := GetAllModulePaths(workspaceRoot)
 	if err != nil {
-		log.Fatal("Failed to read content of %s/ directory: %s.\n", util.DepsDirName, err)
+		return nil, err
 	}
 	modules := map[string]Module{}
+	for name, modulePath := range modulePaths {
+		if modules[name], err = OpenModule(modulePath.Path); err != nil {
+			return nil, err
+		}
+	}
+	return modules, nil
+}
 
-	for _, file := range files {
-		if file.IsDir() || (file.Mode()&os.ModeSymlink) == os.ModeSymlink {
-			modules[file.Name()] = OpenModule(path.Join(depsDir, file.Name()))
+// GetAllModulePaths returns the locations of all modules in the workspace by name. Modules in
+// DEPS/ take precedence over modules in the module roots of the workspace, which take precedence
+// in the order they are declared in the MODULE file.
+func GetAllModulePaths(workspaceRoot string) (map[string]ModulePath, error) {
+	if IsQuickstartWorkspace(workspaceRoot) {
+		return getQuickstartModulePaths(workspaceRoot), nil
+	}
+
+	moduleFile, err := ReadModuleFile(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	// Workspaces whose modules all live in module roots do not need a DEPS/ directory.
+	if !util.DirExists(depsDir) && len(moduleFile.ModuleRoots) == 0 {
+		log.Warning("There is no %s/ directory in the workspace. Try running 'dbt sync' first.\n", util.DepsDirName)
+		return nil, nil
+	}
+	modulePaths := map[string]ModulePath{}
+	if util.DirExists(depsDir) {
+		if err := addModulePaths(modulePaths, depsDir); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, root := range moduleFile.ModuleRoots {
+		if !path.IsAbs(root) {
+			root = path.Join(workspaceRoot, root)
+		}
+		if !util.DirExists(root) {
+			log.Warning("Module root '%s' does not exist.\n", root)
+			continue
+		}
+		if err := addModulePaths(modulePaths, root); err != nil {
+			return nil, err
 		}
 	}
 
-	moduleFile := ReadModuleFile(workspaceRoot)
 	if moduleFile.Layout == "cpp" {
-		modules[path.Base(workspaceRoot)] = OpenModule(workspaceRoot)
+		modulePaths[path.Base(workspaceRoot)] = ModulePath{Path: workspaceRoot, Root: workspaceRoot}
 	}
 
-	return modules
+	return modulePaths, nil
+}
+
+// addModulePaths adds the modules in `root` that are not in `modulePaths` yet.
+func addModulePaths(modulePaths map[string]ModulePath, root string) error {
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return log.Errorf("Failed to read content of '%s': %s.\n", root, err)
+	}
+	for _, file := range files {
+		if !file.IsDir() && (file.Mode()&os.ModeSymlink) != os.ModeSymlink {
+			continue
+		}
+		modulePath := path.Join(root, file.Name())
+		if existing, exists := modulePaths[file.Name()]; exists {
+			existing.Shadowed = append(existing.Shadowed, modulePath)
+			modulePaths[file.Name()] = existing
+			continue
+		}
+		modulePaths[file.Name()] = ModulePath{Path: modulePath, Root: root}
+	}
+	return nil
 }
@@ -0,0 +1,90 @@
+package module
+
+import (
+	"path"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const quickstartDirName = "QUICKSTART"
+const quickstartRulesName = "dbt-rules"
+
+// IsQuickstartWorkspace returns true if the workspace has neither a MODULE file nor a DEPS/ directory.
+// Such a workspace is built as a single module named after its root directory that implicitly
+// depends on dbt-rules.
+func IsQuickstartWorkspace(workspaceRoot string) bool {
+	return !util.FileExists(path.Join(workspaceRoot, util.ModuleFileName)) &&
+		!util.DirExists(path.Join(workspaceRoot, util.DepsDirName))
+}
+
+// QuickstartRulesAvailable returns false if the workspace is in quickstart mode and dbt-rules
+// has not been fetched yet.
+func QuickstartRulesAvailable(workspaceRoot string) bool {
+	return !IsQuickstartWorkspace(workspaceRoot) ||
+		util.DirExists(path.Join(workspaceRoot, buildDirName, quickstartDirName, quickstartRulesName))
+}
+
+// getQuickstartModules returns the workspace module and dbt-rules, which is fetched into the
+// BUILD/ directory on first use and kept at the pinned version.
+func getQuickstartModules(workspaceRoot string) (map[string]Module, error) {
+	rulesPath := path.Join(workspaceRoot, buildDirName, quickstartDirName, quickstartRulesName)
+	version := config.GetConfig().QuickstartRulesVersion
+	if !util.DirExists(rulesPath) {
+		log.Log("No %s file found. Fetching %s %s for quickstart mode.\n", util.ModuleFileName, quickstartRulesName, version)
+	}
+
+	workspaceModule, err := OpenModule(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	rulesModule, err := OpenOrCreateModule(rulesPath, config.GetConfig().QuickstartRules, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, isGit := rulesModule.(GitModule); isGit && version != "" {
+		if err := checkoutQuickstartRules(rulesModule, version); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]Module{
+		path.Base(workspaceRoot): workspaceModule,
+		quickstartRulesName:      rulesModule,
+	}, nil
+}
+
+// checkoutQuickstartRules checks out the version `version` of dbt-rules unless it is checked out
+// already. The module is only fetched if it does not know the version, e.g. after the version
+// was changed in the DBT configuration.
+func checkoutQuickstartRules(rules Module, version string) error {
+	head, err := rules.Head()
+	if err != nil {
+		return log.Errorf("Failed to determine the version of %s: %s.\n", quickstartRulesName, err)
+	}
+	hash, err := rules.RevParse(version)
+	if err == nil && hash == head {
+		return nil
+	}
+	if err != nil {
+		if _, err := rules.Fetch(); err != nil {
+			return err
+		}
+		if hash, err = rules.RevParse(version); err != nil {
+			return log.Errorf("Version '%s' of %s does not exist.\n", version, quickstartRulesName)
+		}
+	}
+	log.Log("Checking out %s %s for quickstart mode.\n", quickstartRulesName, version)
+	if err := rules.Checkout(hash); err != nil {
+		return log.Errorf("Failed to check out version '%s' of %s: %s.\n", version, quickstartRulesName, err)
+	}
+	return nil
+}
+
+func getQuickstartModulePaths(workspaceRoot string) map[string]ModulePath {
+	quickstartDir := path.Join(workspaceRoot, buildDirName, quickstartDirName)
+	return map[string]ModulePath{
+		path.Base(workspaceRoot): {Path: workspaceRoot, Root: workspaceRoot},
+		quickstartRulesName:      {Path: path.Join(quickstartDir, quickstartRulesName), Root: quickstartDir},
+	}
+}
@@ -13,8 +13,8 @@ import (
 	"strings"
 
 	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/credentials"
 	"github.com/daedaleanai/dbt/log"
-	"github.com/daedaleanai/dbt/netrc"
 	"github.com/daedaleanai/dbt/util"
 )
 
@@ -74,12 +74,14 @@ func getOrCreateTarMirror(url string) (*TarMirror, error) {
 		return &TarMirror{path: mirrorPath}, nil
 	}
 
-	util.MkdirAll(mirrorPath)
+	if err := util.MkdirAll(mirrorPath); err != nil {
+		return nil, err
+	}
 	mod := TarModule{mirrorPath, nil}
 	if err := mod.download(url); err != nil {
 		// If downloading fails, we remove the mirror path to leave a clean tree so that the
 		// operation can be retried.
-		util.RemoveDir(mod.path)
+		os.RemoveAll(mod.path)
 		return nil, err
 	}
 	log.Debug("Mirror downloaded at '%s'.\n", mirrorPath)
@@ -114,46 +116,51 @@ func (m TarModule) RootPath() string {
 }
 
 // URL returns the url of the underlying tar archive.
-func (m TarModule) URL() string {
+func (m TarModule) URL() (string, error) {
 	var metadata metadataFile
-	util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
-	return metadata.URL
+	err := util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
+	return metadata.URL, err
 }
 
 // Head returns the default version for all TarModules.
-func (m TarModule) Head() string {
+func (m TarModule) Head() (string, error) {
 	var metadata metadataFile
-	util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
-	return metadata.Sha256
+	err := util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
+	return metadata.Sha256, err
 }
 
 // RevParse returns the default version for all TarModules.
-func (m TarModule) RevParse(rev string) string {
+func (m TarModule) RevParse(rev string) (string, error) {
 	return m.Head()
 }
 
 // IsDirty returns whether the module has any uncommited changes.
 // TarModules never have any uncommited changes by definition.
-func (m TarModule) IsDirty() bool {
-	return false
+func (m TarModule) IsDirty() (bool, error) {
+	return false, nil
 }
 
-func (m TarModule) IsAncestor(ancestor, rev string) bool {
-	return true
+func (m TarModule) IsAncestor(ancestor, rev string) (bool, error) {
+	return true, nil
 }
 
 // Fetch does nothing on TarModules and reports that no changes have been fetched.
-func (m TarModule) Fetch() bool {
-	return false
+func (m TarModule) Fetch() (bool, error) {
+	return false, nil
 }
 
 // Checkout changes the module's current version to `ref`.
 // TarModules only have a single version. Attempting to check out any
 // other version results in an error.
-func (m TarModule) Checkout(hash string) {
-	if hash != m.Head() {
-		log.Fatal("Failed to checkout version '%s': cannot change version of TarModule.\n", hash)
+func (m TarModule) Checkout(hash string) error {
+	head, err := m.Head()
+	if err != nil {
+		return err
+	}
+	if hash != head {
+		return log.ErrorfWithCode(log.ExitDependencies, nil, "Failed to checkout version '%s': cannot change version of TarModule.\n", hash)
 	}
+	return nil
 }
 
 // clones a tar from either a mirror (if the tar module contains one and is valid) or downloaded from
@@ -182,8 +189,7 @@ func (m TarModule) download(url string) error {
 		return fmt.Errorf("failed to construct HTTP request to download archive: %s", err)
 	}
 
-	if auth := netrc.GetAuthForUrl(url); auth != nil {
-		log.Debug("Using netrc auth for url %q\n", url)
+	if auth := credentials.ForURL(url); auth != nil {
 		request.SetBasicAuth(auth.User, auth.Password)
 	}
 
@@ -192,6 +198,14 @@ func (m TarModule) download(url string) error {
 		return fmt.Errorf("failed to download archive: %s", err)
 	}
 	defer response.Body.Close()
+	switch {
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w for '%s' (%s)", ErrAuthentication, url, response.Status)
+	case response.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w at '%s' (%s)", ErrRepositoryNotFound, url, response.Status)
+	case response.StatusCode != http.StatusOK:
+		return fmt.Errorf("failed to download archive: %s", response.Status)
+	}
 
 	hasher := sha256.New()
 	gzFile := io.TeeReader(response.Body, hasher)
@@ -284,6 +298,5 @@ func (m TarModule) download(url string) error {
 	}
 
 	metadata := metadataFile{url, hex.EncodeToString(hasher.Sum(nil))}
-	util.WriteYaml(path.Join(m.path, tarMetadataFileName), metadata)
-	return nil
+	return util.WriteYaml(path.Join(m.path, tarMetadataFileName), metadata)
 }
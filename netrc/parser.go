@@ -44,6 +44,10 @@ func parseNetrc() {
 
 	netrcPath := path.Join(homeEnvVar, ".netrc")
 	netrcContents, err := os.ReadFile(netrcPath)
+	if os.IsNotExist(err) {
+		log.Debug("There is no %q.\n", netrcPath)
+		return
+	}
 	if err != nil {
 		log.Warning("Error reading %q.\n", netrcPath)
 		return
@@ -0,0 +1,300 @@
+// Package dbt runs the generator of a DBT workspace and builds its targets, e.g. for release
+// automation or IDE plugins. The dbt command is built on top of it. All functions operate on the
+// workspace described by a Context and return errors of type *log.FatalError, which carry the exit
+// code that the dbt command exits with.
+package dbt
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/daedaleanai/dbt/config"
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const defaultOutputDir = "OUTPUT"
+const ninjaFileName = "build.ninja"
+const outputDirFlagName = "output-dir"
+
+// Context describes the workspace to operate on and where output goes.
+type Context struct {
+	// WorkspaceRoot is the root directory of the workspace.
+	WorkspaceRoot string
+	// WorkingDir is the directory that target patterns not starting with "//" are relative to. If
+	// empty, WorkspaceRoot is used.
+	WorkingDir string
+	// Flags are the build flags set on the command-line, e.g. {"optimize": "2"}.
+	Flags map[string]string
+	// Config is the DBT configuration. If nil, the configuration of the workspace is loaded.
+	Config *config.Config
+	// Log receives the messages of DBT and the output of the generator. If nil, they are discarded.
+	Log io.Writer
+	// Stdout receives the output of ninja. If nil, it is discarded.
+	Stdout io.Writer
+	// RunCommand runs the generator and ninja. If nil, exec.Cmd.Run is used. Errors of type
+	// *log.FatalError are returned unchanged, e.g. to report an interruption.
+	RunCommand func(*exec.Cmd) error
+}
+
+func (ctx Context) workingDir() string {
+	if ctx.WorkingDir == "" {
+		return ctx.WorkspaceRoot
+	}
+	return ctx.WorkingDir
+}
+
+func (ctx Context) config() config.Config {
+	if ctx.Config == nil {
+		return config.Load(ctx.WorkspaceRoot)
+	}
+	return *ctx.Config
+}
+
+func (ctx Context) log() io.Writer {
+	if ctx.Log == nil {
+		return ioutil.Discard
+	}
+	return ctx.Log
+}
+
+func (ctx Context) stdout() io.Writer {
+	if ctx.Stdout == nil {
+		return ioutil.Discard
+	}
+	return ctx.Stdout
+}
+
+func (ctx Context) run(cmd *exec.Cmd) error {
+	if ctx.RunCommand == nil {
+		return cmd.Run()
+	}
+	return ctx.RunCommand(cmd)
+}
+
+// Options select what to generate or build.
+type Options struct {
+	// Patterns are target patterns as passed to 'dbt build', e.g. "//app/...".
+	Patterns []string
+	// ListOutputs makes the generator report the outputs of all targets.
+	ListOutputs bool
+	// ListDependencies makes the generator report the dependencies of all targets.
+	ListDependencies bool
+}
+
+// Generation is the result of running the generator.
+type Generation struct {
+	// OutputDir is the directory that the targets are built in.
+	OutputDir string
+	// ProtocolVersion is the version of the protocol spoken by the generator.
+	ProtocolVersion uint
+	// NinjaFile is the content of the generated ninja file.
+	NinjaFile string
+	// Targets maps the IDs of all targets, e.g. "//module/pkg/target", to the targets.
+	Targets map[string]Target
+	// Flags maps the names of all build flags to their values.
+	Flags map[string]Flag
+	// Selected are the IDs of the targets matching the target patterns of the options, with
+	// aliases replaced by the targets they stand for.
+	Selected []string
+}
+
+// Generate runs the generator without building anything. Unlike 'dbt build', it neither persists
+// build flags nor applies build configs, flag overrides or test backends. Warnings of the
+// generator go to the log of `ctx`, errors are returned.
+func Generate(ctx Context, options Options) (*Generation, error) {
+	input, err := newGeneratorInput(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	output, err := RunGenerator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDiagnostics(ctx, output.Diagnostics); err != nil {
+		return nil, err
+	}
+
+	generation := &Generation{
+		OutputDir:       input.OutputDir,
+		ProtocolVersion: output.ProtocolVersion,
+		NinjaFile:       output.NinjaFile,
+		Targets:         map[string]Target{},
+		Flags:           output.Flags,
+		Selected:        []string{},
+	}
+	if output.BuildDir != "" {
+		generation.OutputDir = output.BuildDir
+	}
+	for name, target := range output.Targets {
+		generation.Targets["//"+name] = target
+	}
+	selected, err := selectTargets(ctx, options.Patterns, output.Targets)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range selected {
+		generation.Selected = append(generation.Selected, "//"+name)
+	}
+	return generation, nil
+}
+
+// Build runs the generator like Generate and builds the selected targets with ninja. Unlike
+// 'dbt build', it does not run hooks, send notifications or record the build.
+func Build(ctx Context, options Options) error {
+	generation, err := Generate(ctx, options)
+	if err != nil {
+		return err
+	}
+	if len(generation.Selected) == 0 {
+		return log.Errorf("No targets match the target patterns.\n")
+	}
+	if err := util.WriteFile(path.Join(generation.OutputDir, ninjaFileName), []byte(generation.NinjaFile)); err != nil {
+		return err
+	}
+
+	cfg := ctx.config()
+	ninjaBin := cfg.NinjaBin
+	if ninjaBin == "" {
+		ninjaBin = "ninja"
+	}
+	args := []string{}
+	if cfg.Jobs > 0 {
+		args = append(args, fmt.Sprintf("-j%d", cfg.Jobs))
+	}
+	for _, id := range generation.Selected {
+		args = append(args, strings.TrimPrefix(id, "//"))
+	}
+	cmd := exec.Command(ninjaBin, args...)
+	cmd.Dir = generation.OutputDir
+	cmd.Stdout = ctx.stdout()
+	cmd.Stderr = ctx.log()
+	err = ctx.run(cmd)
+	if _, isFatal := err.(*log.FatalError); isFatal {
+		return err
+	}
+	if err != nil {
+		return log.ErrorfWithCode(log.ExitNinja, nil, "Running ninja failed: %s.\n", err)
+	}
+	return nil
+}
+
+// newGeneratorInput returns the generator input for the workspace and build flags of `ctx`.
+func newGeneratorInput(ctx Context, options Options) (GeneratorInput, error) {
+	dbtRulesDir := path.Join(ctx.WorkspaceRoot, util.DepsDirName, dbtRulesDirName)
+	if !module.IsQuickstartWorkspace(ctx.WorkspaceRoot) && !util.DirExists(dbtRulesDir) {
+		return GeneratorInput{}, util.Fail(util.DepsNotSynced, nil, "'%s' is not available in the workspace.\n", dbtRulesDirName)
+	}
+	moduleFile, err := module.ReadModuleFile(ctx.WorkspaceRoot)
+	if err != nil {
+		return GeneratorInput{}, err
+	}
+	for _, name := range sortedKeys(moduleFile.Dependencies) {
+		if !util.DirExists(path.Join(ctx.WorkspaceRoot, util.DepsDirName, name)) {
+			return GeneratorInput{}, util.Fail(util.DepsNotSynced, nil, "Dependency '%s' is not checked out.\n", name)
+		}
+	}
+
+	// Default flags of the DBT configuration take precedence over the flags of the MODULE file.
+	workspaceFlags := map[string]string{}
+	for name, value := range moduleFile.Flags {
+		workspaceFlags[name] = value
+	}
+	for name, value := range ctx.config().Flags {
+		workspaceFlags[name] = value
+	}
+	cmdlineFlags := map[string]string{}
+	for name, value := range ctx.Flags {
+		cmdlineFlags[name] = value
+	}
+
+	outputDir := defaultOutputDir
+	if workspaceOutputDir, exists := workspaceFlags[outputDirFlagName]; exists {
+		outputDir = workspaceOutputDir
+		delete(workspaceFlags, outputDirFlagName)
+	}
+	if cmdlineOutputDir, exists := cmdlineFlags[outputDirFlagName]; exists {
+		outputDir = cmdlineOutputDir
+		delete(cmdlineFlags, outputDirFlagName)
+	}
+	if !strings.HasPrefix(outputDir, "/") {
+		outputDir = path.Join(ctx.WorkspaceRoot, buildDirName, outputDir)
+	}
+
+	return GeneratorInput{
+		DbtVersion:       util.DbtVersion,
+		OutputDir:        outputDir,
+		CmdlineFlags:     cmdlineFlags,
+		WorkspaceFlags:   workspaceFlags,
+		TestArgs:         []string{},
+		RunArgs:          []string{},
+		PersistFlags:     false,
+		ListOutputs:      options.ListOutputs,
+		ListDependencies: options.ListDependencies,
+
+		// Legacy fields
+		Version:        2,
+		BuildDirPrefix: outputDir,
+		BuildFlags:     cmdlineFlags,
+	}, nil
+}
+
+// checkDiagnostics writes the warnings of the generator to the log of `ctx` and fails if it
+// reported any errors.
+func checkDiagnostics(ctx Context, diagnostics []Diagnostic) error {
+	errors := []string{}
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Severity {
+		case "error":
+			errors = append(errors, strings.TrimSpace(diagnostic.Message))
+		case "warning":
+			log.Fwarning(ctx.log(), "%s\n", strings.TrimSpace(diagnostic.Message))
+		}
+	}
+	if len(errors) > 0 {
+		return log.ErrorfWithCode(log.ExitGenerator, nil, "The generator reported errors:\n%s\n", strings.Join(errors, "\n"))
+	}
+	return nil
+}
+
+// selectTargets returns the names of the targets matching any of the target patterns `patterns`,
+// with aliases replaced by the targets they stand for. Every pattern must match a target.
+func selectTargets(ctx Context, patterns []string, targets map[string]Target) ([]string, error) {
+	selected := map[string]bool{}
+	for _, pattern := range patterns {
+		name, err := normalizeTarget(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(fmt.Sprintf("^%s$", TargetPatternRegexp(name)))
+		if err != nil {
+			return nil, log.Errorf("Target pattern '%s' is not a valid regular expression: %s.\n", pattern, err)
+		}
+		matches := false
+		for name, target := range targets {
+			if !re.MatchString(name) {
+				continue
+			}
+			matches = true
+			names := []string{name}
+			if len(target.Alias) > 0 {
+				if names, err = ExpandAlias(name, targets); err != nil {
+					return nil, err
+				}
+			}
+			for _, name := range names {
+				selected[name] = true
+			}
+		}
+		if !matches {
+			return nil, log.Errorf("Target pattern '%s' does not match any targets.\n", pattern)
+		}
+	}
+	return sortedKeys(selected), nil
+}
@@ -0,0 +1,696 @@
+package dbt
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os/exec"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/module"
+	"github.com/daedaleanai/dbt/util"
+)
+
+const buildDirName = "BUILD"
+const buildFileName = "BUILD.go"
+const dbtRulesDirName = "dbt-rules"
+const generatorDirName = "GENERATOR"
+const initFileName = "init.go"
+const mainFileName = "main.go"
+const modFileName = "go.mod"
+
+// GeneratorInputFileName and GeneratorOutputFileName are the names of the files in the generator
+// directory that the generator reads its input from and writes its output to.
+const GeneratorInputFileName = "input.json"
+const GeneratorOutputFileName = "output.json"
+
+// OverlayFileName is the name of the Go overlay file in the generator directory.
+const OverlayFileName = "overlay.json"
+
+// WorkFileName is the name of the file that makes a directory a Go workspace.
+const WorkFileName = "go.work"
+
+// GoMajorVersion and GoMinorVersion are the oldest version of go that runs the generator.
+const GoMajorVersion = 1
+const GoMinorVersion = 16
+
+// Go version required for go.work files.
+const goWorkMinorVersion = 18
+
+var goVersionRegexp = regexp.MustCompile(`go(\d+)\.(\d+)`)
+
+// Matches file locations in compiler output, e.g. "RULES/cc/library.go:12:3".
+var goFileLocationRegexp = regexp.MustCompile(`[^\s:()]+\.go:\d+`)
+
+const initFileTemplate = `
+// This file is generated. Do not edit this file.
+
+package %s
+
+import "dbt-rules/RULES/core"
+
+type __internal_pkg struct{}
+
+func DbtMain(vars map[string]interface{}) {
+%s
+}
+
+func in(name string) core.Path {
+	return core.NewInPath(__internal_pkg{}, name)
+}
+
+func ins(names ...string) []core.Path {
+	var paths []core.Path
+	for _, name := range names {
+		paths = append(paths, in(name))
+	}
+	return paths
+}
+
+func out(name string) core.OutPath {
+	return core.NewOutPath(__internal_pkg{}, name)
+}
+
+func (ip __internal_pkg) SrcDir() string {
+	return %q
+}
+
+`
+const mainFileTemplate = `
+// This file is generated. Do not edit this file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"dbt-rules/RULES/core"
+)
+
+%s
+
+func init() {
+	requiredMajor := uint64(%d)
+	requiredMinor := uint64(%d)
+
+	re := regexp.MustCompile("^go([[:digit:]]+)\\.([[:digit:]]+)(\\.[[:digit:]]+)?$")
+	matches := re.FindStringSubmatch(runtime.Version())
+	if matches == nil {
+		core.Fatal("Failed to determine go version")
+	}
+	currentMajor, _ := strconv.ParseUint(matches[1], 10, 64)
+	currentMinor, _ := strconv.ParseUint(matches[2], 10, 64)
+
+	if currentMajor < requiredMajor || (currentMajor == requiredMajor && currentMinor < requiredMinor) {
+		core.Fatal("DBT requires go version >= %%d.%%d. Found %%d.%%d", requiredMajor, requiredMinor, currentMajor, currentMinor)
+	}
+}
+
+func main() {
+    defer reportPanic()
+    vars := map[string]interface{}{}
+
+%s
+
+    core.GeneratorMain(vars)
+}
+
+// reportPanic reports a panic in a build rule to DBT as an error diagnostic in the generator output.
+func reportPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	output := map[string]interface{}{
+		"ProtocolVersion": %d,
+		"Diagnostics": []map[string]string{{
+			"Severity": "error",
+			"Message":  fmt.Sprintf("A build rule panicked: %%v\n%%s", r, debug.Stack()),
+		}},
+	}
+	data, _ := json.Marshal(output)
+	if err := ioutil.WriteFile(%q, data, 0644); err != nil {
+		panic(r)
+	}
+}
+`
+
+// Generator is the generator directory of a workspace, which contains the BUILD.go and RULES/
+// files of all modules. The files are not copied. Instead, a Go overlay file maps their paths
+// inside the generator directory to the source files, see GoCommand.
+type Generator struct {
+	// Dir is the path of the generator directory.
+	Dir string
+	// Sources maps the overlaid paths inside Dir to the source files.
+	Sources map[string]string
+}
+
+// GeneratorDir returns the path of the generator directory of the workspace `workspaceRoot`.
+func GeneratorDir(workspaceRoot string) string {
+	return path.Join(workspaceRoot, buildDirName, generatorDirName)
+}
+
+// PrepareGenerator recreates the generator directory from the BUILD.go and RULES/ files of all
+// modules in the workspace of `ctx`.
+func PrepareGenerator(ctx Context) (*Generator, error) {
+	// Remove all existing buildfiles.
+	generatorDir := GeneratorDir(ctx.WorkspaceRoot)
+	if err := util.RemoveDir(generatorDir); err != nil {
+		return nil, err
+	}
+
+	// Overlay all BUILD.go files and RULES/ files from the source directory.
+	// Modules are processed in a fixed order so that conflicts are always reported the same way.
+	modules, err := module.GetAllModules(ctx.WorkspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	goWork := ctx.config().GoWork
+	owners := map[string]string{}
+	sources := map[string]string{}
+	imports := map[string][]string{}
+	packages := []string{}
+	for _, modName := range sortedKeys(modules) {
+		modBuildfilesDir := path.Join(generatorDir, modName)
+		modulePackages, err := addBuildAndRuleFiles(ctx, modName, modules[modName].RootPath(), modBuildfilesDir, modules, owners, sources, imports, goWork)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, modulePackages...)
+	}
+	if err := checkImportCycles(generatorDir, imports, sources); err != nil {
+		return nil, err
+	}
+
+	// Some tools (e.g., 'go vet') require the package directories to exist.
+	for overlaidPath := range sources {
+		if err := util.MkdirAll(path.Dir(overlaidPath)); err != nil {
+			return nil, err
+		}
+	}
+	if err := util.WriteJson(path.Join(generatorDir, OverlayFileName), &goOverlay{Replace: sources}); err != nil {
+		return nil, err
+	}
+	if err := createGeneratorMainFile(generatorDir, packages, modules, goWork); err != nil {
+		return nil, err
+	}
+	if goWork {
+		if err := CheckGoWorkSupport("'go-work' in the DBT configuration file"); err != nil {
+			return nil, err
+		}
+		if err := WriteWorkFile(generatorDir, modules); err != nil {
+			return nil, err
+		}
+	}
+	if err := createSumGoFile(ctx, generatorDir); err != nil {
+		return nil, err
+	}
+	return &Generator{Dir: generatorDir, Sources: sources}, nil
+}
+
+// PrepareInput fills in the fields of `input` that describe the workspace of `ctx` and the
+// protocol version.
+func PrepareInput(ctx Context, input GeneratorInput) (GeneratorInput, error) {
+	moduleFile, err := module.ReadModuleFile(ctx.WorkspaceRoot)
+	if err != nil {
+		return GeneratorInput{}, err
+	}
+	input.Layout = moduleFile.Layout
+	input.SourceDir = path.Join(ctx.WorkspaceRoot, util.DepsDirName)
+	if module.IsQuickstartWorkspace(ctx.WorkspaceRoot) {
+		// Without DEPS/, the workspace module is located relative to its parent directory.
+		input.SourceDir = path.Dir(ctx.WorkspaceRoot)
+	}
+	input.WorkingDir = ctx.workingDir()
+	input.ProtocolVersion = ProtocolVersion
+	return input, nil
+}
+
+// RunGenerator prepares the generator directory and runs the generator for `input`, which is
+// completed with PrepareInput. The diagnostics of the generator are returned, not reported.
+func RunGenerator(ctx Context, input GeneratorInput) (GeneratorOutput, error) {
+	input, err := PrepareInput(ctx, input)
+	if err != nil {
+		return GeneratorOutput{}, err
+	}
+	generator, err := PrepareGenerator(ctx)
+	if err != nil {
+		return GeneratorOutput{}, err
+	}
+	return generator.Run(ctx, input)
+}
+
+// Run runs the generator with `go run` for the prepared `input`. Unless the input only asks for
+// completions, the output of the generator goes to the log of `ctx`.
+func (g *Generator) Run(ctx Context, input GeneratorInput) (GeneratorOutput, error) {
+	if err := g.WriteInput(input); err != nil {
+		return GeneratorOutput{}, err
+	}
+
+	// Compiler errors refer to the overlaid paths in the generator directory. Point them to the files the user edits instead.
+	stderr := &remappingWriter{out: ctx.log(), dir: g.Dir, sources: g.Sources}
+	cmd := g.GoCommand("run", mainFileName)
+	if !input.CompletionsOnly {
+		cmd.Stderr = stderr
+		cmd.Stdout = ctx.log()
+	}
+	err := ctx.run(cmd)
+	stderr.Flush()
+	if _, isFatal := err.(*log.FatalError); isFatal {
+		return GeneratorOutput{}, err
+	}
+	if err != nil {
+		return GeneratorOutput{}, log.ErrorfWithCode(log.ExitGenerator, nil, "Failed to run generator: %s.\n", err)
+	}
+	return g.ReadOutput()
+}
+
+// BuildCommand returns a go command that compiles the generator into the binary `binPath`, which
+// runs in the generator directory like Run does.
+func (g *Generator) BuildCommand(binPath string) *exec.Cmd {
+	return g.GoCommand("build", "-o", binPath, mainFileName)
+}
+
+// WriteInput writes the input that the generator reads.
+func (g *Generator) WriteInput(input GeneratorInput) error {
+	return util.WriteJson(path.Join(g.Dir, GeneratorInputFileName), &input)
+}
+
+// ReadOutput reads the output that the generator wrote. The paths of overlaid files in the
+// messages of the diagnostics, e.g. in the stack trace of a panicking build rule, point to the
+// files the user edits.
+func (g *Generator) ReadOutput() (GeneratorOutput, error) {
+	var output GeneratorOutput
+	if err := util.ReadJson(path.Join(g.Dir, GeneratorOutputFileName), &output); err != nil {
+		return GeneratorOutput{}, err
+	}
+	for idx := range output.Diagnostics {
+		output.Diagnostics[idx].Message = g.RemapPaths(output.Diagnostics[idx].Message, g.Dir)
+	}
+	return output, nil
+}
+
+// goOverlay is the format of the file passed to the -overlay flag of the go command.
+type goOverlay struct {
+	Replace map[string]string
+}
+
+// GoCommand returns a go command that runs in the generator directory and sees the BUILD.go and
+// RULES/ files of all modules inside it.
+func (g *Generator) GoCommand(subcommand string, args ...string) *exec.Cmd {
+	overlayArg := fmt.Sprintf("-overlay=%s", path.Join(g.Dir, OverlayFileName))
+	cmd := exec.Command("go", append([]string{subcommand, overlayArg}, args...)...)
+	cmd.Dir = g.Dir
+	return cmd
+}
+
+// RemapPaths replaces the paths of overlaid files and source files in `output` (absolute or
+// relative to `dir`) with the absolute paths of their source files.
+func (g *Generator) RemapPaths(output, dir string) string {
+	return remapGeneratorPaths(output, dir, g.Sources)
+}
+
+// remapGeneratorPaths replaces the paths of overlaid files and source files in `output` (absolute
+// or relative to `dir`) with the absolute paths of their source files.
+func remapGeneratorPaths(output, dir string, sources map[string]string) string {
+	return goFileLocationRegexp.ReplaceAllStringFunc(output, func(location string) string {
+		idx := strings.LastIndex(location, ":")
+		filePath, line := location[:idx], location[idx:]
+		absPath := strings.TrimPrefix(filePath, "./")
+		if !path.IsAbs(absPath) {
+			absPath = path.Join(dir, absPath)
+		}
+		if source, exists := sources[absPath]; exists {
+			return source + line
+		}
+		// With overlays, the go command may also report source files relative to `dir`.
+		for _, source := range sources {
+			if source == absPath {
+				return source + line
+			}
+		}
+		return location
+	})
+}
+
+// remappingWriter forwards complete lines to `out` after remapping the paths of overlaid files
+// to the paths of their source files.
+type remappingWriter struct {
+	out     io.Writer
+	dir     string
+	sources map[string]string
+	line    []byte
+}
+
+func (w *remappingWriter) Write(data []byte) (int, error) {
+	w.line = append(w.line, data...)
+	idx := bytes.LastIndexByte(w.line, '\n')
+	if idx < 0 {
+		return len(data), nil
+	}
+	lines := string(w.line[:idx+1])
+	w.line = w.line[idx+1:]
+	if _, err := io.WriteString(w.out, remapGeneratorPaths(lines, w.dir, w.sources)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush writes any remaining incomplete line.
+func (w *remappingWriter) Flush() {
+	if len(w.line) > 0 {
+		io.WriteString(w.out, remapGeneratorPaths(string(w.line), w.dir, w.sources))
+		w.line = nil
+	}
+}
+
+// claimGeneratorPath records that `moduleName` writes `copyPath` in the generator directory.
+// Modules must never write the same path, since they would silently overwrite each other.
+func claimGeneratorPath(owners map[string]string, moduleName, copyPath string) error {
+	if owner, exists := owners[copyPath]; exists && owner != moduleName {
+		return log.Errorf("Modules '%s' and '%s' both provide '%s'. Set 'namespace-rules: true' in the %s file of one of the modules to avoid the conflict.\n", owner, moduleName, copyPath, util.ModuleFileName)
+	}
+	owners[copyPath] = moduleName
+	return nil
+}
+
+// addBuildAndRuleFiles overlays the BUILD.go and RULES/ files of the module `moduleName` and
+// records the imports of each BUILD.go package in `imports`. It returns the BUILD.go packages.
+func addBuildAndRuleFiles(ctx Context, moduleName, modulePath, buildFilesDir string, modules map[string]module.Module, owners, sources map[string]string, imports map[string][]string, goWork bool) ([]string, error) {
+	packages := []string{}
+
+	log.Debug("Processing module '%s'.\n", moduleName)
+
+	goFilesDir := path.Dir(buildFilesDir)
+
+	goModules, err := module.ListGoModules(modules[moduleName])
+	if err != nil {
+		return nil, err
+	}
+	for _, goMod := range goModules {
+		if err := claimGeneratorPath(owners, moduleName, path.Join(goMod.Name, modFileName)); err != nil {
+			return nil, err
+		}
+		modFile := path.Join(goFilesDir, goMod.Name, modFileName)
+		// The generated init.go files import dbt-rules, so it is a dependency even if the
+		// MODULE file does not list it (e.g., in quickstart mode).
+		deps := append([]string{}, goMod.Deps...)
+		hasRulesDep := goMod.Name == dbtRulesDirName
+		for _, dep := range deps {
+			hasRulesDep = hasRulesDep || dep == dbtRulesDirName
+		}
+		if !hasRulesDep {
+			deps = append(deps, dbtRulesDirName)
+		}
+		modFileContent := createModFileContent(goMod.Name, deps, goWork)
+		if err := util.WriteFile(modFile, modFileContent); err != nil {
+			return nil, err
+		}
+	}
+
+	buildFiles, err := module.ListBuildFiles(modules[moduleName])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, buildFile := range buildFiles {
+		relativeDirPath := strings.TrimSuffix(path.Dir(buildFile.CopyPath), "/")
+
+		packages = append(packages, relativeDirPath)
+		packageName, vars, packageImports, err := parseBuildFile(ctx, buildFile.SourcePath)
+		if err != nil {
+			return nil, err
+		}
+		imports[relativeDirPath] = packageImports
+		varLines := []string{}
+		for _, varName := range vars {
+			varLines = append(varLines, fmt.Sprintf("    vars[in(%q).Relative()] = &%s", varName, varName))
+		}
+
+		initFileContent := fmt.Sprintf(initFileTemplate, packageName, strings.Join(varLines, "\n"), path.Dir(buildFile.SourcePath))
+		initFilePath := path.Join(goFilesDir, relativeDirPath, initFileName)
+		if err := util.WriteFile(initFilePath, []byte(initFileContent)); err != nil {
+			return nil, err
+		}
+
+		if err := claimGeneratorPath(owners, moduleName, buildFile.CopyPath); err != nil {
+			return nil, err
+		}
+		sources[path.Join(goFilesDir, buildFile.CopyPath)] = buildFile.SourcePath
+	}
+
+	ruleFiles, err := module.ListRules(modules[moduleName])
+	if err != nil {
+		return nil, err
+	}
+	for _, ruleFile := range ruleFiles {
+		if err := claimGeneratorPath(owners, moduleName, ruleFile.CopyPath); err != nil {
+			return nil, err
+		}
+		sources[path.Join(goFilesDir, ruleFile.CopyPath)] = ruleFile.SourcePath
+	}
+
+	return packages, nil
+}
+
+// parseBuildFile returns the package name, the variables and the imports of a BUILD.go file.
+func parseBuildFile(ctx Context, buildFilePath string) (string, []string, []string, error) {
+	fileAst, err := parser.ParseFile(token.NewFileSet(), buildFilePath, nil, parser.AllErrors)
+
+	if err != nil {
+		return "", nil, nil, log.Errorf("Failed to parse '%s': %s.\n", buildFilePath, err)
+	}
+
+	vars := []string{}
+	imports := []string{}
+
+	for _, decl := range fileAst.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			return "", nil, nil, log.Errorf("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
+		}
+
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.ImportSpec:
+				importPath, _ := strconv.Unquote(spec.Path.Value)
+				imports = append(imports, importPath)
+			case *ast.ValueSpec:
+				if decl.Tok.String() != "var" {
+					return "", nil, nil, log.Errorf("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
+				}
+				for _, id := range spec.Names {
+					if id.Name == "_" {
+						log.Fwarning(ctx.log(), "'%s' contains an anonymous declarations.\n", buildFilePath)
+						continue
+					}
+					vars = append(vars, id.Name)
+				}
+			default:
+				return "", nil, nil, log.Errorf("'%s' contains invalid declarations. Only import statements and 'var' declarations are allowed.\n", buildFilePath)
+			}
+		}
+	}
+
+	return fileAst.Name.String(), vars, imports, nil
+}
+
+// checkImportCycles fails if BUILD.go packages import each other cyclically. The go command would
+// report the cycle in terms of the paths inside the generator directory instead.
+func checkImportCycles(generatorDir string, imports map[string][]string, sources map[string]string) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(pkg string) []string
+	visit = func(pkg string) []string {
+		state[pkg] = visiting
+		stack = append(stack, pkg)
+		for _, imported := range imports[pkg] {
+			if _, isBuildPackage := imports[imported]; !isBuildPackage {
+				continue
+			}
+			switch state[imported] {
+			case visiting:
+				for idx, stackPkg := range stack {
+					if stackPkg == imported {
+						return append(append([]string{}, stack[idx:]...), imported)
+					}
+				}
+			case unvisited:
+				if cycle := visit(imported); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[pkg] = visited
+		return nil
+	}
+
+	for _, pkg := range sortedKeys(imports) {
+		if state[pkg] != unvisited {
+			continue
+		}
+		cycle := visit(pkg)
+		if cycle == nil {
+			continue
+		}
+		lines := []string{}
+		for _, cyclePkg := range cycle {
+			lines = append(lines, fmt.Sprintf("  '%s' (%s)", cyclePkg, sources[path.Join(generatorDir, cyclePkg, buildFileName)]))
+		}
+		return log.Errorf("%s files import each other cyclically:\n%s\n", buildFileName, strings.Join(lines, " imports\n"))
+	}
+	return nil
+}
+
+func createRootModFileContent(moduleName string, modules map[string]module.Module, goWork bool) ([]byte, error) {
+	mod := strings.Builder{}
+
+	fmt.Fprintf(&mod, "module %s\n\n", moduleName)
+	fmt.Fprintf(&mod, "go %d.%d\n\n", GoMajorVersion, GoMinorVersion)
+	// The go.work file makes all modules available without replace directives.
+	if goWork {
+		return []byte(mod.String()), nil
+	}
+
+	// Modules are listed in a fixed order, so that the generator is only rebuilt if they change.
+	for _, name := range sortedKeys(modules) {
+		goModules, err := module.ListGoModules(modules[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, goModule := range goModules {
+			fmt.Fprintf(&mod, "require %s v0.0.0\n", goModule.Name)
+			fmt.Fprintf(&mod, "replace %s => ./%s\n\n", goModule.Name, goModule.Name)
+		}
+	}
+
+	return []byte(mod.String()), nil
+}
+
+func createModFileContent(moduleName string, deps []string, goWork bool) []byte {
+	mod := strings.Builder{}
+
+	fmt.Fprintf(&mod, "module %s\n\n", moduleName)
+	fmt.Fprintf(&mod, "go %d.%d\n\n", GoMajorVersion, GoMinorVersion)
+	if goWork {
+		return []byte(mod.String())
+	}
+
+	// Namespaced modules (e.g., "module/name") are nested deeper in the generator directory.
+	rootDir := strings.Repeat("../", strings.Count(moduleName, "/")+1)
+	for _, modName := range deps {
+		fmt.Fprintf(&mod, "require %s v0.0.0\n", modName)
+		fmt.Fprintf(&mod, "replace %s => %s%s\n\n", modName, rootDir, modName)
+	}
+
+	return []byte(mod.String())
+}
+
+// WriteWorkFile writes a go.work file that makes `dir` a single Go workspace with the root module
+// and the Go modules of all `modules`. Unlike replace directives, go.work files are understood by
+// gopls, so IDEs can open the directory directly.
+func WriteWorkFile(dir string, modules map[string]module.Module) error {
+	goModules := map[string]bool{}
+	for _, mod := range modules {
+		modGoModules, err := module.ListGoModules(mod)
+		if err != nil {
+			return err
+		}
+		for _, goModule := range modGoModules {
+			goModules[goModule.Name] = true
+		}
+	}
+
+	work := strings.Builder{}
+	fmt.Fprintf(&work, "go %d.%d\n\n", GoMajorVersion, goWorkMinorVersion)
+	fmt.Fprintf(&work, "use (\n\t.\n")
+	for _, name := range sortedKeys(goModules) {
+		fmt.Fprintf(&work, "\t./%s\n", name)
+	}
+	fmt.Fprintf(&work, ")\n")
+	return util.WriteFile(path.Join(dir, WorkFileName), []byte(work.String()))
+}
+
+// CheckGoWorkSupport fails if the installed go does not support go.work files, which `feature`
+// requires.
+func CheckGoWorkSupport(feature string) error {
+	output, err := exec.Command("go", "env", "GOVERSION").Output()
+	matches := goVersionRegexp.FindStringSubmatch(string(output))
+	if err != nil || matches == nil {
+		return log.Errorf("Failed to determine the version of go.\n")
+	}
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	if major < GoMajorVersion || (major == GoMajorVersion && minor < goWorkMinorVersion) {
+		return log.Errorf("%s requires go >= %d.%d. Found %d.%d.\n", feature, GoMajorVersion, goWorkMinorVersion, major, minor)
+	}
+	return nil
+}
+
+func createGeneratorMainFile(generatorDir string, packages []string, modules map[string]module.Module, goWork bool) error {
+	importLines := []string{}
+	dbtMainLines := []string{}
+	for idx, pkg := range packages {
+		importLines = append(importLines, fmt.Sprintf("import p%d %q", idx, pkg))
+		dbtMainLines = append(dbtMainLines, fmt.Sprintf("    p%d.DbtMain(vars)", idx))
+	}
+
+	mainFilePath := path.Join(generatorDir, mainFileName)
+	mainFileContent := fmt.Sprintf(mainFileTemplate, strings.Join(importLines, "\n"), GoMajorVersion, GoMinorVersion, strings.Join(dbtMainLines, "\n"),
+		ProtocolVersion, GeneratorOutputFileName)
+	if err := util.WriteFile(mainFilePath, []byte(mainFileContent)); err != nil {
+		return err
+	}
+
+	modFilePath := path.Join(generatorDir, modFileName)
+	modFileContent, err := createRootModFileContent("root", modules, goWork)
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(modFilePath, modFileContent)
+}
+
+func createSumGoFile(ctx Context, generatorDir string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "mod", "download")
+	cmd.Dir = generatorDir
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	ctx.log().Write(stderr.Bytes())
+	if err != nil {
+		return log.Errorf("Failed to run 'go mod download': %s.\n", err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the map `m` with string keys in sorted order.
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
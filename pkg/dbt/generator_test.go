@@ -0,0 +1,25 @@
+package dbt
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestInitFileWithHostileSourceDir(t *testing.T) {
+	names := []string{
+		"with space/file name.txt",
+		"dollar/$HOME/$$x",
+		"quote/it's \"quoted\"",
+		"backtick/a`b",
+		"backslash/a\\b",
+		"newline/a\nb",
+	}
+	for _, name := range names {
+		source := fmt.Sprintf(initFileTemplate, "pkg", "", "/workspace/"+name)
+		if _, err := parser.ParseFile(token.NewFileSet(), "init.go", source, 0); err != nil {
+			t.Errorf("The init file for source directory %q does not parse: %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package dbt
+
+// The types in this file make up the JSON protocol spoken between DBT and the generator, which
+// runs the BUILD.go files of the workspace.
+
+// ProtocolVersion is the version of the protocol. Generators that do not know about the protocol
+// version report version 0.
+const ProtocolVersion = 18
+
+// Target is a target declared in a BUILD.go file.
+type Target struct {
+	Description string
+	Runnable    bool
+	Testable    bool
+	Report      bool
+	Cleanable   bool
+	Outputs     []string
+	Deps        []string
+	Headers     []string
+	Objects     []string
+	// Goldens are the golden files compared against by a test target. They are reported
+	// since protocol version 4.
+	Goldens []string
+	// Installs maps install destinations relative to the install prefix to the outputs installed
+	// there. They are reported since protocol version 5.
+	Installs map[string]string
+	// Tier is one of "blocking", "nightly" or "experimental" and lets CI pipelines apply different
+	// policies to targets. It is empty for targets without a tier and reported since protocol version 6.
+	Tier string
+	// Alias lists the targets that an alias target stands for. Aliases are expanded before
+	// targets are passed to ninja. They are reported since protocol version 7.
+	Alias []string
+	// Kind is the kind of rule that defines the target, e.g. "binary", "library" or "test". It is
+	// used to restrict shell completion and reported since protocol version 8.
+	Kind string
+	// GeneratedSources are the outputs of the target that other targets consume as sources, e.g.
+	// generated headers. They are reported since protocol version 11.
+	GeneratedSources []string
+	// Toolchain and Arch identify what a target is built for (Arch as named by QEMU, e.g.
+	// "aarch64"). They select the test backend and are reported since protocol version 12.
+	Toolchain string
+	Arch      string
+	// Tools are the targets whose outputs the actions of the target run as build tools. They are
+	// built for the host before the target and reported since protocol version 14.
+	Tools []string
+	// Visibility lists who may depend on the target: "public", "module" for targets of the same
+	// module or patterns of packages like "//module/pkg/...". If empty, the default visibility of
+	// the module applies. It is reported since protocol version 15.
+	Visibility []string
+	// Signable targets have their outputs signed by 'dbt build --sign'. They are reported since
+	// protocol version 18.
+	Signable bool
+}
+
+// Flag is a build flag declared by the rules.
+type Flag struct {
+	Description   string
+	Type          string
+	AllowedValues []string
+	Value         string
+	// Default and Source are reported since protocol version 3. Source is one of "cmdline",
+	// "persisted", "workspace" or "default".
+	Default string
+	Source  string
+}
+
+// Diagnostic is an error, warning or note that the generator reports.
+type Diagnostic struct {
+	Severity string
+	Message  string
+	Target   string
+	// Flags are the names of the build flags the diagnostic is about, e.g. a combination of flags
+	// rejected by a flag validator. They are reported since protocol version 13.
+	Flags []string
+}
+
+// GeneratorInput is what DBT passes to the generator.
+type GeneratorInput struct {
+	DbtVersion           [3]uint
+	ProtocolVersion      uint
+	SourceDir            string
+	WorkingDir           string
+	OutputDir            string
+	CmdlineFlags         map[string]string
+	WorkspaceFlags       map[string]string
+	CompletionsOnly      bool
+	RunArgs              []string
+	TestArgs             []string
+	Layout               string
+	SelectedTargets      []string
+	BuildAnalyzerTargets bool
+	PersistFlags         bool
+	ListOutputs          bool
+	Coverage             bool
+	CoverageDir          string
+	ListDependencies     bool
+	UpdateGoldens        bool
+	// StampFile is the path of the file with the build metadata that rules can embed into outputs.
+	// It is set since protocol version 9.
+	StampFile string
+	// FlagOverrides set build flags for the targets matching a pattern. Later overrides take
+	// precedence. They are set since protocol version 10.
+	FlagOverrides []FlagOverride
+	// TestBackends run the tests of targets built for another architecture. They are set since
+	// protocol version 12.
+	TestBackends []TestBackend
+	// HostArch is the architecture (as named by QEMU) that tools used by the build are built for.
+	// It is set since protocol version 14.
+	HostArch string
+	// FlagsOnly makes the generator only report the build flags with their types and allowed
+	// values, without loading the BUILD.go files. It is set since protocol version 16.
+	FlagsOnly bool
+	// ConfigName is the name of the selected build config. It is not passed to the generator.
+	ConfigName string `json:"-"`
+
+	// These fields are used by dbt-rules < v1.10.0 and must be kept for backward compatibility
+	Version        uint
+	BuildDirPrefix string
+	BuildFlags     map[string]string
+}
+
+// FlagOverride sets build flags for all targets whose name matches the regular expression Pattern.
+type FlagOverride struct {
+	Pattern string
+	Flags   map[string]string
+}
+
+// GeneratorOutput is what the generator reports back to DBT. Targets are identified by their
+// names without the "//" prefix.
+type GeneratorOutput struct {
+	ProtocolVersion uint
+	NinjaFile       string
+	Targets         map[string]Target
+	Flags           map[string]Flag
+	CompDbRules     []string
+	Diagnostics     []Diagnostic
+	// Toolchains maps the names of the toolchains of the targets to their versions. They are
+	// reported since protocol version 17.
+	Toolchains map[string]string
+
+	// This field is set by dbt-rules < v1.10.0 and must be kept for backward compatibility
+	BuildDir string
+}
+
+// TestBackend runs the tests of the targets built with Toolchain or for Arch. In Command, "{}"
+// stands for the test binary and "{args}" for the arguments of the test. The rules of dbt-rules
+// use the first backend for the toolchain of a test, or else the first backend for its
+// architecture unless the test is built for the host architecture.
+type TestBackend struct {
+	Toolchain string
+	Arch      string
+	Command   string
+}
@@ -0,0 +1,114 @@
+package dbt
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/daedaleanai/dbt/log"
+	"github.com/daedaleanai/dbt/util"
+)
+
+// NormalizeTarget returns the canonical ID (e.g., "//module/pkg/target") of the target or target
+// pattern `target`. Targets that do not start with "//" are relative to the working directory of
+// `ctx`. A trailing "/" is kept.
+func NormalizeTarget(ctx Context, target string) (string, error) {
+	name, err := normalizeTarget(ctx, target)
+	return "//" + name, err
+}
+
+// normalizeTarget returns the name of `target` relative to the workspace source directory.
+func normalizeTarget(ctx Context, target string) (string, error) {
+	// Build targets are interpreted as relative to the workspace root when they start with '//'.
+	// Otherwise they are interpreted as relative to the current working directory.
+	// E.g.: Running 'dbt build //src/path/to/mylib.a' from anywhere in the workspace is equivalent
+	// to 'dbt build mylib.a' in '.../src/path/to/' or 'dbt build path/to/mylib.a' in '.../src/'.
+	if strings.HasPrefix(target, "//") {
+		return strings.TrimLeft(target, "/"), nil
+	}
+	endsWithSlash := strings.HasSuffix(target, "/") || target == ""
+	target = path.Join(ctx.workingDir(), target)
+	moduleRoot, err := util.GetModuleRootForPath(target)
+	if err != nil {
+		return "", err
+	}
+	target = strings.TrimPrefix(target, path.Dir(moduleRoot))
+	if endsWithSlash {
+		target = target + "/"
+	}
+	return strings.TrimLeft(target, "/"), nil
+}
+
+// Target patterns are regular expressions that are matched against target names, except for two
+// forms that respect package boundaries, where the package of a target is the directory of its
+// BUILD.go file:
+//   - "src/lib/..." (or "src/lib...") matches the targets of the package "src/lib" and of all its
+//     subpackages, but not those of "src/libxyz".
+//   - "src/lib:name" matches the target "name" of the package "src/lib", where "name" may contain
+//     the wildcards "*" and "?". "src/lib:all" (or "src/lib:*") matches all targets of the
+//     package, but not those of its subpackages. ":name" matches the top-level target "name".
+
+// packagePathRegexp matches the package part of a target pattern with ":". Anything else before
+// the ":" is part of a regular expression, e.g. "(?i:" or "[[:alpha:]]", and not a package.
+var packagePathRegexp = regexp.MustCompile(`^[A-Za-z0-9_.+/-]*$`)
+
+// TargetPatternRegexp returns the regular expression matching the names of the targets selected by
+// the normalized target pattern `pattern`.
+func TargetPatternRegexp(pattern string) string {
+	if idx := strings.LastIndex(pattern, ":"); idx >= 0 && !strings.Contains(pattern[idx+1:], "/") && packagePathRegexp.MatchString(pattern[:idx]) {
+		pkg, name := strings.TrimSuffix(pattern[:idx], "/"), pattern[idx+1:]
+		if name == "all" {
+			name = "*"
+		}
+		name = strings.ReplaceAll(regexp.QuoteMeta(name), `\*`, "[^/]*")
+		name = strings.ReplaceAll(name, `\?`, "[^/]")
+		// Targets of the empty package are at the top level.
+		if pkg == "" {
+			return name
+		}
+		return regexp.QuoteMeta(pkg) + "/" + name
+	}
+	if strings.HasSuffix(pattern, "...") {
+		pkg := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if pkg == "" {
+			return ".*"
+		}
+		return regexp.QuoteMeta(pkg) + "/.*"
+	}
+	return pattern
+}
+
+// ExpandAlias returns the names of the targets that the alias target `name` stands for. Aliases
+// that refer to other aliases are expanded recursively.
+func ExpandAlias(name string, targets map[string]Target) ([]string, error) {
+	return expandAlias(name, targets, map[string]bool{})
+}
+
+// expandAlias expands the alias `name`, `visiting` contains the aliases being expanded to detect
+// cycles.
+func expandAlias(name string, targets map[string]Target, visiting map[string]bool) ([]string, error) {
+	if visiting[name] {
+		return nil, log.Errorf("Alias '//%s' refers to itself.\n", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	names := []string{}
+	for _, member := range targets[name].Alias {
+		member = strings.TrimLeft(member, "/")
+		target, exists := targets[member]
+		if !exists {
+			return nil, log.Errorf("Alias '//%s' refers to unknown target '//%s'.\n", name, member)
+		}
+		if len(target.Alias) > 0 {
+			memberNames, err := expandAlias(member, targets, visiting)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, memberNames...)
+		} else {
+			names = append(names, member)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,48 @@
+package dbt
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestTargetPatternRegexp(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		matches    []string
+		nonMatches []string
+	}{
+		{"...", []string{"lib", "src/lib/a"}, nil},
+		{"src/lib/...", []string{"src/lib/a", "src/lib/sub/b"}, []string{"src/libxyz/a", "src/lib"}},
+		{"src/lib...", []string{"src/lib/a", "src/lib/sub/b"}, []string{"src/libxyz/a"}},
+		{"src/lib:a", []string{"src/lib/a"}, []string{"src/lib/ab", "src/lib/sub/a", "src/libxyz/a"}},
+		{"src/lib/:a", []string{"src/lib/a"}, []string{"src/lib/sub/a"}},
+		{"src/lib:all", []string{"src/lib/a", "src/lib/b.c"}, []string{"src/lib/sub/a", "src/libxyz/a"}},
+		{"src/lib:*", []string{"src/lib/a", "src/lib/b.c"}, []string{"src/lib/sub/a"}},
+		{"src/lib:*_test", []string{"src/lib/a_test"}, []string{"src/lib/a_test2", "src/lib/sub/a_test"}},
+		{"src/lib:a?", []string{"src/lib/ab", "src/lib/a1"}, []string{"src/lib/a", "src/lib/abc", "src/lib/a/"}},
+		{"src/lib:a.b", []string{"src/lib/a.b"}, []string{"src/lib/axb"}},
+		{":foo", []string{"foo"}, []string{"/foo", "src/foo"}},
+		{":all", []string{"foo", "bar"}, []string{"src/foo"}},
+		{"(?i:src/LIB/a)", []string{"src/lib/a", "SRC/lib/A"}, []string{"src/lib/b"}},
+		{"src/[[:alpha:]]+", []string{"src/lib", "src/abc"}, []string{"src/lib1", "src/lib/a"}},
+		{"src/lib/.*", []string{"src/lib/a", "src/lib/sub/b"}, []string{"src/libxyz/a"}},
+	}
+	for _, test := range tests {
+		re, err := regexp.Compile(fmt.Sprintf("^%s$", TargetPatternRegexp(test.pattern)))
+		if err != nil {
+			t.Errorf("TargetPatternRegexp(%q) = %q is invalid: %s", test.pattern, TargetPatternRegexp(test.pattern), err)
+			continue
+		}
+		for _, name := range test.matches {
+			if !re.MatchString(name) {
+				t.Errorf("TargetPatternRegexp(%q) = %q does not match %q", test.pattern, re, name)
+			}
+		}
+		for _, name := range test.nonMatches {
+			if re.MatchString(name) {
+				t.Errorf("TargetPatternRegexp(%q) = %q matches %q", test.pattern, re, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package provenance describes what went into the artifacts of a build (the modules, toolchains
+// and build flags) and encodes the description as an SPDX or CycloneDX software bill of materials.
+package provenance
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats of the manifests.
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatSPDX, FormatCycloneDX}
+
+// Module is a module of the workspace.
+type Module struct {
+	Name   string
+	URL    string
+	Commit string
+	// Dirty reports whether the module had uncommitted changes.
+	Dirty bool
+}
+
+// Toolchain is a toolchain that built some of the artifacts. The version is empty if unknown.
+type Toolchain struct {
+	Name    string
+	Version string
+}
+
+// Artifact is an output file of a target.
+type Artifact struct {
+	// Path is relative to the output directory.
+	Path   string
+	SHA256 string
+	Target string
+	// Modules and Toolchains are the names of the modules and toolchains that contributed to the
+	// artifact.
+	Modules    []string
+	Toolchains []string
+}
+
+// Manifest describes the artifacts of a build and where they came from.
+type Manifest struct {
+	Name       string
+	Created    time.Time
+	Tool       string
+	Version    string
+	Modules    []Module
+	Toolchains []Toolchain
+	Flags      map[string]string
+	Artifacts  []Artifact
+}
+
+// FileName returns the name of the manifest file for `format`.
+func FileName(format string) string {
+	if format == FormatCycloneDX {
+		return "sbom.cdx.json"
+	}
+	return "sbom.spdx.json"
+}
+
+// Encode returns the manifest in `format` as JSON.
+func (manifest Manifest) Encode(format string) ([]byte, error) {
+	var document interface{}
+	switch format {
+	case FormatSPDX:
+		document = manifest.spdx()
+	case FormatCycloneDX:
+		document = manifest.cycloneDX()
+	default:
+		return nil, fmt.Errorf("unknown format '%s', expected one of '%s'", format, strings.Join(Formats, "', '"))
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+func newUUID() string {
+	var bytes [16]byte
+	rand.Read(bytes[:])
+	bytes[6] = (bytes[6] & 0x0f) | 0x40
+	bytes[8] = (bytes[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+}
+
+func (manifest Manifest) flagList() []string {
+	names := []string{}
+	for name := range manifest.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	flags := []string{}
+	for _, name := range names {
+		flags = append(flags, fmt.Sprintf("%s=%s", name, manifest.Flags[name]))
+	}
+	return flags
+}
+
+// spdxIDRegexp matches the characters that are not allowed in SPDX identifiers.
+var spdxIDRegexp = regexp.MustCompile(`[^A-Za-z0-9.\-]`)
+
+func spdxID(kind, name string) string {
+	return fmt.Sprintf("SPDXRef-%s-%s", kind, spdxIDRegexp.ReplaceAllString(name, "-"))
+}
+
+func (manifest Manifest) spdx() map[string]interface{} {
+	noAssertion := "NOASSERTION"
+	packages := []map[string]interface{}{}
+	for _, module := range manifest.Modules {
+		location := noAssertion
+		if module.URL != "" {
+			location = fmt.Sprintf("git+%s@%s", module.URL, module.Commit)
+		}
+		pkg := map[string]interface{}{
+			"name":             module.Name,
+			"SPDXID":           spdxID("Module", module.Name),
+			"versionInfo":      module.Commit,
+			"downloadLocation": location,
+			"filesAnalyzed":    false,
+			"licenseConcluded": noAssertion,
+			"licenseDeclared":  noAssertion,
+			"copyrightText":    noAssertion,
+		}
+		if module.Dirty {
+			pkg["comment"] = "The module had uncommitted changes."
+		}
+		packages = append(packages, pkg)
+	}
+	for _, toolchain := range manifest.Toolchains {
+		pkg := map[string]interface{}{
+			"name":                  toolchain.Name,
+			"SPDXID":                spdxID("Toolchain", toolchain.Name),
+			"downloadLocation":      noAssertion,
+			"filesAnalyzed":         false,
+			"licenseConcluded":      noAssertion,
+			"licenseDeclared":       noAssertion,
+			"copyrightText":         noAssertion,
+			"primaryPackagePurpose": "APPLICATION",
+		}
+		if toolchain.Version != "" {
+			pkg["versionInfo"] = toolchain.Version
+		}
+		packages = append(packages, pkg)
+	}
+
+	files := []map[string]interface{}{}
+	relationships := []map[string]interface{}{}
+	for idx, artifact := range manifest.Artifacts {
+		id := fmt.Sprintf("SPDXRef-File-%d", idx)
+		files = append(files, map[string]interface{}{
+			"fileName":         "./" + artifact.Path,
+			"SPDXID":           id,
+			"checksums":        []map[string]string{{"algorithm": "SHA256", "checksumValue": artifact.SHA256}},
+			"licenseConcluded": noAssertion,
+			"copyrightText":    noAssertion,
+			"comment":          "Output of target " + artifact.Target,
+		})
+		relationships = append(relationships, map[string]interface{}{
+			"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": id,
+		})
+		for _, module := range artifact.Modules {
+			relationships = append(relationships, map[string]interface{}{
+				"spdxElementId": id, "relationshipType": "GENERATED_FROM", "relatedSpdxElement": spdxID("Module", module),
+			})
+		}
+		for _, toolchain := range artifact.Toolchains {
+			relationships = append(relationships, map[string]interface{}{
+				"spdxElementId": spdxID("Toolchain", toolchain), "relationshipType": "BUILD_TOOL_OF", "relatedSpdxElement": id,
+			})
+		}
+	}
+
+	creationInfo := map[string]interface{}{
+		"created":  manifest.Created.UTC().Format(time.RFC3339),
+		"creators": []string{fmt.Sprintf("Tool: %s-%s", manifest.Tool, manifest.Version)},
+	}
+	if len(manifest.Flags) > 0 {
+		creationInfo["comment"] = "Build flags: " + strings.Join(manifest.flagList(), " ")
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              manifest.Name,
+		"documentNamespace": fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", spdxIDRegexp.ReplaceAllString(manifest.Name, "-"), newUUID()),
+		"creationInfo":      creationInfo,
+		"packages":          packages,
+		"files":             files,
+		"relationships":     relationships,
+	}
+}
+
+func cycloneDXProperty(name, value string) map[string]string {
+	return map[string]string{"name": name, "value": value}
+}
+
+func (manifest Manifest) cycloneDX() map[string]interface{} {
+	components := []map[string]interface{}{}
+	for _, module := range manifest.Modules {
+		component := map[string]interface{}{
+			"type":       "library",
+			"bom-ref":    "module:" + module.Name,
+			"name":       module.Name,
+			"version":    module.Commit,
+			"properties": []map[string]string{cycloneDXProperty("dbt:dirty", fmt.Sprint(module.Dirty))},
+		}
+		if module.URL != "" {
+			component["externalReferences"] = []map[string]string{{"type": "vcs", "url": module.URL}}
+		}
+		components = append(components, component)
+	}
+	for _, toolchain := range manifest.Toolchains {
+		component := map[string]interface{}{
+			"type":    "application",
+			"bom-ref": "toolchain:" + toolchain.Name,
+			"name":    toolchain.Name,
+		}
+		if toolchain.Version != "" {
+			component["version"] = toolchain.Version
+		}
+		components = append(components, component)
+	}
+
+	dependencies := []map[string]interface{}{}
+	for _, artifact := range manifest.Artifacts {
+		ref := "artifact:" + artifact.Path
+		components = append(components, map[string]interface{}{
+			"type":       "file",
+			"bom-ref":    ref,
+			"name":       artifact.Path,
+			"hashes":     []map[string]string{{"alg": "SHA-256", "content": artifact.SHA256}},
+			"properties": []map[string]string{cycloneDXProperty("dbt:target", artifact.Target)},
+		})
+		dependsOn := []string{}
+		for _, module := range artifact.Modules {
+			dependsOn = append(dependsOn, "module:"+module)
+		}
+		for _, toolchain := range artifact.Toolchains {
+			dependsOn = append(dependsOn, "toolchain:"+toolchain)
+		}
+		dependencies = append(dependencies, map[string]interface{}{"ref": ref, "dependsOn": dependsOn})
+	}
+
+	properties := []map[string]string{}
+	for _, flag := range manifest.flagList() {
+		parts := strings.SplitN(flag, "=", 2)
+		properties = append(properties, cycloneDXProperty("dbt:flag:"+parts[0], parts[1]))
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + newUUID(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": manifest.Created.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []map[string]string{{"type": "application", "name": manifest.Tool, "version": manifest.Version}},
+			},
+			"component":  map[string]string{"type": "application", "name": manifest.Name, "bom-ref": "workspace:" + manifest.Name},
+			"properties": properties,
+		},
+		"components":   components,
+		"dependencies": dependencies,
+	}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"github.com/daedaleanai/dbt/log"
+)
+
+// Failure is a class of common errors, mostly made by new users, that come with suggestions how
+// to resolve them.
+type Failure int
+
+const (
+	// NinjaNotFound means that there is no ninja binary to run.
+	NinjaNotFound Failure = iota
+	// DepsNotSynced means that dependencies of the workspace are not checked out.
+	DepsNotSynced
+	// NoBuildFiles means that no module of the workspace declares any targets.
+	NoBuildFiles
+	// UnknownTarget means that a target pattern matches no target at all.
+	UnknownTarget
+	// NotInWorkspace means that a command that requires a workspace was run outside of one.
+	NotInWorkspace
+)
+
+var failureExitCodes = map[Failure]int{
+	NinjaNotFound:  log.ExitNinja,
+	DepsNotSynced:  log.ExitDependencies,
+	NoBuildFiles:   log.ExitUsage,
+	UnknownTarget:  log.ExitUsage,
+	NotInWorkspace: log.ExitUsage,
+}
+
+var failureHints = map[Failure][]string{
+	NinjaNotFound: {
+		"Install ninja, e.g. with 'apt install ninja-build' or 'brew install ninja'.",
+		"Set 'ninja-bin: <path>' in the DBT configuration file to use a ninja binary that is not in PATH.",
+		"Run 'dbt doctor' to check the setup of DBT.",
+	},
+	DepsNotSynced: {
+		"Run 'dbt sync' to check out all dependencies of the workspace.",
+	},
+	NoBuildFiles: {
+		"Declare targets in BUILD.go files next to the sources. See 'Defining build targets' in the DBT README.",
+		"Run 'dbt sync' if the targets are declared by dependencies of the workspace.",
+	},
+	UnknownTarget: {
+		"Run the command without target patterns to list all available targets.",
+	},
+	NotInWorkspace: {
+		"Run DBT inside a git repository or a directory that contains a MODULE file.",
+		"Run 'dbt clone URL' to clone an existing workspace or 'dbt init --from=URL' to create one from a template.",
+		"Pass '--workspace DIR' to operate on a workspace outside of the working directory.",
+	},
+}
+
+// Fail returns an error with the error message followed by `hints` that are specific to the error
+// and the general hints for `failure`, which terminates DBT with the exit code of `failure`.
+func Fail(failure Failure, hints []string, format string, a ...interface{}) error {
+	return log.ErrorfWithCode(failureExitCodes[failure], append(append([]string{}, hints...), failureHints[failure]...), format, a...)
+}
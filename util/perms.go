@@ -0,0 +1,53 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NormalizePermissions sets the mode of all directories and files below `root` owned by the
+// current user. Directories and files with any executable bit set get `execMode`, all other
+// files get `dataMode`. Symbolic links are not followed.
+func NormalizePermissions(root string, execMode, dataMode os.FileMode) error {
+	uid := os.Getuid()
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 || !isOwnedBy(info, uid) {
+			return nil
+		}
+
+		mode := dataMode
+		if info.IsDir() || info.Mode()&0111 != 0 {
+			mode = execMode
+		}
+		if info.Mode().Perm() == mode {
+			return nil
+		}
+		return os.Chmod(filePath, mode)
+	})
+}
+
+// FindForeignFiles returns all files and directories below `root` that are not owned by the
+// current user (e.g., leftovers of builds that ran as root inside a container).
+func FindForeignFiles(root string) ([]string, error) {
+	uid := os.Getuid()
+	foreign := []string{}
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !isOwnedBy(info, uid) {
+			foreign = append(foreign, filePath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return foreign, nil
+	}
+	return foreign, err
+}
@@ -24,6 +24,13 @@ const ModuleFileName = "MODULE"
 // DepsDirName is directory that dependencies are stored in.
 const DepsDirName = "DEPS"
 
+// WorkspaceMarkerFileName is the name of the file that marks the root directory of a workspace
+// nested inside another workspace.
+const WorkspaceMarkerFileName = ".dbtworkspace"
+
+// WorkspaceRootOverride selects the workspace root directory explicitly if it is not empty.
+var WorkspaceRootOverride string
+
 const fileMode = 0664
 const dirMode = 0775
 
@@ -40,85 +47,115 @@ func DirExists(dir string) bool {
 }
 
 // RemoveDir removes a directory and all of its content.
-func RemoveDir(p string) {
+func RemoveDir(p string) error {
 	err := os.RemoveAll(p)
 	if err != nil {
-		log.Fatal("Failed to remove directory '%s': %s.\n", p, err)
+		return log.Errorf("Failed to remove directory '%s': %s.\n", p, err)
 	}
+	return nil
 }
 
 // MkdirAll creates directory `p` and all parent directories.
-func MkdirAll(p string) {
+func MkdirAll(p string) error {
 	err := os.MkdirAll(p, dirMode)
 	if err != nil {
-		log.Fatal("Failed to create directory '%s': %s.\n", p, err)
+		return log.Errorf("Failed to create directory '%s': %s.\n", p, err)
 	}
+	return nil
 }
 
-func ReadFile(filePath string) []byte {
+func ReadFile(filePath string) ([]byte, error) {
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal("Failed to read file '%s': %s.\n", filePath, err)
+		return nil, log.Errorf("Failed to read file '%s': %s.\n", filePath, err)
 	}
-	return data
+	return data, nil
 }
 
-func ReadJson(filePath string, v interface{}) {
-	err := json.Unmarshal(ReadFile(filePath), v)
+func ReadJson(filePath string, v interface{}) error {
+	data, err := ReadFile(filePath)
 	if err != nil {
-		log.Fatal("Failed to unmarshal JSON file '%s': %s.\n", filePath, err)
+		return err
 	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return log.Errorf("Failed to unmarshal JSON file '%s': %s.\n", filePath, err)
+	}
+	return nil
 }
 
-func ReadYaml(filePath string, v interface{}) {
-	err := yaml.Unmarshal(ReadFile(filePath), v)
+func ReadYaml(filePath string, v interface{}) error {
+	data, err := ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	err = yaml.Unmarshal(data, v)
 	if err != nil {
-		log.Fatal("Failed to unmarshal YAML file '%s': %s.\n", filePath, err)
+		return log.Errorf("Failed to unmarshal YAML file '%s': %s.\n", filePath, err)
 	}
+	return nil
 }
 
-func WriteFile(filePath string, data []byte) {
+func WriteFile(filePath string, data []byte) error {
 	dir := path.Dir(filePath)
 	err := os.MkdirAll(dir, dirMode)
 	if err != nil {
-		log.Fatal("Failed to create directory '%s': %s.\n", dir, err)
+		return log.Errorf("Failed to create directory '%s': %s.\n", dir, err)
 	}
 	err = ioutil.WriteFile(filePath, data, fileMode)
 	if err != nil {
-		log.Fatal("Failed to write file '%s': %s.\n", filePath, err)
+		return log.Errorf("Failed to write file '%s': %s.\n", filePath, err)
 	}
+	return nil
 }
 
-func WriteJson(filePath string, v interface{}) {
+func WriteJson(filePath string, v interface{}) error {
 	data, err := json.Marshal(v)
 	if err != nil {
-		log.Fatal("Failed to marshal JSON for file '%s': %s.\n", filePath, err)
+		return log.Errorf("Failed to marshal JSON for file '%s': %s.\n", filePath, err)
 	}
-	WriteFile(filePath, data)
+	return WriteFile(filePath, data)
 }
 
-func WriteYaml(filePath string, v interface{}) {
+func WriteYaml(filePath string, v interface{}) error {
 	data, err := yaml.Marshal(v)
 	if err != nil {
-		log.Fatal("Failed to marshal YAML for file '%s': %s.\n", filePath, err)
+		return log.Errorf("Failed to marshal YAML for file '%s': %s.\n", filePath, err)
 	}
-	WriteFile(filePath, data)
+	return WriteFile(filePath, data)
 }
 
-func CopyFile(sourceFile, destFile string) {
-	WriteFile(destFile, ReadFile(sourceFile))
+func CopyFile(sourceFile, destFile string) error {
+	data, err := ReadFile(sourceFile)
+	if err != nil {
+		return err
+	}
+	return WriteFile(destFile, data)
 }
 
 // Copies a directory recursing into its inner directories
 func CopyDirRecursively(sourceDir, destDir string) error {
 	var wg sync.WaitGroup
-	err := copyDirRecursivelyInner(sourceDir, destDir, &wg)
+	// Files are copied in parallel. The first error that occurs while copying a file is returned.
+	var copyErr error
+	var copyErrMutex sync.Mutex
+	reportErr := func(err error) {
+		copyErrMutex.Lock()
+		defer copyErrMutex.Unlock()
+		if copyErr == nil {
+			copyErr = err
+		}
+	}
+	err := copyDirRecursivelyInner(sourceDir, destDir, &wg, reportErr)
 	wg.Wait()
 
-	return err
+	if err != nil {
+		return err
+	}
+	return copyErr
 }
 
-func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup) error {
+func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup, reportErr func(error)) error {
 	stat, err := os.Stat(sourceDir)
 	if err != nil {
 		return err
@@ -128,12 +165,14 @@ func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup) erro
 		return fmt.Errorf("'%s' is not a directory", sourceDir)
 	}
 
-	MkdirAll(destDir)
+	if err := MkdirAll(destDir); err != nil {
+		return err
+	}
 
 	fileInfos, err := ioutil.ReadDir(sourceDir)
 	for _, fileInfo := range fileInfos {
 		if fileInfo.IsDir() {
-			err = copyDirRecursivelyInner(path.Join(sourceDir, fileInfo.Name()), path.Join(destDir, fileInfo.Name()), wg)
+			err = copyDirRecursivelyInner(path.Join(sourceDir, fileInfo.Name()), path.Join(destDir, fileInfo.Name()), wg, reportErr)
 			if err != nil {
 				return err
 			}
@@ -146,9 +185,15 @@ func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup) erro
 
 			go func(source, dest string, sourceFileInfo os.FileInfo) {
 				defer wg.Done()
-				CopyFile(source, dest)
-				if err := os.Chmod(dest, sourceFileInfo.Mode()); err != nil {
-					log.Fatal("failed to change filemode: ", err)
+				data, err := ioutil.ReadFile(source)
+				if err == nil {
+					err = ioutil.WriteFile(dest, data, sourceFileInfo.Mode())
+				}
+				if err == nil {
+					err = os.Chmod(dest, sourceFileInfo.Mode())
+				}
+				if err != nil {
+					reportErr(fmt.Errorf("failed to copy '%s' to '%s': %s", source, dest, err))
 				}
 			}(path.Join(sourceDir, fileInfo.Name()), path.Join(destDir, fileInfo.Name()), fileInfo)
 		}
@@ -157,7 +202,19 @@ func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup) erro
 	return nil
 }
 
+// getModuleRoot returns the nearest directory at or above `p` that is the root of a module or of
+// a workspace nested inside a module.
 func getModuleRoot(p string) (string, error) {
+	moduleRoot, err := findModuleRoot(p)
+	if err != nil {
+		return "", err
+	}
+	return findNestedWorkspaceRoot(p, moduleRoot), nil
+}
+
+// findModuleRoot returns the nearest directory at or above `p` that has a MODULE file or a .git
+// directory or is a dependency in DEPS/.
+func findModuleRoot(p string) (string, error) {
 	for {
 		moduleFilePath := path.Join(p, ModuleFileName)
 		gitDirPath := path.Join(p, ".git")
@@ -172,49 +229,85 @@ func getModuleRoot(p string) (string, error) {
 	}
 }
 
-func GetModuleRootForPath(p string) string {
+// findNestedWorkspaceRoot returns the nearest directory between `p` and `root` that has a workspace
+// marker file, or `root` if there is none. Marker files above `root` are ignored, so that a stray
+// marker file outside of any module does not turn an unrelated directory into a workspace.
+func findNestedWorkspaceRoot(p, root string) string {
+	for dir := p; dir != root && strings.HasPrefix(dir, root+"/"); dir = path.Dir(dir) {
+		if FileExists(path.Join(dir, WorkspaceMarkerFileName)) {
+			return dir
+		}
+	}
+	return root
+}
+
+func GetModuleRootForPath(p string) (string, error) {
 	moduleRoot, err := getModuleRoot(p)
 	if err != nil {
-		log.Fatal("Could not identify module root directory. Make sure you run this command inside a module: %s.\n", err)
+		return "", log.Errorf("Could not identify module root directory. Make sure you run this command inside a module: %s.\n", err)
 	}
-	return moduleRoot
+	return moduleRoot, nil
 }
 
 // GetModuleRoot returns the root directory of the current module.
-func GetModuleRoot() string {
-	workingDir := GetWorkingDir()
-	moduleRoot, err := getModuleRoot(workingDir)
+func GetModuleRoot() (string, error) {
+	workingDir, err := GetWorkingDir()
 	if err != nil {
-		log.Fatal("Could not identify module root directory. Make sure you run this command inside a module: %s.\n", err)
+		return "", err
 	}
-	return moduleRoot
+	return GetModuleRootForPath(workingDir)
 }
 
 // GetWorkspaceRoot returns the root directory of the current workspace (i.e., top-level module).
-func GetWorkspaceRoot() string {
-	var err error
-	p := GetWorkingDir()
+// The nearest directory inside it that contains a workspace marker file takes precedence.
+func GetWorkspaceRoot() (string, error) {
+	root, err := FindWorkspaceRoot()
+	if err != nil {
+		return "", Fail(NotInWorkspace, nil, "%s.\n", err)
+	}
+	return root, nil
+}
+
+// FindWorkspaceRoot returns the root directory of the current workspace or an error if the working
+// directory is not inside a workspace.
+func FindWorkspaceRoot() (string, error) {
+	workingDir, err := GetWorkingDir()
+	if err != nil {
+		return "", err
+	}
+	if WorkspaceRootOverride != "" {
+		root := WorkspaceRootOverride
+		if !path.IsAbs(root) {
+			root = path.Join(workingDir, root)
+		}
+		if !DirExists(root) {
+			return "", fmt.Errorf("Workspace root directory '%s' does not exist", root)
+		}
+		return path.Clean(root), nil
+	}
+
+	p := workingDir
 	for {
-		p, err = getModuleRoot(p)
+		p, err = findModuleRoot(p)
 		if err != nil {
-			log.Fatal("Could not identify workspace root directory. Make sure you run this command inside a workspace: %s.\n", err)
+			return "", fmt.Errorf("Could not identify workspace root directory. Make sure you run this command inside a workspace: %s", err)
 		}
 
 		parentDirName := path.Base(path.Dir(p))
 		if parentDirName != DepsDirName {
-			return p
+			return findNestedWorkspaceRoot(workingDir, p), nil
 		}
 		p = path.Dir(p)
 	}
 }
 
 // GetWorkingDir returns the current working directory.
-func GetWorkingDir() string {
+func GetWorkingDir() (string, error) {
 	workingDir, err := os.Getwd()
 	if err != nil {
-		log.Fatal("Could not get working directory: %s.\n", err)
+		return "", log.Errorf("Could not get working directory: %s.\n", err)
 	}
-	return workingDir
+	return workingDir, nil
 }
 
 // WalkSymlink works like filepath.Walk but also accepts symbolic links as `root`.